@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/brizzbuzz/opnix/internal/errors"
+	"github.com/brizzbuzz/opnix/pkg/env"
+)
+
+// auditLog appends one JSON line per reference lookup to a file readable
+// only by its owner. Entries never contain secret values.
+type auditLog struct {
+	path string
+
+	mu   sync.Mutex
+	file *os.File
+	err  error
+}
+
+func openAuditLog(path string) (*auditLog, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, errors.FileOperationError(
+			"Opening audit log",
+			path,
+			"Failed to open audit log for appending",
+			err,
+		)
+	}
+	return &auditLog{path: path, file: file}, nil
+}
+
+// record appends entry, remembering the first write failure for close
+func (l *auditLog) record(entry env.AuditEntry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.file.Write(append(data, '\n')); err != nil && l.err == nil {
+		l.err = err
+	}
+}
+
+// close closes the log and reports any failed write, so a run never
+// succeeds with an incomplete audit trail
+func (l *auditLog) close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	err := l.file.Close()
+	if l.err != nil {
+		err = l.err
+	}
+	if err != nil {
+		return errors.FileOperationError(
+			"Writing audit log",
+			l.path,
+			"Failed to record every reference lookup",
+			err,
+		)
+	}
+	return nil
+}
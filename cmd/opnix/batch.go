@@ -0,0 +1,241 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/brizzbuzz/opnix/internal/errors"
+	"github.com/brizzbuzz/opnix/pkg/env"
+)
+
+// batchOptions holds the configs and output directory for "opnix env batch"
+type batchOptions struct {
+	configs string
+	outDir  string
+	jobs    int
+}
+
+// batchExtensions names the output file extension for each format
+var batchExtensions = map[string]string{
+	"shell":      ".sh",
+	"dotenv":     ".env",
+	"docker-env": ".env",
+	"json":       ".json",
+	"env-json":   ".json",
+	"kv":         ".txt",
+	"plist":      ".plist",
+	"properties": ".properties",
+	"hcl":        ".tfvars",
+}
+
+// resolverPool hands out one resolver per token source, so every config in
+// a batch shares the same client and cache and a reference used by several
+// configs resolves once
+type resolverPool struct {
+	mu        sync.Mutex
+	resolvers map[string]env.Resolver
+}
+
+func newResolverPool() *resolverPool {
+	return &resolverPool{resolvers: make(map[string]env.Resolver)}
+}
+
+// get returns the resolver for key, building it on first use. The lock is
+// held while building so concurrent configs never create duplicate clients.
+func (p *resolverPool) get(key string, build func() (env.Resolver, error)) (env.Resolver, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if resolver, ok := p.resolvers[key]; ok {
+		return resolver, nil
+	}
+	resolver, err := build()
+	if err != nil {
+		return nil, err
+	}
+	p.resolvers[key] = resolver
+	return resolver, nil
+}
+
+// lockedWriter serializes writes from the concurrent configs of a batch
+type lockedWriter struct {
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+func (l lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+// initBatch registers the batch flags alongside the env flags
+func (e *envCommand) initBatch(args []string) error {
+	e.registerBatchFlags()
+	e.fs.SetOutput(e.stderr)
+	return e.fs.Parse(args)
+}
+
+// registerBatchFlags adds the batch flags to the env flag set
+func (e *envCommand) registerBatchFlags() {
+	e.batch = &batchOptions{}
+	e.fs.StringVar(&e.batch.configs, "configs", "", "Comma-separated configuration files to resolve (required)")
+	e.fs.StringVar(&e.batch.outDir, "out-dir", "", "Directory that receives one output file per configuration (required)")
+	e.fs.IntVar(&e.batch.jobs, "jobs", 4, "Number of configurations resolved concurrently")
+}
+
+// batchPaths splits -configs and checks that every config gets its own
+// output file, which is named after the config without its extension
+func (e *envCommand) batchPaths() ([]string, error) {
+	if strings.TrimSpace(e.batch.configs) == "" || e.batch.outDir == "" {
+		return nil, errors.ConfigValidationError(
+			"env.batch",
+			e.batch.configs,
+			"Both -configs and -out-dir are required",
+			[]string{"Example: opnix env batch -configs api.json,worker.json -out-dir ./gen"},
+		)
+	}
+	if e.batch.jobs < 1 {
+		return nil, errors.ConfigValidationError(
+			"env.batch.jobs",
+			fmt.Sprint(e.batch.jobs),
+			"-jobs must be at least 1",
+			[]string{"Use -jobs 1 to resolve one configuration at a time"},
+		)
+	}
+	if err := e.checkConflicts(
+		"env.batch",
+		e.batch.configs,
+		"batch takes its configurations from -configs and writes them to -out-dir",
+		[]string{"-config", "-config-json", "-raw", "-update", "-output", "-outputs", "-masked-output", "-report", "-check", "-watch", "-explain", "-print-config", "-stdout-only"},
+		"Run opnix env separately for those modes",
+	); err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	owners := make(map[string]string)
+	for _, path := range strings.Split(e.batch.configs, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		stem := batchStem(path)
+		if other, ok := owners[stem]; ok {
+			return nil, errors.ConfigValidationError(
+				"env.batch.configs",
+				path,
+				fmt.Sprintf("%s and %s would both write %s in -out-dir", other, path, stem),
+				[]string{"Give each configuration a distinct file name, or run them in separate batches"},
+			)
+		}
+		owners[stem] = path
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// batchStem names a config's output file, before the format's extension
+func batchStem(path string) string {
+	base := filepath.Base(path)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// runBatch resolves every config, up to -jobs at a time, writing each to
+// -out-dir. A failing config does not stop the others; the failures are
+// reported together once all of them have finished.
+func (e *envCommand) runBatch() (err error) {
+	paths, err := e.batchPaths()
+	if err != nil {
+		return err
+	}
+	if e.checkDups {
+		if err := e.checkBatchDuplicates(paths); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(e.batch.outDir, 0700); err != nil {
+		return errors.FileOperationError(
+			"Creating batch output directory",
+			e.batch.outDir,
+			"Failed to create the -out-dir directory",
+			err,
+		)
+	}
+
+	// The audit log and timing stats are shared so they cover the whole batch
+	if e.auditPath != "" {
+		audit, err := openAuditLog(e.auditPath)
+		if err != nil {
+			return err
+		}
+		e.audit = audit
+		defer func() {
+			e.audit = nil
+			if closeErr := audit.close(); err == nil {
+				err = closeErr
+			}
+		}()
+	}
+	if e.timing {
+		stats := &timingStats{}
+		e.stats = stats
+		defer func() {
+			e.stats = nil
+			stats.write(e.stderr)
+		}()
+	}
+	e.pool = newResolverPool()
+	defer func() { e.pool = nil }()
+
+	var mu sync.Mutex
+	stdout, stderr := lockedWriter{&mu, e.stdout}, lockedWriter{&mu, e.stderr}
+
+	errs := make([]error, len(paths))
+	slots := make(chan struct{}, e.batch.jobs)
+	var wg sync.WaitGroup
+	for i, path := range paths {
+		job := *e
+		job.batch = nil
+		// The whole batch was checked for duplicate references above
+		job.checkDups = false
+		job.configPath = path
+		job.outputStem = filepath.Join(e.batch.outDir, batchStem(path))
+		job.stdout, job.stderr = stdout, stderr
+
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, job *envCommand) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			errs[i] = job.run()
+		}(i, &job)
+	}
+	wg.Wait()
+
+	var failed []string
+	for i, jobErr := range errs {
+		if jobErr == nil {
+			continue
+		}
+		failed = append(failed, paths[i])
+		e.noticef("ERROR: %s:\n%v\n", paths[i], jobErr)
+	}
+	if len(failed) > 0 {
+		return &errors.OpnixError{
+			Operation: "Resolving batch configurations",
+			Component: "environment variable resolution",
+			Issue:     fmt.Sprintf("%d of %d configurations failed", len(failed), len(paths)),
+			Context:   fmt.Sprintf("Failed: %s", strings.Join(failed, ", ")),
+			Suggestions: []string{
+				"See the errors above for each configuration",
+				"The outputs of the other configurations were written",
+			},
+		}
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/brizzbuzz/opnix/pkg/env"
+)
+
+// countingResolver records how often each reference reaches the resolver
+type countingResolver struct {
+	fakeResolver
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (c *countingResolver) ResolveSecret(reference string) (string, error) {
+	c.mu.Lock()
+	c.calls[reference]++
+	c.mu.Unlock()
+	return c.fakeResolver.ResolveSecret(reference)
+}
+
+func TestEnvCommand_Batch(t *testing.T) {
+	dir := t.TempDir()
+	configs := map[string]string{
+		"api.json":    `{"format":"dotenv","vars":[{"name":"DB_PASSWORD","reference":"op://Example/Service/password"},{"name":"API_TOKEN","reference":"op://Example/Service/token"}]}`,
+		"worker.yaml": "format: json\nvars:\n  - name: DB_PASSWORD\n    reference: op://Example/Service/password\n",
+		"broken.json": `{"vars":[{"name":"MISSING","reference":"op://Example/Service/missing"}]}`,
+	}
+	paths := make(map[string]string)
+	for name, content := range configs {
+		paths[name] = filepath.Join(dir, name)
+		if err := os.WriteFile(paths[name], []byte(content), 0600); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+	}
+	outDir := filepath.Join(dir, "gen")
+
+	resolver := &countingResolver{
+		fakeResolver: fakeResolver{secrets: map[string]string{
+			"op://Example/Service/password": "test-password",
+			"op://Example/Service/token":    "test-token",
+		}},
+		calls: make(map[string]int),
+	}
+	clients := 0
+	cmd, _, stderr := newTestEnvCommand(nil)
+	cmd.newClient = func(string) (env.Resolver, error) {
+		clients++
+		return resolver, nil
+	}
+
+	args := []string{"batch", "-configs", strings.Join([]string{paths["api.json"], paths["worker.yaml"], paths["broken.json"]}, ","), "-out-dir", outDir, "-jobs", "2"}
+	if err := cmd.Init(args); err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+	err := cmd.Run()
+	if err == nil || !strings.Contains(err.Error(), "1 of 3 configurations failed") {
+		t.Fatalf("Expected the broken config to be reported, got %v", err)
+	}
+	if !strings.Contains(stderr.String(), "op://Example/Service/missing") {
+		t.Errorf("Expected the broken config's error on stderr, got %q", stderr.String())
+	}
+
+	wants := map[string]string{
+		"api.env":     "API_TOKEN=test-token\nDB_PASSWORD=test-password\n",
+		"worker.json": `"DB_PASSWORD": "test-password"`,
+	}
+	for name, want := range wants {
+		data, err := os.ReadFile(filepath.Join(outDir, name))
+		if err != nil {
+			t.Fatalf("Expected %s to be written: %v", name, err)
+		}
+		if !strings.Contains(string(data), want) {
+			t.Errorf("Expected %s to contain %q, got %q", name, want, string(data))
+		}
+	}
+
+	if clients != 1 {
+		t.Errorf("Expected one shared client, got %d", clients)
+	}
+	if calls := resolver.calls["op://Example/Service/password"]; calls != 1 {
+		t.Errorf("Expected the shared reference to resolve once, got %d calls", calls)
+	}
+}
+
+func TestEnvCommand_BatchValidation(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		wantError string
+	}{
+		{"configs required", []string{"batch", "-out-dir", "gen"}, "Both -configs and -out-dir are required"},
+		{"out-dir required", []string{"batch", "-configs", "a.json"}, "Both -configs and -out-dir are required"},
+		{"duplicate output names", []string{"batch", "-configs", "svc/a.json,other/a.yaml", "-out-dir", "gen"}, "would both write a"},
+		{"output flags rejected", []string{"batch", "-configs", "a.json", "-out-dir", "gen", "-output", "a.env"}, "cannot be combined with -config"},
+		{"jobs must be positive", []string{"batch", "-configs", "a.json", "-out-dir", "gen", "-jobs", "0"}, "-jobs must be at least 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, _, _ := newTestEnvCommand(&fakeResolver{})
+			if err := cmd.Init(tt.args); err != nil {
+				t.Fatalf("Unexpected init error: %v", err)
+			}
+			if err := cmd.Run(); err == nil || !strings.Contains(err.Error(), tt.wantError) {
+				t.Fatalf("Expected error containing %q, got %v", tt.wantError, err)
+			}
+		})
+	}
+}
+
+func TestEnvCommand_BatchIgnoresConfigEnvironment(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "api.json")
+	if err := os.WriteFile(path, []byte(`{"format":"dotenv","vars":[{"name":"DB_PASSWORD","reference":"op://Example/Service/password"}]}`), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	t.Setenv("OPNIX_ENV_CONFIG_JSON", `{"vars":[{"name":"OTHER","reference":"op://Example/Other/password"}]}`)
+	t.Setenv("OPNIX_ENV_CONFIG", filepath.Join(dir, "missing.json"))
+
+	outDir := filepath.Join(dir, "gen")
+	cmd, _, _ := newTestEnvCommand(&fakeResolver{secrets: map[string]string{
+		"op://Example/Service/password": "test-password",
+	}})
+	if err := cmd.Init([]string{"batch", "-configs", path, "-out-dir", outDir}); err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(outDir, "api.env"))
+	if err != nil {
+		t.Fatalf("Expected api.env to be written: %v", err)
+	}
+	if string(data) != "DB_PASSWORD=test-password\n" {
+		t.Errorf("Expected the -configs file to be used, got %q", string(data))
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/brizzbuzz/opnix/internal/errors"
+	"github.com/brizzbuzz/opnix/internal/onepass"
+)
+
+// metadataClient lists vault and item metadata without touching secret values
+type metadataClient interface {
+	ListVaults() ([]onepass.VaultSummary, error)
+	ListItems(vault string) ([]onepass.ItemSummary, error)
+}
+
+func newMetadataClient(tokenFile string) (metadataClient, error) {
+	return onepass.NewClient(tokenFile)
+}
+
+type vaultsCommand struct {
+	fs        *flag.FlagSet
+	tokenFile string
+	json      bool
+
+	stdout io.Writer
+
+	newClient func(string) (metadataClient, error)
+}
+
+func newVaultsCommand() *vaultsCommand {
+	vc := &vaultsCommand{
+		fs:        flag.NewFlagSet("vaults", flag.ExitOnError),
+		stdout:    os.Stdout,
+		newClient: newMetadataClient,
+	}
+
+	vc.fs.StringVar(&vc.tokenFile, "token-file", defaultTokenPath, "Path to file containing 1Password service account token")
+	vc.fs.BoolVar(&vc.json, "json", false, "Print vaults as JSON")
+
+	vc.fs.Usage = func() {
+		fmt.Fprintf(vc.fs.Output(), "Usage: opnix vaults [options]\n\n")
+		fmt.Fprintf(vc.fs.Output(), "List the vaults the service account token can access\n\n")
+		fmt.Fprintf(vc.fs.Output(), "Options:\n")
+		vc.fs.PrintDefaults()
+	}
+
+	return vc
+}
+
+func (v *vaultsCommand) Name() string { return v.fs.Name() }
+
+func (v *vaultsCommand) Flags() *flag.FlagSet { return v.fs }
+
+func (v *vaultsCommand) Init(args []string) error {
+	return v.fs.Parse(args)
+}
+
+func (v *vaultsCommand) Run() error {
+	client, err := v.newClient(v.tokenFile)
+	if err != nil {
+		return err
+	}
+
+	vaults, err := client.ListVaults()
+	if err != nil {
+		return err
+	}
+	sort.Slice(vaults, func(i, j int) bool {
+		return strings.ToLower(vaults[i].Title) < strings.ToLower(vaults[j].Title)
+	})
+
+	if v.json {
+		return writeJSON(v.stdout, vaults)
+	}
+
+	w := tabwriter.NewWriter(v.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VAULT\tID\tREFERENCE")
+	for _, vault := range vaults {
+		fmt.Fprintf(w, "%s\t%s\top://%s/\n", vault.Title, vault.ID, escapeReferenceSegment(vault.Title))
+	}
+	return w.Flush()
+}
+
+type itemsCommand struct {
+	fs        *flag.FlagSet
+	tokenFile string
+	json      bool
+	vault     string
+
+	stdout io.Writer
+
+	newClient func(string) (metadataClient, error)
+}
+
+func newItemsCommand() *itemsCommand {
+	ic := &itemsCommand{
+		fs:        flag.NewFlagSet("items", flag.ExitOnError),
+		stdout:    os.Stdout,
+		newClient: newMetadataClient,
+	}
+
+	ic.fs.StringVar(&ic.tokenFile, "token-file", defaultTokenPath, "Path to file containing 1Password service account token")
+	ic.fs.BoolVar(&ic.json, "json", false, "Print items as JSON")
+
+	ic.fs.Usage = func() {
+		fmt.Fprintf(ic.fs.Output(), "Usage: opnix items [options] <vault>\n\n")
+		fmt.Fprintf(ic.fs.Output(), "List the items in a vault by title or ID\n\n")
+		fmt.Fprintf(ic.fs.Output(), "Options:\n")
+		ic.fs.PrintDefaults()
+	}
+
+	return ic
+}
+
+func (i *itemsCommand) Name() string { return i.fs.Name() }
+
+func (i *itemsCommand) Flags() *flag.FlagSet { return i.fs }
+
+func (i *itemsCommand) Init(args []string) error {
+	if err := i.fs.Parse(args); err != nil {
+		return err
+	}
+
+	if i.fs.NArg() != 1 {
+		i.fs.Usage()
+		return fmt.Errorf("exactly one vault name or ID required")
+	}
+
+	i.vault = i.fs.Arg(0)
+	return nil
+}
+
+func (i *itemsCommand) Run() error {
+	client, err := i.newClient(i.tokenFile)
+	if err != nil {
+		return err
+	}
+
+	items, err := client.ListItems(i.vault)
+	if err != nil {
+		return err
+	}
+	sort.Slice(items, func(a, b int) bool {
+		return strings.ToLower(items[a].Title) < strings.ToLower(items[b].Title)
+	})
+
+	if i.json {
+		return writeJSON(i.stdout, items)
+	}
+
+	w := tabwriter.NewWriter(i.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ITEM\tCATEGORY\tREFERENCE")
+	for _, item := range items {
+		fmt.Fprintf(w, "%s\t%s\top://%s/%s/\n", item.Title, item.Category, escapeReferenceSegment(i.vault), escapeReferenceSegment(item.Title))
+	}
+	return w.Flush()
+}
+
+// escapeReferenceSegment percent-encodes the characters that cannot appear
+// literally in a reference segment
+func escapeReferenceSegment(segment string) string {
+	segment = strings.ReplaceAll(segment, "%", "%25")
+	return strings.ReplaceAll(segment, "/", "%2F")
+}
+
+func writeJSON(w io.Writer, value interface{}) error {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return errors.ConfigError("Rendering JSON output", "Failed to encode metadata", err)
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
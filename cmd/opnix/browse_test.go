@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/brizzbuzz/opnix/internal/onepass"
+)
+
+type fakeMetadataClient struct {
+	vaults []onepass.VaultSummary
+	items  map[string][]onepass.ItemSummary
+}
+
+func (f *fakeMetadataClient) ListVaults() ([]onepass.VaultSummary, error) {
+	return f.vaults, nil
+}
+
+func (f *fakeMetadataClient) ListItems(vault string) ([]onepass.ItemSummary, error) {
+	return f.items[vault], nil
+}
+
+func newFakeMetadataClient() *fakeMetadataClient {
+	return &fakeMetadataClient{
+		vaults: []onepass.VaultSummary{
+			{ID: "v2", Title: "Production"},
+			{ID: "v1", Title: "Development"},
+		},
+		items: map[string][]onepass.ItemSummary{
+			"Development": {
+				{ID: "i2", Title: "TLS/Cert", Category: "Document"},
+				{ID: "i1", Title: "API Key", Category: "ApiCredentials"},
+			},
+		},
+	}
+}
+
+func TestVaultsCommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		contains []string
+	}{
+		{"table", nil, []string{"VAULT", "Development  v1  op://Development/", "Production   v2  op://Production/"}},
+		{"json", []string{"-json"}, []string{`"title": "Development"`, `"id": "v2"`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			cmd := newVaultsCommand()
+			cmd.stdout = &stdout
+			cmd.newClient = func(string) (metadataClient, error) { return newFakeMetadataClient(), nil }
+
+			if err := cmd.Init(tt.args); err != nil {
+				t.Fatalf("Unexpected init error: %v", err)
+			}
+			if err := cmd.Run(); err != nil {
+				t.Fatalf("Unexpected run error: %v", err)
+			}
+
+			for _, want := range tt.contains {
+				if !strings.Contains(stdout.String(), want) {
+					t.Errorf("Expected output to contain %q, got:\n%s", want, stdout.String())
+				}
+			}
+			if strings.Index(stdout.String(), "Development") > strings.Index(stdout.String(), "Production") {
+				t.Errorf("Expected vaults sorted by title, got:\n%s", stdout.String())
+			}
+		})
+	}
+}
+
+func TestItemsCommand(t *testing.T) {
+	var stdout bytes.Buffer
+	cmd := newItemsCommand()
+	cmd.stdout = &stdout
+	cmd.newClient = func(string) (metadataClient, error) { return newFakeMetadataClient(), nil }
+
+	if err := cmd.Init([]string{"-json", "Development"}); err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Unexpected run error: %v", err)
+	}
+
+	var items []onepass.ItemSummary
+	if err := json.Unmarshal(stdout.Bytes(), &items); err != nil {
+		t.Fatalf("Failed to parse JSON output: %v", err)
+	}
+	if len(items) != 2 || items[0].Title != "API Key" {
+		t.Errorf("Expected items sorted by title, got %+v", items)
+	}
+
+	stdout.Reset()
+	cmd = newItemsCommand()
+	cmd.stdout = &stdout
+	cmd.newClient = func(string) (metadataClient, error) { return newFakeMetadataClient(), nil }
+	if err := cmd.Init([]string{"Development"}); err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Unexpected run error: %v", err)
+	}
+	if !strings.Contains(stdout.String(), "op://Development/TLS%2FCert/") {
+		t.Errorf("Expected slash in item title to be percent-encoded, got:\n%s", stdout.String())
+	}
+
+	if err := newItemsCommand().Init(nil); err == nil {
+		t.Error("Expected error when no vault is given")
+	}
+}
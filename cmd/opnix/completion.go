@@ -0,0 +1,305 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// completionShells lists the shells completion scripts are generated for
+var completionShells = []string{"bash", "zsh", "fish"}
+
+// completionWords are the positional words a command accepts besides flags
+var completionWords = map[string][]string{
+	"secret":     {"resolve-stdin"},
+	"token":      {"set", "show-source"},
+	"env":        {"batch", "diff-refs", "example", "exec", "k8s-secret", "to-vault"},
+	"completion": completionShells,
+}
+
+type completionCommand struct {
+	fs    *flag.FlagSet
+	shell string
+
+	stdout io.Writer
+
+	// commands are the registered commands whose flags are completed
+	commands []command
+}
+
+func newCompletionCommand() *completionCommand {
+	cc := &completionCommand{
+		fs:     flag.NewFlagSet("completion", flag.ExitOnError),
+		stdout: os.Stdout,
+	}
+
+	cc.fs.Usage = func() {
+		fmt.Fprintf(cc.fs.Output(), "Usage: opnix completion <bash|zsh|fish>\n\n")
+		fmt.Fprintf(cc.fs.Output(), "Print a completion script for the given shell\n\n")
+		fmt.Fprintf(cc.fs.Output(), "Examples:\n")
+		fmt.Fprintf(cc.fs.Output(), "  source <(opnix completion bash)\n")
+		fmt.Fprintf(cc.fs.Output(), "  opnix completion fish > ~/.config/fish/completions/opnix.fish\n")
+	}
+
+	return cc
+}
+
+func (c *completionCommand) Name() string { return c.fs.Name() }
+
+func (c *completionCommand) Flags() *flag.FlagSet { return c.fs }
+
+func (c *completionCommand) Init(args []string) error {
+	if err := c.fs.Parse(args); err != nil {
+		return err
+	}
+
+	if c.fs.NArg() != 1 {
+		c.fs.Usage()
+		return fmt.Errorf("exactly one shell required")
+	}
+
+	c.shell = c.fs.Arg(0)
+	for _, shell := range completionShells {
+		if c.shell == shell {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported shell %q, use one of: %s", c.shell, strings.Join(completionShells, ", "))
+}
+
+func (c *completionCommand) Run() error {
+	var script string
+	switch c.shell {
+	case "bash":
+		script = bashCompletion(c.commands)
+	case "zsh":
+		script = zshCompletion(c.commands)
+	case "fish":
+		script = fishCompletion(c.commands)
+	}
+	_, err := fmt.Fprint(c.stdout, script)
+	return err
+}
+
+// completionFlag is a flag as presented by a completion script
+type completionFlag struct {
+	name    string
+	usage   string
+	boolean bool
+}
+
+// commandFlags lists the flags of fs in name order, so completions never
+// drift from the flags a command actually parses
+func commandFlags(fs *flag.FlagSet) []completionFlag {
+	var flags []completionFlag
+	fs.VisitAll(func(f *flag.Flag) {
+		boolean := false
+		if bf, ok := f.Value.(interface{ IsBoolFlag() bool }); ok {
+			boolean = bf.IsBoolFlag()
+		}
+		flags = append(flags, completionFlag{name: f.Name, usage: f.Usage, boolean: boolean})
+	})
+	return flags
+}
+
+// subcommander is implemented by commands whose subcommands register flags
+// of their own when they are initialized
+type subcommander interface {
+	subcommandFlags() map[string]*flag.FlagSet
+}
+
+// completionSubcommand is a subcommand with the flags it accepts
+type completionSubcommand struct {
+	name  string
+	flags []completionFlag
+}
+
+// subcommands lists cmd's subcommands that take flags, in name order
+func subcommands(cmd command) []completionSubcommand {
+	sc, ok := cmd.(subcommander)
+	if !ok {
+		return nil
+	}
+	var subs []completionSubcommand
+	for name, fs := range sc.subcommandFlags() {
+		subs = append(subs, completionSubcommand{name: name, flags: commandFlags(fs)})
+	}
+	sort.Slice(subs, func(i, j int) bool { return subs[i].name < subs[j].name })
+	return subs
+}
+
+// flagWords returns flags as the words a shell completes
+func flagWords(flags []completionFlag) []string {
+	words := make([]string, 0, len(flags))
+	for _, f := range flags {
+		words = append(words, "-"+f.name)
+	}
+	return words
+}
+
+func bashCompletion(cmds []command) string {
+	var names []string
+	for _, cmd := range cmds {
+		names = append(names, cmd.Name())
+	}
+
+	var b strings.Builder
+	b.WriteString("# bash completion for opnix\n")
+	b.WriteString("_opnix() {\n")
+	b.WriteString("    local cur=\"${COMP_WORDS[COMP_CWORD]}\"\n")
+	b.WriteString("    if [ \"$COMP_CWORD\" -eq 1 ]; then\n")
+	fmt.Fprintf(&b, "        COMPREPLY=($(compgen -W \"%s\" -- \"$cur\"))\n", strings.Join(names, " "))
+	b.WriteString("        return\n")
+	b.WriteString("    fi\n")
+	b.WriteString("    local sub=\"\"\n")
+	b.WriteString("    if [ \"$COMP_CWORD\" -gt 2 ]; then\n")
+	b.WriteString("        sub=\"${COMP_WORDS[2]}\"\n")
+	b.WriteString("    fi\n")
+	b.WriteString("    case \"${COMP_WORDS[1]}\" in\n")
+	for _, cmd := range cmds {
+		words := append(append([]string{}, completionWords[cmd.Name()]...), flagWords(commandFlags(cmd.Flags()))...)
+		subs := subcommands(cmd)
+		if len(subs) == 0 {
+			if len(words) > 0 {
+				fmt.Fprintf(&b, "        %s) COMPREPLY=($(compgen -W \"%s\" -- \"$cur\")) ;;\n", cmd.Name(), strings.Join(words, " "))
+			}
+			continue
+		}
+		fmt.Fprintf(&b, "        %s)\n", cmd.Name())
+		b.WriteString("            case \"$sub\" in\n")
+		for _, sub := range subs {
+			fmt.Fprintf(&b, "                %s) COMPREPLY=($(compgen -W \"%s\" -- \"$cur\")) ;;\n", sub.name, strings.Join(flagWords(sub.flags), " "))
+		}
+		fmt.Fprintf(&b, "                *) COMPREPLY=($(compgen -W \"%s\" -- \"$cur\")) ;;\n", strings.Join(words, " "))
+		b.WriteString("            esac\n")
+		b.WriteString("            ;;\n")
+	}
+	b.WriteString("    esac\n")
+	b.WriteString("}\n")
+	// Unmatched words, such as flag values, fall back to file name completion
+	b.WriteString("complete -o default -F _opnix opnix\n")
+	return b.String()
+}
+
+func zshCompletion(cmds []command) string {
+	var b strings.Builder
+	b.WriteString("#compdef opnix\n\n")
+	b.WriteString("_opnix() {\n")
+	b.WriteString("    local -a commands\n")
+	b.WriteString("    commands=(\n")
+	for _, cmd := range cmds {
+		fmt.Fprintf(&b, "        %s\n", zshQuote(cmd.Name()+":"+commandSummaries[cmd.Name()]))
+	}
+	b.WriteString("    )\n\n")
+	b.WriteString("    if (( CURRENT == 2 )); then\n")
+	b.WriteString("        _describe 'command' commands\n")
+	b.WriteString("        return\n")
+	b.WriteString("    fi\n\n")
+	b.WriteString("    shift words\n")
+	b.WriteString("    (( CURRENT-- ))\n")
+	b.WriteString("    case $words[1] in\n")
+	for _, cmd := range cmds {
+		specs := zshSpecs(commandFlags(cmd.Flags()))
+		if words := completionWords[cmd.Name()]; len(words) > 0 {
+			specs = append(specs, zshQuote(fmt.Sprintf("1: :(%s)", strings.Join(words, " "))))
+		}
+		if len(specs) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "        %s)\n", cmd.Name())
+		if subs := subcommands(cmd); len(subs) > 0 {
+			// Past the subcommand, complete its flags instead of the command's
+			b.WriteString("            if (( CURRENT > 2 )); then\n")
+			b.WriteString("                case $words[2] in\n")
+			for _, sub := range subs {
+				fmt.Fprintf(&b, "                    %s)\n", sub.name)
+				b.WriteString("                        shift words\n")
+				b.WriteString("                        (( CURRENT-- ))\n")
+				fmt.Fprintf(&b, "                        _arguments \\\n                            %s\n", strings.Join(zshSpecs(sub.flags), " \\\n                            "))
+				b.WriteString("                        return\n")
+				b.WriteString("                        ;;\n")
+			}
+			b.WriteString("                esac\n")
+			b.WriteString("            fi\n")
+		}
+		fmt.Fprintf(&b, "            _arguments \\\n                %s\n", strings.Join(specs, " \\\n                "))
+		b.WriteString("            ;;\n")
+	}
+	b.WriteString("    esac\n")
+	b.WriteString("}\n\n")
+	b.WriteString("_opnix \"$@\"\n")
+	return b.String()
+}
+
+// zshSpecs returns the _arguments specs for flags
+func zshSpecs(flags []completionFlag) []string {
+	specs := make([]string, 0, len(flags))
+	for _, f := range flags {
+		spec := fmt.Sprintf("-%s[%s]", f.name, zshEscapeDescription(f.usage))
+		if !f.boolean {
+			spec += ":" + f.name + ":_files"
+		}
+		specs = append(specs, zshQuote(spec))
+	}
+	return specs
+}
+
+func fishCompletion(cmds []command) string {
+	var b strings.Builder
+	b.WriteString("# fish completion for opnix\n")
+	b.WriteString("complete -c opnix -f\n")
+	for _, cmd := range cmds {
+		fmt.Fprintf(&b, "complete -c opnix -n __fish_use_subcommand -a %s -d %s\n", cmd.Name(), fishQuote(commandSummaries[cmd.Name()]))
+	}
+	for _, cmd := range cmds {
+		seen := "__fish_seen_subcommand_from " + cmd.Name()
+		subs := subcommands(cmd)
+		condition := seen
+		if len(subs) > 0 {
+			names := make([]string, 0, len(subs))
+			for _, sub := range subs {
+				names = append(names, sub.name)
+			}
+			condition += "; and not __fish_seen_subcommand_from " + strings.Join(names, " ")
+		}
+		for _, word := range completionWords[cmd.Name()] {
+			fmt.Fprintf(&b, "complete -c opnix -n %s -a %s\n", fishQuote(condition), word)
+		}
+		writeFishFlags(&b, condition, commandFlags(cmd.Flags()))
+		for _, sub := range subs {
+			writeFishFlags(&b, seen+"; and __fish_seen_subcommand_from "+sub.name, sub.flags)
+		}
+	}
+	return b.String()
+}
+
+// writeFishFlags completes flags while condition holds
+func writeFishFlags(b *strings.Builder, condition string, flags []completionFlag) {
+	for _, f := range flags {
+		line := fmt.Sprintf("complete -c opnix -n %s -o %s -d %s", fishQuote(condition), f.name, fishQuote(f.usage))
+		if !f.boolean {
+			line += " -r -F"
+		}
+		b.WriteString(line + "\n")
+	}
+}
+
+// zshQuote wraps value in single quotes for zsh
+func zshQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// zshEscapeDescription escapes the characters _arguments treats specially
+// inside an option description
+func zshEscapeDescription(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`, ":", `\:`).Replace(value)
+}
+
+// fishQuote wraps value in single quotes for fish, which only treats \\
+// and \' as escapes inside them
+func fishQuote(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(value) + "'"
+}
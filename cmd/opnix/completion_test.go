@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestCompletionCommand_Scripts(t *testing.T) {
+	cmds := []command{newSecretCommand(), newTokenCommand(), newEnvCommand()}
+
+	tests := []struct {
+		shell    string
+		expected []string
+	}{
+		{"bash", []string{"complete -o default -F _opnix opnix", "secret token env", "-config-json", "resolve-stdin"}},
+		{"zsh", []string{"#compdef opnix", "'env:Resolve environment variables for development shells'", "'-config-json[", "'-mask[Replace secret values with a mask in the output]'", "(resolve-stdin)"}},
+		{"fish", []string{"-a env -d 'Resolve environment variables for development shells'", "-o config-json", "-a resolve-stdin"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.shell, func(t *testing.T) {
+			var stdout bytes.Buffer
+			cc := newCompletionCommand()
+			cc.stdout = &stdout
+			cc.commands = cmds
+
+			if err := cc.Init([]string{tt.shell}); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if err := cc.Run(); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			for _, want := range tt.expected {
+				if !strings.Contains(stdout.String(), want) {
+					t.Errorf("Expected %s completion to contain %q, got:\n%s", tt.shell, want, stdout.String())
+				}
+			}
+		})
+	}
+}
+
+func TestCompletionCommand_SubcommandFlags(t *testing.T) {
+	cmds := []command{newSecretCommand(), newTokenCommand(), newEnvCommand()}
+
+	tests := []struct {
+		shell    string
+		expected []string
+	}{
+		{"bash", []string{"batch) COMPREPLY=($(compgen -W \"", "-configs", "-out-dir", "-jobs", "-clear-env", "-name -namespace", "-path", "-fail-on-drift"}},
+		{"zsh", []string{"case $words[2] in", "'-clear-env[", "'-configs[", "'-jobs[", "'-name[", "'-path[", "'-token-file["}},
+		{"fish", []string{
+			"'__fish_seen_subcommand_from env; and __fish_seen_subcommand_from exec' -o clear-env",
+			"'__fish_seen_subcommand_from env; and __fish_seen_subcommand_from batch' -o jobs",
+			"'__fish_seen_subcommand_from env; and __fish_seen_subcommand_from k8s-secret' -o name",
+			"'__fish_seen_subcommand_from env; and __fish_seen_subcommand_from to-vault' -o path",
+			"'__fish_seen_subcommand_from env; and not __fish_seen_subcommand_from batch diff-refs example exec k8s-secret to-vault' -o config ",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.shell, func(t *testing.T) {
+			var stdout bytes.Buffer
+			cc := newCompletionCommand()
+			cc.stdout = &stdout
+			cc.commands = cmds
+
+			if err := cc.Init([]string{tt.shell}); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if err := cc.Run(); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			for _, want := range tt.expected {
+				if !strings.Contains(stdout.String(), want) {
+					t.Errorf("Expected %s completion to contain %q", tt.shell, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCompletionCommand_BashCompletesSubcommandFlags(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not installed")
+	}
+	script := bashCompletion([]command{newSecretCommand(), newTokenCommand(), newEnvCommand()})
+
+	tests := []struct {
+		words string
+		want  string
+	}{
+		{"opnix env batch -jo", "-jobs"},
+		{"opnix env exec -clear", "-clear-env"},
+		{"opnix env k8s-secret -nam", "-name -namespace"},
+		{"opnix env diff-refs -fail", "-fail-on-drift"},
+		{"opnix env bat", "batch"},
+		{"opnix secret resolve-stdin -tok", "-token-file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.words, func(t *testing.T) {
+			words := strings.Fields(tt.words)
+			probe := fmt.Sprintf("%s\nCOMP_WORDS=(%s); COMP_CWORD=%d; _opnix; printf %%s \"${COMPREPLY[*]}\"", script, tt.words, len(words)-1)
+			out, err := exec.Command("bash", "-c", probe).CombinedOutput()
+			if err != nil {
+				t.Fatalf("Completion script failed: %v\n%s", err, out)
+			}
+			if string(out) != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, string(out))
+			}
+		})
+	}
+}
+
+func TestCompletionCommand_FlagsFollowFlagSet(t *testing.T) {
+	ec := newEnvCommand()
+	flags := commandFlags(ec.Flags())
+
+	count := 0
+	ec.Flags().VisitAll(func(*flag.Flag) { count++ })
+	if len(flags) != count {
+		t.Errorf("Expected %d flags, got %d", count, len(flags))
+	}
+	for _, f := range flags {
+		switch f.name {
+		case "mask":
+			if !f.boolean {
+				t.Errorf("Expected -mask to be a boolean flag")
+			}
+		case "config":
+			if f.boolean {
+				t.Errorf("Expected -config to take a value")
+			}
+		}
+	}
+}
+
+func TestCompletionCommand_InvalidShell(t *testing.T) {
+	for _, args := range [][]string{{"powershell"}, {}, {"bash", "zsh"}} {
+		cc := newCompletionCommand()
+		cc.fs.SetOutput(&bytes.Buffer{})
+		if err := cc.Init(args); err == nil {
+			t.Errorf("Expected error for args %v", args)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/brizzbuzz/opnix/internal/errors"
+)
+
+// envFlagSet reports whether each flag that modes conflict over was given,
+// keyed by the name used in error messages
+var envFlagSet = map[string]func(e *envCommand) bool{
+	"-config":        func(e *envCommand) bool { return e.configPath != "" },
+	"-config-json":   func(e *envCommand) bool { return e.configJSON != "" },
+	"-format":        func(e *envCommand) bool { return e.format != "" },
+	"-raw":           func(e *envCommand) bool { return e.raw != "" },
+	"-update":        func(e *envCommand) bool { return e.updatePath != "" },
+	"-output":        func(e *envCommand) bool { return e.outputPath != "" },
+	"-outputs":       func(e *envCommand) bool { return e.outputs != "" },
+	"-masked-output": func(e *envCommand) bool { return e.maskedPath != "" },
+	"-mask":          func(e *envCommand) bool { return e.mask },
+	"-report":        func(e *envCommand) bool { return e.reportPath != "" },
+	"-check":         func(e *envCommand) bool { return e.check },
+	"-watch":         func(e *envCommand) bool { return e.watch },
+	"-explain":       func(e *envCommand) bool { return e.explain != "" },
+	"-print-config":  func(e *envCommand) bool { return e.printConfig },
+	"-stdout-only":   func(e *envCommand) bool { return e.stdoutOnly },
+	"-dry-run":       func(e *envCommand) bool { return e.dryRun },
+	"k8s-secret":     func(e *envCommand) bool { return e.k8s != nil },
+}
+
+// outputFlags choose where or how resolved values are written, for modes
+// such as exec and to-vault that hand the values somewhere else
+var outputFlags = []string{"-format", "-raw", "-update", "-output", "-outputs", "-masked-output", "-mask", "-check", "-watch", "-explain", "-print-config"}
+
+// checkConflicts fails when any of flags was given alongside a mode that
+// does something else, naming every flag the mode cannot be combined with
+func (e *envCommand) checkConflicts(field, value, reason string, flags []string, suggestions ...string) error {
+	for _, flag := range flags {
+		if envFlagSet[flag](e) {
+			return errors.ConfigValidationError(
+				field,
+				value,
+				reason+", so it cannot be combined with "+joinFlags(flags),
+				suggestions,
+			)
+		}
+	}
+	return nil
+}
+
+// joinFlags lists flags as "a, b, or c"
+func joinFlags(flags []string) string {
+	switch len(flags) {
+	case 1:
+		return flags[0]
+	case 2:
+		return flags[0] + " or " + flags[1]
+	}
+	return strings.Join(flags[:len(flags)-1], ", ") + ", or " + flags[len(flags)-1]
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestJoinFlags(t *testing.T) {
+	tests := []struct {
+		flags []string
+		want  string
+	}{
+		{[]string{"-raw"}, "-raw"},
+		{[]string{"-raw", "-update"}, "-raw or -update"},
+		{[]string{"-explain", "-check", "-watch"}, "-explain, -check, or -watch"},
+	}
+	for _, tt := range tests {
+		if got := joinFlags(tt.flags); got != tt.want {
+			t.Errorf("joinFlags(%q) = %q, want %q", tt.flags, got, tt.want)
+		}
+	}
+}
+
+func TestCheckConflicts(t *testing.T) {
+	for name := range envFlagSet {
+		if envFlagSet[name](&envCommand{}) {
+			t.Errorf("Expected %s to be unset on an empty command", name)
+		}
+	}
+	for _, name := range outputFlags {
+		if envFlagSet[name] == nil {
+			t.Errorf("Expected %s to be in envFlagSet", name)
+		}
+	}
+
+	e := &envCommand{watch: true}
+	if err := e.checkConflicts("env.dry-run", "true", "-dry-run prints a plan", []string{"-explain", "-check"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err := e.checkConflicts("env.dry-run", "true", "-dry-run prints a plan", []string{"-explain", "-check", "-watch"})
+	if err == nil || !strings.Contains(err.Error(), "-dry-run prints a plan, so it cannot be combined with -explain, -check, or -watch") {
+		t.Fatalf("Expected a conflict naming every flag, got %v", err)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/brizzbuzz/opnix/internal/errors"
+)
+
+// envDiffRefsCommand implements "opnix env diff-refs", comparing the
+// references of two configurations without resolving anything
+type envDiffRefsCommand struct {
+	fs  *flag.FlagSet
+	env *envCommand
+
+	failOnDrift bool
+	paths       []string
+}
+
+func newEnvDiffRefsCommand(e *envCommand) *envDiffRefsCommand {
+	dc := &envDiffRefsCommand{
+		fs:  flag.NewFlagSet("env diff-refs", flag.ExitOnError),
+		env: e,
+	}
+
+	dc.fs.StringVar(&e.environment, "environment", "", "Named environment block to layer over the shared vars of both configurations")
+	dc.fs.StringVar(&e.vault, "vault", "", "Default vault for short Item/field references (overrides defaultVault)")
+	dc.fs.BoolVar(&dc.failOnDrift, "fail-on-drift", false, "Exit non-zero when the references differ")
+
+	dc.fs.Usage = func() {
+		fmt.Fprintf(dc.fs.Output(), "Usage: opnix env diff-refs [options] OLD NEW\n\n")
+		fmt.Fprintf(dc.fs.Output(), "Report variables whose references were added, removed, or changed between two configurations, without resolving secrets\n\n")
+		fmt.Fprintf(dc.fs.Output(), "Options:\n")
+		dc.fs.PrintDefaults()
+	}
+
+	return dc
+}
+
+func (d *envDiffRefsCommand) Init(args []string) error {
+	d.fs.SetOutput(d.env.stderr)
+	if err := d.fs.Parse(args); err != nil {
+		return err
+	}
+	d.paths = d.fs.Args()
+	if len(d.paths) != 2 {
+		return errors.ConfigValidationError(
+			"env.diff-refs",
+			fmt.Sprintf("%d paths", len(d.paths)),
+			"diff-refs compares exactly two configuration files",
+			[]string{"Example: opnix env diff-refs staging.json prod.json"},
+		)
+	}
+	return nil
+}
+
+func (d *envDiffRefsCommand) Run() error {
+	old, err := d.references(d.paths[0])
+	if err != nil {
+		return err
+	}
+	updated, err := d.references(d.paths[1])
+	if err != nil {
+		return err
+	}
+
+	drift := diffReferences(old, updated)
+	writeReferenceDrift(d.env.stdout, d.paths[0], d.paths[1], drift)
+
+	if d.failOnDrift && !drift.empty() {
+		return errors.ConfigError(
+			"Comparing configuration references",
+			fmt.Sprintf("%d added, %d removed, and %d changed references between %s and %s", len(drift.added), len(drift.removed), len(drift.changed), d.paths[0], d.paths[1]),
+			nil,
+		)
+	}
+	return nil
+}
+
+// references loads the configuration at path and maps each variable name to
+// its qualified reference, or "" for a static value
+func (d *envDiffRefsCommand) references(path string) (map[string]string, error) {
+	cfg, err := d.env.loadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	if cfg, err = cfg.Select(d.env.environment); err != nil {
+		return nil, err
+	}
+	if err := cfg.QualifyReferences(d.env.vault); err != nil {
+		return nil, err
+	}
+
+	references := make(map[string]string, len(cfg.Vars))
+	for _, variable := range cfg.Vars {
+		references[variable.Name] = variable.Reference
+	}
+	return references, nil
+}
+
+// referenceChange is a variable whose reference differs between configurations
+type referenceChange struct {
+	name     string
+	old, new string
+}
+
+// referenceDrift holds the differences found by diffReferences, each sorted by name
+type referenceDrift struct {
+	added   []referenceChange
+	removed []referenceChange
+	changed []referenceChange
+}
+
+func (d referenceDrift) empty() bool {
+	return len(d.added) == 0 && len(d.removed) == 0 && len(d.changed) == 0
+}
+
+// diffReferences compares two name-to-reference maps. Static values only
+// count when a variable switches between a static value and a reference;
+// the values themselves are never compared.
+func diffReferences(old, updated map[string]string) referenceDrift {
+	var drift referenceDrift
+	for name, reference := range updated {
+		previous, ok := old[name]
+		switch {
+		case !ok:
+			drift.added = append(drift.added, referenceChange{name: name, new: reference})
+		case previous != reference:
+			drift.changed = append(drift.changed, referenceChange{name: name, old: previous, new: reference})
+		}
+	}
+	for name, reference := range old {
+		if _, ok := updated[name]; !ok {
+			drift.removed = append(drift.removed, referenceChange{name: name, old: reference})
+		}
+	}
+
+	for _, changes := range [][]referenceChange{drift.added, drift.removed, drift.changed} {
+		sort.Slice(changes, func(i, j int) bool { return changes[i].name < changes[j].name })
+	}
+	return drift
+}
+
+// writeReferenceDrift prints the drift as +, -, and ~ lines grouped by kind
+func writeReferenceDrift(w io.Writer, oldPath, newPath string, drift referenceDrift) {
+	if drift.empty() {
+		fmt.Fprintf(w, "No reference changes between %s and %s\n", oldPath, newPath)
+		return
+	}
+
+	if len(drift.added) > 0 {
+		fmt.Fprintf(w, "Added in %s:\n", newPath)
+		for _, change := range drift.added {
+			fmt.Fprintf(w, "  + %s  %s\n", change.name, describeReference(change.new))
+		}
+	}
+	if len(drift.removed) > 0 {
+		fmt.Fprintf(w, "Removed from %s:\n", oldPath)
+		for _, change := range drift.removed {
+			fmt.Fprintf(w, "  - %s  %s\n", change.name, describeReference(change.old))
+		}
+	}
+	if len(drift.changed) > 0 {
+		fmt.Fprintf(w, "Changed:\n")
+		for _, change := range drift.changed {
+			fmt.Fprintf(w, "  ~ %s  %s -> %s\n", change.name, describeReference(change.old), describeReference(change.new))
+		}
+	}
+}
+
+func describeReference(reference string) string {
+	if reference == "" {
+		return "(static value)"
+	}
+	return reference
+}
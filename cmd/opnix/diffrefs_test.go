@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEnvCommand_DiffRefs(t *testing.T) {
+	dir := t.TempDir()
+	staging := filepath.Join(dir, "staging.json")
+	prod := filepath.Join(dir, "prod.json")
+	if err := os.WriteFile(staging, []byte(`{"defaultVault":"Staging","vars":[
+		{"name":"DB_PASSWORD","reference":"Database/password"},
+		{"name":"API_TOKEN","reference":"op://Shared/API/token"},
+		{"name":"LEGACY_KEY","reference":"op://Shared/Legacy/key"},
+		{"name":"REGION","value":"eu"}
+	]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(prod, []byte(`{"defaultVault":"Prod","vars":[
+		{"name":"DB_PASSWORD","reference":"Database/password"},
+		{"name":"API_TOKEN","reference":"op://Shared/API/token"},
+		{"name":"SENTRY_DSN","reference":"op://Shared/Sentry/dsn"},
+		{"name":"REGION","value":"us"}
+	]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd, stdout, _ := newTestEnvCommand(&fakeResolver{})
+	cmd.newClient = nil // diff-refs must not create a client
+	if err := cmd.Init([]string{"diff-refs", "-fail-on-drift", staging, prod}); err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+	err := cmd.Run()
+	if err == nil || !strings.Contains(err.Error(), "1 added, 1 removed, and 1 changed") {
+		t.Errorf("Expected -fail-on-drift to report the counts, got %v", err)
+	}
+
+	expected := "Added in " + prod + ":\n" +
+		"  + SENTRY_DSN  op://Shared/Sentry/dsn\n" +
+		"Removed from " + staging + ":\n" +
+		"  - LEGACY_KEY  op://Shared/Legacy/key\n" +
+		"Changed:\n" +
+		"  ~ DB_PASSWORD  op://Staging/Database/password -> op://Prod/Database/password\n"
+	if got := stdout.String(); got != expected {
+		t.Errorf("Unexpected drift report:\n%s\nwant:\n%s", got, expected)
+	}
+}
+
+func TestEnvCommand_DiffRefsNeedsTwoPaths(t *testing.T) {
+	cmd, _, _ := newTestEnvCommand(&fakeResolver{})
+	if err := cmd.Init([]string{"diff-refs", "only.json"}); err == nil || !strings.Contains(err.Error(), "exactly two") {
+		t.Errorf("Expected an error for a single path, got %v", err)
+	}
+}
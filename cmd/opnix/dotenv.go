@@ -0,0 +1,362 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/brizzbuzz/opnix/internal/errors"
+)
+
+// dotenvKeyPattern matches keys in hand-written dotenv files, which may use
+// lowercase names that opnix itself would reject
+var dotenvKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// quoteStyle selects how dotenv values are quoted
+type quoteStyle string
+
+const (
+	// quoteAuto quotes only values that need it, using double quotes
+	quoteAuto quoteStyle = "auto"
+	// quoteDouble always double-quotes with backslash escapes
+	quoteDouble quoteStyle = "double"
+	// quoteSingle always single-quotes, leaving the value literal
+	quoteSingle quoteStyle = "single"
+	// quoteNone writes values raw and rejects values that need quoting
+	quoteNone quoteStyle = "none"
+)
+
+var quoteStyles = []string{string(quoteAuto), string(quoteDouble), string(quoteSingle), string(quoteNone)}
+
+// parseQuoteStyle validates a -quote-style value
+func parseQuoteStyle(name string) (quoteStyle, error) {
+	for _, style := range quoteStyles {
+		if name == style {
+			return quoteStyle(name), nil
+		}
+	}
+	return "", errors.ConfigValidationError(
+		"env.quote-style",
+		name,
+		"Unsupported dotenv quote style",
+		[]string{"Use one of: " + strings.Join(quoteStyles, ", ")},
+	)
+}
+
+// quote renders value for key in style. The zero style behaves like auto.
+func (s quoteStyle) quote(key, value string) (string, error) {
+	switch s {
+	case quoteDouble:
+		return `"` + escapeDotenv(value) + `"`, nil
+	case quoteSingle:
+		if strings.ContainsAny(value, "'\r\n") {
+			return "", errors.ConfigValidationError(
+				"env.quote-style",
+				string(s),
+				fmt.Sprintf("Variable %s contains a single quote or line break, which single-quoted dotenv values cannot represent", key),
+				[]string{"Use -quote-style double or auto, which escape these characters"},
+			)
+		}
+		return "'" + value + "'", nil
+	case quoteNone:
+		if dotenvNeedsQuotes(value) {
+			return "", errors.ConfigValidationError(
+				"env.quote-style",
+				string(s),
+				fmt.Sprintf("Variable %s contains whitespace, quotes, or '#', which unquoted dotenv values cannot represent", key),
+				[]string{"Use -quote-style auto to quote only the values that need it"},
+			)
+		}
+		return value, nil
+	default:
+		return dotenvValue(value), nil
+	}
+}
+
+// dotenvUpdate summarizes the changes applied to an existing dotenv file
+type dotenvUpdate struct {
+	content string
+	updated int
+	added   int
+}
+
+// updateDotenv rewrites managed keys in existing dotenv content. Comments,
+// blank lines, ordering, and unmanaged keys are preserved; managed keys that
+// are not present yet are appended in keys order. Lines end the way the
+// file's first line does, so a CRLF file stays CRLF throughout.
+func updateDotenv(existing string, values map[string]string, keys []string, style quoteStyle) (dotenvUpdate, error) {
+	eol := dotenvLineEnding(existing)
+	var lines []string
+	if existing != "" {
+		lines = strings.Split(strings.TrimSuffix(existing, "\n"), "\n")
+		for i := range lines {
+			lines[i] = strings.TrimSuffix(lines[i], "\r")
+		}
+	}
+
+	var out []string
+	written := make(map[string]bool, len(keys))
+	update := dotenvUpdate{}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		prefix, key, rawValue, ok := parseDotenvLine(line)
+		value, managed := values[key]
+		if !ok || !managed {
+			out = append(out, line)
+			continue
+		}
+
+		// Skip continuation lines of a multi-line double-quoted value
+		if strings.HasPrefix(rawValue, `"`) && !closesDoubleQuote(rawValue[1:]) {
+			for i+1 < len(lines) {
+				i++
+				if closesDoubleQuote(lines[i]) {
+					break
+				}
+			}
+		}
+
+		if written[key] {
+			continue
+		}
+		written[key] = true
+		update.updated++
+		quoted, err := style.quote(key, value)
+		if err != nil {
+			return dotenvUpdate{}, err
+		}
+		out = append(out, prefix+key+"="+quoted)
+	}
+
+	for _, key := range keys {
+		if written[key] {
+			continue
+		}
+		written[key] = true
+		update.added++
+		quoted, err := style.quote(key, values[key])
+		if err != nil {
+			return dotenvUpdate{}, err
+		}
+		out = append(out, key+"="+quoted)
+	}
+
+	if len(out) > 0 {
+		update.content = strings.Join(out, eol) + eol
+	}
+	return update, nil
+}
+
+// dotenvLineEnding returns "\r\n" when content's first line ends with CRLF,
+// and "\n" otherwise
+func dotenvLineEnding(content string) string {
+	if end := strings.Index(content, "\n"); end > 0 && content[end-1] == '\r' {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+// parseDotenvLine splits an assignment into its leading indentation and
+// optional export keyword, the key, and the raw value
+func parseDotenvLine(line string) (prefix, key, value string, ok bool) {
+	trimmed := strings.TrimLeft(line, " \t")
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+		return "", "", "", false
+	}
+
+	prefix = line[:len(line)-len(trimmed)]
+	if rest, found := strings.CutPrefix(trimmed, "export "); found {
+		prefix += "export "
+		trimmed = strings.TrimLeft(rest, " \t")
+	}
+
+	key, value, found := strings.Cut(trimmed, "=")
+	key = strings.TrimRight(key, " \t")
+	if !found || !dotenvKeyPattern.MatchString(key) {
+		return "", "", "", false
+	}
+
+	return prefix, key, strings.TrimLeft(value, " \t"), true
+}
+
+// parseDotenv reads key/value pairs from dotenv content, returning the values
+// and the order in which keys first appear. Double-quoted values support the
+// escapes emitted by dotenvValue and may span lines; single-quoted values are
+// literal; unquoted values end at an inline " #" comment.
+func parseDotenv(content string) (map[string]string, []string) {
+	values := make(map[string]string)
+	var order []string
+
+	lines := strings.Split(content, "\n")
+	for i := 0; i < len(lines); i++ {
+		_, key, raw, ok := parseDotenvLine(strings.TrimSuffix(lines[i], "\r"))
+		if !ok {
+			continue
+		}
+
+		var value string
+		switch {
+		case strings.HasPrefix(raw, `"`):
+			quoted := raw[1:]
+			for !closesDoubleQuote(quoted) && i+1 < len(lines) {
+				i++
+				quoted += "\n" + lines[i]
+			}
+			value = unescapeDotenv(quoted)
+		case strings.HasPrefix(raw, "'"):
+			value = raw[1:]
+			if end := strings.Index(value, "'"); end >= 0 {
+				value = value[:end]
+			}
+		default:
+			value = raw
+			if idx := strings.Index(value, " #"); idx >= 0 {
+				value = value[:idx]
+			}
+			value = strings.TrimSpace(value)
+		}
+
+		if _, seen := values[key]; !seen {
+			order = append(order, key)
+		}
+		values[key] = value
+	}
+
+	return values, order
+}
+
+// unescapeDotenv decodes a double-quoted value up to its closing quote
+func unescapeDotenv(s string) string {
+	var b strings.Builder
+	escaped := false
+	for _, r := range s {
+		if escaped {
+			switch r {
+			case 'n':
+				b.WriteRune('\n')
+			case 'r':
+				b.WriteRune('\r')
+			case 't':
+				b.WriteRune('\t')
+			default:
+				b.WriteRune(r)
+			}
+			escaped = false
+			continue
+		}
+		switch r {
+		case '\\':
+			escaped = true
+		case '"':
+			return b.String()
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// loadBaseDotenv reads the dotenv file that resolved values are layered over
+func loadBaseDotenv(path string) (map[string]string, []string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, errors.FileOperationError(
+			"Loading base dotenv file",
+			path,
+			"Failed to read base dotenv file",
+			err,
+		)
+	}
+
+	values, order := parseDotenv(string(content))
+	return values, order, nil
+}
+
+// closesDoubleQuote reports whether s contains an unescaped double quote
+func closesDoubleQuote(s string) bool {
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '"':
+			return true
+		}
+	}
+	return false
+}
+
+// writeDotenvUpdate merges values into the dotenv file at path. It is
+// written with mode, or when mode is 0 keeps the existing file's mode and
+// creates a missing file with 0600. chown, when set, runs on the temporary
+// file before it replaces path.
+func writeDotenvUpdate(path string, values map[string]string, keys []string, style quoteStyle, mode os.FileMode, chown func(string) error) (dotenvUpdate, error) {
+	keepMode := mode == 0
+	if keepMode {
+		mode = 0600
+	}
+	existing, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if info, statErr := os.Stat(path); statErr == nil && keepMode {
+			mode = info.Mode().Perm()
+		}
+	case os.IsNotExist(err):
+		existing = nil
+	default:
+		return dotenvUpdate{}, errors.FileOperationError(
+			"Reading dotenv file for update",
+			path,
+			"Failed to read existing dotenv file",
+			err,
+		)
+	}
+
+	update, err := updateDotenv(string(existing), values, keys, style)
+	if err != nil {
+		return dotenvUpdate{}, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".opnix-env-*")
+	if err != nil {
+		return dotenvUpdate{}, errors.FileOperationError(
+			"Updating dotenv file",
+			path,
+			"Failed to create temporary file next to the dotenv file",
+			err,
+		)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	if _, err := tmp.WriteString(update.content); err != nil {
+		tmp.Close()
+		return dotenvUpdate{}, errors.FileOperationError("Updating dotenv file", path, "Failed to write updated content", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return dotenvUpdate{}, errors.FileOperationError("Updating dotenv file", path, "Failed to write updated content", err)
+	}
+	if err := os.Chmod(tmpPath, mode); err != nil {
+		return dotenvUpdate{}, errors.FileOperationError("Updating dotenv file", path, "Failed to set file permissions", err)
+	}
+	if chown != nil {
+		if err := chown(tmpPath); err != nil {
+			return dotenvUpdate{}, err
+		}
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return dotenvUpdate{}, errors.FileOperationError(
+			"Updating dotenv file",
+			path,
+			fmt.Sprintf("Failed to replace %s with updated content", filepath.Base(path)),
+			err,
+		)
+	}
+
+	return update, nil
+}
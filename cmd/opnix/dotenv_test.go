@@ -0,0 +1,195 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUpdateDotenv(t *testing.T) {
+	values := map[string]string{
+		"API_TOKEN": "new-token",
+		"DB_URL":    "postgres://db",
+		"NEW_KEY":   "hello world",
+	}
+	keys := []string{"API_TOKEN", "DB_URL", "NEW_KEY"}
+
+	tests := []struct {
+		name     string
+		existing string
+		expected string
+		updated  int
+		added    int
+	}{
+		{
+			name:     "empty file",
+			existing: "",
+			expected: "API_TOKEN=new-token\nDB_URL=postgres://db\nNEW_KEY=\"hello world\"\n",
+			added:    3,
+		},
+		{
+			name:     "preserves comments and unmanaged keys",
+			existing: "# team settings\nLOCAL_ONLY=1\n\nexport API_TOKEN=old\n  DB_URL = stale # inline\n",
+			expected: "# team settings\nLOCAL_ONLY=1\n\nexport API_TOKEN=new-token\n  DB_URL=postgres://db\nNEW_KEY=\"hello world\"\n",
+			updated:  2,
+			added:    1,
+		},
+		{
+			name:     "replaces multi-line quoted value",
+			existing: "API_TOKEN=\"line one\nline two\"\nAFTER=kept",
+			expected: "API_TOKEN=new-token\nAFTER=kept\nDB_URL=postgres://db\nNEW_KEY=\"hello world\"\n",
+			updated:  1,
+			added:    2,
+		},
+		{
+			name:     "keeps CRLF line endings",
+			existing: "# header\r\nAPI_TOKEN=old\r\nOTHER=1 # keep\r\n",
+			expected: "# header\r\nAPI_TOKEN=new-token\r\nOTHER=1 # keep\r\nDB_URL=postgres://db\r\nNEW_KEY=\"hello world\"\r\n",
+			updated:  1,
+			added:    2,
+		},
+		{
+			name:     "keeps CRLF without a final line ending",
+			existing: "OTHER=1\r\nAPI_TOKEN=old",
+			expected: "OTHER=1\r\nAPI_TOKEN=new-token\r\nDB_URL=postgres://db\r\nNEW_KEY=\"hello world\"\r\n",
+			updated:  1,
+			added:    2,
+		},
+		{
+			name:     "drops duplicate managed keys",
+			existing: "API_TOKEN=one\nAPI_TOKEN=two\n",
+			expected: "API_TOKEN=new-token\nDB_URL=postgres://db\nNEW_KEY=\"hello world\"\n",
+			updated:  1,
+			added:    2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			update, err := updateDotenv(tt.existing, values, keys, quoteAuto)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if update.content != tt.expected {
+				t.Errorf("Expected content %q, got %q", tt.expected, update.content)
+			}
+			if update.updated != tt.updated || update.added != tt.added {
+				t.Errorf("Expected %d updated and %d added, got %d and %d", tt.updated, tt.added, update.updated, update.added)
+			}
+		})
+	}
+}
+
+func TestWriteDotenvUpdate_PreservesMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(path, []byte("# keep\nAPI_TOKEN=old\n"), 0640); err != nil {
+		t.Fatalf("Failed to write dotenv file: %v", err)
+	}
+
+	if _, err := writeDotenvUpdate(path, map[string]string{"API_TOKEN": "new"}, []string{"API_TOKEN"}, quoteAuto, 0, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read dotenv file: %v", err)
+	}
+	if string(content) != "# keep\nAPI_TOKEN=new\n" {
+		t.Errorf("Unexpected content %q", string(content))
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat dotenv file: %v", err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("Expected mode 0640, got %o", info.Mode().Perm())
+	}
+}
+
+func TestParseDotenv(t *testing.T) {
+	content := "# defaults\nexport REGION=us-east-1\nGREETING=\"hello\\nworld\"\nLITERAL='a \\n b'\nMULTI=\"line one\nline two\"\nPORT=8080 # http\nPORT=9090\nnot a pair\n"
+
+	values, order := parseDotenv(content)
+
+	expected := map[string]string{
+		"REGION":   "us-east-1",
+		"GREETING": "hello\nworld",
+		"LITERAL":  `a \n b`,
+		"MULTI":    "line one\nline two",
+		"PORT":     "9090",
+	}
+	for key, want := range expected {
+		if values[key] != want {
+			t.Errorf("Expected %s=%q, got %q", key, want, values[key])
+		}
+	}
+	if len(values) != len(expected) {
+		t.Errorf("Expected %d values, got %d: %v", len(expected), len(values), values)
+	}
+
+	wantOrder := []string{"REGION", "GREETING", "LITERAL", "MULTI", "PORT"}
+	if strings.Join(order, ",") != strings.Join(wantOrder, ",") {
+		t.Errorf("Expected order %v, got %v", wantOrder, order)
+	}
+
+	// Values written by opnix must round-trip through the parser
+	rendered, err := renderDotenv(expected, wantOrder, quoteAuto)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	roundTrip, _ := parseDotenv(rendered)
+	for key, want := range expected {
+		if roundTrip[key] != want {
+			t.Errorf("Expected round-tripped %s=%q, got %q", key, want, roundTrip[key])
+		}
+	}
+}
+
+func TestQuoteStyle_Quote(t *testing.T) {
+	tests := []struct {
+		name      string
+		style     quoteStyle
+		value     string
+		expected  string
+		wantError string
+	}{
+		{name: "auto leaves plain values", style: quoteAuto, value: "plain", expected: "plain"},
+		{name: "auto quotes spaces", style: quoteAuto, value: "hello world", expected: `"hello world"`},
+		{name: "zero value behaves like auto", value: "plain", expected: "plain"},
+		{name: "double quotes plain values", style: quoteDouble, value: "plain", expected: `"plain"`},
+		{name: "double quotes empty values", style: quoteDouble, value: "", expected: `""`},
+		{name: "double escapes", style: quoteDouble, value: "say \"hi\"\n", expected: `"say \"hi\"\n"`},
+		{name: "single quotes literally", style: quoteSingle, value: `a\b "c"`, expected: `'a\b "c"'`},
+		{name: "single rejects quotes", style: quoteSingle, value: "it's", wantError: "single-quoted dotenv values cannot represent"},
+		{name: "single rejects newlines", style: quoteSingle, value: "a\nb", wantError: "single-quoted dotenv values cannot represent"},
+		{name: "none writes raw", style: quoteNone, value: "postgres://db:5432", expected: "postgres://db:5432"},
+		{name: "none rejects spaces", style: quoteNone, value: "hello world", wantError: "unquoted dotenv values cannot represent"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.style.quote("API_TOKEN", tt.value)
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("Expected error containing %q, got %v", tt.wantError, err)
+				}
+				if !strings.Contains(err.Error(), "API_TOKEN") {
+					t.Errorf("Expected error to name the variable, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+
+	if _, err := parseQuoteStyle("backtick"); err == nil {
+		t.Error("Expected error for unknown quote style")
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/brizzbuzz/opnix/pkg/env"
+)
+
+// planEntry is one row of the -dry-run plan
+type planEntry struct {
+	Name      string `json:"name"`
+	Reference string `json:"reference,omitempty"`
+	Target    string `json:"target"`
+	Optional  bool   `json:"optional"`
+}
+
+// writeDryRunPlan lists what each variable maps to without resolving
+// anything: a table on stderr, or JSON on stdout with -json
+func (e *envCommand) writeDryRunPlan(cfg *env.Config, format string, prefix string) error {
+	required := make(map[string]bool, len(e.require)+1)
+	for _, name := range e.require {
+		required[prefix+name] = true
+	}
+	if e.raw != "" {
+		required[e.raw] = true
+	}
+
+	target := e.planTarget(format)
+	entries := make([]planEntry, 0, len(cfg.Vars))
+	for _, variable := range cfg.Vars {
+		reference := variable.Reference
+		if e.redactRefs {
+			reference = redactReferences(reference)
+		}
+		entries = append(entries, planEntry{
+			Name:      variable.Name,
+			Reference: reference,
+			Target:    target,
+			Optional:  cfg.IsOptional(variable) && !required[variable.Name],
+		})
+	}
+	if e.sort {
+		sort.SliceStable(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	}
+
+	if e.json {
+		return writeJSON(e.stdout, entries)
+	}
+
+	w := tabwriter.NewWriter(e.stderr, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tREFERENCE\tTARGET\tOPTIONAL")
+	for _, entry := range entries {
+		reference := entry.Reference
+		if reference == "" {
+			reference = "(static value)"
+		}
+		optional := "no"
+		if entry.Optional {
+			optional = "yes"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", entry.Name, reference, entry.Target, optional)
+	}
+	return w.Flush()
+}
+
+// planTarget describes where a run with the current flags would send values
+func (e *envCommand) planTarget(format string) string {
+	switch {
+	case e.exec != nil:
+		return "env"
+	case format == "none":
+		return "none"
+	case e.updatePath != "":
+		return e.updatePath
+	}
+
+	var paths []string
+	if targets, err := parseOutputTargets(e.outputs); err == nil {
+		for _, target := range targets {
+			paths = append(paths, target.path)
+		}
+	}
+	if e.outputPath != "" {
+		paths = append(paths, e.outputPath)
+	}
+	if len(paths) == 0 {
+		return "stdout"
+	}
+	return strings.Join(paths, ",")
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const dryRunConfig = `{"vars":[
+	{"name":"DB_PASSWORD","reference":"op://Example/Database/password"},
+	{"name":"SENTRY_DSN","reference":"op://Example/Sentry/dsn","optional":true},
+	{"name":"LOG_LEVEL","value":"info"}
+]}`
+
+func TestEnvCommand_DryRunTable(t *testing.T) {
+	cmd, stdout, stderr := newTestEnvCommand(&fakeResolver{})
+	cmd.newClient = nil // the plan must not create a client
+
+	if err := cmd.Init([]string{"-config-json", dryRunConfig, "-dry-run", "-output", "app.env", "-redact-references"}); err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Unexpected run error: %v", err)
+	}
+
+	if stdout.Len() != 0 {
+		t.Errorf("Expected the table on stderr only, got stdout %q", stdout.String())
+	}
+	expected := "NAME         REFERENCE                  TARGET   OPTIONAL\n" +
+		"DB_PASSWORD  op://Example/***/password  app.env  no\n" +
+		"LOG_LEVEL    (static value)             app.env  no\n" +
+		"SENTRY_DSN   op://Example/***/dsn       app.env  yes\n"
+	if got := stderr.String(); got != expected {
+		t.Errorf("Unexpected plan table:\n%s\nwant:\n%s", got, expected)
+	}
+}
+
+func TestEnvCommand_DryRunJSON(t *testing.T) {
+	cmd, stdout, _ := newTestEnvCommand(&fakeResolver{})
+	if err := cmd.Init([]string{"-config-json", dryRunConfig, "-dry-run", "-json", "-require", "SENTRY_DSN"}); err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Unexpected run error: %v", err)
+	}
+
+	var plan []planEntry
+	if err := json.Unmarshal(stdout.Bytes(), &plan); err != nil {
+		t.Fatalf("Failed to parse plan: %v", err)
+	}
+	if len(plan) != 3 || plan[2].Name != "SENTRY_DSN" || plan[2].Optional || plan[2].Target != "stdout" {
+		t.Errorf("Expected SENTRY_DSN to be required by -require and go to stdout, got %+v", plan)
+	}
+	if plan[1].Reference != "" {
+		t.Errorf("Expected no reference for a static value, got %q", plan[1].Reference)
+	}
+}
+
+func TestEnvCommand_JSONRequiresDryRun(t *testing.T) {
+	cmd, _, _ := newTestEnvCommand(&fakeResolver{})
+	if err := cmd.Init([]string{"-config-json", dryRunConfig, "-json"}); err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+	if err := cmd.Run(); err == nil || !strings.Contains(err.Error(), "-json only applies to the -dry-run plan") {
+		t.Errorf("Expected -json without -dry-run to fail, got %v", err)
+	}
+}
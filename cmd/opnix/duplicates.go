@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/brizzbuzz/opnix/internal/errors"
+	"github.com/brizzbuzz/opnix/pkg/env"
+)
+
+// referenceUse is a variable that uses a reference, in the config at source
+type referenceUse struct {
+	name   string
+	source string
+}
+
+func (u referenceUse) String() string {
+	if u.source == "" {
+		return u.name
+	}
+	return fmt.Sprintf("%s (%s)", u.name, u.source)
+}
+
+// referenceUses maps each reference to the variables using it
+type referenceUses map[string][]referenceUse
+
+func (r referenceUses) add(cfg *env.Config, source string) {
+	for _, variable := range cfg.Vars {
+		if variable.Reference != "" {
+			r[variable.Reference] = append(r[variable.Reference], referenceUse{name: variable.Name, source: source})
+		}
+	}
+}
+
+// duplicates returns the references used under more than one variable name,
+// sorted. The same name using the same reference in several configs is the
+// normal case for a batch and is not reported.
+func (r referenceUses) duplicates() []string {
+	var references []string
+	for reference, uses := range r {
+		names := make(map[string]bool, len(uses))
+		for _, use := range uses {
+			names[use.name] = true
+		}
+		if len(names) > 1 {
+			references = append(references, reference)
+		}
+	}
+	sort.Strings(references)
+	return references
+}
+
+// checkDuplicateReferences reports references used by several variables,
+// as warnings or, with -strict, as an error listing them all
+func (e *envCommand) checkDuplicateReferences(uses referenceUses) error {
+	references := uses.duplicates()
+	if len(references) == 0 {
+		return nil
+	}
+
+	lines := make([]string, 0, len(references))
+	for _, reference := range references {
+		names := make([]string, 0, len(uses[reference]))
+		for _, use := range uses[reference] {
+			names = append(names, use.String())
+		}
+		lines = append(lines, fmt.Sprintf("%s is used by %s", reference, strings.Join(names, ", ")))
+	}
+
+	if e.strict {
+		return &errors.OpnixError{
+			Operation: "Checking for duplicate references",
+			Component: "configuration",
+			Issue:     fmt.Sprintf("%d references are used by more than one variable", len(references)),
+			Context:   strings.Join(lines, "\n"),
+			Suggestions: []string{
+				"Point each variable at its own reference if the aliasing is a mistake",
+				"Or drop -strict to only warn when the aliasing is intentional",
+			},
+		}
+	}
+	for _, line := range lines {
+		e.noticef("WARNING: %s\n", line)
+	}
+	return nil
+}
+
+// checkBatchDuplicates loads every -configs file the way each batch job
+// will and checks for references shared across all of them
+func (e *envCommand) checkBatchDuplicates(paths []string) error {
+	environment := e.environment
+	if environment == "" {
+		environment = strings.TrimSpace(os.Getenv("OPNIX_ENV_ENVIRONMENT"))
+	}
+
+	var references map[string]string
+	if e.references != "" {
+		loaded, err := env.LoadReferences(e.references)
+		if err != nil {
+			return err
+		}
+		references = loaded
+	}
+
+	uses := make(referenceUses)
+	for _, path := range paths {
+		cfg, err := e.loadConfig(path)
+		if err != nil {
+			return err
+		}
+		if references != nil {
+			if _, err := cfg.MergeReferences(references, e.references); err != nil {
+				return err
+			}
+		}
+		if cfg, err = cfg.Select(environment); err != nil {
+			return err
+		}
+		if err := cfg.QualifyReferences(e.vault); err != nil {
+			return err
+		}
+		uses.add(cfg, path)
+	}
+	return e.checkDuplicateReferences(uses)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEnvCommand_CheckDuplicates(t *testing.T) {
+	config := `{"defaultVault":"Example","vars":[
+		{"name":"DB_PASSWORD","reference":"Database/password"},
+		{"name":"PGPASSWORD","reference":"op://Example/Database/password"},
+		{"name":"API_TOKEN","reference":"op://Example/API/token"}
+	]}`
+	resolver := &fakeResolver{secrets: map[string]string{
+		"op://Example/Database/password": "test-password",
+		"op://Example/API/token":         "test-token",
+	}}
+
+	cmd, stdout, stderr := newTestEnvCommand(resolver)
+	if err := cmd.Init([]string{"-config-json", config, "-check-duplicates-across-configs"}); err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Unexpected run error: %v", err)
+	}
+	if want := "WARNING: op://Example/Database/password is used by DB_PASSWORD, PGPASSWORD\n"; stderr.String() != want {
+		t.Errorf("Expected %q, got %q", want, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "PGPASSWORD") {
+		t.Errorf("Expected output to be written after the warning, got %q", stdout.String())
+	}
+
+	cmd, stdout, _ = newTestEnvCommand(resolver)
+	if err := cmd.Init([]string{"-config-json", config, "-check-duplicates-across-configs", "-strict"}); err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+	err := cmd.Run()
+	if err == nil || !strings.Contains(err.Error(), "1 references are used by more than one variable") {
+		t.Fatalf("Expected -strict to fail, got %v", err)
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("Expected no output, got %q", stdout.String())
+	}
+}
+
+func TestEnvCommand_CheckDuplicatesAcrossBatch(t *testing.T) {
+	dir := t.TempDir()
+	configs := map[string]string{
+		"api.json":    `{"vars":[{"name":"DB_PASSWORD","reference":"op://Example/Database/password"},{"name":"API_TOKEN","reference":"op://Example/API/token"}]}`,
+		"worker.json": `{"vars":[{"name":"DB_PASSWORD","reference":"op://Example/Database/password"},{"name":"WORKER_TOKEN","reference":"op://Example/API/token"}]}`,
+	}
+	var paths []string
+	for _, name := range []string{"api.json", "worker.json"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(configs[name]), 0600); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+		paths = append(paths, path)
+	}
+
+	resolver := &fakeResolver{secrets: map[string]string{
+		"op://Example/Database/password": "test-password",
+		"op://Example/API/token":         "test-token",
+	}}
+	args := []string{"batch", "-configs", strings.Join(paths, ","), "-check-duplicates-across-configs"}
+
+	cmd, _, stderr := newTestEnvCommand(resolver)
+	if err := cmd.Init(append(args, "-out-dir", filepath.Join(dir, "gen"))); err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Unexpected run error: %v", err)
+	}
+	want := "WARNING: op://Example/API/token is used by API_TOKEN (" + paths[0] + "), WORKER_TOKEN (" + paths[1] + ")\n"
+	if stderr.String() != want {
+		t.Errorf("Expected only the token shared under different names to be reported, got %q", stderr.String())
+	}
+
+	cmd, _, _ = newTestEnvCommand(resolver)
+	if err := cmd.Init(append(args, "-out-dir", filepath.Join(dir, "strict"), "-strict")); err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+	if err := cmd.Run(); err == nil || !strings.Contains(err.Error(), "WORKER_TOKEN") {
+		t.Fatalf("Expected -strict to fail the batch, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "strict", "api.sh")); err == nil {
+		t.Error("Expected no output once -strict rejected the batch")
+	}
+}
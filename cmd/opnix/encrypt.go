@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/brizzbuzz/opnix/internal/errors"
+)
+
+// seal encrypts rendered output to the -encrypt-to recipients, or returns it
+// unchanged when none are given
+func (e *envCommand) seal(output string) (string, error) {
+	if len(e.encryptTo) == 0 {
+		return output, nil
+	}
+	return e.encrypt(e.encryptTo, output)
+}
+
+// ageEncrypt encrypts plaintext to every recipient with the age CLI,
+// producing ASCII-armored output that "age -d" decrypts. The plaintext is
+// passed on stdin so it never appears in the process arguments.
+func ageEncrypt(recipients []string, plaintext string) (string, error) {
+	if _, err := exec.LookPath("age"); err != nil {
+		return "", &errors.OpnixError{
+			Operation: "Encrypting environment output",
+			Component: "age encryption",
+			Issue:     "-encrypt-to requires the age command, which was not found in PATH",
+			Cause:     err,
+			Suggestions: []string{
+				"Install age: https://age-encryption.org",
+				"With Nix: nix shell nixpkgs#age",
+			},
+		}
+	}
+
+	args := []string{"--encrypt", "--armor"}
+	for _, recipient := range recipients {
+		args = append(args, "--recipient", recipient)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("age", args...)
+	cmd.Stdin = strings.NewReader(plaintext)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", &errors.OpnixError{
+			Operation: "Encrypting environment output",
+			Component: "age encryption",
+			Issue:     fmt.Sprintf("age failed: %s", strings.TrimSpace(stderr.String())),
+			Cause:     err,
+			Suggestions: []string{
+				"Check that each -encrypt-to value is an age recipient (age1...) or an SSH public key",
+			},
+		}
+	}
+	return stdout.String(), nil
+}
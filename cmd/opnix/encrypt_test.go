@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEnvCommand_EncryptTo(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bundle.env.age")
+	resolver := &fakeResolver{secrets: map[string]string{"op://Vault/Item/token": "secret-token"}}
+
+	cmd, _, _ := newTestEnvCommand(resolver)
+	var gotRecipients []string
+	cmd.encrypt = func(recipients []string, plaintext string) (string, error) {
+		gotRecipients = recipients
+		return "SEALED(" + plaintext + ")", nil
+	}
+	err := cmd.Init([]string{
+		"-config-json", `{"vars":[{"name":"API_TOKEN","reference":"op://Vault/Item/token"}]}`,
+		"-format", "dotenv",
+		"-encrypt-to", "age1first",
+		"-encrypt-to", "age1second",
+		"-output", path,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Unexpected run error: %v", err)
+	}
+
+	if strings.Join(gotRecipients, ",") != "age1first,age1second" {
+		t.Errorf("Expected both recipients, got %v", gotRecipients)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	if got := string(data); got != "SEALED(API_TOKEN=secret-token\n)" {
+		t.Errorf("Expected only the encrypted output on disk, got %q", got)
+	}
+}
+
+func TestEnvCommand_EncryptToRejectsUpdate(t *testing.T) {
+	cmd, _, _ := newTestEnvCommand(&fakeResolver{})
+	if err := cmd.Init([]string{"-config-json", `{"vars":[{"name":"A","value":"1"}]}`, "-encrypt-to", "age1first", "-update", ".env"}); err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+	if err := cmd.Run(); err == nil || !strings.Contains(err.Error(), "cannot be combined with -update") {
+		t.Errorf("Expected -encrypt-to with -update to fail, got %v", err)
+	}
+}
@@ -0,0 +1,2264 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	stderrors "errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/brizzbuzz/opnix/internal/errors"
+	"github.com/brizzbuzz/opnix/internal/onepass"
+	"github.com/brizzbuzz/opnix/internal/validation"
+	"github.com/brizzbuzz/opnix/pkg/env"
+)
+
+type envCommand struct {
+	fs *flag.FlagSet
+
+	configPath          string
+	ignoreMissingConfig bool
+	tokenFile           string
+	format              string
+
+	configJSON   string
+	environment  string
+	vault        string
+	errorOnEmpty bool
+	trimMode     string
+	require      stringSliceFlag
+	maxSkips     int
+	maxValueSize int
+	normalize    bool
+	retries      int
+	retryBackoff time.Duration
+	timeout      time.Duration
+	allowVaults  stringSliceFlag
+	precheck     bool
+	mask         bool
+	sort         bool
+	check        bool
+	checkAccess  bool
+	updatePath   string
+	basePath     string
+	outputPath   string
+	maskedPath   string
+	outputs      string
+	allowTracked bool
+	fixturesPath string
+	envFile      string
+	verbose      bool
+	redactRefs   bool
+	explain      string
+	printConfig  bool
+	printRefs    bool
+	allowTTY     bool
+	dryRun       bool
+	json         bool
+	placeholder  string
+	createStub   bool
+	bestEffort   bool
+	failuresPath string
+	encryptTo    stringSliceFlag
+	prefix       string
+	basePrefix   bool
+	strict       bool
+	expandEnv    bool
+	strictEnv    bool
+	unusedStatic bool
+	checkDups    bool
+	stdoutOnly   bool
+	fixtures     env.Resolver
+	kvPrefix     string
+	kvSeparator  string
+	quoteStyle   string
+	autoexport   bool
+	reportPath   string
+	auditPath    string
+	allowlist    string
+	references   string
+	timing       bool
+	raw          string
+	newline      bool
+	watch        bool
+	interval     time.Duration
+	onChange     string
+
+	// configSource describes where resolveConfig found the configuration
+	configSource string
+
+	lastFingerprint string
+	changed         bool
+	// lastWritten holds the variable names in the last output watch mode wrote
+	lastWritten map[string]bool
+
+	summary runSummary
+
+	// audit records reference lookups while a run with -audit-log is in progress
+	audit *auditLog
+	// stats collects resolver latencies while a run with -timing is in progress
+	stats *timingStats
+
+	// example is set when running "opnix env example"
+	example *envExampleCommand
+	// diffRefs is set when running "opnix env diff-refs"
+	diffRefs *envDiffRefsCommand
+	// k8s is set when running "opnix env k8s-secret"
+	k8s *k8sSecretOptions
+	// exec is set when running "opnix env exec"
+	exec *execOptions
+	// toVault is set when running "opnix env to-vault"
+	toVault *toVaultOptions
+	// batch is set when running "opnix env batch"
+	batch *batchOptions
+	// outputStem is the output path, without its extension, of one config in a batch
+	outputStem string
+	// pool shares resolvers between the configs of a batch
+	pool *resolverPool
+
+	stdout io.Writer
+	stderr io.Writer
+
+	loadConfig       func(string) (*env.Config, error)
+	parseConfig      func(string) (*env.Config, error)
+	newClient        func(string) (env.Resolver, error)
+	newAccountClient func(env.Account) (env.Resolver, error)
+	runHook          func(ctx context.Context, command string) error
+	runChild         func(argv, environ []string) error
+	gitUnignored     func(path string) (bool, error)
+	chown            func(path string, uid, gid int) error
+	encrypt          func(recipients []string, plaintext string) (string, error)
+	isTerminal       func(w io.Writer) bool
+}
+
+// stringSliceFlag collects repeated occurrences of a flag
+type stringSliceFlag []string
+
+func (s *stringSliceFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringSliceFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+func newEnvCommand() *envCommand {
+	cmd := &envCommand{
+		fs:     flag.NewFlagSet("env", flag.ExitOnError),
+		stdout: os.Stdout,
+		stderr: os.Stderr,
+	}
+
+	cmd.fs.StringVar(&cmd.configPath, "config", "", "Path to environment configuration file")
+	cmd.fs.StringVar(&cmd.configJSON, "config-json", "", "Inline environment configuration as JSON")
+	cmd.fs.StringVar(&cmd.references, "references", "", "Path to a JSON or YAML map of variable names to references merged into the configuration's shared vars")
+	cmd.fs.StringVar(&cmd.environment, "environment", "", "Named environment block to layer over the shared vars")
+	cmd.fs.StringVar(&cmd.vault, "vault", "", "Default vault for short Item/field references (overrides defaultVault)")
+	cmd.fs.BoolVar(&cmd.ignoreMissingConfig, "ignore-missing-config", false, "Produce empty output instead of an error when the -config file does not exist")
+	cmd.fs.BoolVar(&cmd.verbose, "verbose", false, "Print notices about how the configuration was interpreted to stderr")
+	cmd.fs.BoolVar(&cmd.allowTTY, "allow-tty", false, "Print secret values even when stdout is an interactive terminal")
+	cmd.fs.BoolVar(&cmd.printRefs, "print-references", false, "Print the sorted, deduplicated 1Password references a run would resolve, without resolving them")
+	cmd.fs.BoolVar(&cmd.printConfig, "print-config", false, "Print the effective configuration as JSON, after environments, prefixes, and default vaults are applied, without resolving any secrets")
+	cmd.fs.BoolVar(&cmd.dryRun, "dry-run", false, "Print a table of each variable's reference, target, and whether it is optional to stderr, without resolving anything")
+	cmd.fs.BoolVar(&cmd.json, "json", false, "With -dry-run, print the plan as JSON on stdout instead of a table")
+	cmd.fs.StringVar(&cmd.explain, "explain", "", "Resolve, then report where the named variable's value came from instead of printing output")
+	cmd.fs.BoolVar(&cmd.redactRefs, "redact-references", false, "Mask the item name of references in warnings, notices, and errors, keeping the vault visible")
+	cmd.fs.BoolVar(&cmd.strict, "strict", false, "Treat ambiguous configuration, such as conflicting formats, as an error")
+	cmd.fs.BoolVar(&cmd.expandEnv, "expand-env", false, "Expand $VAR and ${VAR} in variable references from the environment")
+	cmd.fs.BoolVar(&cmd.strictEnv, "strict-env", false, "Like -expand-env, but fail when a variable is not set")
+	cmd.fs.BoolVar(&cmd.checkDups, "check-duplicates-across-configs", false, "Warn about every reference used by more than one variable, across all -configs in a batch; an error with -strict")
+	cmd.fs.BoolVar(&cmd.unusedStatic, "warn-unused-static", false, "Warn about every variable that still uses a static value instead of a reference; an error with -strict")
+	cmd.fs.StringVar(&cmd.envFile, "env-file", "", "Dotenv file that env://NAME references are read from before the process environment")
+	cmd.fs.StringVar(&cmd.fixturesPath, "fixtures", "", "Resolve references from a JSON map of reference to value instead of 1Password (or set OPNIX_FIXTURES)")
+	cmd.fs.StringVar(&cmd.tokenFile, "token-file", defaultTokenPath, "Path to file containing 1Password service account token")
+	cmd.fs.StringVar(&cmd.format, "format", "", "Output format: "+strings.Join(supportedFormats, ", ")+" (default shell)")
+	cmd.fs.BoolVar(&cmd.errorOnEmpty, "error-on-empty", false, "Treat references that resolve to an empty value as errors")
+	cmd.fs.StringVar(&cmd.trimMode, "trim-mode", string(env.TrimFull), "Default whitespace trimming for values: "+strings.Join(env.TrimModes, ", "))
+	cmd.fs.BoolVar(&cmd.normalize, "normalize-newlines", false, "Convert CRLF and CR line endings in values to LF, after trimming")
+	cmd.fs.Var(&cmd.require, "require", "Treat the named variable as required for this run (repeatable)")
+	cmd.fs.IntVar(&cmd.retries, "retries", 0, "Retry failed 1Password lookups up to N times with exponential backoff")
+	cmd.fs.DurationVar(&cmd.retryBackoff, "retry-backoff", time.Second, "Wait before the first retry, doubling for each retry after it")
+	cmd.fs.DurationVar(&cmd.timeout, "timeout", 0, "Abort resolution, including retries, once this much time has passed (0 disables)")
+	cmd.fs.StringVar(&cmd.placeholder, "placeholder-on-missing", "", "Substitute this string for references that fail to resolve, with a warning, instead of failing or skipping")
+	cmd.fs.BoolVar(&cmd.createStub, "create-stub", false, "Print the op item create or op item edit command that would make each not-found reference resolvable; nothing is created")
+	cmd.fs.BoolVar(&cmd.bestEffort, "best-effort", false, "Write the variables that resolved even when required ones fail, then exit non-zero listing the failures")
+	cmd.fs.StringVar(&cmd.failuresPath, "failures-report", "", "With -best-effort, write a JSON list of the variables that failed to resolve (no values) to this path")
+	cmd.fs.IntVar(&cmd.maxValueSize, "max-value-size", 0, "Fail when a resolved value is larger than N bytes; 0 disables the limit")
+	cmd.fs.IntVar(&cmd.maxSkips, "max-skips", -1, "Fail when more than N optional variables are skipped; -1 allows any number")
+	cmd.fs.StringVar(&cmd.prefix, "prefix", "", "Prepend this prefix to every variable name in the output")
+	cmd.fs.BoolVar(&cmd.basePrefix, "env-prefix-from-file-basename", false, "Prefix every variable name with the -config file's basename (service-a.json becomes SERVICE_A_)")
+	cmd.fs.StringVar(&cmd.kvPrefix, "kv-prefix", "", "Key namespace prepended to each key in kv format")
+	cmd.fs.StringVar(&cmd.kvSeparator, "kv-separator", " ", "Separator between key and value in kv format")
+	cmd.fs.StringVar(&cmd.quoteStyle, "quote-style", string(quoteAuto), "Quoting for dotenv values: "+strings.Join(quoteStyles, ", "))
+	cmd.fs.BoolVar(&cmd.autoexport, "shell-autoexport", false, "Wrap shell output in set -a / set +a and emit plain KEY=value assignments instead of export lines")
+	cmd.fs.StringVar(&cmd.raw, "raw", "", "Resolve only the named variable and print its bare value")
+	cmd.fs.BoolVar(&cmd.newline, "newline", false, "Append a trailing newline to -raw output")
+	cmd.fs.BoolVar(&cmd.watch, "watch", false, "Keep running and re-resolve every -interval, writing output only when it changes")
+	cmd.fs.DurationVar(&cmd.interval, "interval", 5*time.Minute, "Time between re-resolutions in -watch mode; setting it enables -watch")
+	cmd.fs.StringVar(&cmd.onChange, "onchange", "", "Shell command to run after output changes in -watch or -interval mode")
+	cmd.fs.StringVar(&cmd.auditPath, "audit-log", "", "Append a JSON line per reference lookup (no values) to this file, created with 0600 permissions")
+	cmd.fs.BoolVar(&cmd.timing, "timing", false, "Print a summary of resolution latencies and cache hits (no values) to stderr after each run")
+	cmd.fs.StringVar(&cmd.reportPath, "report", "", "Write a JSON run summary (no values) to this path on success")
+	cmd.fs.StringVar(&cmd.outputPath, "output", "", "Write rendered output to a file with 0600 permissions instead of stdout")
+	cmd.fs.BoolVar(&cmd.stdoutOnly, "stdout-only", false, "Refuse every flag that writes files, so output can only go to stdout")
+	cmd.fs.StringVar(&cmd.outputs, "outputs", "", "Comma-separated path:format pairs to write from a single resolution (e.g. app.env:dotenv,app.json:json)")
+	cmd.fs.Var(&cmd.encryptTo, "encrypt-to", "Encrypt rendered output to this age recipient before writing it (repeatable; requires the age command)")
+	cmd.fs.BoolVar(&cmd.allowTracked, "allow-tracked", false, "Allow writing resolved output to a path inside a git repository that is not gitignored")
+	cmd.fs.StringVar(&cmd.maskedPath, "masked-output", "", "Also write a copy of the output with secret values masked")
+	cmd.fs.StringVar(&cmd.basePath, "base", "", "Dotenv file whose values are passed through underneath resolved variables")
+	cmd.fs.StringVar(&cmd.updatePath, "update", "", "Merge managed variables into an existing dotenv file instead of printing them")
+	cmd.fs.Var(&cmd.allowVaults, "allow-vault", "Only allow references to the named vault (repeatable)")
+	cmd.fs.StringVar(&cmd.allowlist, "allowlist", "", "File listing the references or glob patterns the configuration may use; anything else fails before resolving")
+	cmd.fs.BoolVar(&cmd.checkAccess, "check-access", false, "Verify the token can access every referenced vault before resolving")
+	cmd.fs.BoolVar(&cmd.precheck, "precheck", false, "Verify all required references exist before resolving any of them")
+	cmd.fs.BoolVar(&cmd.mask, "mask", false, "Replace secret values with a mask in the output")
+	cmd.fs.BoolVar(&cmd.sort, "sort", true, "Sort variables by name; use -sort=false to keep configuration order")
+	cmd.fs.BoolVar(&cmd.check, "check", false, "Compare resolved values against expectedSha256 instead of printing them")
+
+	cmd.fs.Usage = func() {
+		fmt.Fprintf(cmd.fs.Output(), "Usage: opnix env [options]\n")
+		fmt.Fprintf(cmd.fs.Output(), "       opnix env example [options]\n")
+		fmt.Fprintf(cmd.fs.Output(), "       opnix env diff-refs [options] OLD NEW\n")
+		fmt.Fprintf(cmd.fs.Output(), "       opnix env k8s-secret -name NAME [-namespace NAMESPACE] [options]\n")
+		fmt.Fprintf(cmd.fs.Output(), "       opnix env exec [-clear-env] [options] -- COMMAND [ARGS...]\n")
+		fmt.Fprintf(cmd.fs.Output(), "       opnix env to-vault -path MOUNT/PATH [-dry-run] [options]\n")
+		fmt.Fprintf(cmd.fs.Output(), "       opnix env batch -configs FILE[,FILE...] -out-dir DIR [-jobs N] [options]\n\n")
+		fmt.Fprintf(cmd.fs.Output(), "Resolve environment variables from 1Password references\n\n")
+		fmt.Fprintf(cmd.fs.Output(), "Options:\n")
+		cmd.fs.PrintDefaults()
+	}
+
+	cmd.loadConfig = func(path string) (*env.Config, error) {
+		cfg, err := env.Load(path)
+		if err != nil {
+			return nil, err
+		}
+		return cmd.expandReferences(cfg, path)
+	}
+	cmd.parseConfig = func(raw string) (*env.Config, error) {
+		cfg, err := env.ParseString(raw)
+		if err != nil {
+			return nil, err
+		}
+		return cmd.expandReferences(cfg, "inline configuration")
+	}
+	cmd.newClient = func(path string) (env.Resolver, error) {
+		return onepass.NewClient(path)
+	}
+	cmd.newAccountClient = newEnvAccountClient
+	cmd.runHook = cmd.runShellHook
+	cmd.runChild = cmd.runChildProcess
+	cmd.gitUnignored = pathUnignoredInGit
+	cmd.chown = os.Chown
+	cmd.encrypt = ageEncrypt
+	cmd.isTerminal = isTerminalWriter
+
+	return cmd
+}
+
+func (e *envCommand) Name() string { return e.fs.Name() }
+
+func (e *envCommand) Flags() *flag.FlagSet { return e.fs }
+
+// subcommandFlags returns the flag set of each env subcommand, registered by
+// the same functions Init uses, so completions offer their flags too
+func (e *envCommand) subcommandFlags() map[string]*flag.FlagSet {
+	flagSets := map[string]*flag.FlagSet{
+		"example":   newEnvExampleCommand(newEnvCommand()).fs,
+		"diff-refs": newEnvDiffRefsCommand(newEnvCommand()).fs,
+	}
+	for name, register := range map[string]func(*envCommand){
+		"batch":      (*envCommand).registerBatchFlags,
+		"exec":       (*envCommand).registerExecFlags,
+		"k8s-secret": (*envCommand).registerK8sSecretFlags,
+		"to-vault":   (*envCommand).registerToVaultFlags,
+	} {
+		sub := newEnvCommand()
+		register(sub)
+		flagSets[name] = sub.fs
+	}
+	return flagSets
+}
+
+func (e *envCommand) Init(args []string) error {
+	if len(args) > 0 && args[0] == "example" {
+		e.example = newEnvExampleCommand(e)
+		return e.example.Init(args[1:])
+	}
+	if len(args) > 0 && args[0] == "diff-refs" {
+		e.diffRefs = newEnvDiffRefsCommand(e)
+		return e.diffRefs.Init(args[1:])
+	}
+	if len(args) > 0 && args[0] == "k8s-secret" {
+		return e.initK8sSecret(args[1:])
+	}
+	if len(args) > 0 && args[0] == "exec" {
+		return e.initExec(args[1:])
+	}
+	if len(args) > 0 && args[0] == "to-vault" {
+		return e.initToVault(args[1:])
+	}
+	if len(args) > 0 && args[0] == "batch" {
+		return e.initBatch(args[1:])
+	}
+	e.fs.SetOutput(e.stderr)
+	return e.fs.Parse(args)
+}
+
+func (e *envCommand) Run() (err error) {
+	if e.example != nil {
+		return e.example.Run()
+	}
+	if e.diffRefs != nil {
+		return e.diffRefs.Run()
+	}
+	if e.redactRefs {
+		defer func() { err = redactError(err) }()
+	}
+
+	// An explicit -interval asks for periodic re-resolution on its own
+	e.fs.Visit(func(f *flag.Flag) {
+		if f.Name == "interval" {
+			e.watch = true
+		}
+	})
+	if e.onChange != "" && !e.watch {
+		return errors.ConfigValidationError(
+			"env.onchange",
+			e.onChange,
+			"The -onchange hook requires -watch",
+			[]string{"Add -watch or -interval to re-resolve periodically and run the hook on changes"},
+		)
+	}
+	if e.watch && e.interval <= 0 {
+		return errors.ConfigValidationError(
+			"env.interval",
+			e.interval.String(),
+			"The refresh interval must be positive",
+			[]string{"Pass a duration such as -interval 30s or -interval 5m"},
+		)
+	}
+	if err := e.checkStdoutOnly(); err != nil {
+		return err
+	}
+	if e.batch != nil {
+		return e.runBatch()
+	}
+	if e.watch {
+		return e.watchLoop()
+	}
+
+	start := time.Now()
+	if err := e.run(); err != nil {
+		return err
+	}
+
+	if e.reportPath == "" {
+		return nil
+	}
+	e.summary.DurationMillis = time.Since(start).Milliseconds()
+	return e.writeReport()
+}
+
+func (e *envCommand) run() (err error) {
+	e.summary = runSummary{}
+
+	cfg, err := e.resolveConfig()
+	if err != nil {
+		return err
+	}
+	if cfg != nil && e.references != "" {
+		if err := e.mergeReferences(cfg); err != nil {
+			return err
+		}
+	}
+	loaded := cfg
+
+	if e.environment == "" {
+		e.environment = strings.TrimSpace(os.Getenv("OPNIX_ENV_ENVIRONMENT"))
+	}
+	if cfg == nil {
+		// A missing config ignored by -ignore-missing-config renders empty output
+		cfg = &env.Config{}
+	} else {
+		cfg, err = cfg.Select(e.environment)
+		if err != nil {
+			return err
+		}
+	}
+
+	prefix, err := e.variablePrefix()
+	if err != nil {
+		return err
+	}
+
+	var explained *variableExplanation
+	if e.explain != "" {
+		if explained, err = e.explainEntry(loaded, prefix); err != nil {
+			return err
+		}
+	}
+
+	if err := cfg.QualifyReferences(e.vault); err != nil {
+		return err
+	}
+
+	if e.checkDups {
+		uses := make(referenceUses)
+		uses.add(cfg, "")
+		if err := e.checkDuplicateReferences(uses); err != nil {
+			return err
+		}
+	}
+
+	if e.raw != "" {
+		cfg, err = selectRawVariable(cfg, e.raw)
+		if err != nil {
+			return err
+		}
+	}
+
+	if cfg, err = cfg.WithPrefix(prefix); err != nil {
+		return err
+	}
+
+	if e.allowlist != "" {
+		allowlist, err := validation.LoadReferenceAllowlist(e.allowlist)
+		if err != nil {
+			return err
+		}
+		if err := cfg.CheckAllowlist(allowlist); err != nil {
+			return err
+		}
+	}
+
+	if e.unusedStatic {
+		if err := e.checkStaticValues(cfg); err != nil {
+			return err
+		}
+	}
+
+	format, err := e.selectFormat(cfg)
+	if err != nil {
+		return err
+	}
+	if e.exec != nil {
+		if err := e.checkExec(); err != nil {
+			return err
+		}
+	}
+	if e.toVault != nil {
+		if err := e.checkToVault(); err != nil {
+			return err
+		}
+	}
+	if len(e.encryptTo) > 0 && (e.updatePath != "" || e.exec != nil || e.toVault != nil) {
+		return errors.ConfigValidationError(
+			"env.encrypt-to",
+			e.encryptTo.String(),
+			"-encrypt-to encrypts rendered output, so it cannot be combined with -update, exec, or to-vault",
+			[]string{"Write the encrypted output with -output or to stdout instead"},
+		)
+	}
+	if e.k8s != nil {
+		if err := e.checkK8sSecret(); err != nil {
+			return err
+		}
+		format = k8sSecretFormat
+	} else if !isSupportedFormat(format) {
+		return errors.ConfigValidationError(
+			"env.format",
+			format,
+			"Unsupported format specified",
+			[]string{
+				"Use one of: " + strings.Join(supportedFormats, ", "),
+				"Example: opnix env -format shell",
+			},
+		)
+	}
+	if e.outputStem != "" {
+		extension, ok := batchExtensions[format]
+		if !ok {
+			return errors.ConfigValidationError(
+				"env.format",
+				format,
+				fmt.Sprintf("Format %s does not write output, so it cannot be used with env batch", format),
+				[]string{"Choose a format that writes values, such as dotenv or json"},
+			)
+		}
+		e.outputPath = e.outputStem + extension
+	}
+	if format == "none" {
+		if err := e.checkConflicts(
+			"env.format",
+			format,
+			"Format none resolves without writing output",
+			[]string{"-raw", "-update", "-output", "-outputs", "-masked-output"},
+			"Choose a concrete format to write output",
+		); err != nil {
+			return err
+		}
+	}
+	if format == statusJSONFormat {
+		if err := e.checkConflicts(
+			"env.format",
+			format,
+			"Format status-json reports outcomes on stdout instead of values",
+			[]string{"-raw", "-update", "-output", "-outputs", "-masked-output", "-check", "-watch"},
+			"Run opnix env -format status-json separately from the command that writes output",
+		); err != nil {
+			return err
+		}
+	}
+	if e.bestEffort && (format == statusJSONFormat || e.watch) {
+		return errors.ConfigValidationError(
+			"env.best-effort",
+			"true",
+			"-best-effort cannot be combined with -format status-json or -watch",
+			[]string{"Use -format status-json on its own to report every variable's outcome"},
+		)
+	}
+	if e.failuresPath != "" && !e.bestEffort {
+		return errors.ConfigValidationError(
+			"env.failures-report",
+			e.failuresPath,
+			"-failures-report requires -best-effort",
+			[]string{"Add -best-effort to write the variables that resolved and report the ones that failed"},
+		)
+	}
+	if e.explain != "" {
+		if err := e.checkConflicts(
+			"env.explain",
+			e.explain,
+			"-explain reports provenance instead of writing output",
+			[]string{"-raw", "-update", "-output", "-outputs", "-masked-output", "-check", "-watch"},
+			"Run opnix env -explain separately from the command that writes output",
+		); err != nil {
+			return err
+		}
+	}
+	if e.printConfig {
+		if err := e.checkConflicts(
+			"env.print-config",
+			"true",
+			"-print-config prints the configuration instead of resolving it",
+			[]string{"-explain", "-update", "-output", "-outputs", "-masked-output", "-report", "-check", "-watch", "k8s-secret"},
+			"Run opnix env -print-config separately from the command that writes output",
+		); err != nil {
+			return err
+		}
+		return e.writeEffectiveConfig(cfg, format)
+	}
+	if e.printRefs {
+		if err := e.checkConflicts(
+			"env.print-references",
+			"true",
+			"-print-references lists references instead of resolving them",
+			[]string{"-explain", "-update", "-output", "-outputs", "-masked-output", "-report", "-check", "-watch", "-dry-run", "k8s-secret"},
+			"Run opnix env -print-references separately from the command that writes output",
+		); err != nil {
+			return err
+		}
+		return e.writeReferences(cfg)
+	}
+	if e.json && (!e.dryRun || e.toVault != nil) {
+		return errors.ConfigValidationError(
+			"env.json",
+			"true",
+			"-json only applies to the -dry-run plan",
+			[]string{"Add -dry-run to print the plan as JSON", "Use -format json to print resolved values as JSON"},
+		)
+	}
+	if e.dryRun && e.toVault == nil {
+		if err := e.checkConflicts(
+			"env.dry-run",
+			"true",
+			"-dry-run prints a plan instead of resolving",
+			[]string{"-explain", "-check", "-watch"},
+			"Run opnix env -dry-run separately from the command that resolves",
+		); err != nil {
+			return err
+		}
+		return e.writeDryRunPlan(cfg, format, prefix)
+	}
+	if err := e.checkTerminalOutput(cfg, format); err != nil {
+		return err
+	}
+	e.summary.Format = format
+	e.summary.Environment = e.environment
+
+	targets, err := parseOutputTargets(e.outputs)
+	if err != nil {
+		return err
+	}
+	if len(targets) > 0 && (e.raw != "" || e.updatePath != "") {
+		return errors.ConfigValidationError(
+			"env.outputs",
+			e.outputs,
+			"-outputs cannot be combined with -raw or -update",
+			[]string{"Run opnix env separately for each mode"},
+		)
+	}
+
+	trimMode, err := env.ParseTrimMode(e.trimMode)
+	if err != nil {
+		return err
+	}
+	if _, err := parseQuoteStyle(e.quoteStyle); err != nil {
+		return err
+	}
+
+	if err := e.loadFixtures(); err != nil {
+		return err
+	}
+
+	if e.auditPath != "" && e.audit == nil {
+		audit, err := openAuditLog(e.auditPath)
+		if err != nil {
+			return err
+		}
+		e.audit = audit
+		defer func() {
+			e.audit = nil
+			if closeErr := audit.close(); err == nil {
+				err = closeErr
+			}
+		}()
+	}
+
+	if e.timing && e.stats == nil {
+		stats := &timingStats{}
+		e.stats = stats
+		defer func() {
+			e.stats = nil
+			stats.write(e.stderr)
+		}()
+	}
+
+	resolver, err := e.buildResolver(cfg)
+	if err != nil {
+		return err
+	}
+
+	accounts, err := e.buildAccountResolvers(cfg)
+	if err != nil {
+		return err
+	}
+
+	processor := env.NewProcessor(resolver)
+	processor.Accounts = accounts
+	processor.ErrorOnEmpty = e.errorOnEmpty
+	processor.TrimMode = trimMode
+	processor.NormalizeNewlines = e.normalize
+	processor.AllowedVaults = e.allowVaults
+	processor.MissingPlaceholder = e.placeholder
+	processor.MaxValueSize = e.maxValueSize
+	processor.CollectFailures = format == statusJSONFormat || e.createStub || e.bestEffort
+	for _, name := range e.require {
+		processor.Required[prefix+name] = true
+	}
+	if e.raw != "" {
+		processor.Required[e.raw] = true
+	}
+
+	if e.checkAccess {
+		if err := processor.CheckAccess(cfg); err != nil {
+			return err
+		}
+	}
+
+	if e.precheck {
+		if err := processor.PrecheckConfig(cfg); err != nil {
+			return err
+		}
+	}
+
+	interrupts := watchInterrupts(context.Background())
+	defer interrupts.stop()
+
+	ctx := interrupts.ctx
+	if e.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.timeout)
+		defer cancel()
+	}
+
+	result, err := processor.ProcessContext(ctx, cfg)
+	if err != nil {
+		if stderrors.Is(err, context.DeadlineExceeded) {
+			err = &errors.OpnixError{
+				Operation: "Resolving environment variables",
+				Component: "environment variable resolution",
+				Issue:     fmt.Sprintf("Resolution did not finish within -timeout %s", e.timeout),
+				Cause:     err,
+				Suggestions: []string{
+					"Increase -timeout",
+					"Check connectivity to 1Password",
+				},
+			}
+		}
+		return interrupts.err(err)
+	}
+	if e.createStub {
+		e.writeCreateStubs(cfg, result)
+		if len(result.Failed) > 0 && format != statusJSONFormat && !e.bestEffort {
+			return failedVariablesError(result, "Run the printed op commands, then resolve again")
+		}
+	}
+
+	e.summary.Resolved = len(result.Values) - len(result.Placeholders)
+	e.summary.Skipped = len(result.Skipped)
+	for _, skipped := range result.Skipped {
+		e.noticef("WARNING: Skipped optional env var %s: %v\n", skipped.Name, skipped.Err)
+		e.summary.SkippedVariables = append(e.summary.SkippedVariables, skipped.Name)
+	}
+	for _, missing := range result.Placeholders {
+		e.noticef("WARNING: Using placeholder for env var %s: %v\n", missing.Name, missing.Err)
+		e.summary.PlaceholderVariables = append(e.summary.PlaceholderVariables, missing.Name)
+	}
+	if e.bestEffort {
+		if err := e.reportBestEffortFailures(cfg, result); err != nil {
+			return err
+		}
+		if len(result.Failed) > 0 {
+			// The successes are still written; the failures fail the run afterwards
+			defer func() {
+				if err == nil {
+					err = failedVariablesError(result, "The variables that resolved were written; fix the failed references and run again")
+				}
+			}()
+		}
+	}
+	if e.maxSkips >= 0 && len(result.Skipped) > e.maxSkips {
+		return &errors.OpnixError{
+			Operation: "Resolving environment variables",
+			Component: "environment variable resolution",
+			Issue:     fmt.Sprintf("%d optional variables were skipped, more than the -max-skips limit of %d", len(result.Skipped), e.maxSkips),
+			Context:   fmt.Sprintf("Skipped: %s", strings.Join(e.summary.SkippedVariables, ", ")),
+			Suggestions: []string{
+				"Check that the token and -vault point at the intended vault",
+				"Run with -check-access to confirm the token can read every referenced vault",
+			},
+		}
+	}
+
+	if explained != nil {
+		e.summary.Output = "explain"
+		return e.writeExplanation(e.stdout, explained, cfg, result)
+	}
+
+	if e.check {
+		e.summary.Output = "check"
+		return e.reportHashCheck(cfg, result)
+	}
+
+	if format == statusJSONFormat {
+		e.summary.Output = statusJSONFormat
+		return e.writeStatusJSON(cfg, result)
+	}
+
+	// Format none is a smoke test: every required reference resolved, so
+	// report the counts and discard the values
+	if format == "none" {
+		fmt.Fprintf(e.stderr, "Resolved %d variables, skipped %d optional\n", len(result.Values), len(result.Skipped))
+		e.summary.Output = "none"
+		return nil
+	}
+
+	values := result.Values
+	if e.mask {
+		values = maskSecretValues(values, cfg.Vars)
+	}
+
+	var order []string
+	if !e.sort {
+		order = make([]string, 0, len(cfg.Vars))
+		for _, variable := range cfg.Vars {
+			order = append(order, variable.Name)
+		}
+	}
+
+	if e.basePath != "" {
+		baseValues, baseOrder, err := loadBaseDotenv(e.basePath)
+		if err != nil {
+			return err
+		}
+		values, order = layerValues(baseValues, baseOrder, values, order)
+	}
+
+	if e.exec != nil {
+		e.summary.Output = "exec"
+		return e.runExec(values)
+	}
+	if e.toVault != nil {
+		e.summary.Output = "to-vault"
+		return e.runToVault(values, cfg.Vars)
+	}
+
+	// In watch mode, unchanged values are not written again
+	fingerprint := valuesFingerprint(values)
+	e.changed = fingerprint != e.lastFingerprint
+	if e.watch && !e.changed {
+		return nil
+	}
+	if e.watch {
+		if err := e.checkDroppedVariables(result.Skipped, values); err != nil {
+			return err
+		}
+		// Only a successful write becomes the baseline for the next refresh,
+		// so a failed write is retried even if the values stay the same
+		defer func() {
+			if err == nil {
+				e.lastFingerprint = fingerprint
+				e.lastWritten = make(map[string]bool, len(values))
+				for name := range values {
+					e.lastWritten[name] = true
+				}
+			}
+		}()
+	}
+
+	if e.raw != "" {
+		output := values[e.raw]
+		if e.newline {
+			output += "\n"
+		}
+		if output, err = e.seal(output); err != nil {
+			return err
+		}
+		if e.outputPath != "" {
+			if err := e.checkUntracked(e.outputPath); err != nil {
+				return err
+			}
+			e.summary.Output = e.outputPath
+			return e.writeSecretFile(cfg, e.outputPath, output)
+		}
+		fmt.Fprint(e.stdout, output)
+		e.summary.Output = "stdout"
+		return nil
+	}
+
+	if e.updatePath != "" {
+		if err := rejectArrays(outputKeys(values, order), "dotenv", e.renderOptions(cfg)); err != nil {
+			return err
+		}
+		if err := e.checkUntracked(e.updatePath); err != nil {
+			return err
+		}
+		// A files entry sets the owner and group; its mode replaces the
+		// existing file's only when one is configured
+		options := cfg.FileOptionsFor(e.updatePath)
+		chown, err := e.fileChown(e.updatePath, options)
+		if err != nil {
+			return err
+		}
+		var mode os.FileMode
+		if options.Mode != "" {
+			mode = options.FileMode()
+		}
+		update, err := writeDotenvUpdate(e.updatePath, values, outputKeys(values, order), quoteStyle(e.quoteStyle), mode, chown)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(e.stderr, "Updated %d and added %d variables in %s\n", update.updated, update.added, e.updatePath)
+		e.summary.Output = e.updatePath
+		return nil
+	}
+
+	if e.maskedPath != "" {
+		masked, err := renderOutput(maskSecretValues(values, cfg.Vars), order, format, e.renderOptions(cfg))
+		if err != nil {
+			return err
+		}
+		if err := writeOutputFile(e.maskedPath, masked, 0644); err != nil {
+			return err
+		}
+	}
+
+	if e.outputPath != "" {
+		targets = append(targets, outputTarget{path: e.outputPath, format: format})
+	}
+	if len(targets) > 0 {
+		return e.writeOutputTargets(cfg, targets, values, order, e.renderOptions(cfg))
+	}
+
+	output, err := renderOutput(values, order, format, e.renderOptions(cfg))
+	if err != nil {
+		return err
+	}
+	if output, err = e.seal(output); err != nil {
+		return err
+	}
+
+	fmt.Fprint(e.stdout, output)
+	e.summary.Output = "stdout"
+	return nil
+}
+
+// outputTarget is one file written by -outputs
+type outputTarget struct {
+	path   string
+	format string
+}
+
+// parseOutputTargets parses a comma-separated list of path:format pairs. The
+// format follows the last colon, so paths may contain colons.
+func parseOutputTargets(spec string) ([]outputTarget, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+
+	var targets []outputTarget
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		idx := strings.LastIndex(entry, ":")
+		if idx <= 0 || idx == len(entry)-1 {
+			return nil, errors.ConfigValidationError(
+				"env.outputs",
+				entry,
+				"Output entries must use the form path:format",
+				[]string{"Example: -outputs app.env:dotenv,app.json:json"},
+			)
+		}
+
+		target := outputTarget{path: entry[:idx], format: strings.ToLower(entry[idx+1:])}
+		if !isSupportedFormat(target.format) || target.format == "none" || target.format == statusJSONFormat {
+			return nil, errors.ConfigValidationError(
+				"env.outputs",
+				entry,
+				"Unsupported format specified",
+				[]string{"Use one of: " + strings.Join(supportedFormats, ", ")},
+			)
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+// writeOutputTargets renders every target before writing any of them, so a
+// rendering failure never leaves the files out of sync
+func (e *envCommand) writeOutputTargets(cfg *env.Config, targets []outputTarget, values map[string]string, order []string, opts renderOptions) error {
+	rendered := make([]string, len(targets))
+	for i, target := range targets {
+		output, err := renderOutput(values, order, target.format, opts)
+		if err != nil {
+			return err
+		}
+		if output, err = e.seal(output); err != nil {
+			return err
+		}
+		rendered[i] = output
+	}
+
+	paths := make([]string, 0, len(targets))
+	for _, target := range targets {
+		if err := e.checkUntracked(target.path); err != nil {
+			return err
+		}
+	}
+	for i, target := range targets {
+		if err := e.writeSecretFile(cfg, target.path, rendered[i]); err != nil {
+			return err
+		}
+		paths = append(paths, target.path)
+	}
+	e.summary.Output = strings.Join(paths, ",")
+	return nil
+}
+
+// checkUntracked refuses to write resolved secrets where git would pick them
+// up, unless -allow-tracked is set
+func (e *envCommand) checkUntracked(path string) error {
+	if e.allowTracked {
+		return nil
+	}
+
+	unignored, err := e.gitUnignored(path)
+	if err != nil || !unignored {
+		return err
+	}
+
+	return errors.ConfigValidationError(
+		"env.output",
+		path,
+		"Output path is inside a git repository and is not gitignored",
+		[]string{
+			fmt.Sprintf("Add '%s' to .gitignore so resolved secrets are never committed", filepath.Base(path)),
+			"Or pass -allow-tracked to write the file anyway",
+		},
+	)
+}
+
+// variablePrefix returns the prefix for variable names from -prefix or
+// -env-prefix-from-file-basename. It runs after resolveConfig so the config
+// path is known.
+func (e *envCommand) variablePrefix() (string, error) {
+	if !e.basePrefix {
+		if e.prefix != "" && e.raw != "" {
+			return "", errors.ConfigValidationError(
+				"env.prefix",
+				e.prefix,
+				"-raw prints a bare value, so a name prefix has no effect",
+				[]string{"Remove -prefix when using -raw"},
+			)
+		}
+		return e.prefix, nil
+	}
+
+	switch {
+	case e.prefix != "":
+		return "", errors.ConfigValidationError(
+			"env.prefix",
+			e.prefix,
+			"-prefix and -env-prefix-from-file-basename cannot be combined",
+			[]string{"Choose one way to set the prefix"},
+		)
+	case e.raw != "":
+		return "", errors.ConfigValidationError(
+			"env.prefix",
+			e.configPath,
+			"-raw prints a bare value, so a name prefix has no effect",
+			[]string{"Remove -env-prefix-from-file-basename when using -raw"},
+		)
+	case strings.TrimSpace(e.configJSON) != "" || strings.TrimSpace(e.configPath) == "":
+		return "", errors.ConfigValidationError(
+			"env.prefix",
+			"<inline>",
+			"-env-prefix-from-file-basename needs a configuration file to name the prefix after",
+			[]string{"Pass the configuration with -config <file>", "Or set the prefix directly with -prefix"},
+		)
+	}
+	return env.PrefixFromPath(e.configPath), nil
+}
+
+// noticef writes a diagnostic line to stderr, masking reference item names
+// when -redact-references is set
+func (e *envCommand) noticef(format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	if e.redactRefs {
+		message = redactReferences(message)
+	}
+	fmt.Fprint(e.stderr, message)
+}
+
+// watchLoop re-resolves the configuration every interval until interrupted.
+// Failed refreshes and failed hooks are logged without stopping the loop.
+func (e *envCommand) watchLoop() error {
+	interrupts := watchInterrupts(context.Background())
+	defer interrupts.stop()
+
+	for cycle := 0; ; cycle++ {
+		err := e.run()
+		var sigErr *signalError
+		switch {
+		case stderrors.As(err, &sigErr):
+			return err
+		case err != nil:
+			e.noticef("WARNING: Refresh failed, keeping the last good output: %v\n", err)
+		case e.changed && cycle > 0 && e.onChange != "":
+			if err := e.runHook(interrupts.ctx, e.onChange); err != nil {
+				e.noticef("WARNING: onchange hook failed: %v\n", err)
+			}
+		}
+
+		select {
+		case <-interrupts.ctx.Done():
+			return interrupts.err(interrupts.ctx.Err())
+		case <-time.After(e.interval):
+		}
+	}
+}
+
+// checkDroppedVariables fails a refresh that skipped a variable the last
+// written output contained, so a transient lookup failure keeps the last good
+// output instead of replacing it with one that lacks the variable
+func (e *envCommand) checkDroppedVariables(skipped []env.Skipped, values map[string]string) error {
+	var dropped []string
+	for _, s := range skipped {
+		if _, ok := values[s.Name]; !ok && e.lastWritten[s.Name] {
+			dropped = append(dropped, s.Name)
+		}
+	}
+	if len(dropped) == 0 {
+		return nil
+	}
+	return &errors.OpnixError{
+		Operation: "Refreshing environment output",
+		Component: "environment variable resolution",
+		Issue:     fmt.Sprintf("Could not resolve %s, which the previous output contained; keeping the last good output", strings.Join(dropped, ", ")),
+		Suggestions: []string{
+			"The next refresh tries again",
+			"Check connectivity to 1Password if the warning persists",
+		},
+	}
+}
+
+// runShellHook executes command with sh, sending its output to stderr so it
+// never mixes with rendered output on stdout
+func (e *envCommand) runShellHook(ctx context.Context, command string) error {
+	hook := exec.CommandContext(ctx, "sh", "-c", command)
+	hook.Stdout = e.stderr
+	hook.Stderr = e.stderr
+	return hook.Run()
+}
+
+// valuesFingerprint summarizes values so watch mode can detect changes
+// without keeping the previous secrets in memory
+func valuesFingerprint(values map[string]string) string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	hash := sha256.New()
+	for _, key := range keys {
+		fmt.Fprintf(hash, "%d:%s%d:%s", len(key), key, len(values[key]), values[key])
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// selectRawVariable narrows cfg to the single variable printed by -raw so no
+// other references are resolved
+func selectRawVariable(cfg *env.Config, name string) (*env.Config, error) {
+	for _, variable := range cfg.Vars {
+		if variable.Name == name {
+			return &env.Config{
+				Vars:            []env.Variable{variable},
+				Format:          cfg.Format,
+				Accounts:        cfg.Accounts,
+				DefaultOptional: cfg.DefaultOptional,
+				Files:           cfg.Files,
+			}, nil
+		}
+	}
+
+	return nil, errors.ConfigValidationError(
+		"env.raw",
+		name,
+		"Variable is not defined in the environment configuration",
+		[]string{
+			"Check the variable name passed to -raw",
+			"Variable names are case-sensitive",
+		},
+	)
+}
+
+// runSummary is the machine-readable report written by -report. It never
+// contains resolved values.
+type runSummary struct {
+	Resolved             int      `json:"resolved"`
+	Skipped              int      `json:"skipped"`
+	SkippedVariables     []string `json:"skippedVariables,omitempty"`
+	PlaceholderVariables []string `json:"placeholderVariables,omitempty"`
+	Format               string   `json:"format"`
+	Environment          string   `json:"environment,omitempty"`
+	Output               string   `json:"output"`
+	DurationMillis       int64    `json:"durationMs"`
+}
+
+// writeEffectiveConfig prints cfg as the JSON configuration opnix would act
+// on. Unselected environments are dropped and the chosen format is filled in,
+// so the output can itself be passed back as -config.
+func (e *envCommand) writeEffectiveConfig(cfg *env.Config, format string) error {
+	effective := *cfg
+	effective.Environments = nil
+	effective.DefaultVault = ""
+	effective.Format = format
+
+	data, err := json.MarshalIndent(effective, "", "  ")
+	if err != nil {
+		return errors.ConfigError("Printing effective configuration", "Failed to encode configuration", err)
+	}
+	_, err = fmt.Fprintln(e.stdout, string(data))
+	return err
+}
+
+// writeReferences prints each 1Password reference the configuration would
+// resolve, including fieldFallbacks, once per line in sorted order. Selectors
+// are dropped since they do not change what is fetched, and env:// references
+// are left out because they never reach 1Password.
+func (e *envCommand) writeReferences(cfg *env.Config) error {
+	seen := make(map[string]bool)
+	var references []string
+	for _, variable := range cfg.Vars {
+		if variable.Reference == "" || env.IsEnvReference(variable.Reference) {
+			continue
+		}
+		for _, reference := range append([]string{variable.LookupReference()}, variable.FallbackReferences()...) {
+			reference = validation.StripSelector(reference)
+			if !seen[reference] {
+				seen[reference] = true
+				references = append(references, reference)
+			}
+		}
+	}
+	sort.Strings(references)
+
+	for _, reference := range references {
+		if _, err := fmt.Fprintln(e.stdout, reference); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// variableStatus is one entry of -format status-json output
+type variableStatus struct {
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+	Reference string `json:"reference,omitempty"`
+}
+
+// writeStatusJSON prints the outcome of every variable without its value,
+// then fails if any required variable could not be resolved
+func (e *envCommand) writeStatusJSON(cfg *env.Config, result *env.Result) error {
+	statuses := make(map[string]string, len(cfg.Vars))
+	for name := range result.Values {
+		statuses[name] = "resolved"
+	}
+	for _, placeholder := range result.Placeholders {
+		statuses[placeholder.Name] = "default"
+	}
+	for _, skipped := range result.Skipped {
+		statuses[skipped.Name] = "skipped"
+	}
+	for _, failed := range result.Failed {
+		statuses[failed.Name] = "failed"
+	}
+
+	entries := make([]variableStatus, 0, len(cfg.Vars))
+	for _, variable := range cfg.Vars {
+		reference := variable.Reference
+		if source, ok := result.Sources[variable.Name]; ok {
+			reference = source
+		}
+		entries = append(entries, variableStatus{
+			Name:      variable.Name,
+			Status:    statuses[variable.Name],
+			Reference: reference,
+		})
+	}
+	if e.sort {
+		sort.SliceStable(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	}
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return errors.ConfigError("Rendering variable status", "Failed to encode status output", err)
+	}
+	if _, err := fmt.Fprintln(e.stdout, string(data)); err != nil {
+		return err
+	}
+
+	if len(result.Failed) == 0 {
+		return nil
+	}
+	return failedVariablesError(result, "Check the references reported as failed in the status output")
+}
+
+// failureEntry is one entry of the -failures-report file
+type failureEntry struct {
+	Name      string `json:"name"`
+	Reference string `json:"reference,omitempty"`
+	Error     string `json:"error"`
+}
+
+// reportBestEffortFailures warns about each required variable -best-effort
+// left out of the output and writes them to -failures-report when set. The
+// report is written even when nothing failed, so a stale one never lingers.
+func (e *envCommand) reportBestEffortFailures(cfg *env.Config, result *env.Result) error {
+	references := make(map[string]string, len(cfg.Vars))
+	for _, variable := range cfg.Vars {
+		references[variable.Name] = variable.Reference
+	}
+
+	entries := make([]failureEntry, 0, len(result.Failed))
+	for _, failed := range result.Failed {
+		e.noticef("WARNING: Leaving out required env var %s, which failed to resolve: %v\n", failed.Name, failed.Err)
+		entries = append(entries, failureEntry{Name: failed.Name, Reference: references[failed.Name], Error: failed.Err.Error()})
+	}
+	if e.failuresPath == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return errors.ConfigError("Writing failures report", "Failed to encode failures", err)
+	}
+	return writeOutputFile(e.failuresPath, string(data)+"\n", 0644)
+}
+
+// failedVariablesError reports the required variables collected in
+// result.Failed
+func failedVariablesError(result *env.Result, suggestion string) error {
+	names := make([]string, len(result.Failed))
+	for i, failed := range result.Failed {
+		names[i] = failed.Name
+	}
+	return &errors.OpnixError{
+		Operation:   "Resolving environment variables",
+		Component:   "environment variable resolution",
+		Issue:       fmt.Sprintf("%d required variables failed to resolve", len(result.Failed)),
+		Context:     fmt.Sprintf("Failed: %s", strings.Join(names, ", ")),
+		Cause:       result.Failed[0].Err,
+		Suggestions: []string{suggestion},
+	}
+}
+
+func (e *envCommand) writeReport() error {
+	data, err := json.MarshalIndent(e.summary, "", "  ")
+	if err != nil {
+		return errors.ConfigError("Writing run report", "Failed to encode run summary", err)
+	}
+	return writeOutputFile(e.reportPath, string(data)+"\n", 0644)
+}
+
+// writeOutputFile atomically replaces path with rendered output, so an
+// interrupted run never leaves a partially written file behind
+func writeOutputFile(path, content string, mode os.FileMode) error {
+	return writeOwnedOutputFile(path, content, mode, nil)
+}
+
+// writeOwnedOutputFile is like writeOutputFile but runs chown on the
+// temporary file before it is renamed into place, so the file never appears
+// with the wrong ownership
+func writeOwnedOutputFile(path, content string, mode os.FileMode, chown func(string) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".opnix-output-*")
+	if err != nil {
+		return errors.FileOperationError(
+			"Writing environment output",
+			path,
+			"Failed to create temporary file next to the output file",
+			err,
+		)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	if _, err := tmp.WriteString(content); err != nil {
+		tmp.Close()
+		return errors.FileOperationError("Writing environment output", path, "Failed to write rendered output", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.FileOperationError("Writing environment output", path, "Failed to write rendered output", err)
+	}
+	if err := os.Chmod(tmpPath, mode); err != nil {
+		return errors.FileOperationError("Writing environment output", path, "Failed to set output file permissions", err)
+	}
+	if chown != nil {
+		if err := chown(tmpPath); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return errors.FileOperationError("Writing environment output", path, "Failed to replace output file", err)
+	}
+	return nil
+}
+
+// layerValues overlays resolved values on top of base values. Resolved values
+// win; base-only keys pass through unchanged. When an explicit order is in
+// use, base keys keep their file order ahead of newly introduced variables.
+func layerValues(base map[string]string, baseOrder []string, resolved map[string]string, order []string) (map[string]string, []string) {
+	merged := make(map[string]string, len(base)+len(resolved))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range resolved {
+		merged[key] = value
+	}
+
+	if order == nil {
+		return merged, nil
+	}
+	return merged, append(append([]string{}, baseOrder...), order...)
+}
+
+// reportHashCheck compares resolved values with their pinned SHA-256 hashes,
+// printing one status line per pinned variable without revealing any values
+func (e *envCommand) reportHashCheck(cfg *env.Config, result *env.Result) error {
+	var mismatched []string
+	checked := 0
+
+	for _, variable := range cfg.Vars {
+		if variable.ExpectedSHA256 == "" {
+			continue
+		}
+
+		value, ok := result.Values[variable.Name]
+		if !ok {
+			fmt.Fprintf(e.stdout, "SKIPPED  %s\n", variable.Name)
+			continue
+		}
+
+		checked++
+		if sha256Hex(value) == strings.ToLower(variable.ExpectedSHA256) {
+			fmt.Fprintf(e.stdout, "OK       %s\n", variable.Name)
+			continue
+		}
+
+		fmt.Fprintf(e.stdout, "MISMATCH %s\n", variable.Name)
+		mismatched = append(mismatched, variable.Name)
+	}
+
+	if len(mismatched) > 0 {
+		return errors.ConfigError(
+			"Checking resolved values",
+			fmt.Sprintf("%d of %d pinned variables do not match their expected SHA-256: %s", len(mismatched), checked, strings.Join(mismatched, ", ")),
+			nil,
+		)
+	}
+	return nil
+}
+
+func sha256Hex(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// checkStdoutOnly rejects file-writing flags when -stdout-only is set
+func (e *envCommand) checkStdoutOnly() error {
+	if !e.stdoutOnly {
+		return nil
+	}
+
+	writes := []struct {
+		flag  string
+		value string
+	}{
+		{"-output", e.outputPath},
+		{"-outputs", e.outputs},
+		{"-masked-output", e.maskedPath},
+		{"-update", e.updatePath},
+		{"-report", e.reportPath},
+		{"-failures-report", e.failuresPath},
+		{"-audit-log", e.auditPath},
+	}
+	for _, write := range writes {
+		if write.value != "" {
+			return errors.ConfigValidationError(
+				"env.stdout-only",
+				write.value,
+				fmt.Sprintf("-stdout-only forbids writing files, but %s was given", write.flag),
+				[]string{
+					fmt.Sprintf("Remove %s to print to stdout", write.flag),
+					"Or drop -stdout-only if the file write is intended",
+				},
+			)
+		}
+	}
+	return nil
+}
+
+// expandReferences expands environment variables in cfg's references when
+// -expand-env or -strict-env is set
+func (e *envCommand) expandReferences(cfg *env.Config, source string) (*env.Config, error) {
+	if !e.expandEnv && !e.strictEnv {
+		return cfg, nil
+	}
+	if err := cfg.ExpandEnv(source, e.strictEnv); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// resolveConfig loads the configuration from flags or the environment. It
+// returns a nil config without error when -ignore-missing-config is set and
+// the config file does not exist.
+func (e *envCommand) resolveConfig() (*env.Config, error) {
+	jsonSource := "inline -config-json"
+	pathSource := e.configPath
+	// The variables only stand in for flags that were not given, so a
+	// -config flag or a batch job's configuration is never overridden
+	if strings.TrimSpace(e.configJSON) == "" && strings.TrimSpace(e.configPath) == "" {
+		if envJSON := os.Getenv("OPNIX_ENV_CONFIG_JSON"); strings.TrimSpace(envJSON) != "" {
+			e.configJSON = envJSON
+			jsonSource = "inline OPNIX_ENV_CONFIG_JSON"
+		} else if envPath := os.Getenv("OPNIX_ENV_CONFIG"); strings.TrimSpace(envPath) != "" {
+			e.configPath = envPath
+			pathSource = envPath + " (from OPNIX_ENV_CONFIG)"
+		}
+	}
+
+	if strings.TrimSpace(e.configJSON) != "" {
+		e.configSource = jsonSource
+		return e.parseConfig(e.configJSON)
+	}
+
+	if strings.TrimSpace(e.configPath) != "" {
+		if e.ignoreMissingConfig {
+			if _, err := os.Stat(e.configPath); os.IsNotExist(err) {
+				if e.verbose {
+					e.noticef("INFO: Configuration %s does not exist; producing empty output\n", e.configPath)
+				}
+				return nil, nil
+			}
+		}
+		e.configSource = pathSource
+		return e.loadConfig(e.configPath)
+	}
+
+	return nil, errors.ConfigError(
+		"Loading environment configuration",
+		"No environment configuration provided. Use -config, -config-json, OPNIX_ENV_CONFIG, or OPNIX_ENV_CONFIG_JSON.",
+		nil,
+	)
+}
+
+// mergeReferences merges the -references file into cfg. Variables the
+// configuration gives a static value keep it, noted with -verbose.
+func (e *envCommand) mergeReferences(cfg *env.Config) error {
+	references, err := env.LoadReferences(e.references)
+	if err != nil {
+		return err
+	}
+	overridden, err := cfg.MergeReferences(references, e.references)
+	if err != nil {
+		return err
+	}
+	if e.verbose {
+		for _, name := range overridden {
+			e.noticef("INFO: %s has a static value in the configuration; ignoring its reference in %s\n", name, e.references)
+		}
+	}
+	return nil
+}
+
+// checkStaticValues reports the variables that use a static value instead
+// of a reference, as warnings or, with -strict, as an error
+func (e *envCommand) checkStaticValues(cfg *env.Config) error {
+	var static []string
+	for _, variable := range cfg.Vars {
+		if variable.Reference == "" {
+			static = append(static, variable.Name)
+		}
+	}
+	if len(static) == 0 {
+		return nil
+	}
+
+	if e.strict {
+		return errors.ConfigValidationError(
+			"env.vars",
+			strings.Join(static, ", "),
+			fmt.Sprintf("%d variables use a static value instead of a reference", len(static)),
+			[]string{
+				"Move each value into 1Password and set 'reference' instead of 'value'",
+				"Or drop -strict to only warn",
+			},
+		)
+	}
+	for _, name := range static {
+		e.noticef("WARNING: %s uses a static value instead of a reference\n", name)
+	}
+	return nil
+}
+
+// selectFormat picks the output format. The -format flag wins over the
+// configured format; a conflict between them is reported with -verbose and
+// rejected with -strict.
+func (e *envCommand) selectFormat(cfg *env.Config) (string, error) {
+	flagFormat := strings.ToLower(e.format)
+	configFormat := strings.ToLower(cfg.Format)
+
+	if flagFormat != "" && configFormat != "" && flagFormat != configFormat {
+		if e.strict {
+			return "", errors.ConfigValidationError(
+				"env.format",
+				flagFormat,
+				fmt.Sprintf("-format %s conflicts with format %s in the configuration", flagFormat, configFormat),
+				[]string{
+					"Remove -format to use the configured format",
+					"Or change the configuration's 'format' to match",
+				},
+			)
+		}
+		if e.verbose {
+			e.noticef("INFO: -format %s overrides format %s from the configuration\n", flagFormat, configFormat)
+		}
+	}
+
+	switch {
+	case flagFormat != "":
+		return flagFormat, nil
+	case configFormat != "":
+		return configFormat, nil
+	default:
+		return "shell", nil
+	}
+}
+
+// loadFixtures reads the -fixtures file (or OPNIX_FIXTURES) so every account
+// resolves from it without a token. It is reloaded on each run so watch mode
+// picks up edits.
+func (e *envCommand) loadFixtures() error {
+	path := e.fixturesPath
+	if path == "" {
+		path = strings.TrimSpace(os.Getenv("OPNIX_FIXTURES"))
+	}
+	if path == "" {
+		e.fixtures = nil
+		return nil
+	}
+
+	fixtures, err := env.LoadFixtures(path)
+	if err != nil {
+		return err
+	}
+	e.fixtures = fixtures
+	return nil
+}
+
+// buildResolver creates the resolver for variables without an account. When
+// the config mixes in env:// references, those are routed to a local
+// resolver so only the rest reach 1Password.
+func (e *envCommand) buildResolver(cfg *env.Config) (env.Resolver, error) {
+	resolver, err := e.buildOnePasswordResolver(cfg)
+	if err != nil {
+		return nil, err
+	}
+	for _, variable := range cfg.Vars {
+		if env.IsEnvReference(variable.Reference) {
+			local, err := e.localResolver()
+			if err != nil {
+				return nil, err
+			}
+			return env.NewSchemeResolver(resolver, e.timed(e.audited(local, ""))), nil
+		}
+	}
+	return resolver, nil
+}
+
+// localResolver reads env:// references from the -env-file dotenv file,
+// falling back to the process environment
+func (e *envCommand) localResolver() (env.Resolver, error) {
+	if e.envFile == "" {
+		return env.NewEnvResolver(nil), nil
+	}
+	content, err := os.ReadFile(e.envFile)
+	if err != nil {
+		return nil, errors.FileOperationError(
+			"Loading env file",
+			e.envFile,
+			"Failed to read the dotenv file for env:// references",
+			err,
+		)
+	}
+	values, _ := parseDotenv(string(content))
+	return env.NewEnvResolver(values), nil
+}
+
+func (e *envCommand) buildOnePasswordResolver(cfg *env.Config) (env.Resolver, error) {
+	if e.fixtures != nil {
+		return e.timed(e.audited(e.fixtures, "")), nil
+	}
+	for _, variable := range cfg.Vars {
+		if variable.Reference != "" && variable.Account == "" && !env.IsEnvReference(variable.Reference) {
+			return e.shared("token-file:"+e.tokenFile, func() (env.Resolver, error) {
+				client, err := e.newClient(e.tokenFile)
+				if err != nil {
+					return nil, err
+				}
+				return e.cached(e.retrying(e.timed(e.audited(client, "")))), nil
+			})
+		}
+	}
+	return staticResolver{}, nil
+}
+
+// buildAccountResolvers creates one client per named account referenced by a variable
+func (e *envCommand) buildAccountResolvers(cfg *env.Config) (map[string]env.Resolver, error) {
+	accounts := make(map[string]env.Resolver)
+	for _, variable := range cfg.Vars {
+		if variable.Reference == "" || variable.Account == "" {
+			continue
+		}
+		if _, ok := accounts[variable.Account]; ok {
+			continue
+		}
+		if e.fixtures != nil {
+			accounts[variable.Account] = e.timed(e.audited(e.fixtures, variable.Account))
+			continue
+		}
+
+		name, account := variable.Account, cfg.Accounts[variable.Account]
+		resolver, err := e.shared(fmt.Sprintf("account:%s:%s:%s", name, account.TokenEnv, account.TokenFile), func() (env.Resolver, error) {
+			client, err := e.newAccountClient(account)
+			if err != nil {
+				return nil, errors.WrapWithSuggestions(
+					err,
+					fmt.Sprintf("Initializing 1Password client for account %s", name),
+					"1Password integration",
+					[]string{
+						fmt.Sprintf("Check the token configured for account '%s'", name),
+					},
+				)
+			}
+			return e.cached(e.retrying(e.timed(e.audited(client, name)))), nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		accounts[name] = resolver
+	}
+	return accounts, nil
+}
+
+// shared builds a resolver, or reuses the one built under key by another
+// config of the same batch
+func (e *envCommand) shared(key string, build func() (env.Resolver, error)) (env.Resolver, error) {
+	if e.pool == nil {
+		return build()
+	}
+	return e.pool.get(key, build)
+}
+
+// audited wraps resolver so its lookups are recorded when -audit-log is set
+func (e *envCommand) audited(resolver env.Resolver, account string) env.Resolver {
+	if e.audit == nil {
+		return resolver
+	}
+	return env.NewAuditResolver(resolver, account, e.audit.record)
+}
+
+// timed wraps resolver so its calls are measured when -timing is set
+func (e *envCommand) timed(resolver env.Resolver) env.Resolver {
+	if e.stats == nil {
+		return resolver
+	}
+	return env.NewTimingResolver(resolver, e.stats.record)
+}
+
+// cached wraps resolver in a CachingResolver whose hits -timing reports
+func (e *envCommand) cached(resolver env.Resolver) env.Resolver {
+	cache := env.NewCachingResolver(resolver)
+	if e.stats != nil {
+		e.stats.track(cache)
+	}
+	return cache
+}
+
+// retrying wraps resolver so failed lookups are retried when -retries is set
+func (e *envCommand) retrying(resolver env.Resolver) env.Resolver {
+	if e.retries <= 0 {
+		return resolver
+	}
+	return env.NewRetryingResolver(resolver, e.retries+1, e.retryBackoff)
+}
+
+// newEnvAccountClient creates a client from an account's token source. The
+// account token never falls back to OP_SERVICE_ACCOUNT_TOKEN.
+func newEnvAccountClient(account env.Account) (env.Resolver, error) {
+	if account.TokenEnv != "" {
+		if token := strings.TrimSpace(os.Getenv(account.TokenEnv)); token != "" {
+			return onepass.NewClientWithToken(token)
+		}
+	}
+
+	token, err := onepass.ReadTokenFile(account.TokenFile)
+	if err != nil {
+		return nil, err
+	}
+	return onepass.NewClientWithToken(token)
+}
+
+var supportedFormats = []string{"shell", "dotenv", "docker-env", "json", "env-json", "kv", "plist", "properties", "hcl", statusJSONFormat, "none"}
+
+// statusJSONFormat reports each variable's outcome instead of its value
+const statusJSONFormat = "status-json"
+
+func isSupportedFormat(format string) bool {
+	for _, supported := range supportedFormats {
+		if format == supported {
+			return true
+		}
+	}
+	return false
+}
+
+const maskedValue = "********"
+
+// maskSecretValues returns a copy of values with every secret variable masked
+func maskSecretValues(values map[string]string, vars []env.Variable) map[string]string {
+	masked := make(map[string]string, len(values))
+	for key, value := range values {
+		masked[key] = value
+	}
+
+	for _, variable := range vars {
+		if _, ok := masked[variable.Name]; ok && variable.IsSecret() {
+			masked[variable.Name] = maskedValue
+		}
+	}
+
+	return masked
+}
+
+type staticResolver struct{}
+
+func (staticResolver) ResolveSecret(string) (string, error) {
+	return "", fmt.Errorf("no 1Password client configured")
+}
+
+func (r staticResolver) ResolveSecretContext(_ context.Context, reference string) (string, error) {
+	return r.ResolveSecret(reference)
+}
+
+func (r staticResolver) ResolveAll(ctx context.Context, references []string) (map[string]string, map[string]error, error) {
+	return env.ResolveEach(ctx, references, r.ResolveSecretContext)
+}
+
+// renderOptions carries format-specific rendering settings
+type renderOptions struct {
+	kvPrefix    string
+	kvSeparator string
+	// quoteStyle sets how dotenv values are quoted
+	quoteStyle quoteStyle
+	// autoexport brackets shell assignments with set -a and set +a
+	autoexport bool
+	// k8sName and k8sNamespace fill in the k8s-secret manifest metadata
+	k8sName      string
+	k8sNamespace string
+	// arrays holds the array-typed variables, keyed by name
+	arrays map[string]env.Variable
+}
+
+func (e *envCommand) renderOptions(cfg *env.Config) renderOptions {
+	opts := renderOptions{kvPrefix: e.kvPrefix, kvSeparator: e.kvSeparator, quoteStyle: quoteStyle(e.quoteStyle), autoexport: e.autoexport}
+	if e.k8s != nil {
+		opts.k8sName = e.k8s.name
+		opts.k8sNamespace = e.k8s.namespace
+	}
+	for _, variable := range cfg.Vars {
+		if variable.IsArray() {
+			if opts.arrays == nil {
+				opts.arrays = make(map[string]env.Variable)
+			}
+			opts.arrays[variable.Name] = variable
+		}
+	}
+	return opts
+}
+
+// rejectArrays fails when any of keys is an array-typed variable, which only
+// the shell format can represent
+func rejectArrays(keys []string, format string, opts renderOptions) error {
+	for _, key := range keys {
+		if _, ok := opts.arrays[key]; ok {
+			return errors.ConfigValidationError(
+				"env.format",
+				format,
+				fmt.Sprintf("Variable %s has type \"array\", which only the shell format supports", key),
+				[]string{
+					"Use -format shell to emit a bash array declaration",
+					"Or remove \"type\": \"array\" to emit the raw delimited value",
+				},
+			)
+		}
+	}
+	return nil
+}
+
+// renderOutput renders values in the requested format. When order is nil the
+// variables are sorted by name; otherwise they are emitted in the given order.
+func renderOutput(values map[string]string, order []string, format string, opts renderOptions) (string, error) {
+	keys := outputKeys(values, order)
+
+	if format != "shell" {
+		if err := rejectArrays(keys, format, opts); err != nil {
+			return "", err
+		}
+	}
+
+	switch format {
+	case "shell":
+		return renderShell(values, keys, opts), nil
+	case "dotenv":
+		return renderDotenv(values, keys, opts.quoteStyle)
+	case "docker-env":
+		return renderDockerEnv(values, keys)
+	case "json":
+		return renderJSON(values, keys)
+	case "env-json":
+		return renderEnvJSON(values, keys)
+	case "kv":
+		return renderKV(values, keys, opts), nil
+	case "plist":
+		return renderPlist(values, keys)
+	case "properties":
+		return renderProperties(values, keys), nil
+	case "hcl":
+		return renderHCL(values, keys), nil
+	case k8sSecretFormat:
+		return renderK8sSecret(values, keys, opts)
+	case "none":
+		return "", nil
+	default:
+		return "", fmt.Errorf("unknown format: %s", format)
+	}
+}
+
+// outputKeys returns the keys of values sorted by name, or following order when provided
+func outputKeys(values map[string]string, order []string) []string {
+	var keys []string
+	if order == nil {
+		for k := range values {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		return keys
+	}
+
+	seen := make(map[string]bool, len(order))
+	for _, key := range order {
+		if _, ok := values[key]; ok && !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// renderShell emits export statements, or bash array declarations for
+// array-typed variables. Arrays cannot be exported, so they are only visible
+// to the shell that evaluates the output. With autoexport, plain assignments
+// are bracketed by set -a and set +a, which exports them as they are made.
+func renderShell(values map[string]string, keys []string, opts renderOptions) string {
+	var b strings.Builder
+	if opts.autoexport && len(keys) > 0 {
+		b.WriteString("set -a\n")
+	}
+	for _, key := range keys {
+		if variable, ok := opts.arrays[key]; ok {
+			elements := variable.Elements(values[key])
+			quoted := make([]string, len(elements))
+			for i, element := range elements {
+				quoted[i] = shellQuote(element)
+			}
+			fmt.Fprintf(&b, "%s=(%s)\n", key, strings.Join(quoted, " "))
+			continue
+		}
+		if opts.autoexport {
+			fmt.Fprintf(&b, "%s=%s\n", key, shellQuote(values[key]))
+			continue
+		}
+		fmt.Fprintf(&b, "export %s=%s\n", key, shellQuote(values[key]))
+	}
+	if opts.autoexport && len(keys) > 0 {
+		b.WriteString("set +a\n")
+	}
+	return b.String()
+}
+
+// renderJSON emits a flat JSON object whose members follow the order of keys
+func renderJSON(values map[string]string, keys []string) (string, error) {
+	if len(keys) == 0 {
+		return "{}\n", nil
+	}
+
+	var b strings.Builder
+	b.WriteString("{\n")
+	for i, key := range keys {
+		name, err := json.Marshal(key)
+		if err != nil {
+			return "", jsonRenderError(err)
+		}
+		value, err := json.Marshal(values[key])
+		if err != nil {
+			return "", jsonRenderError(err)
+		}
+
+		fmt.Fprintf(&b, "  %s: %s", name, value)
+		if i < len(keys)-1 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("}\n")
+
+	return b.String(), nil
+}
+
+func jsonRenderError(err error) error {
+	return errors.ConfigError(
+		"Rendering environment variables",
+		"Failed to marshal JSON output",
+		err,
+	)
+}
+
+// envVarEntry mirrors the Kubernetes EnvVar shape used by container specs
+type envVarEntry struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+func renderEnvJSON(values map[string]string, keys []string) (string, error) {
+	entries := make([]envVarEntry, 0, len(keys))
+	for _, key := range keys {
+		entries = append(entries, envVarEntry{Name: key, Value: values[key]})
+	}
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return "", errors.ConfigError(
+			"Rendering environment variables",
+			"Failed to marshal env-json output",
+			err,
+		)
+	}
+	return string(data) + "\n", nil
+}
+
+func renderDotenv(values map[string]string, keys []string, style quoteStyle) (string, error) {
+	var b strings.Builder
+	for _, key := range keys {
+		quoted, err := style.quote(key, values[key])
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "%s=%s\n", key, quoted)
+	}
+
+	return b.String(), nil
+}
+
+// renderDockerEnv emits lines for docker's --env-file, which takes
+// everything after the first '=' literally and has no quoting or escapes.
+// Values are written unquoted, so multi-line values cannot be represented.
+func renderDockerEnv(values map[string]string, keys []string) (string, error) {
+	var b strings.Builder
+	for _, key := range keys {
+		value := values[key]
+		if strings.ContainsAny(value, "\r\n") {
+			return "", errors.ConfigValidationError(
+				"env.format",
+				"docker-env",
+				fmt.Sprintf("Variable %s has a multi-line value, which docker --env-file cannot represent", key),
+				[]string{
+					"Use -format env-json or json and pass the value another way",
+					"Or store the value on a single line, for example base64-encoded",
+				},
+			)
+		}
+		fmt.Fprintf(&b, "%s=%s\n", key, value)
+	}
+	return b.String(), nil
+}
+
+// renderProperties emits a Java .properties file. Keys and values use the
+// escapes java.util.Properties reads back: backslash, separators, and
+// comment characters are backslash-escaped and non-ASCII characters become
+// \uXXXX escapes. Newlines in values are written as \n followed by a line
+// continuation so multi-line values stay readable.
+func renderProperties(values map[string]string, keys []string) string {
+	var b strings.Builder
+	for _, key := range keys {
+		b.WriteString(propertiesEscape(key, true))
+		b.WriteByte('=')
+		b.WriteString(propertiesEscape(values[key], false))
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// propertiesEscape escapes s for a properties key or value. Spaces are
+// escaped everywhere in keys but only where they would otherwise be
+// stripped in values: at the start and after a line continuation.
+func propertiesEscape(s string, isKey bool) string {
+	var b strings.Builder
+	lineStart := true
+	for _, r := range s {
+		switch {
+		case r == ' ':
+			if isKey || lineStart {
+				b.WriteString(`\ `)
+			} else {
+				b.WriteByte(' ')
+			}
+		case r == '\\' || r == ':' || r == '=' || r == '#' || r == '!':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\f':
+			b.WriteString(`\f`)
+		case r == '\n':
+			if isKey {
+				b.WriteString(`\n`)
+			} else {
+				b.WriteString("\\n\\\n")
+				lineStart = true
+				continue
+			}
+		case r < 0x20 || r > 0x7e:
+			for _, unit := range utf16.Encode([]rune{r}) {
+				fmt.Fprintf(&b, "\\u%04X", unit)
+			}
+		default:
+			b.WriteRune(r)
+		}
+		lineStart = false
+	}
+	return b.String()
+}
+
+// renderHCL emits `KEY = "value"` lines for a Terraform .tfvars file
+func renderHCL(values map[string]string, keys []string) string {
+	var b strings.Builder
+	for _, key := range keys {
+		fmt.Fprintf(&b, "%s = \"%s\"\n", key, hclEscape(values[key]))
+	}
+	return b.String()
+}
+
+// hclEscape escapes s for an HCL quoted string. Template sequences are
+// doubled ($${ and %%{) so Terraform does not interpolate them, and control
+// characters become \uXXXX escapes.
+func hclEscape(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		switch {
+		case r == '"':
+			b.WriteString(`\"`)
+		case r == '\\':
+			b.WriteString(`\\`)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case (r == '$' || r == '%') && strings.HasPrefix(s[i+1:], "{"):
+			b.WriteRune(r)
+			b.WriteRune(r)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, "\\u%04X", r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// kvBase64Marker prefixes kv values that had to be base64-encoded
+const kvBase64Marker = "base64:"
+
+// renderKV emits one "prefix/KEY value" line per variable for KV stores such
+// as Consul or etcd. Values that cannot be carried on a single line, or that
+// could be mistaken for an encoded value, are base64-encoded behind a marker.
+func renderKV(values map[string]string, keys []string, opts renderOptions) string {
+	prefix := strings.TrimSuffix(opts.kvPrefix, "/")
+	separator := opts.kvSeparator
+	if separator == "" {
+		separator = " "
+	}
+
+	var b strings.Builder
+	for _, key := range keys {
+		path := key
+		if prefix != "" {
+			path = prefix + "/" + key
+		}
+
+		value := values[key]
+		if strings.ContainsAny(value, "\r\n") || strings.HasPrefix(value, kvBase64Marker) {
+			value = kvBase64Marker + base64.StdEncoding.EncodeToString([]byte(value))
+		}
+
+		fmt.Fprintf(&b, "%s%s%s\n", path, separator, value)
+	}
+	return b.String()
+}
+
+// renderPlist emits a property list holding a launchd EnvironmentVariables
+// dict, ready to merge into an agent or daemon definition
+func renderPlist(values map[string]string, keys []string) (string, error) {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">` + "\n")
+	b.WriteString("<plist version=\"1.0\">\n<dict>\n\t<key>EnvironmentVariables</key>\n\t<dict>\n")
+	for _, key := range keys {
+		value := values[key]
+		if !isValidXMLText(value) {
+			return "", errors.ConfigError(
+				"Rendering environment variables",
+				fmt.Sprintf("Value of %s contains control characters that cannot be stored in a plist", key),
+				nil,
+			)
+		}
+
+		b.WriteString("\t\t<key>")
+		_ = xml.EscapeText(&b, []byte(key))
+		b.WriteString("</key>\n\t\t<string>")
+		_ = xml.EscapeText(&b, []byte(value))
+		b.WriteString("</string>\n")
+	}
+	b.WriteString("\t</dict>\n</dict>\n</plist>\n")
+	return b.String(), nil
+}
+
+// isValidXMLText reports whether value only holds characters allowed in XML 1.0
+func isValidXMLText(value string) bool {
+	if !utf8.ValidString(value) {
+		return false
+	}
+	for _, r := range value {
+		switch {
+		case r == '\t' || r == '\n' || r == '\r':
+		case r < 0x20, r == 0xFFFE, r == 0xFFFF:
+			return false
+		}
+	}
+	return true
+}
+
+func shellQuote(value string) string {
+	if value == "" {
+		return "''"
+	}
+	return "'" + strings.ReplaceAll(value, "'", `'"'"'`) + "'"
+}
+
+func dotenvValue(value string) string {
+	if value == "" {
+		return ""
+	}
+
+	if dotenvNeedsQuotes(value) {
+		return `"` + escapeDotenv(value) + `"`
+	}
+
+	return value
+}
+
+// dotenvNeedsQuotes reports whether value must be quoted to survive a dotenv parser
+func dotenvNeedsQuotes(value string) bool {
+	return strings.ContainsAny(value, " #\"'\n\r\t")
+}
+
+// escapeDotenv applies the backslash escapes used inside double-quoted values
+func escapeDotenv(value string) string {
+	escaped := strings.ReplaceAll(value, `\`, `\\`)
+	escaped = strings.ReplaceAll(escaped, `"`, `\"`)
+	escaped = strings.ReplaceAll(escaped, "\n", `\n`)
+	escaped = strings.ReplaceAll(escaped, "\r", `\r`)
+	return strings.ReplaceAll(escaped, "\t", `\t`)
+}
@@ -0,0 +1,2258 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	stderrors "errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/brizzbuzz/opnix/pkg/env"
+)
+
+// fakeResolver resolves references from an in-memory map
+type fakeResolver struct {
+	secrets map[string]string
+}
+
+func (f *fakeResolver) ResolveSecret(reference string) (string, error) {
+	if value, ok := f.secrets[reference]; ok {
+		return value, nil
+	}
+	return "", fmt.Errorf("secret not found: %s", reference)
+}
+
+func (f *fakeResolver) Precheck(references []string) ([]string, error) {
+	var missing []string
+	for _, reference := range references {
+		if _, ok := f.secrets[reference]; !ok {
+			missing = append(missing, reference)
+		}
+	}
+	return missing, nil
+}
+
+// newTestEnvCommand builds an env command wired to the given resolver with captured output
+func newTestEnvCommand(resolver env.Resolver) (*envCommand, *bytes.Buffer, *bytes.Buffer) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := newEnvCommand()
+	cmd.stdout = &stdout
+	cmd.stderr = &stderr
+	cmd.newClient = func(string) (env.Resolver, error) {
+		return resolver, nil
+	}
+	cmd.gitUnignored = func(string) (bool, error) {
+		return false, nil
+	}
+
+	return cmd, &stdout, &stderr
+}
+
+func TestEnvCommand_RunWritesToInjectedWriters(t *testing.T) {
+	resolver := &fakeResolver{
+		secrets: map[string]string{
+			"op://Vault/Item/token": "secret-token",
+		},
+	}
+
+	cmd, stdout, stderr := newTestEnvCommand(resolver)
+	err := cmd.Init([]string{
+		"-config-json", `{"vars":[{"name":"API_TOKEN","reference":"op://Vault/Item/token"},{"name":"MISSING","reference":"op://Vault/Item/missing","optional":true}]}`,
+		"-format", "dotenv",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Unexpected run error: %v", err)
+	}
+
+	if got := stdout.String(); got != "API_TOKEN=secret-token\n" {
+		t.Errorf("Expected dotenv output, got %q", got)
+	}
+
+	if !strings.Contains(stderr.String(), "Skipped optional env var MISSING") {
+		t.Errorf("Expected skip warning on stderr, got %q", stderr.String())
+	}
+}
+
+func TestRenderOutput_EnvJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		values   map[string]string
+		expected string
+	}{
+		{
+			name:     "empty values",
+			values:   map[string]string{},
+			expected: "[]\n",
+		},
+		{
+			name: "sorted entries",
+			values: map[string]string{
+				"ZETA":  "last",
+				"ALPHA": "first \"quoted\"",
+			},
+			expected: `[
+  {
+    "name": "ALPHA",
+    "value": "first \"quoted\""
+  },
+  {
+    "name": "ZETA",
+    "value": "last"
+  }
+]
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderOutput(tt.values, nil, "env-json", renderOptions{})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("Expected output:\n%s\ngot:\n%s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestMaskSecretValues(t *testing.T) {
+	vars := []env.Variable{
+		{Name: "API_TOKEN", Reference: "op://Vault/Item/token"},
+		{Name: "PASSPHRASE", Value: "shared", Secret: true},
+		{Name: "REGION", Value: "us-east-1"},
+	}
+	values := map[string]string{
+		"API_TOKEN":  "secret-token",
+		"PASSPHRASE": "shared",
+		"REGION":     "us-east-1",
+	}
+
+	masked := maskSecretValues(values, vars)
+
+	expected := map[string]string{
+		"API_TOKEN":  maskedValue,
+		"PASSPHRASE": maskedValue,
+		"REGION":     "us-east-1",
+	}
+	for key, want := range expected {
+		if masked[key] != want {
+			t.Errorf("Expected %s=%q, got %q", key, want, masked[key])
+		}
+	}
+
+	if values["API_TOKEN"] != "secret-token" {
+		t.Error("Expected original values to be left untouched")
+	}
+}
+
+func TestRenderOutput_Order(t *testing.T) {
+	values := map[string]string{
+		"ZETA":  "z",
+		"ALPHA": "a",
+		"MID":   "it's",
+	}
+	order := []string{"ZETA", "ALPHA", "MID"}
+
+	tests := []struct {
+		name     string
+		order    []string
+		format   string
+		expected string
+	}{
+		{
+			name:     "shell sorted by default",
+			format:   "shell",
+			expected: "export ALPHA='a'\nexport MID='it'\"'\"'s'\nexport ZETA='z'\n",
+		},
+		{
+			name:     "shell in config order",
+			order:    order,
+			format:   "shell",
+			expected: "export ZETA='z'\nexport ALPHA='a'\nexport MID='it'\"'\"'s'\n",
+		},
+		{
+			name:     "dotenv in config order",
+			order:    order,
+			format:   "dotenv",
+			expected: "ZETA=z\nALPHA=a\nMID=\"it's\"\n",
+		},
+		{
+			name:     "json sorted by default",
+			format:   "json",
+			expected: "{\n  \"ALPHA\": \"a\",\n  \"MID\": \"it's\",\n  \"ZETA\": \"z\"\n}\n",
+		},
+		{
+			name:     "json in config order",
+			order:    order,
+			format:   "json",
+			expected: "{\n  \"ZETA\": \"z\",\n  \"ALPHA\": \"a\",\n  \"MID\": \"it's\"\n}\n",
+		},
+		{
+			name:     "order skips unresolved names",
+			order:    []string{"SKIPPED", "MID"},
+			format:   "dotenv",
+			expected: "MID=\"it's\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderOutput(values, tt.order, tt.format, renderOptions{})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestEnvCommand_MultipleAccounts(t *testing.T) {
+	personal := &fakeResolver{secrets: map[string]string{"op://Personal/GitHub/token": "personal-token"}}
+	work := &fakeResolver{secrets: map[string]string{"op://Work/Deploy/key": "work-key"}}
+
+	config := `{
+		"accounts": {"work": {"tokenFile": "/run/secrets/work-token"}},
+		"vars": [
+			{"name": "GITHUB_TOKEN", "reference": "op://Personal/GitHub/token"},
+			{"name": "DEPLOY_KEY", "reference": "op://Work/Deploy/key", "account": "work"}
+		]
+	}`
+
+	t.Run("resolves against each account", func(t *testing.T) {
+		cmd, stdout, _ := newTestEnvCommand(personal)
+		var requested []string
+		cmd.newAccountClient = func(account env.Account) (env.Resolver, error) {
+			requested = append(requested, account.TokenFile)
+			return work, nil
+		}
+
+		if err := cmd.Init([]string{"-config-json", config, "-format", "dotenv"}); err != nil {
+			t.Fatalf("Unexpected init error: %v", err)
+		}
+		if err := cmd.Run(); err != nil {
+			t.Fatalf("Unexpected run error: %v", err)
+		}
+
+		expected := "DEPLOY_KEY=work-key\nGITHUB_TOKEN=personal-token\n"
+		if stdout.String() != expected {
+			t.Errorf("Expected %q, got %q", expected, stdout.String())
+		}
+		if len(requested) != 1 || requested[0] != "/run/secrets/work-token" {
+			t.Errorf("Expected a single client for the work account, got %v", requested)
+		}
+	})
+
+	t.Run("errors name the failing account", func(t *testing.T) {
+		cmd, _, _ := newTestEnvCommand(personal)
+		cmd.newAccountClient = func(env.Account) (env.Resolver, error) {
+			return &fakeResolver{secrets: map[string]string{}}, nil
+		}
+
+		if err := cmd.Init([]string{"-config-json", config}); err != nil {
+			t.Fatalf("Unexpected init error: %v", err)
+		}
+		err := cmd.Run()
+		if err == nil {
+			t.Fatal("Expected error but got none")
+		}
+		if !strings.Contains(err.Error(), "from account work") {
+			t.Errorf("Expected error to name the work account, got:\n%v", err)
+		}
+	})
+}
+
+func TestEnvCommand_Check(t *testing.T) {
+	resolver := &fakeResolver{
+		secrets: map[string]string{
+			"op://Vault/Item/a": "alpha",
+			"op://Vault/Item/b": "bravo",
+		},
+	}
+
+	alphaHash := sha256Hex("alpha")
+
+	tests := []struct {
+		name     string
+		config   string
+		wantErr  bool
+		expected string
+	}{
+		{
+			name:     "all hashes match",
+			config:   fmt.Sprintf(`{"vars":[{"name":"A","reference":"op://Vault/Item/a","expectedSha256":"%s"},{"name":"B","reference":"op://Vault/Item/b"}]}`, alphaHash),
+			expected: "OK       A\n",
+		},
+		{
+			name:     "mismatch reported without values",
+			config:   fmt.Sprintf(`{"vars":[{"name":"A","reference":"op://Vault/Item/a","expectedSha256":"%s"},{"name":"B","reference":"op://Vault/Item/b","expectedSha256":"%s"}]}`, alphaHash, alphaHash),
+			wantErr:  true,
+			expected: "OK       A\nMISMATCH B\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, stdout, _ := newTestEnvCommand(resolver)
+			if err := cmd.Init([]string{"-check", "-config-json", tt.config}); err != nil {
+				t.Fatalf("Unexpected init error: %v", err)
+			}
+
+			err := cmd.Run()
+			if tt.wantErr && err == nil {
+				t.Fatal("Expected error but got none")
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if stdout.String() != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, stdout.String())
+			}
+			if strings.Contains(stdout.String(), "bravo") || (err != nil && strings.Contains(err.Error(), "bravo")) {
+				t.Error("Check output must not reveal secret values")
+			}
+		})
+	}
+}
+
+func TestEnvCommand_PrecheckSkipsOptional(t *testing.T) {
+	resolver := &fakeResolver{
+		secrets: map[string]string{
+			"op://Vault/Item/token": "secret-token",
+		},
+	}
+
+	cmd, stdout, _ := newTestEnvCommand(resolver)
+	err := cmd.Init([]string{
+		"-precheck",
+		"-config-json", `{"vars":[{"name":"API_TOKEN","reference":"op://Vault/Item/token"},{"name":"EXTRA","reference":"op://Vault/Item/extra","optional":true}]}`,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Unexpected run error: %v", err)
+	}
+	if !strings.Contains(stdout.String(), "API_TOKEN") {
+		t.Errorf("Expected API_TOKEN in output, got %q", stdout.String())
+	}
+}
+
+func TestEnvCommand_ExpandEnv(t *testing.T) {
+	t.Setenv("OPNIX_TEST_ENVIRONMENT", "Staging")
+	config := `{"vars":[{"name":"API_TOKEN","reference":"op://App-${OPNIX_TEST_ENVIRONMENT}/Item/token"}]}`
+	resolver := &fakeResolver{secrets: map[string]string{"op://App-Staging/Item/token": "secret-token"}}
+
+	cmd, stdout, _ := newTestEnvCommand(resolver)
+	if err := cmd.Init([]string{"-expand-env", "-config-json", config}); err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Unexpected run error: %v", err)
+	}
+	if !strings.Contains(stdout.String(), "secret-token") {
+		t.Errorf("Expected the expanded reference to resolve, got %q", stdout.String())
+	}
+
+	// References are used as written unless expansion is requested
+	cmd, _, _ = newTestEnvCommand(resolver)
+	if err := cmd.Init([]string{"-config-json", config}); err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+	if err := cmd.Run(); err == nil {
+		t.Error("Expected the unexpanded reference to fail")
+	}
+
+	cmd, _, _ = newTestEnvCommand(resolver)
+	if err := cmd.Init([]string{"-strict-env", "-config-json", `{"vars":[{"name":"API_TOKEN","reference":"op://App-${OPNIX_TEST_UNSET}/Item/token"}]}`}); err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+	if err := cmd.Run(); err == nil || !strings.Contains(err.Error(), "OPNIX_TEST_UNSET") {
+		t.Errorf("Expected -strict-env to report the unset variable, got %v", err)
+	}
+}
+
+func TestEnvCommand_Base(t *testing.T) {
+	resolver := &fakeResolver{secrets: map[string]string{"op://Vault/Item/token": "secret-token"}}
+
+	basePath := filepath.Join(t.TempDir(), ".env.defaults")
+	if err := os.WriteFile(basePath, []byte("# defaults\nLOG_LEVEL=info\nAPI_TOKEN=placeholder\n"), 0600); err != nil {
+		t.Fatalf("Failed to write base file: %v", err)
+	}
+
+	config := `{"vars":[{"name":"API_TOKEN","reference":"op://Vault/Item/token"},{"name":"REGION","value":"eu"}]}`
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{"sorted", nil, "API_TOKEN=secret-token\nLOG_LEVEL=info\nREGION=eu\n"},
+		{"configuration order", []string{"-sort=false"}, "LOG_LEVEL=info\nAPI_TOKEN=secret-token\nREGION=eu\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, stdout, _ := newTestEnvCommand(resolver)
+			args := append([]string{"-config-json", config, "-format", "dotenv", "-base", basePath}, tt.args...)
+			if err := cmd.Init(args); err != nil {
+				t.Fatalf("Unexpected init error: %v", err)
+			}
+			if err := cmd.Run(); err != nil {
+				t.Fatalf("Unexpected run error: %v", err)
+			}
+			if stdout.String() != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, stdout.String())
+			}
+		})
+	}
+}
+
+func TestEnvCommand_MaskedOutput(t *testing.T) {
+	resolver := &fakeResolver{secrets: map[string]string{"op://Vault/Item/token": "secret-token"}}
+	dir := t.TempDir()
+	outputPath := filepath.Join(dir, ".env")
+	maskedPath := filepath.Join(dir, ".env.masked")
+
+	cmd, stdout, _ := newTestEnvCommand(resolver)
+	err := cmd.Init([]string{
+		"-config-json", `{"vars":[{"name":"API_TOKEN","reference":"op://Vault/Item/token"},{"name":"REGION","value":"eu"}]}`,
+		"-format", "dotenv",
+		"-output", outputPath,
+		"-masked-output", maskedPath,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Unexpected run error: %v", err)
+	}
+
+	if stdout.Len() != 0 {
+		t.Errorf("Expected no stdout output with -output, got %q", stdout.String())
+	}
+
+	files := []struct {
+		path     string
+		expected string
+		mode     os.FileMode
+	}{
+		{outputPath, "API_TOKEN=secret-token\nREGION=eu\n", 0600},
+		{maskedPath, "API_TOKEN=********\nREGION=eu\n", 0644},
+	}
+	for _, file := range files {
+		content, err := os.ReadFile(file.path)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", file.path, err)
+		}
+		if string(content) != file.expected {
+			t.Errorf("Expected %s to contain %q, got %q", filepath.Base(file.path), file.expected, string(content))
+		}
+		info, err := os.Stat(file.path)
+		if err != nil {
+			t.Fatalf("Failed to stat %s: %v", file.path, err)
+		}
+		if info.Mode().Perm() != file.mode {
+			t.Errorf("Expected %s mode %o, got %o", filepath.Base(file.path), file.mode, info.Mode().Perm())
+		}
+	}
+}
+
+func TestRenderOutput_KV(t *testing.T) {
+	values := map[string]string{
+		"API_TOKEN": "secret-token",
+		"CERT":      "line one\nline two",
+		"TRICKY":    "base64:literal",
+	}
+
+	tests := []struct {
+		name     string
+		opts     renderOptions
+		expected string
+	}{
+		{
+			name: "default separator without prefix",
+			opts: renderOptions{},
+			expected: "API_TOKEN secret-token\n" +
+				"CERT base64:bGluZSBvbmUKbGluZSB0d28=\n" +
+				"TRICKY base64:YmFzZTY0OmxpdGVyYWw=\n",
+		},
+		{
+			name: "prefix and custom separator",
+			opts: renderOptions{kvPrefix: "apps/web/", kvSeparator: "="},
+			expected: "apps/web/API_TOKEN=secret-token\n" +
+				"apps/web/CERT=base64:bGluZSBvbmUKbGluZSB0d28=\n" +
+				"apps/web/TRICKY=base64:YmFzZTY0OmxpdGVyYWw=\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderOutput(values, nil, "kv", tt.opts)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestEnvCommand_Report(t *testing.T) {
+	resolver := &fakeResolver{secrets: map[string]string{"op://Vault/Item/token": "secret-token"}}
+	reportPath := filepath.Join(t.TempDir(), "report.json")
+
+	cmd, _, _ := newTestEnvCommand(resolver)
+	err := cmd.Init([]string{
+		"-config-json", `{"vars":[{"name":"API_TOKEN","reference":"op://Vault/Item/token"},{"name":"MISSING","reference":"op://Vault/Item/missing","optional":true}]}`,
+		"-format", "json",
+		"-report", reportPath,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Unexpected run error: %v", err)
+	}
+
+	data, err := os.ReadFile(reportPath)
+	if err != nil {
+		t.Fatalf("Failed to read report: %v", err)
+	}
+	if strings.Contains(string(data), "secret-token") {
+		t.Fatal("Report must not contain resolved values")
+	}
+
+	var report runSummary
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("Failed to parse report: %v", err)
+	}
+
+	if report.Resolved != 1 || report.Skipped != 1 {
+		t.Errorf("Expected 1 resolved and 1 skipped, got %d and %d", report.Resolved, report.Skipped)
+	}
+	if len(report.SkippedVariables) != 1 || report.SkippedVariables[0] != "MISSING" {
+		t.Errorf("Expected MISSING to be listed as skipped, got %v", report.SkippedVariables)
+	}
+	if report.Format != "json" || report.Output != "stdout" {
+		t.Errorf("Expected json format written to stdout, got %q and %q", report.Format, report.Output)
+	}
+}
+
+func TestEnvCommand_PlaceholderOnMissing(t *testing.T) {
+	resolver := &fakeResolver{secrets: map[string]string{"op://Vault/Item/token": "secret-token"}}
+	reportPath := filepath.Join(t.TempDir(), "report.json")
+
+	cmd, stdout, stderr := newTestEnvCommand(resolver)
+	err := cmd.Init([]string{
+		"-config-json", `{"vars":[{"name":"API_TOKEN","reference":"op://Vault/Item/token"},{"name":"WEBHOOK_SECRET","reference":"op://Vault/Item/webhook"}]}`,
+		"-format", "dotenv",
+		"-placeholder-on-missing", "__MISSING__",
+		"-report", reportPath,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Unexpected run error: %v", err)
+	}
+
+	if got := stdout.String(); got != "API_TOKEN=secret-token\nWEBHOOK_SECRET=__MISSING__\n" {
+		t.Errorf("Expected placeholder in output, got %q", got)
+	}
+	if !strings.Contains(stderr.String(), "WARNING: Using placeholder for env var WEBHOOK_SECRET") {
+		t.Errorf("Expected placeholder warning, got %q", stderr.String())
+	}
+
+	data, err := os.ReadFile(reportPath)
+	if err != nil {
+		t.Fatalf("Failed to read report: %v", err)
+	}
+	var report runSummary
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("Failed to parse report: %v", err)
+	}
+	if report.Resolved != 1 || len(report.PlaceholderVariables) != 1 || report.PlaceholderVariables[0] != "WEBHOOK_SECRET" {
+		t.Errorf("Expected 1 resolved and WEBHOOK_SECRET as a placeholder, got %d and %v", report.Resolved, report.PlaceholderVariables)
+	}
+}
+
+func TestEnvCommand_BestEffort(t *testing.T) {
+	resolver := &fakeResolver{secrets: map[string]string{"op://Vault/Item/token": "secret-token"}}
+	failuresPath := filepath.Join(t.TempDir(), "failures.json")
+
+	cmd, stdout, stderr := newTestEnvCommand(resolver)
+	err := cmd.Init([]string{
+		"-config-json", `{"vars":[{"name":"API_TOKEN","reference":"op://Vault/Item/token"},{"name":"WEBHOOK_SECRET","reference":"op://Vault/Item/webhook"},{"name":"SENTRY_DSN","reference":"op://Vault/Sentry/dsn","optional":true}]}`,
+		"-format", "dotenv",
+		"-best-effort",
+		"-failures-report", failuresPath,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+	err = cmd.Run()
+	if err == nil || !strings.Contains(err.Error(), "WEBHOOK_SECRET") {
+		t.Fatalf("Expected the required failure to fail the run, got %v", err)
+	}
+
+	if got := stdout.String(); got != "API_TOKEN=secret-token\n" {
+		t.Errorf("Expected only the resolved variable in output, got %q", got)
+	}
+	if !strings.Contains(stderr.String(), "WARNING: Leaving out required env var WEBHOOK_SECRET") {
+		t.Errorf("Expected failure warning, got %q", stderr.String())
+	}
+
+	data, err := os.ReadFile(failuresPath)
+	if err != nil {
+		t.Fatalf("Failed to read failures report: %v", err)
+	}
+	var failures []failureEntry
+	if err := json.Unmarshal(data, &failures); err != nil {
+		t.Fatalf("Failed to parse failures report: %v", err)
+	}
+	if len(failures) != 1 || failures[0].Name != "WEBHOOK_SECRET" || failures[0].Reference != "op://Vault/Item/webhook" {
+		t.Errorf("Expected only WEBHOOK_SECRET in the failures report, got %+v", failures)
+	}
+}
+
+func TestEnvCommand_FailuresReportRequiresBestEffort(t *testing.T) {
+	cmd, _, _ := newTestEnvCommand(&fakeResolver{})
+	if err := cmd.Init([]string{"-config-json", `{"vars":[{"name":"A","value":"1"}]}`, "-failures-report", "failures.json"}); err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+	if err := cmd.Run(); err == nil || !strings.Contains(err.Error(), "-failures-report requires -best-effort") {
+		t.Errorf("Expected -failures-report without -best-effort to fail, got %v", err)
+	}
+}
+
+func TestRenderOutput_Arrays(t *testing.T) {
+	values := map[string]string{
+		"HOSTS":     "db1.example.com, db2.example.com ,it's-here",
+		"API_TOKEN": "secret-token",
+		"EMPTY":     "",
+	}
+	opts := renderOptions{arrays: map[string]env.Variable{
+		"HOSTS": {Name: "HOSTS", Type: env.TypeArray},
+		"EMPTY": {Name: "EMPTY", Type: env.TypeArray, Delimiter: ";"},
+	}}
+
+	got, err := renderOutput(values, nil, "shell", opts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := "export API_TOKEN='secret-token'\n" +
+		"EMPTY=()\n" +
+		"HOSTS=('db1.example.com' 'db2.example.com' 'it'\"'\"'s-here')\n"
+	if got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+
+	for _, format := range []string{"dotenv", "json", "env-json", "kv"} {
+		if _, err := renderOutput(values, nil, format, opts); err == nil || !strings.Contains(err.Error(), "only the shell format supports") {
+			t.Errorf("Expected %s format to reject array variables, got %v", format, err)
+		}
+	}
+}
+
+func TestEnvCommand_Raw(t *testing.T) {
+	resolver := &fakeResolver{secrets: map[string]string{"op://Vault/Item/password": "hunter2"}}
+	config := `{"vars":[{"name":"PASSWORD","reference":"op://Vault/Item/password","optional":true},{"name":"OTHER","reference":"op://Vault/Item/other"}]}`
+
+	tests := []struct {
+		name      string
+		args      []string
+		expected  string
+		wantError string
+	}{
+		{"bare value", []string{"-raw", "PASSWORD"}, "hunter2", ""},
+		{"with newline", []string{"-raw", "PASSWORD", "-newline"}, "hunter2\n", ""},
+		{"undefined variable", []string{"-raw", "MISSING"}, "", "not defined"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, stdout, _ := newTestEnvCommand(resolver)
+			if err := cmd.Init(append([]string{"-config-json", config}, tt.args...)); err != nil {
+				t.Fatalf("Unexpected init error: %v", err)
+			}
+
+			err := cmd.Run()
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Errorf("Expected error containing %q, got %v", tt.wantError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected run error: %v", err)
+			}
+			if stdout.String() != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, stdout.String())
+			}
+		})
+	}
+
+	t.Run("optional variable is required", func(t *testing.T) {
+		cmd, _, _ := newTestEnvCommand(&fakeResolver{secrets: map[string]string{}})
+		if err := cmd.Init([]string{"-config-json", config, "-raw", "PASSWORD"}); err != nil {
+			t.Fatalf("Unexpected init error: %v", err)
+		}
+		if err := cmd.Run(); err == nil {
+			t.Error("Expected error when the raw variable cannot be resolved")
+		}
+	})
+}
+
+func TestEnvCommand_WatchRunsHookOnChange(t *testing.T) {
+	values := []string{"first", "first", "second", "second"}
+	cycles := 0
+
+	cmd, stdout, stderr := newTestEnvCommand(nil)
+	cmd.newClient = func(string) (env.Resolver, error) {
+		value := values[len(values)-1]
+		if cycles < len(values) {
+			value = values[cycles]
+		}
+		cycles++
+		if cycles == len(values)+1 {
+			if err := syscall.Kill(syscall.Getpid(), syscall.SIGINT); err != nil {
+				t.Fatalf("Failed to send SIGINT: %v", err)
+			}
+		}
+		return &fakeResolver{secrets: map[string]string{"op://Vault/Item/token": value}}, nil
+	}
+
+	var hooks []string
+	cmd.runHook = func(_ context.Context, command string) error {
+		hooks = append(hooks, command)
+		return fmt.Errorf("hook exited with status 1")
+	}
+
+	err := cmd.Init([]string{
+		"-config-json", `{"vars":[{"name":"API_TOKEN","reference":"op://Vault/Item/token"}]}`,
+		"-format", "dotenv",
+		"-watch",
+		"-interval", "1ms",
+		"-onchange", "systemctl reload example",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+
+	err = cmd.Run()
+	var sigErr *signalError
+	if !stderrors.As(err, &sigErr) {
+		t.Fatalf("Expected signal error after SIGINT, got %v", err)
+	}
+
+	if len(hooks) != 1 || hooks[0] != "systemctl reload example" {
+		t.Errorf("Expected hook to run once for the single change, got %v", hooks)
+	}
+	if got := stdout.String(); got != "API_TOKEN=first\nAPI_TOKEN=second\n" {
+		t.Errorf("Expected output only when values change, got %q", got)
+	}
+	if !strings.Contains(stderr.String(), "onchange hook failed") {
+		t.Errorf("Expected hook failure to be logged, got %q", stderr.String())
+	}
+	if cycles <= len(values) {
+		t.Errorf("Expected watching to continue after hook failure, got %d cycles", cycles)
+	}
+}
+
+func TestEnvCommand_IntervalKeepsLastGoodOutput(t *testing.T) {
+	outPath := filepath.Join(t.TempDir(), "app.env")
+	cycles := 0
+
+	cmd, _, stderr := newTestEnvCommand(nil)
+	cmd.newClient = func(string) (env.Resolver, error) {
+		cycles++
+		switch cycles {
+		case 1:
+			return &fakeResolver{secrets: map[string]string{"op://Vault/Item/token": "first"}}, nil
+		case 3:
+			if err := syscall.Kill(syscall.Getpid(), syscall.SIGINT); err != nil {
+				t.Fatalf("Failed to send SIGINT: %v", err)
+			}
+		}
+		// The optional lookup fails transiently after the first write
+		return &fakeResolver{secrets: map[string]string{}}, nil
+	}
+
+	var hooks int
+	cmd.runHook = func(context.Context, string) error {
+		hooks++
+		return nil
+	}
+
+	err := cmd.Init([]string{
+		"-config-json", `{"vars":[{"name":"API_TOKEN","reference":"op://Vault/Item/token","optional":true},{"name":"REGION","value":"eu"}]}`,
+		"-format", "dotenv",
+		"-output", outPath,
+		"-interval", "1ms",
+		"-onchange", "systemctl reload example",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+
+	err = cmd.Run()
+	var sigErr *signalError
+	if !stderrors.As(err, &sigErr) {
+		t.Fatalf("Expected signal error after SIGINT, got %v", err)
+	}
+
+	content, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	if string(content) != "API_TOKEN=first\nREGION=eu\n" {
+		t.Errorf("Expected last good output to be kept, got %q", string(content))
+	}
+	if hooks != 0 {
+		t.Errorf("Expected no hook runs without a change, got %d", hooks)
+	}
+	if !strings.Contains(stderr.String(), "keeping the last good output") {
+		t.Errorf("Expected failed refresh to be logged, got %q", stderr.String())
+	}
+}
+
+func TestEnvCommand_IntervalMustBePositive(t *testing.T) {
+	cmd, _, _ := newTestEnvCommand(&fakeResolver{})
+	err := cmd.Init([]string{
+		"-config-json", `{"vars":[{"name":"API_TOKEN","reference":"op://Vault/Item/token"}]}`,
+		"-interval", "0s",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+
+	if err := cmd.Run(); err == nil || !strings.Contains(err.Error(), "interval must be positive") {
+		t.Errorf("Expected non-positive -interval to fail, got %v", err)
+	}
+}
+
+func TestEnvCommand_OnChangeRequiresWatch(t *testing.T) {
+	cmd, _, _ := newTestEnvCommand(&fakeResolver{})
+	err := cmd.Init([]string{
+		"-config-json", `{"vars":[{"name":"API_TOKEN","reference":"op://Vault/Item/token"}]}`,
+		"-onchange", "true",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+
+	if err := cmd.Run(); err == nil || !strings.Contains(err.Error(), "-watch") {
+		t.Errorf("Expected -onchange without -watch to fail, got %v", err)
+	}
+}
+
+func TestEnvCommand_Outputs(t *testing.T) {
+	resolver := &fakeResolver{secrets: map[string]string{"op://Vault/Item/token": "secret-token"}}
+	dir := t.TempDir()
+	envPath := filepath.Join(dir, "app.env")
+	jsonPath := filepath.Join(dir, "app.json")
+
+	cmd, stdout, _ := newTestEnvCommand(resolver)
+	err := cmd.Init([]string{
+		"-config-json", `{"vars":[{"name":"API_TOKEN","reference":"op://Vault/Item/token"},{"name":"REGION","value":"eu"}]}`,
+		"-outputs", envPath + ":dotenv," + jsonPath + ":json",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Unexpected run error: %v", err)
+	}
+
+	if stdout.Len() != 0 {
+		t.Errorf("Expected no stdout output with -outputs, got %q", stdout.String())
+	}
+
+	content, err := os.ReadFile(envPath)
+	if err != nil {
+		t.Fatalf("Failed to read dotenv output: %v", err)
+	}
+	if string(content) != "API_TOKEN=secret-token\nREGION=eu\n" {
+		t.Errorf("Unexpected dotenv output: %q", string(content))
+	}
+
+	content, err = os.ReadFile(jsonPath)
+	if err != nil {
+		t.Fatalf("Failed to read JSON output: %v", err)
+	}
+	var values map[string]string
+	if err := json.Unmarshal(content, &values); err != nil {
+		t.Fatalf("Expected valid JSON output, got %q: %v", string(content), err)
+	}
+	if values["API_TOKEN"] != "secret-token" || values["REGION"] != "eu" {
+		t.Errorf("Unexpected JSON output: %v", values)
+	}
+
+	if cmd.summary.Output != envPath+","+jsonPath {
+		t.Errorf("Expected summary to list both outputs, got %q", cmd.summary.Output)
+	}
+}
+
+func TestEnvCommand_FileOptions(t *testing.T) {
+	groups, err := os.Getgroups()
+	if err != nil || len(groups) == 0 {
+		t.Skip("Cannot determine a group of the current user")
+	}
+	group, err := user.LookupGroupId(strconv.Itoa(groups[0]))
+	if err != nil {
+		t.Skip("Cannot look up a group of the current user")
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.env")
+	config := fmt.Sprintf(`{"vars":[{"name":"A","value":"1"}],"files":{%q:{"group":%q,"mode":"0640"}}}`, path, group.Name)
+
+	cmd, _, stderr := newTestEnvCommand(&fakeResolver{})
+	var chowned string
+	cmd.chown = func(name string, uid, gid int) error {
+		chowned = fmt.Sprintf("%d:%d", uid, gid)
+		return &os.PathError{Op: "chown", Path: name, Err: syscall.EPERM}
+	}
+	if err := cmd.Init([]string{"-config-json", config, "-format", "dotenv", "-output", path}); err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Unexpected run error: %v", err)
+	}
+
+	if chowned != "-1:"+group.Gid {
+		t.Errorf("Expected chown to the configured group only, got %q", chowned)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Expected the output to be written: %v", err)
+	}
+	if mode := info.Mode().Perm(); mode != 0640 {
+		t.Errorf("Expected mode 0640, got %04o", mode)
+	}
+	if !strings.Contains(stderr.String(), "WARNING: Could not change the ownership of "+path) {
+		t.Errorf("Expected a warning about the refused chown, got %q", stderr.String())
+	}
+}
+
+func TestEnvCommand_UpdateFileOptions(t *testing.T) {
+	groups, err := os.Getgroups()
+	if err != nil || len(groups) == 0 {
+		t.Skip("Cannot determine a group of the current user")
+	}
+	group, err := user.LookupGroupId(strconv.Itoa(groups[0]))
+	if err != nil {
+		t.Skip("Cannot look up a group of the current user")
+	}
+
+	path := filepath.Join(t.TempDir(), "app.env")
+	if err := os.WriteFile(path, []byte("LOCAL_ONLY=1\n"), 0600); err != nil {
+		t.Fatalf("Failed to write dotenv file: %v", err)
+	}
+	config := fmt.Sprintf(`{"vars":[{"name":"A","value":"1"}],"files":{%q:{"group":%q,"mode":"0640"}}}`, path, group.Name)
+
+	cmd, _, stderr := newTestEnvCommand(&fakeResolver{})
+	var chowned string
+	cmd.chown = func(name string, uid, gid int) error {
+		chowned = fmt.Sprintf("%d:%d", uid, gid)
+		return &os.PathError{Op: "chown", Path: name, Err: syscall.EPERM}
+	}
+	if err := cmd.Init([]string{"-config-json", config, "-update", path}); err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Unexpected run error: %v", err)
+	}
+
+	if chowned != "-1:"+group.Gid {
+		t.Errorf("Expected chown to the configured group only, got %q", chowned)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Expected the file to be updated: %v", err)
+	}
+	if mode := info.Mode().Perm(); mode != 0640 {
+		t.Errorf("Expected the configured mode 0640, got %04o", mode)
+	}
+	if !strings.Contains(stderr.String(), "WARNING: Could not change the ownership of "+path) || !strings.Contains(stderr.String(), "mode 0640") {
+		t.Errorf("Expected a warning about the refused chown, got %q", stderr.String())
+	}
+}
+
+func TestParseOutputTargets(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []outputTarget
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"app.env:dotenv, /tmp/a:b/app.json:JSON", []outputTarget{{"app.env", "dotenv"}, {"/tmp/a:b/app.json", "json"}}, false},
+		{"app.env", nil, true},
+		{"app.env:", nil, true},
+		{"app.yaml:yaml", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := parseOutputTargets(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestEnvCommand_Fixtures(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fixtures.json")
+	if err := os.WriteFile(path, []byte(`{"op://Example/Service/password": "test-password"}`), 0600); err != nil {
+		t.Fatalf("Failed to write fixtures: %v", err)
+	}
+
+	cmd, stdout, _ := newTestEnvCommand(nil)
+	cmd.newClient = func(string) (env.Resolver, error) {
+		return nil, fmt.Errorf("unexpected 1Password client")
+	}
+
+	err := cmd.Init([]string{
+		"-config-json", `{"vars":[{"name":"DB_PASSWORD","reference":"op://Example/Service/password"}]}`,
+		"-format", "dotenv",
+		"-fixtures", path,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Unexpected run error: %v", err)
+	}
+
+	if stdout.String() != "DB_PASSWORD=test-password\n" {
+		t.Errorf("Expected fixture value in output, got %q", stdout.String())
+	}
+}
+
+func TestEnvCommand_FormatConflict(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		wantOutput string
+		wantNotice bool
+		wantErr    bool
+	}{
+		{"flag overrides silently", []string{"-format", "dotenv"}, "REGION=eu\n", false, false},
+		{"verbose notice", []string{"-format", "dotenv", "-verbose"}, "REGION=eu\n", true, false},
+		{"strict rejects conflict", []string{"-format", "dotenv", "-strict"}, "", false, true},
+		{"strict allows matching format", []string{"-format", "JSON", "-strict"}, "{\n  \"REGION\": \"eu\"\n}\n", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, stdout, stderr := newTestEnvCommand(&fakeResolver{})
+			args := append([]string{"-config-json", `{"format":"json","vars":[{"name":"REGION","value":"eu"}]}`}, tt.args...)
+			if err := cmd.Init(args); err != nil {
+				t.Fatalf("Unexpected init error: %v", err)
+			}
+
+			err := cmd.Run()
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "conflicts with format json") {
+					t.Errorf("Expected format conflict error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected run error: %v", err)
+			}
+			if stdout.String() != tt.wantOutput {
+				t.Errorf("Expected output %q, got %q", tt.wantOutput, stdout.String())
+			}
+			if notice := strings.Contains(stderr.String(), "overrides format json"); notice != tt.wantNotice {
+				t.Errorf("Expected notice %v, got stderr %q", tt.wantNotice, stderr.String())
+			}
+		})
+	}
+}
+
+func TestEnvCommand_WarnUnusedStatic(t *testing.T) {
+	config := `{"vars":[{"name":"API_TOKEN","reference":"op://Vault/Item/token"},{"name":"DB_PASSWORD","value":"hunter2"},{"name":"REGION","value":"eu"}]}`
+	resolver := &fakeResolver{secrets: map[string]string{"op://Vault/Item/token": "secret-token"}}
+
+	cmd, _, stderr := newTestEnvCommand(resolver)
+	if err := cmd.Init([]string{"-config-json", config, "-warn-unused-static"}); err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Unexpected run error: %v", err)
+	}
+	for _, name := range []string{"DB_PASSWORD", "REGION"} {
+		if !strings.Contains(stderr.String(), "WARNING: "+name+" uses a static value instead of a reference") {
+			t.Errorf("Expected a warning for %s, got %q", name, stderr.String())
+		}
+	}
+	if strings.Contains(stderr.String(), "API_TOKEN") {
+		t.Errorf("Expected no warning for a reference, got %q", stderr.String())
+	}
+
+	cmd, stdout, _ := newTestEnvCommand(resolver)
+	if err := cmd.Init([]string{"-config-json", config, "-warn-unused-static", "-strict"}); err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+	if err := cmd.Run(); err == nil || !strings.Contains(err.Error(), "DB_PASSWORD, REGION") {
+		t.Errorf("Expected -strict to reject static values, got %v", err)
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("Expected no output with -strict, got %q", stdout.String())
+	}
+}
+
+func TestRenderOutput_Plist(t *testing.T) {
+	values := map[string]string{
+		"API_TOKEN": "a<b>&\"c\"",
+		"CERT":      "line one\nline two",
+		"EMPTY":     "",
+	}
+
+	got, err := renderOutput(values, nil, "plist", renderOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := xml.Header +
+		`<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">` + "\n" +
+		"<plist version=\"1.0\">\n<dict>\n\t<key>EnvironmentVariables</key>\n\t<dict>\n" +
+		"\t\t<key>API_TOKEN</key>\n\t\t<string>a&lt;b&gt;&amp;&#34;c&#34;</string>\n" +
+		"\t\t<key>CERT</key>\n\t\t<string>line one&#xA;line two</string>\n" +
+		"\t\t<key>EMPTY</key>\n\t\t<string></string>\n" +
+		"\t</dict>\n</dict>\n</plist>\n"
+	if got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+
+	// The document must round-trip through an XML decoder to the original values
+	var plist struct {
+		Dict struct {
+			Dict struct {
+				Keys    []string `xml:"key"`
+				Strings []string `xml:"string"`
+			} `xml:"dict"`
+		} `xml:"dict"`
+	}
+	if err := xml.Unmarshal([]byte(got), &plist); err != nil {
+		t.Fatalf("Expected well-formed XML: %v", err)
+	}
+	for i, key := range plist.Dict.Dict.Keys {
+		if plist.Dict.Dict.Strings[i] != values[key] {
+			t.Errorf("Expected %s to decode to %q, got %q", key, values[key], plist.Dict.Dict.Strings[i])
+		}
+	}
+
+	if _, err := renderOutput(map[string]string{"BAD": "bell\a"}, nil, "plist", renderOptions{}); err == nil {
+		t.Error("Expected error for control characters in a plist value")
+	}
+}
+
+func TestEnvCommand_IgnoreMissingConfig(t *testing.T) {
+	dir := t.TempDir()
+	invalidPath := filepath.Join(dir, "invalid.json")
+	if err := os.WriteFile(invalidPath, []byte(`{"vars": [`), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    string
+		wantErr bool
+	}{
+		{"missing config fails by default", []string{"-config", filepath.Join(dir, "missing.json")}, "", true},
+		{"missing config ignored", []string{"-config", filepath.Join(dir, "missing.json"), "-ignore-missing-config"}, "", false},
+		{"missing config renders empty json", []string{"-config", filepath.Join(dir, "missing.json"), "-ignore-missing-config", "-format", "json"}, "{}\n", false},
+		{"invalid config still fails", []string{"-config", invalidPath, "-ignore-missing-config"}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, stdout, _ := newTestEnvCommand(&fakeResolver{})
+			if err := cmd.Init(tt.args); err != nil {
+				t.Fatalf("Unexpected init error: %v", err)
+			}
+
+			err := cmd.Run()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if stdout.String() != tt.want {
+				t.Errorf("Expected output %q, got %q", tt.want, stdout.String())
+			}
+		})
+	}
+}
+
+func TestEnvCommand_StdoutOnly(t *testing.T) {
+	outputPath := filepath.Join(t.TempDir(), ".env")
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{"stdout allowed", []string{"-stdout-only"}, ""},
+		{"output rejected", []string{"-stdout-only", "-output", outputPath}, "-output was given"},
+		{"update rejected", []string{"-stdout-only", "-update", outputPath}, "-update was given"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, stdout, _ := newTestEnvCommand(&fakeResolver{})
+			args := append([]string{"-config-json", `{"vars":[{"name":"REGION","value":"eu"}]}`, "-format", "dotenv"}, tt.args...)
+			if err := cmd.Init(args); err != nil {
+				t.Fatalf("Unexpected init error: %v", err)
+			}
+
+			err := cmd.Run()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Unexpected run error: %v", err)
+				}
+				if stdout.String() != "REGION=eu\n" {
+					t.Errorf("Expected stdout output, got %q", stdout.String())
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+			if _, statErr := os.Stat(outputPath); statErr == nil {
+				t.Error("Expected no file to be written")
+			}
+		})
+	}
+}
+
+func TestEnvCommand_MaxSkips(t *testing.T) {
+	config := `{"vars":[
+		{"name":"DB_PASSWORD","reference":"op://Example/Service/password"},
+		{"name":"API_TOKEN","reference":"op://Example/Service/token","optional":true},
+		{"name":"SMTP_PASSWORD","reference":"op://Example/Mail/password","optional":true}
+	]}`
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr bool
+	}{
+		{"unlimited by default", nil, false},
+		{"within limit", []string{"-max-skips", "2"}, false},
+		{"exceeds limit", []string{"-max-skips", "1"}, true},
+		{"zero allows no skips", []string{"-max-skips", "0"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver := &fakeResolver{secrets: map[string]string{"op://Example/Service/password": "test-password"}}
+			cmd, stdout, _ := newTestEnvCommand(resolver)
+
+			args := append([]string{"-config-json", config, "-format", "dotenv"}, tt.args...)
+			if err := cmd.Init(args); err != nil {
+				t.Fatalf("Unexpected init error: %v", err)
+			}
+
+			err := cmd.Run()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Expected error but got none")
+				}
+				for _, want := range []string{"2 optional variables were skipped", "API_TOKEN, SMTP_PASSWORD"} {
+					if !strings.Contains(err.Error(), want) {
+						t.Errorf("Expected error to contain %q, got %v", want, err)
+					}
+				}
+				if stdout.Len() != 0 {
+					t.Errorf("Expected no output, got %q", stdout.String())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected run error: %v", err)
+			}
+		})
+	}
+}
+
+func TestEnvCommand_Example(t *testing.T) {
+	cmd, stdout, _ := newTestEnvCommand(nil)
+	cmd.newClient = func(string) (env.Resolver, error) {
+		return nil, fmt.Errorf("unexpected 1Password client")
+	}
+
+	err := cmd.Init([]string{
+		"example",
+		"-config-json", `{"defaultVault":"Example","vars":[
+			{"name":"DB_PASSWORD","reference":"Database/password","description":"Primary database password"},
+			{"name":"API_KEY","reference":"op://Example/API Key/credential","optional":true},
+			{"name":"LOG_LEVEL","value":"debug"}
+		]}`,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Unexpected run error: %v", err)
+	}
+
+	expected := "# Generated by opnix env example. Values are 1Password references, not secrets.\n" +
+		"\n# Primary database password\nDB_PASSWORD=op://Example/Database/password\n" +
+		"\n# Optional\nAPI_KEY=\"op://Example/API Key/credential\"\n" +
+		"\nLOG_LEVEL=\n"
+	if stdout.String() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, stdout.String())
+	}
+}
+
+func TestEnvCommand_AuditLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	config := `{"vars":[
+		{"name":"DB_PASSWORD","reference":"op://Example/Service/password"},
+		{"name":"API_TOKEN","reference":"op://Example/Service/token","optional":true}
+	]}`
+
+	for i := 0; i < 2; i++ {
+		resolver := &fakeResolver{secrets: map[string]string{"op://Example/Service/password": "test-password"}}
+		cmd, _, _ := newTestEnvCommand(resolver)
+		if err := cmd.Init([]string{"-config-json", config, "-audit-log", path}); err != nil {
+			t.Fatalf("Unexpected init error: %v", err)
+		}
+		if err := cmd.Run(); err != nil {
+			t.Fatalf("Unexpected run error: %v", err)
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat audit log: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected audit log mode 0600, got %o", info.Mode().Perm())
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read audit log: %v", err)
+	}
+	if strings.Contains(string(data), "test-password") {
+		t.Fatalf("Audit log must not contain secret values:\n%s", data)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("Expected 4 entries appended across two runs, got %d:\n%s", len(lines), data)
+	}
+	var entry env.AuditEntry
+	if err := json.Unmarshal([]byte(lines[1]), &entry); err != nil {
+		t.Fatalf("Failed to decode audit entry: %v", err)
+	}
+	if entry.Reference != "op://Example/Service/token" || entry.Vault != "Example" || entry.Item != "Service" || entry.Success {
+		t.Errorf("Unexpected audit entry: %+v", entry)
+	}
+}
+
+func TestEnvCommand_Timing(t *testing.T) {
+	config := `{"vars":[
+		{"name":"DB_PASSWORD","reference":"op://Example/Service/password"},
+		{"name":"DB_PASSWORD_COPY","reference":"op://Example/Service/password"},
+		{"name":"API_TOKEN","reference":"op://Example/Service/token","optional":true}
+	]}`
+
+	resolver := &fakeResolver{secrets: map[string]string{"op://Example/Service/password": "test-password"}}
+	cmd, _, stderr := newTestEnvCommand(resolver)
+	if err := cmd.Init([]string{"-config-json", config, "-timing"}); err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Unexpected run error: %v", err)
+	}
+
+	output := stderr.String()
+	start := strings.Index(output, "Resolution timing:")
+	if start < 0 {
+		t.Fatalf("Expected a timing summary on stderr, got:\n%s", output)
+	}
+	output = output[start:]
+	if strings.Contains(output, "test-password") || strings.Contains(output, "op://") {
+		t.Fatalf("Timing summary must not contain values or references:\n%s", output)
+	}
+	for _, want := range []string{
+		"Resolution timing: 2 API calls (1 failed), 1 cache hits",
+		"min ",
+		"median ",
+		"p95 ",
+		"max ",
+		"<10ms",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected stderr to contain %q, got:\n%s", want, output)
+		}
+	}
+}
+
+func TestEnvCommand_PrintConfig(t *testing.T) {
+	config := `{
+		"defaultVault": "Example",
+		"format": "dotenv",
+		"vars": [
+			{"name":"DB_PASSWORD","reference":"Service/password"},
+			{"name":"LOG_LEVEL","value":"info"}
+		],
+		"environments": {
+			"prod": {"format": "json", "vars": [{"name":"LOG_LEVEL","value":"warn"}]},
+			"dev": {"vars": [{"name":"DEBUG","value":"true"}]}
+		}
+	}`
+
+	newClientCalled := false
+	cmd, stdout, _ := newTestEnvCommand(&fakeResolver{})
+	cmd.newClient = func(string) (env.Resolver, error) {
+		newClientCalled = true
+		return &fakeResolver{}, nil
+	}
+	if err := cmd.Init([]string{"-config-json", config, "-environment", "prod", "-prefix", "APP_", "-print-config"}); err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Unexpected run error: %v", err)
+	}
+	if newClientCalled {
+		t.Error("Expected -print-config not to create a 1Password client")
+	}
+
+	var effective env.Config
+	if err := json.Unmarshal(stdout.Bytes(), &effective); err != nil {
+		t.Fatalf("Failed to decode effective config: %v\n%s", err, stdout.String())
+	}
+	if effective.Format != "json" {
+		t.Errorf("Expected the environment's format, got %q", effective.Format)
+	}
+	if len(effective.Environments) != 0 || effective.DefaultVault != "" {
+		t.Errorf("Expected environments and defaultVault to be applied, got %+v", effective)
+	}
+	expected := []env.Variable{
+		{Name: "APP_DB_PASSWORD", Reference: "op://Example/Service/password"},
+		{Name: "APP_LOG_LEVEL", Value: "warn"},
+	}
+	if len(effective.Vars) != len(expected) {
+		t.Fatalf("Expected %d vars, got %+v", len(expected), effective.Vars)
+	}
+	for i, want := range expected {
+		got := effective.Vars[i]
+		if got.Name != want.Name || got.Reference != want.Reference || got.Value != want.Value {
+			t.Errorf("Var %d: expected %+v, got %+v", i, want, got)
+		}
+	}
+
+	cmd, _, _ = newTestEnvCommand(&fakeResolver{})
+	if err := cmd.Init([]string{"-config-json", config, "-print-config", "-check"}); err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+	if err := cmd.Run(); err == nil || !strings.Contains(err.Error(), "-print-config prints the configuration") {
+		t.Errorf("Expected -print-config to reject -check, got %v", err)
+	}
+}
+
+func TestEnvCommand_PrintReferences(t *testing.T) {
+	config := `{
+		"defaultVault": "Example",
+		"vars": [
+			{"name":"DB_PASSWORD","reference":"Service/password"},
+			{"name":"DB_URL","reference":"op://Example/Service/notesPlain?json=.url"},
+			{"name":"DB_HOST","reference":"op://Example/Service/notesPlain?json=.host"},
+			{"name":"API_TOKEN","reference":"op://Example/API/token","fieldFallbacks":["credential"]},
+			{"name":"LEGACY","reference":"env://LEGACY"},
+			{"name":"LOG_LEVEL","value":"info"}
+		],
+		"environments": {"prod": {"vars": [{"name":"SENTRY_DSN","reference":"op://Prod/Sentry/dsn","optional":true}]}}
+	}`
+
+	cmd, stdout, _ := newTestEnvCommand(nil)
+	cmd.newClient = nil // listing references must not create a client
+	if err := cmd.Init([]string{"-config-json", config, "-environment", "prod", "-print-references"}); err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Unexpected run error: %v", err)
+	}
+
+	expected := "op://Example/API/credential\n" +
+		"op://Example/API/token\n" +
+		"op://Example/Service/notesPlain\n" +
+		"op://Example/Service/password\n" +
+		"op://Prod/Sentry/dsn\n"
+	if stdout.String() != expected {
+		t.Errorf("Expected sorted unique references:\n%s\ngot:\n%s", expected, stdout.String())
+	}
+
+	cmd, _, _ = newTestEnvCommand(&fakeResolver{})
+	if err := cmd.Init([]string{"-config-json", config, "-print-references", "-output", "app.env"}); err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+	if err := cmd.Run(); err == nil || !strings.Contains(err.Error(), "-print-references lists references") {
+		t.Errorf("Expected -print-references to reject -output, got %v", err)
+	}
+}
+
+func TestEnvCommand_StatusJSON(t *testing.T) {
+	config := `{"vars":[
+		{"name":"DB_PASSWORD","reference":"op://Example/Service/password"},
+		{"name":"API_TOKEN","reference":"op://Example/Service/token","optional":true},
+		{"name":"WEBHOOK","reference":"op://Example/Service/webhook","optional":true},
+		{"name":"LOG_LEVEL","value":"info"}
+	]}`
+	resolver := &fakeResolver{secrets: map[string]string{"op://Example/Service/password": "test-password"}}
+
+	cmd, stdout, _ := newTestEnvCommand(resolver)
+	if err := cmd.Init([]string{"-config-json", config, "-format", "status-json", "-sort=false"}); err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Unexpected run error: %v", err)
+	}
+	if strings.Contains(stdout.String(), "test-password") || strings.Contains(stdout.String(), "info") {
+		t.Fatalf("Status output must not contain values:\n%s", stdout.String())
+	}
+
+	var statuses []variableStatus
+	if err := json.Unmarshal(stdout.Bytes(), &statuses); err != nil {
+		t.Fatalf("Failed to decode status output: %v\n%s", err, stdout.String())
+	}
+	expected := []variableStatus{
+		{Name: "DB_PASSWORD", Status: "resolved", Reference: "op://Example/Service/password"},
+		{Name: "API_TOKEN", Status: "skipped", Reference: "op://Example/Service/token"},
+		{Name: "WEBHOOK", Status: "skipped", Reference: "op://Example/Service/webhook"},
+		{Name: "LOG_LEVEL", Status: "resolved"},
+	}
+	if len(statuses) != len(expected) {
+		t.Fatalf("Expected %d statuses, got %+v", len(expected), statuses)
+	}
+	for i, want := range expected {
+		if statuses[i] != want {
+			t.Errorf("Status %d: expected %+v, got %+v", i, want, statuses[i])
+		}
+	}
+
+	// Placeholders report default, and required failures still fail the run
+	cmd, stdout, _ = newTestEnvCommand(resolver)
+	required := strings.Replace(config, `"optional":true},
+		{"name":"WEBHOOK"`, `"optional":false},
+		{"name":"WEBHOOK"`, 1)
+	if err := cmd.Init([]string{"-config-json", required, "-format", "status-json", "-placeholder-on-missing", "unset"}); err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Unexpected run error: %v", err)
+	}
+	if !strings.Contains(stdout.String(), `"status": "default"`) {
+		t.Errorf("Expected placeholder variables to report default, got:\n%s", stdout.String())
+	}
+
+	cmd, stdout, _ = newTestEnvCommand(resolver)
+	if err := cmd.Init([]string{"-config-json", required, "-format", "status-json"}); err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+	err := cmd.Run()
+	if err == nil || !strings.Contains(err.Error(), "1 required variables failed to resolve") {
+		t.Fatalf("Expected required failure, got %v", err)
+	}
+	if !strings.Contains(stdout.String(), `"name": "API_TOKEN",
+    "status": "failed"`) {
+		t.Errorf("Expected API_TOKEN to be reported as failed, got:\n%s", stdout.String())
+	}
+}
+
+func TestEnvCommand_Allowlist(t *testing.T) {
+	allowlist := filepath.Join(t.TempDir(), "allowlist.txt")
+	if err := os.WriteFile(allowlist, []byte("op://Example/Service/password\n"), 0600); err != nil {
+		t.Fatalf("Failed to write allowlist: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		config    string
+		wantError string
+	}{
+		{
+			name:   "allowed references resolve",
+			config: `{"vars":[{"name":"DB_PASSWORD","reference":"op://Example/Service/password"},{"name":"LOG_LEVEL","value":"info"}]}`,
+		},
+		{
+			name:      "unlisted reference fails before resolving",
+			config:    `{"vars":[{"name":"DB_PASSWORD","reference":"op://Example/Service/password"},{"name":"API_TOKEN","reference":"op://Example/Service/token","optional":true}]}`,
+			wantError: "not on the allowlist",
+		},
+		{
+			name:      "fallback fields must be listed",
+			config:    `{"vars":[{"name":"DB_PASSWORD","reference":"op://Example/Service/password","fieldFallbacks":["credential"]}]}`,
+			wantError: "op://Example/Service/credential",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientCreated := false
+			cmd, _, _ := newTestEnvCommand(nil)
+			cmd.newClient = func(string) (env.Resolver, error) {
+				clientCreated = true
+				return &fakeResolver{secrets: map[string]string{"op://Example/Service/password": "test-password"}}, nil
+			}
+			if err := cmd.Init([]string{"-config-json", tt.config, "-allowlist", allowlist}); err != nil {
+				t.Fatalf("Unexpected init error: %v", err)
+			}
+
+			err := cmd.Run()
+			if tt.wantError == "" {
+				if err != nil {
+					t.Fatalf("Unexpected run error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+				t.Fatalf("Expected error containing %q, got %v", tt.wantError, err)
+			}
+			if clientCreated {
+				t.Error("Expected the allowlist check to run before creating a 1Password client")
+			}
+		})
+	}
+}
+
+func TestEnvCommand_References(t *testing.T) {
+	references := filepath.Join(t.TempDir(), "refs.json")
+	if err := os.WriteFile(references, []byte(`{"DB_PASSWORD":"op://Example/Service/password","API_TOKEN":"op://Example/Service/token"}`), 0600); err != nil {
+		t.Fatalf("Failed to write reference file: %v", err)
+	}
+	resolver := &fakeResolver{secrets: map[string]string{
+		"op://Example/Service/password": "test-password",
+		"op://Example/Service/token":    "test-token",
+	}}
+
+	tests := []struct {
+		name       string
+		config     string
+		wantOutput string
+		wantNotice string
+		wantError  string
+	}{
+		{
+			name:       "references are merged with inline vars",
+			config:     `{"format":"dotenv","vars":[{"name":"LOG_LEVEL","value":"info"}]}`,
+			wantOutput: "API_TOKEN=test-token\nDB_PASSWORD=test-password\nLOG_LEVEL=info\n",
+		},
+		{
+			name:       "static value overrides the reference file",
+			config:     `{"format":"dotenv","vars":[{"name":"DB_PASSWORD","value":"local"}]}`,
+			wantOutput: "API_TOKEN=test-token\nDB_PASSWORD=local\n",
+			wantNotice: "DB_PASSWORD has a static value",
+		},
+		{
+			name:      "conflicting inline reference is reported",
+			config:    `{"vars":[{"name":"API_TOKEN","reference":"op://Example/Other/token"}]}`,
+			wantError: "conflicts with the reference in the configuration",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, stdout, stderr := newTestEnvCommand(resolver)
+			if err := cmd.Init([]string{"-config-json", tt.config, "-references", references, "-verbose"}); err != nil {
+				t.Fatalf("Unexpected init error: %v", err)
+			}
+
+			err := cmd.Run()
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("Expected error containing %q, got %v", tt.wantError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected run error: %v", err)
+			}
+			if stdout.String() != tt.wantOutput {
+				t.Errorf("Expected output %q, got %q", tt.wantOutput, stdout.String())
+			}
+			if tt.wantNotice != "" && !strings.Contains(stderr.String(), tt.wantNotice) {
+				t.Errorf("Expected notice containing %q, got %q", tt.wantNotice, stderr.String())
+			}
+		})
+	}
+}
+
+func TestEnvCommand_QuoteStyle(t *testing.T) {
+	config := `{"vars":[
+		{"name":"DB_PASSWORD","reference":"op://Example/Service/password"},
+		{"name":"GREETING","value":"hello world"}
+	]}`
+	resolver := &fakeResolver{secrets: map[string]string{"op://Example/Service/password": "test-password"}}
+
+	cmd, stdout, _ := newTestEnvCommand(resolver)
+	if err := cmd.Init([]string{"-config-json", config, "-format", "dotenv", "-quote-style", "double"}); err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Unexpected run error: %v", err)
+	}
+	if expected := "DB_PASSWORD=\"test-password\"\nGREETING=\"hello world\"\n"; stdout.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, stdout.String())
+	}
+
+	cmd, _, _ = newTestEnvCommand(resolver)
+	if err := cmd.Init([]string{"-config-json", config, "-format", "dotenv", "-quote-style", "none"}); err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+	if err := cmd.Run(); err == nil || !strings.Contains(err.Error(), "Variable GREETING") {
+		t.Errorf("Expected -quote-style none to reject GREETING, got %v", err)
+	}
+
+	cmd, _, _ = newTestEnvCommand(resolver)
+	if err := cmd.Init([]string{"-config-json", config, "-quote-style", "fancy"}); err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+	if err := cmd.Run(); err == nil || !strings.Contains(err.Error(), "Unsupported dotenv quote style") {
+		t.Errorf("Expected unknown quote style error, got %v", err)
+	}
+}
+
+func TestEnvCommand_ShellAutoexport(t *testing.T) {
+	config := `{"vars":[
+		{"name":"DB_PASSWORD","reference":"op://Example/Service/password"},
+		{"name":"GREETING","value":"hello world"}
+	]}`
+	resolver := &fakeResolver{secrets: map[string]string{"op://Example/Service/password": "test-password"}}
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "brackets assignments",
+			args:     []string{"-config-json", config, "-shell-autoexport"},
+			expected: "set -a\nDB_PASSWORD='test-password'\nGREETING='hello world'\nset +a\n",
+		},
+		{
+			name:     "empty output stays empty",
+			args:     []string{"-config-json", `{"vars":[{"name":"API_TOKEN","reference":"op://Example/Service/token","optional":true}]}`, "-shell-autoexport"},
+			expected: "",
+		},
+		{
+			name:     "other formats are unchanged",
+			args:     []string{"-config-json", config, "-shell-autoexport", "-format", "dotenv"},
+			expected: "DB_PASSWORD=test-password\nGREETING=\"hello world\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, stdout, _ := newTestEnvCommand(resolver)
+			if err := cmd.Init(tt.args); err != nil {
+				t.Fatalf("Unexpected init error: %v", err)
+			}
+			if err := cmd.Run(); err != nil {
+				t.Fatalf("Unexpected run error: %v", err)
+			}
+			if stdout.String() != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, stdout.String())
+			}
+		})
+	}
+}
+
+func TestEnvCommand_FormatNone(t *testing.T) {
+	config := `{"vars":[
+		{"name":"DB_PASSWORD","reference":"op://Example/Service/password"},
+		{"name":"API_TOKEN","reference":"op://Example/Service/token","optional":true}
+	]}`
+
+	tests := []struct {
+		name       string
+		secrets    map[string]string
+		args       []string
+		wantErr    bool
+		wantStderr string
+	}{
+		{
+			name:       "all required references resolve",
+			secrets:    map[string]string{"op://Example/Service/password": "test-password"},
+			wantStderr: "Resolved 1 variables, skipped 1 optional\n",
+		},
+		{
+			name:    "required reference fails",
+			secrets: map[string]string{},
+			wantErr: true,
+		},
+		{
+			name:    "cannot write files",
+			secrets: map[string]string{"op://Example/Service/password": "test-password"},
+			args:    []string{"-output", filepath.Join(t.TempDir(), "app.env")},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, stdout, stderr := newTestEnvCommand(&fakeResolver{secrets: tt.secrets})
+
+			args := append([]string{"-config-json", config, "-format", "none"}, tt.args...)
+			if err := cmd.Init(args); err != nil {
+				t.Fatalf("Unexpected init error: %v", err)
+			}
+
+			err := cmd.Run()
+			if stdout.Len() != 0 {
+				t.Errorf("Expected no output, got %q", stdout.String())
+			}
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected run error: %v", err)
+			}
+			if !strings.HasSuffix(stderr.String(), tt.wantStderr) {
+				t.Errorf("Expected stderr to end with %q, got %q", tt.wantStderr, stderr.String())
+			}
+		})
+	}
+}
+
+func TestEnvCommand_RedactReferences(t *testing.T) {
+	config := `{"vars":[
+		{"name":"DB_PASSWORD","reference":"op://Example/Service/password"},
+		{"name":"API_TOKEN","reference":"op://Example/Payroll/token","optional":true}
+	]}`
+
+	resolver := &fakeResolver{secrets: map[string]string{"op://Example/Service/password": "test-password"}}
+	cmd, _, stderr := newTestEnvCommand(resolver)
+	if err := cmd.Init([]string{"-config-json", config, "-format", "dotenv", "-redact-references"}); err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Unexpected run error: %v", err)
+	}
+	if strings.Contains(stderr.String(), "Payroll") || !strings.Contains(stderr.String(), "op://Example/***/token") {
+		t.Errorf("Expected redacted warning, got %q", stderr.String())
+	}
+
+	cmd, _, _ = newTestEnvCommand(&fakeResolver{})
+	if err := cmd.Init([]string{"-config-json", config, "-format", "dotenv", "-redact-references"}); err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+	err := cmd.Run()
+	if err == nil {
+		t.Fatal("Expected error but got none")
+	}
+	if strings.Contains(err.Error(), "Service") {
+		t.Errorf("Expected redacted error, got %v", err)
+	}
+}
+
+func TestEnvCommand_Explain(t *testing.T) {
+	config := `{"defaultVault":"Example","vars":[
+		{"name":"DB_PASSWORD","reference":"op://Example/Shared/password"},
+		{"name":"API_TOKEN","reference":"op://Example/Service/token","optional":true},
+		{"name":"LOG_LEVEL","value":"debug"}
+	],"environments":{"production":{"vars":[
+		{"name":"DB_PASSWORD","reference":"Service/password","fieldFallbacks":["credential"]}
+	]}}}`
+
+	base := filepath.Join(t.TempDir(), "base.env")
+	if err := os.WriteFile(base, []byte("API_TOKEN=from-base\nPORT=8080\n"), 0600); err != nil {
+		t.Fatalf("Failed to write base file: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "environment override with fallback",
+			args: []string{"-explain", "DB_PASSWORD", "-environment", "production"},
+			want: []string{
+				"Config:   inline -config-json",
+				"Entry:    environments.production.vars[0], overriding vars[0]",
+				"Source:   reference op://Example/Service/password (written as Service/password)",
+				"Fallback: resolved from op://Example/Service/credential",
+				"Result:   resolved (15 characters)",
+			},
+		},
+		{
+			name: "static value",
+			args: []string{"-explain", "LOG_LEVEL"},
+			want: []string{"Entry:    vars[2]", "Source:   static value"},
+		},
+		{
+			name: "skipped optional falls back to base",
+			args: []string{"-explain", "API_TOKEN", "-base", base},
+			want: []string{"Result:   skipped:", "Base:     " + base + " supplies the value"},
+		},
+		{
+			name: "base only",
+			args: []string{"-explain", "PORT", "-base", base},
+			want: []string{"Source:   base file " + base, "passed through unchanged"},
+		},
+		{name: "undefined", args: []string{"-explain", "MISSING"}, wantErr: true},
+		{name: "conflicts with output", args: []string{"-explain", "DB_PASSWORD", "-raw", "DB_PASSWORD"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver := &fakeResolver{secrets: map[string]string{
+				"op://Example/Shared/password":    "shared-password",
+				"op://Example/Service/credential": "test-credential",
+			}}
+			cmd, stdout, _ := newTestEnvCommand(resolver)
+			if err := cmd.Init(append([]string{"-config-json", config}, tt.args...)); err != nil {
+				t.Fatalf("Unexpected init error: %v", err)
+			}
+
+			err := cmd.Run()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected run error: %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(stdout.String(), want) {
+					t.Errorf("Expected output to contain %q, got:\n%s", want, stdout.String())
+				}
+			}
+			for _, secret := range []string{"test-credential", "shared-password", "from-base", "debug"} {
+				if strings.Contains(stdout.String(), secret) {
+					t.Errorf("Expected no values in output, got:\n%s", stdout.String())
+				}
+			}
+		})
+	}
+}
+
+func TestEnvCommand_Prefix(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "service-a.json")
+	config := `{"vars":[{"name":"DB_PASSWORD","reference":"op://Example/Service/password"},{"name":"LOG_LEVEL","value":"debug"}]}`
+	if err := os.WriteFile(configPath, []byte(config), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "explicit prefix",
+			args: []string{"-config", configPath, "-prefix", "APP_"},
+			want: "APP_DB_PASSWORD=test-password\nAPP_LOG_LEVEL=debug\n",
+		},
+		{
+			name: "prefix from basename",
+			args: []string{"-config", configPath, "-env-prefix-from-file-basename"},
+			want: "SERVICE_A_DB_PASSWORD=test-password\nSERVICE_A_LOG_LEVEL=debug\n",
+		},
+		{name: "basename needs a file", args: []string{"-config-json", config, "-env-prefix-from-file-basename"}, wantErr: true},
+		{name: "both prefixes", args: []string{"-config", configPath, "-prefix", "APP_", "-env-prefix-from-file-basename"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver := &fakeResolver{secrets: map[string]string{"op://Example/Service/password": "test-password"}}
+			cmd, stdout, _ := newTestEnvCommand(resolver)
+			cmd.loadConfig = env.Load
+			if err := cmd.Init(append([]string{"-format", "dotenv"}, tt.args...)); err != nil {
+				t.Fatalf("Unexpected init error: %v", err)
+			}
+
+			err := cmd.Run()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected run error: %v", err)
+			}
+			if stdout.String() != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, stdout.String())
+			}
+		})
+	}
+}
+
+func TestRenderOutput_DockerEnv(t *testing.T) {
+	values := map[string]string{
+		"API_TOKEN": `quoted "value" with 'quotes'`,
+		"EMPTY":     "",
+		"URL":       "postgres://user@host/db?sslmode=require#frag",
+	}
+
+	got, err := renderOutput(values, nil, "docker-env", renderOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Values are literal to the end of the line, so nothing is quoted or escaped
+	expected := "API_TOKEN=quoted \"value\" with 'quotes'\nEMPTY=\nURL=postgres://user@host/db?sslmode=require#frag\n"
+	if got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+
+	for _, value := range []string{"line one\nline two", "carriage\rreturn"} {
+		_, err := renderOutput(map[string]string{"CERT": value}, nil, "docker-env", renderOptions{})
+		if err == nil || !strings.Contains(err.Error(), "CERT has a multi-line value") {
+			t.Errorf("Expected multi-line error for %q, got %v", value, err)
+		}
+	}
+}
+
+// loadProperties reads key=value lines the way java.util.Properties.load
+// does for the subset renderProperties produces
+func loadProperties(t *testing.T, content string) map[string]string {
+	t.Helper()
+	unescape := func(s string) string {
+		var b strings.Builder
+		for i := 0; i < len(s); i++ {
+			if s[i] != '\\' || i+1 == len(s) {
+				b.WriteByte(s[i])
+				continue
+			}
+			i++
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case 'f':
+				b.WriteByte('\f')
+			case 'u':
+				// Surrogate pairs arrive as two consecutive escapes
+				var units []uint16
+				for {
+					var unit uint16
+					fmt.Sscanf(s[i+1:i+5], "%04X", &unit)
+					units = append(units, unit)
+					i += 4
+					if !utf16.IsSurrogate(rune(unit)) || len(units) == 2 || !strings.HasPrefix(s[i+1:], `\u`) {
+						break
+					}
+					i += 2
+				}
+				b.WriteString(string(utf16.Decode(units)))
+			default:
+				b.WriteByte(s[i])
+			}
+		}
+		return b.String()
+	}
+
+	values := make(map[string]string)
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		for strings.HasSuffix(line, `\`) && !strings.HasSuffix(line, `\\`) && i+1 < len(lines) {
+			i++
+			line = line[:len(line)-1] + strings.TrimLeft(lines[i], " \t")
+		}
+		sep := -1
+		for j := 0; j < len(line); j++ {
+			if line[j] == '\\' {
+				j++
+				continue
+			}
+			if line[j] == '=' {
+				sep = j
+				break
+			}
+		}
+		if sep < 0 {
+			t.Fatalf("Expected a separator in %q", line)
+		}
+		values[unescape(line[:sep])] = unescape(line[sep+1:])
+	}
+	return values
+}
+
+func TestRenderOutput_Properties(t *testing.T) {
+	values := map[string]string{
+		"DB_URL":    "jdbc:postgresql://db:5432/app?user=admin",
+		"GREETING":  " héllo 🔑 #1!",
+		"CERT":      "line one\n  indented\nwindows\r",
+		"BACKSLASH": `C:\path\to`,
+	}
+
+	got, err := renderOutput(values, nil, "properties", renderOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := `BACKSLASH=C\:\\path\\to` + "\n" +
+		`CERT=line one\n\` + "\n" + `\  indented\n\` + "\n" + `windows\r` + "\n" +
+		`DB_URL=jdbc\:postgresql\://db\:5432/app?user\=admin` + "\n" +
+		`GREETING=\ h\u00E9llo \uD83D\uDD11 \#1\!` + "\n"
+	if got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+
+	decoded := loadProperties(t, got)
+	for key, value := range values {
+		if decoded[key] != value {
+			t.Errorf("Expected %s to decode to %q, got %q", key, value, decoded[key])
+		}
+	}
+}
+
+func TestRenderOutput_HCL(t *testing.T) {
+	values := map[string]string{
+		"DB_PASSWORD": `p@ss"w\rd`,
+		"CERT":        "line one\nline two\r\n",
+		"TEMPLATE":    "${var.region}-%{if x}$5{}",
+		"ESCAPED":     "$${already}",
+		"CONTROL":     "bell\a",
+	}
+
+	got, err := renderOutput(values, nil, "hcl", renderOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := `CERT = "line one\nline two\r\n"` + "\n" +
+		`CONTROL = "bell\u0007"` + "\n" +
+		`DB_PASSWORD = "p@ss\"w\\rd"` + "\n" +
+		`ESCAPED = "$$${already}"` + "\n" +
+		`TEMPLATE = "$${var.region}-%%{if x}$5{}"` + "\n"
+	if got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
+
+func TestEnvCommand_EnvFileReferences(t *testing.T) {
+	envFile := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(envFile, []byte("LEGACY_API_KEY=\"from-dotenv\"\n"), 0600); err != nil {
+		t.Fatalf("Failed to write env file: %v", err)
+	}
+
+	cases := []struct {
+		name   string
+		config string
+		want   string
+	}{
+		{"without 1Password references", `{"vars":[{"name":"API_KEY","reference":"env://LEGACY_API_KEY"}]}`, "API_KEY=from-dotenv\n"},
+		{"mixed with 1Password references", `{"vars":[{"name":"API_KEY","reference":"env://LEGACY_API_KEY"},{"name":"TOKEN","reference":"op://Vault/Item/token"}]}`, "API_KEY=from-dotenv\nTOKEN=secret-token\n"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			clients := 0
+			cmd, stdout, _ := newTestEnvCommand(nil)
+			cmd.newClient = func(string) (env.Resolver, error) {
+				clients++
+				return &fakeResolver{secrets: map[string]string{"op://Vault/Item/token": "secret-token"}}, nil
+			}
+			if err := cmd.Init([]string{"-config-json", tc.config, "-env-file", envFile, "-format", "dotenv"}); err != nil {
+				t.Fatalf("Unexpected init error: %v", err)
+			}
+			if err := cmd.Run(); err != nil {
+				t.Fatalf("Unexpected run error: %v", err)
+			}
+			if stdout.String() != tc.want {
+				t.Errorf("Expected %q, got %q", tc.want, stdout.String())
+			}
+			if wantClients := strings.Count(tc.config, "op://"); clients != wantClients {
+				t.Errorf("Expected %d 1Password clients, got %d", wantClients, clients)
+			}
+		})
+	}
+}
+
+func TestEnvCommand_UpdateRefusesTrackedFile(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	repo := t.TempDir()
+	if output, err := exec.Command("git", "init", "-q", repo).CombinedOutput(); err != nil {
+		t.Fatalf("Failed to init repository: %v: %s", err, output)
+	}
+	updatePath := filepath.Join(repo, "app.env")
+	if err := os.WriteFile(updatePath, []byte("LOCAL_ONLY=1\n"), 0600); err != nil {
+		t.Fatalf("Failed to write dotenv file: %v", err)
+	}
+
+	resolver := &fakeResolver{secrets: map[string]string{"op://Example/Service/password": "test-password"}}
+	for _, allow := range []bool{false, true} {
+		cmd, _, _ := newTestEnvCommand(resolver)
+		cmd.gitUnignored = pathUnignoredInGit
+		args := []string{
+			"-config-json", `{"vars":[{"name":"DB_PASSWORD","reference":"op://Example/Service/password"}]}`,
+			"-update", updatePath,
+		}
+		if allow {
+			args = append(args, "-allow-tracked")
+		}
+		if err := cmd.Init(args); err != nil {
+			t.Fatalf("Unexpected init error: %v", err)
+		}
+
+		err := cmd.Run()
+		content, readErr := os.ReadFile(updatePath)
+		if readErr != nil {
+			t.Fatalf("Failed to read dotenv file: %v", readErr)
+		}
+		if allow {
+			if err != nil {
+				t.Errorf("Expected -allow-tracked to permit the update, got %v", err)
+			}
+			if !strings.Contains(string(content), "DB_PASSWORD=test-password") {
+				t.Errorf("Expected the file to be updated, got %q", string(content))
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), ".gitignore") {
+			t.Errorf("Expected an unignored -update file to be refused, got %v", err)
+		}
+		if string(content) != "LOCAL_ONLY=1\n" {
+			t.Errorf("Expected the refused file to be left alone, got %q", string(content))
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/brizzbuzz/opnix/pkg/env"
+)
+
+// envExampleCommand implements "opnix env example", printing a committable
+// dotenv-style file of variable names and references without resolving
+// anything. It shares configuration loading with the env command.
+type envExampleCommand struct {
+	fs  *flag.FlagSet
+	env *envCommand
+}
+
+func newEnvExampleCommand(e *envCommand) *envExampleCommand {
+	xc := &envExampleCommand{
+		fs:  flag.NewFlagSet("env example", flag.ExitOnError),
+		env: e,
+	}
+
+	xc.fs.StringVar(&e.configPath, "config", "", "Path to environment configuration file")
+	xc.fs.StringVar(&e.configJSON, "config-json", "", "Inline environment configuration as JSON")
+	xc.fs.StringVar(&e.environment, "environment", "", "Named environment block to layer over the shared vars")
+	xc.fs.StringVar(&e.vault, "vault", "", "Default vault for short Item/field references (overrides defaultVault)")
+
+	xc.fs.Usage = func() {
+		fmt.Fprintf(xc.fs.Output(), "Usage: opnix env example [options] > .env.example\n\n")
+		fmt.Fprintf(xc.fs.Output(), "Print variable names and their references as a dotenv file, without resolving secrets\n\n")
+		fmt.Fprintf(xc.fs.Output(), "Options:\n")
+		xc.fs.PrintDefaults()
+	}
+
+	return xc
+}
+
+func (x *envExampleCommand) Init(args []string) error {
+	x.fs.SetOutput(x.env.stderr)
+	return x.fs.Parse(args)
+}
+
+func (x *envExampleCommand) Run() error {
+	cfg, err := x.env.resolveConfig()
+	if err != nil {
+		return err
+	}
+	if cfg, err = cfg.Select(x.env.environment); err != nil {
+		return err
+	}
+	if err := cfg.QualifyReferences(x.env.vault); err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprint(x.env.stdout, renderExample(cfg))
+	return err
+}
+
+// renderExample lists each variable in configuration order as KEY=reference,
+// leaving static values empty, with its description and optional status as
+// comments above it
+func renderExample(cfg *env.Config) string {
+	var b strings.Builder
+	b.WriteString("# Generated by opnix env example. Values are 1Password references, not secrets.\n")
+	for _, variable := range cfg.Vars {
+		b.WriteString("\n")
+		if variable.Description != "" {
+			for _, line := range strings.Split(strings.TrimSpace(variable.Description), "\n") {
+				fmt.Fprintf(&b, "# %s\n", strings.TrimSpace(line))
+			}
+		}
+		if cfg.IsOptional(variable) {
+			b.WriteString("# Optional\n")
+		}
+		fmt.Fprintf(&b, "%s=%s\n", variable.Name, dotenvValue(variable.Reference))
+	}
+	return b.String()
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	stderrors "errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"github.com/brizzbuzz/opnix/internal/errors"
+)
+
+// execOptions holds the child command for "opnix env exec"
+type execOptions struct {
+	command  []string
+	clearEnv bool
+}
+
+// childExitError carries a child's non-zero exit status through to the
+// opnix exit code. The child already reported its own failure, so it is
+// not printed again.
+type childExitError struct {
+	code int
+}
+
+func (e *childExitError) Error() string {
+	return fmt.Sprintf("command exited with status %d", e.code)
+}
+
+func (e *childExitError) exitCode() int { return e.code }
+
+// initExec registers the exec flags alongside the env flags. Everything
+// after the flags, usually following "--", is the command to run.
+func (e *envCommand) initExec(args []string) error {
+	e.registerExecFlags()
+	e.fs.SetOutput(e.stderr)
+	if err := e.fs.Parse(args); err != nil {
+		return err
+	}
+	e.exec.command = e.fs.Args()
+	return nil
+}
+
+// registerExecFlags adds the exec flags to the env flag set
+func (e *envCommand) registerExecFlags() {
+	e.exec = &execOptions{}
+	e.fs.BoolVar(&e.exec.clearEnv, "clear-env", false, "Start the command from an empty environment containing only the resolved variables")
+}
+
+// checkExec requires a command and rejects flags that pick a kind of output,
+// since exec hands values to the child instead of printing them
+func (e *envCommand) checkExec() error {
+	if len(e.exec.command) == 0 {
+		return errors.ConfigValidationError(
+			"env.exec",
+			"<empty>",
+			"A command to run is required",
+			[]string{"Example: opnix env exec -config opnix-env.json -- go test ./..."},
+		)
+	}
+	return e.checkConflicts(
+		"env.exec",
+		strings.Join(e.exec.command, " "),
+		"exec passes values to the command instead of writing output",
+		outputFlags,
+		"Run opnix env separately to write output files",
+	)
+}
+
+// childEnvironment returns the environment for the child: the current
+// environment, or nothing with -clear-env, with values layered on top
+func (e *envCommand) childEnvironment(values map[string]string) []string {
+	var environ []string
+	if !e.exec.clearEnv {
+		for _, entry := range os.Environ() {
+			name, _, _ := strings.Cut(entry, "=")
+			if _, ok := values[name]; !ok {
+				environ = append(environ, entry)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		environ = append(environ, name+"="+values[name])
+	}
+	return environ
+}
+
+// runExec starts the command with the resolved values in its environment
+// and waits for it. Only the child's environment is changed; opnix never
+// sets the values in its own process.
+func (e *envCommand) runExec(values map[string]string) error {
+	return e.runChild(e.exec.command, e.childEnvironment(values))
+}
+
+// runChildProcess runs argv with environ, forwarding SIGINT and SIGTERM so
+// the child can shut down cleanly, and maps its exit status to a
+// childExitError. The child stays in opnix's process group so it keeps the
+// terminal for interactive input.
+func (e *envCommand) runChildProcess(argv, environ []string) error {
+	child := exec.Command(argv[0], argv[1:]...)
+	child.Env = environ
+	child.Stdin = os.Stdin
+	child.Stdout = e.stdout
+	child.Stderr = e.stderr
+
+	if err := child.Start(); err != nil {
+		return &errors.OpnixError{
+			Operation: "Running command with resolved environment",
+			Component: "environment exec",
+			Issue:     fmt.Sprintf("Failed to start %s", argv[0]),
+			Cause:     err,
+			Suggestions: []string{
+				"Check that the command is installed and on PATH",
+				"Separate opnix flags from the command with --",
+			},
+		}
+	}
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				if shouldForward(sig, terminalForeground()) {
+					_ = child.Process.Signal(sig)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	err := child.Wait()
+	var exitErr *exec.ExitError
+	if stderrors.As(err, &exitErr) {
+		code := exitErr.ExitCode()
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			code = 128 + int(status.Signal())
+		}
+		return &childExitError{code: code}
+	}
+	return err
+}
+
+// shouldForward reports whether sig must be passed on to the child. Ctrl+C
+// in a terminal interrupts the whole foreground process group, so the child
+// already has that SIGINT; a SIGINT sent to opnix alone, or a SIGTERM, is
+// forwarded.
+func shouldForward(sig os.Signal, foreground bool) bool {
+	return sig != os.Interrupt || !foreground
+}
+
+// terminalForeground reports whether opnix is in the foreground process
+// group of its controlling terminal
+func terminalForeground() bool {
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return false
+	}
+	defer tty.Close()
+
+	var pgrp int32
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, tty.Fd(), syscall.TIOCGPGRP, uintptr(unsafe.Pointer(&pgrp))); errno != 0 {
+		return false
+	}
+	return int(pgrp) == syscall.Getpgrp()
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestEnvCommand_Exec(t *testing.T) {
+	config := `{"vars":[
+		{"name":"DB_PASSWORD","reference":"op://Example/Service/password"},
+		{"name":"LOG_LEVEL","value":"info"}
+	]}`
+	t.Setenv("OPNIX_EXEC_PARENT", "parent")
+	t.Setenv("LOG_LEVEL", "debug")
+
+	tests := []struct {
+		name     string
+		args     []string
+		present  []string
+		absent   []string
+		wantArgv []string
+	}{
+		{
+			name:     "layers values over the current environment",
+			args:     []string{"exec", "-config-json", config, "--", "go", "test", "./..."},
+			present:  []string{"DB_PASSWORD=test-password", "LOG_LEVEL=info", "OPNIX_EXEC_PARENT=parent"},
+			absent:   []string{"LOG_LEVEL=debug"},
+			wantArgv: []string{"go", "test", "./..."},
+		},
+		{
+			name:     "clear-env starts from an empty environment",
+			args:     []string{"exec", "-clear-env", "-config-json", config, "--", "env"},
+			present:  []string{"DB_PASSWORD=test-password", "LOG_LEVEL=info"},
+			absent:   []string{"OPNIX_EXEC_PARENT=parent", "LOG_LEVEL=debug"},
+			wantArgv: []string{"env"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver := &fakeResolver{secrets: map[string]string{"op://Example/Service/password": "test-password"}}
+			cmd, stdout, _ := newTestEnvCommand(resolver)
+			var gotArgv, gotEnv []string
+			cmd.runChild = func(argv, environ []string) error {
+				gotArgv, gotEnv = argv, environ
+				return nil
+			}
+
+			if err := cmd.Init(tt.args); err != nil {
+				t.Fatalf("Unexpected init error: %v", err)
+			}
+			if err := cmd.Run(); err != nil {
+				t.Fatalf("Unexpected run error: %v", err)
+			}
+
+			if strings.Join(gotArgv, " ") != strings.Join(tt.wantArgv, " ") {
+				t.Errorf("Expected argv %v, got %v", tt.wantArgv, gotArgv)
+			}
+			environ := make(map[string]bool, len(gotEnv))
+			for _, entry := range gotEnv {
+				environ[entry] = true
+			}
+			for _, entry := range tt.present {
+				if !environ[entry] {
+					t.Errorf("Expected child environment to contain %s", entry)
+				}
+			}
+			for _, entry := range tt.absent {
+				if environ[entry] {
+					t.Errorf("Expected child environment not to contain %s", entry)
+				}
+			}
+			if stdout.Len() != 0 {
+				t.Errorf("Expected nothing on stdout, got %q", stdout.String())
+			}
+		})
+	}
+}
+
+func TestEnvCommand_ExecValidation(t *testing.T) {
+	config := `{"vars":[{"name":"LOG_LEVEL","value":"info"}]}`
+
+	tests := []struct {
+		name      string
+		args      []string
+		wantError string
+	}{
+		{"missing command", []string{"exec", "-config-json", config}, "A command to run is required"},
+		{"conflicting output flag", []string{"exec", "-config-json", config, "-format", "json", "--", "true"}, "cannot be combined with -format"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, _, _ := newTestEnvCommand(&fakeResolver{})
+			cmd.runChild = func([]string, []string) error {
+				t.Fatal("Expected the command not to run")
+				return nil
+			}
+			if err := cmd.Init(tt.args); err != nil {
+				t.Fatalf("Unexpected init error: %v", err)
+			}
+			if err := cmd.Run(); err == nil || !strings.Contains(err.Error(), tt.wantError) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantError, err)
+			}
+		})
+	}
+}
+
+func TestEnvCommand_RunChildProcess(t *testing.T) {
+	cmd, stdout, _ := newTestEnvCommand(nil)
+
+	if err := cmd.runChildProcess([]string{"sh", "-c", `printf %s "$DB_PASSWORD"`}, []string{"DB_PASSWORD=test-password"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if stdout.String() != "test-password" {
+		t.Errorf("Expected the child to see its environment, got %q", stdout.String())
+	}
+
+	err := cmd.runChildProcess([]string{"sh", "-c", "exit 7"}, nil)
+	if code := exitCodeFor(err); code != 7 {
+		t.Errorf("Expected the child's exit status 7, got %d (%v)", code, err)
+	}
+
+	if err := cmd.runChildProcess([]string{"opnix-missing-command"}, nil); err == nil || !strings.Contains(err.Error(), "Failed to start opnix-missing-command") {
+		t.Errorf("Expected start failure, got %v", err)
+	}
+}
+
+func TestShouldForward(t *testing.T) {
+	tests := []struct {
+		name       string
+		sig        os.Signal
+		foreground bool
+		want       bool
+	}{
+		{"terminal interrupt reaches the child directly", os.Interrupt, true, false},
+		{"interrupt sent to opnix alone", os.Interrupt, false, true},
+		{"terminate in the foreground", syscall.SIGTERM, true, true},
+		{"terminate in the background", syscall.SIGTERM, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shouldForward(tt.sig, tt.foreground); got != tt.want {
+				t.Errorf("shouldForward(%v, %v) = %v, want %v", tt.sig, tt.foreground, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/brizzbuzz/opnix/internal/errors"
+	"github.com/brizzbuzz/opnix/pkg/env"
+)
+
+// variableExplanation records where -explain found a variable before its
+// references were qualified and resolved
+type variableExplanation struct {
+	// name is the variable as configured; key is the output name after any
+	// -prefix is applied
+	name   string
+	key    string
+	config string
+
+	// entry is the configuration path of the effective definition and
+	// overrides the shared entry an environment replaced, if any
+	entry     string
+	overrides string
+	written   env.Variable
+	defined   bool
+
+	inBase bool
+}
+
+// explainEntry locates the -explain variable in the loaded configuration.
+// It must run before QualifyReferences so the reference is seen as written.
+func (e *envCommand) explainEntry(loaded *env.Config, prefix string) (*variableExplanation, error) {
+	x := &variableExplanation{name: e.explain, key: prefix + e.explain, config: e.configSource}
+
+	if loaded != nil {
+		for i, variable := range loaded.Vars {
+			if variable.Name == x.name {
+				x.entry = fmt.Sprintf("vars[%d]", i)
+				x.written = variable
+				x.defined = true
+			}
+		}
+		if e.environment != "" {
+			for i, variable := range loaded.Environments[e.environment].Vars {
+				if variable.Name == x.name {
+					x.overrides = x.entry
+					x.entry = fmt.Sprintf("environments.%s.vars[%d]", e.environment, i)
+					x.written = variable
+					x.defined = true
+				}
+			}
+		}
+	}
+
+	if e.basePath != "" {
+		baseValues, _, err := loadBaseDotenv(e.basePath)
+		if err != nil {
+			return nil, err
+		}
+		_, x.inBase = baseValues[x.key]
+	}
+
+	if !x.defined && !x.inBase {
+		return nil, errors.ConfigValidationError(
+			"env.explain",
+			x.name,
+			"Variable is not defined in the configuration or the -base file",
+			[]string{"Check the variable name and the selected -environment"},
+		)
+	}
+	return x, nil
+}
+
+// writeExplanation reports the provenance of the explained variable without
+// printing its value
+func (e *envCommand) writeExplanation(w io.Writer, x *variableExplanation, cfg *env.Config, result *env.Result) error {
+	var b strings.Builder
+	row := func(label, format string, args ...interface{}) {
+		fmt.Fprintf(&b, "  %-10s%s\n", label+":", fmt.Sprintf(format, args...))
+	}
+
+	fmt.Fprintf(&b, "%s\n", x.key)
+	if x.config != "" {
+		row("Config", "%s", x.config)
+	}
+
+	if !x.defined {
+		row("Source", "base file %s", e.basePath)
+		row("Result", "passed through unchanged")
+		return e.printExplanation(w, b.String())
+	}
+
+	if x.overrides != "" {
+		row("Entry", "%s, overriding %s", x.entry, x.overrides)
+	} else {
+		row("Entry", "%s", x.entry)
+	}
+
+	var variable env.Variable
+	for _, candidate := range cfg.Vars {
+		if candidate.Name == x.key {
+			variable = candidate
+		}
+	}
+
+	if variable.Reference != "" {
+		if variable.Reference != x.written.Reference {
+			row("Source", "reference %s (written as %s)", variable.Reference, x.written.Reference)
+		} else {
+			row("Source", "reference %s", variable.Reference)
+		}
+		if variable.Account != "" {
+			row("Account", "%s", variable.Account)
+		}
+	} else {
+		row("Source", "static value")
+	}
+
+	value, resolved := result.Values[x.key]
+	if len(variable.FieldFallbacks) > 0 && resolved {
+		if source := result.Sources[x.key]; source != variable.Reference {
+			row("Fallback", "resolved from %s", source)
+		} else {
+			row("Fallback", "not used; the primary field resolved")
+		}
+	}
+
+	switch {
+	case resolved:
+		row("Result", "resolved (%d characters)", len([]rune(value)))
+	default:
+		for _, skipped := range result.Skipped {
+			if skipped.Name == x.key {
+				// Structured errors span several lines; keep them under the label
+				row("Result", "skipped: %s", strings.ReplaceAll(skipped.Err.Error(), "\n", "\n            "))
+			}
+		}
+	}
+
+	if x.inBase {
+		if resolved {
+			row("Base", "%s also sets %s; the resolved value takes precedence", e.basePath, x.key)
+		} else {
+			row("Base", "%s supplies the value because the variable was skipped", e.basePath)
+		}
+	}
+
+	return e.printExplanation(w, b.String())
+}
+
+func (e *envCommand) printExplanation(w io.Writer, text string) error {
+	if e.redactRefs {
+		text = redactReferences(text)
+	}
+	_, err := fmt.Fprint(w, text)
+	return err
+}
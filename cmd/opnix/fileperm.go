@@ -0,0 +1,88 @@
+package main
+
+import (
+	stderrors "errors"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+
+	"github.com/brizzbuzz/opnix/internal/errors"
+	"github.com/brizzbuzz/opnix/pkg/env"
+)
+
+// writeSecretFile writes resolved output to path with the owner, group, and
+// mode configured for it under "files". A chown the process lacks the
+// privilege for is reported as a warning, since the file is still written
+// but the service meant to read it may not be able to.
+func (e *envCommand) writeSecretFile(cfg *env.Config, path, content string) error {
+	options := cfg.FileOptionsFor(path)
+	chown, err := e.fileChown(path, options)
+	if err != nil {
+		return err
+	}
+	return writeOwnedOutputFile(path, content, options.FileMode(), chown)
+}
+
+// fileChown returns the step that gives the temporary file written for path
+// the owner and group in options before it is moved into place, or nil when
+// neither is set. It runs after the mode is set, so the warning can report it.
+func (e *envCommand) fileChown(path string, options env.FileOptions) (func(string) error, error) {
+	uid, err := lookupFileOwner(path, options.Owner)
+	if err != nil {
+		return nil, err
+	}
+	gid, err := lookupFileGroup(path, options.Group)
+	if err != nil {
+		return nil, err
+	}
+	if uid == -1 && gid == -1 {
+		return nil, nil
+	}
+
+	return func(tmpPath string) error {
+		err := e.chown(tmpPath, uid, gid)
+		if err == nil {
+			return nil
+		}
+		if stderrors.Is(err, os.ErrPermission) {
+			mode := options.FileMode()
+			if info, statErr := os.Stat(tmpPath); statErr == nil {
+				mode = info.Mode().Perm()
+			}
+			e.noticef("WARNING: Could not change the ownership of %s to %s:%s without privilege; it was written with mode %04o and owned by the current user, so the service may not be able to read it\n",
+				path, options.Owner, options.Group, mode)
+			return nil
+		}
+		return errors.FileOperationError(
+			"Writing environment output",
+			path,
+			fmt.Sprintf("Failed to change ownership to %s:%s", options.Owner, options.Group),
+			err,
+		)
+	}, nil
+}
+
+// lookupFileOwner returns the UID of owner, or -1 when no owner is set
+func lookupFileOwner(path, owner string) (int, error) {
+	if owner == "" {
+		return -1, nil
+	}
+	u, err := user.Lookup(owner)
+	if err != nil {
+		return -1, errors.UserGroupError(fmt.Sprintf("Setting ownership of %s", path), owner, "user", nil)
+	}
+	return strconv.Atoi(u.Uid)
+}
+
+// lookupFileGroup returns the GID of group, or -1 when no group is set
+func lookupFileGroup(path, group string) (int, error) {
+	if group == "" {
+		return -1, nil
+	}
+	g, err := user.LookupGroup(group)
+	if err != nil {
+		return -1, errors.UserGroupError(fmt.Sprintf("Setting ownership of %s", path), group, "group", nil)
+	}
+	return strconv.Atoi(g.Gid)
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	stderrors "errors"
+	"os/exec"
+	"path/filepath"
+)
+
+// pathUnignoredInGit reports whether path lies inside a git work tree without
+// being ignored, meaning a resolved file written there could be committed.
+// Paths outside a repository, or systems without git, are never reported.
+func pathUnignoredInGit(path string) (bool, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return false, nil
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false, err
+	}
+
+	// check-ignore exits 0 for ignored paths, 1 for paths that are not
+	// ignored, and 128 when the directory is not inside a repository
+	err = exec.Command("git", "-C", filepath.Dir(abs), "check-ignore", "-q", "--", abs).Run()
+	var exitErr *exec.ExitError
+	return stderrors.As(err, &exitErr) && exitErr.ExitCode() == 1, nil
+}
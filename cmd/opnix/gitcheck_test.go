@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPathUnignoredInGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	repo := t.TempDir()
+	if output, err := exec.Command("git", "init", "-q", repo).CombinedOutput(); err != nil {
+		t.Fatalf("Failed to init repository: %v: %s", err, output)
+	}
+	if err := os.WriteFile(filepath.Join(repo, ".gitignore"), []byte("*.secret\n"), 0644); err != nil {
+		t.Fatalf("Failed to write .gitignore: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		want bool
+	}{
+		{"not ignored", filepath.Join(repo, ".env"), true},
+		{"ignored", filepath.Join(repo, "app.secret"), false},
+		{"outside repository", filepath.Join(t.TempDir(), ".env"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := pathUnignoredInGit(tt.path)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestEnvCommand_RefusesTrackedOutput(t *testing.T) {
+	resolver := &fakeResolver{secrets: map[string]string{"op://Vault/Item/token": "secret-token"}}
+	outputPath := filepath.Join(t.TempDir(), ".env")
+
+	for _, allow := range []bool{false, true} {
+		cmd, _, _ := newTestEnvCommand(resolver)
+		cmd.gitUnignored = func(string) (bool, error) { return true, nil }
+
+		args := []string{
+			"-config-json", `{"vars":[{"name":"API_TOKEN","reference":"op://Vault/Item/token"}]}`,
+			"-output", outputPath,
+		}
+		if allow {
+			args = append(args, "-allow-tracked")
+		}
+		if err := cmd.Init(args); err != nil {
+			t.Fatalf("Unexpected init error: %v", err)
+		}
+
+		err := cmd.Run()
+		_, statErr := os.Stat(outputPath)
+		if allow {
+			if err != nil {
+				t.Errorf("Expected -allow-tracked to permit the write, got %v", err)
+			}
+			if statErr != nil {
+				t.Errorf("Expected output file to be written: %v", statErr)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), ".gitignore") {
+			t.Errorf("Expected tracked output path to be refused, got %v", err)
+		}
+		if statErr == nil {
+			t.Error("Expected no output file to be written for a tracked path")
+		}
+	}
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/brizzbuzz/opnix/internal/errors"
+	"github.com/brizzbuzz/opnix/internal/onepass"
+	"github.com/brizzbuzz/opnix/pkg/env"
+)
+
+const referencePrefix = "op://"
+
+type injectCommand struct {
+	fs *flag.FlagSet
+
+	inPath       string
+	outPath      string
+	tokenFile    string
+	allowMissing bool
+	json         bool
+
+	stdout io.Writer
+	stderr io.Writer
+
+	newClient func(string) (env.Resolver, error)
+}
+
+func newInjectCommand() *injectCommand {
+	cmd := &injectCommand{
+		fs:     flag.NewFlagSet("inject", flag.ExitOnError),
+		stdout: os.Stdout,
+		stderr: os.Stderr,
+	}
+
+	cmd.fs.StringVar(&cmd.inPath, "in", "", "Path to the file containing op:// references")
+	cmd.fs.StringVar(&cmd.outPath, "out", "", "Path to write the resolved file (default stdout)")
+	cmd.fs.StringVar(&cmd.tokenFile, "token-file", defaultTokenPath, "Path to file containing 1Password service account token")
+	cmd.fs.BoolVar(&cmd.allowMissing, "allow-missing", false, "Leave references that fail to resolve unchanged instead of aborting")
+	cmd.fs.BoolVar(&cmd.json, "json", false, "Parse the input as JSON and replace only string values that are exactly an op:// reference, re-serializing the result")
+
+	cmd.fs.Usage = func() {
+		fmt.Fprintf(cmd.fs.Output(), "Usage: opnix inject -in <file> [-out <file>] [options]\n\n")
+		fmt.Fprintf(cmd.fs.Output(), "Replace op:// references embedded in a file with their resolved values\n\n")
+		fmt.Fprintf(cmd.fs.Output(), "Options:\n")
+		cmd.fs.PrintDefaults()
+	}
+
+	cmd.newClient = func(path string) (env.Resolver, error) {
+		return onepass.NewClient(path)
+	}
+
+	return cmd
+}
+
+func (i *injectCommand) Name() string { return i.fs.Name() }
+
+func (i *injectCommand) Flags() *flag.FlagSet { return i.fs }
+
+func (i *injectCommand) Init(args []string) error {
+	i.fs.SetOutput(i.stderr)
+	return i.fs.Parse(args)
+}
+
+func (i *injectCommand) Run() error {
+	if i.inPath == "" {
+		return errors.ConfigValidationError(
+			"inject.in",
+			"<empty>",
+			"An input file is required",
+			[]string{"Pass the file to resolve with -in <file>"},
+		)
+	}
+
+	input, err := os.ReadFile(i.inPath)
+	if err != nil {
+		return errors.FileOperationError(
+			"Reading file for reference injection",
+			i.inPath,
+			"Failed to read input file",
+			err,
+		)
+	}
+
+	var resolver env.Resolver = staticResolver{}
+	if len(findReferences(string(input))) > 0 {
+		client, err := i.newClient(i.tokenFile)
+		if err != nil {
+			return err
+		}
+		resolver = env.NewCachingResolver(client)
+	}
+
+	inject := injectReferences
+	if i.json {
+		inject = injectJSONReferences
+	}
+	output, err := inject(string(input), resolver, func(reference string, err error) error {
+		if !i.allowMissing {
+			return errors.WrapWithSuggestions(
+				err,
+				fmt.Sprintf("Injecting reference %s", reference),
+				"reference injection",
+				[]string{
+					"Verify the reference exists in 1Password",
+					"Use -allow-missing to leave unresolved references in place",
+				},
+			)
+		}
+		fmt.Fprintf(i.stderr, "WARNING: Left unresolved reference %s: %v\n", reference, err)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if i.outPath == "" {
+		fmt.Fprint(i.stdout, output)
+		return nil
+	}
+
+	if err := os.WriteFile(i.outPath, []byte(output), 0600); err != nil {
+		return errors.FileOperationError(
+			"Writing injected file",
+			i.outPath,
+			"Failed to write resolved output",
+			err,
+		)
+	}
+	return nil
+}
+
+// referenceSpan locates a reference token within a larger document
+type referenceSpan struct {
+	start, end int
+	quote      byte
+}
+
+// findReferences scans content for op:// tokens. A reference that directly
+// follows a quote character extends to the matching closing quote on the same
+// line, so quoted references may contain spaces. Unquoted references end at
+// whitespace or a structural delimiter.
+func findReferences(content string) []referenceSpan {
+	var spans []referenceSpan
+	offset := 0
+	for {
+		idx := strings.Index(content[offset:], referencePrefix)
+		if idx < 0 {
+			return spans
+		}
+		start := offset + idx
+
+		var quote byte
+		if start > 0 && strings.IndexByte(`"'`+"`", content[start-1]) >= 0 {
+			quote = content[start-1]
+		}
+
+		end := start + len(referencePrefix)
+		for end < len(content) {
+			c := content[end]
+			if c == '\n' || c == '\r' {
+				break
+			}
+			if quote != 0 {
+				if c == quote {
+					break
+				}
+			} else if strings.IndexByte(" \t\"'`,;)]}>", c) >= 0 {
+				break
+			}
+			end++
+		}
+
+		// A quoted token without a closing quote on its line is read as unquoted
+		if quote != 0 && (end >= len(content) || content[end] != quote) {
+			quote = 0
+			end = start + len(referencePrefix)
+			for end < len(content) && strings.IndexByte(" \t\r\n\"'`,;)]}>", content[end]) < 0 {
+				end++
+			}
+		}
+
+		if end > start+len(referencePrefix) {
+			spans = append(spans, referenceSpan{start: start, end: end, quote: quote})
+		}
+		offset = end
+	}
+}
+
+// injectReferences replaces every reference in content with its resolved
+// value, escaping values placed inside quotes. onError decides whether a
+// failed lookup aborts; returning nil leaves the reference untouched.
+func injectReferences(content string, resolver env.Resolver, onError func(string, error) error) (string, error) {
+	var b strings.Builder
+	last := 0
+	for _, span := range findReferences(content) {
+		reference := content[span.start:span.end]
+		b.WriteString(content[last:span.start])
+		last = span.end
+
+		value, err := resolver.ResolveSecret(reference)
+		if err != nil {
+			if err := onError(reference, err); err != nil {
+				return "", err
+			}
+			b.WriteString(reference)
+			continue
+		}
+
+		b.WriteString(escapeForQuote(value, span.quote))
+	}
+	b.WriteString(content[last:])
+	return b.String(), nil
+}
+
+// injectJSONReferences parses content as JSON and replaces every string
+// value that is exactly an op:// reference with its resolved value. Object
+// keys, references inside longer strings, and non-string values are left
+// as they are; member order and number formatting are preserved. The
+// result is re-serialized with two-space indentation.
+func injectJSONReferences(content string, resolver env.Resolver, onError func(string, error) error) (string, error) {
+	decoder := json.NewDecoder(strings.NewReader(content))
+	decoder.UseNumber()
+
+	var b bytes.Buffer
+	if err := injectJSONValue(decoder, &b, resolver, onError); err != nil {
+		return "", err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return "", invalidJSONInput(fmt.Errorf("unexpected data after the top-level value"))
+	}
+
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, b.Bytes(), "", "  "); err != nil {
+		return "", invalidJSONInput(err)
+	}
+	indented.WriteByte('\n')
+	return indented.String(), nil
+}
+
+// injectJSONValue copies the next JSON value from decoder to b in compact
+// form, resolving string values that are references
+func injectJSONValue(decoder *json.Decoder, b *bytes.Buffer, resolver env.Resolver, onError func(string, error) error) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return invalidJSONInput(err)
+	}
+
+	switch t := token.(type) {
+	case json.Delim:
+		closing := byte('}')
+		if t == '[' {
+			closing = ']'
+		}
+		b.WriteByte(byte(t))
+		for first := true; decoder.More(); first = false {
+			if !first {
+				b.WriteByte(',')
+			}
+			if t == '{' {
+				key, err := decoder.Token()
+				if err != nil {
+					return invalidJSONInput(err)
+				}
+				writeJSONString(b, key.(string))
+				b.WriteByte(':')
+			}
+			if err := injectJSONValue(decoder, b, resolver, onError); err != nil {
+				return err
+			}
+		}
+		if _, err := decoder.Token(); err != nil {
+			return invalidJSONInput(err)
+		}
+		b.WriteByte(closing)
+	case string:
+		if !strings.HasPrefix(t, referencePrefix) {
+			writeJSONString(b, t)
+			return nil
+		}
+		value, err := resolver.ResolveSecret(t)
+		if err != nil {
+			if err := onError(t, err); err != nil {
+				return err
+			}
+			writeJSONString(b, t)
+			return nil
+		}
+		writeJSONString(b, value)
+	case json.Number:
+		b.WriteString(t.String())
+	case bool:
+		fmt.Fprintf(b, "%t", t)
+	case nil:
+		b.WriteString("null")
+	}
+	return nil
+}
+
+// writeJSONString writes value as a JSON string without HTML escaping
+func writeJSONString(b *bytes.Buffer, value string) {
+	encoder := json.NewEncoder(b)
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode(value)
+	b.Truncate(b.Len() - 1) // Encode appends a newline
+}
+
+func invalidJSONInput(err error) error {
+	return errors.ConfigError("Injecting references into JSON", "Input is not valid JSON", err)
+}
+
+// escapeForQuote escapes value so it stays within the surrounding quotes.
+// Double quotes use the backslash escapes shared by JSON and YAML; single
+// quotes use YAML's doubled-quote escape.
+func escapeForQuote(value string, quote byte) string {
+	switch quote {
+	case '"':
+		escaped := strings.ReplaceAll(value, `\`, `\\`)
+		escaped = strings.ReplaceAll(escaped, `"`, `\"`)
+		escaped = strings.ReplaceAll(escaped, "\n", `\n`)
+		escaped = strings.ReplaceAll(escaped, "\r", `\r`)
+		return strings.ReplaceAll(escaped, "\t", `\t`)
+	case '\'':
+		return strings.ReplaceAll(value, "'", "''")
+	default:
+		return value
+	}
+}
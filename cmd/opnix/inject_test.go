@@ -0,0 +1,157 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/brizzbuzz/opnix/pkg/env"
+)
+
+func TestInjectReferences(t *testing.T) {
+	resolver := &fakeResolver{
+		secrets: map[string]string{
+			"op://Vault/Database/password":                     "p@ss\"word\n",
+			"op://Vault/API Key/credential":                    "it's-secret",
+			"op://Vault/Item/token":                            "token-123",
+			"op://Vault/Item/padded":                           "  padded \n",
+			"op://Vault/Item/one-time password?attribute=totp": "123456",
+		},
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "double quoted json value is escaped",
+			input:    `{"password": "op://Vault/Database/password", "port": 5432}`,
+			expected: `{"password": "p@ss\"word\n", "port": 5432}`,
+		},
+		{
+			name:     "single quoted yaml value with spaces",
+			input:    "api:\n  key: 'op://Vault/API Key/credential'\n",
+			expected: "api:\n  key: 'it''s-secret'\n",
+		},
+		{
+			name:     "unquoted yaml value",
+			input:    "token: op://Vault/Item/token # inline comment\n",
+			expected: "token: token-123 # inline comment\n",
+		},
+		{
+			name:     "quoted reference keeps spaces and query attributes",
+			input:    "otp: \"op://Vault/Item/one-time password?attribute=totp\"",
+			expected: "otp: \"123456\"",
+		},
+		{
+			name:     "unquoted value keeps surrounding whitespace",
+			input:    "padded: op://Vault/Item/padded",
+			expected: "padded:   padded \n",
+		},
+		{
+			name:     "no references",
+			input:    "plain: value\n",
+			expected: "plain: value\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := injectReferences(tt.input, resolver, func(reference string, err error) error { return nil })
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if output != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, output)
+			}
+		})
+	}
+}
+
+func TestInjectCommand_AllowMissing(t *testing.T) {
+	dir := t.TempDir()
+	inPath := filepath.Join(dir, "config.yaml")
+	outPath := filepath.Join(dir, "config.resolved.yaml")
+	input := "token: \"op://Vault/Item/token\"\nmissing: \"op://Vault/Item/missing\"\n"
+	if err := os.WriteFile(inPath, []byte(input), 0644); err != nil {
+		t.Fatalf("Failed to write input: %v", err)
+	}
+
+	newCommand := func(args ...string) (*injectCommand, *strings.Builder) {
+		var stderr strings.Builder
+		cmd := newInjectCommand()
+		cmd.stderr = &stderr
+		cmd.newClient = func(string) (env.Resolver, error) {
+			return &fakeResolver{secrets: map[string]string{"op://Vault/Item/token": "token-123"}}, nil
+		}
+		if err := cmd.Init(append([]string{"-in", inPath, "-out", outPath}, args...)); err != nil {
+			t.Fatalf("Unexpected init error: %v", err)
+		}
+		return cmd, &stderr
+	}
+
+	cmd, _ := newCommand()
+	if err := cmd.Run(); err == nil {
+		t.Fatal("Expected error for missing reference")
+	}
+	if _, err := os.Stat(outPath); !os.IsNotExist(err) {
+		t.Error("Expected no output file when a reference fails")
+	}
+
+	cmd, stderr := newCommand("-allow-missing")
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	content, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	expected := "token: \"token-123\"\nmissing: \"op://Vault/Item/missing\"\n"
+	if string(content) != expected {
+		t.Errorf("Expected %q, got %q", expected, string(content))
+	}
+	if !strings.Contains(stderr.String(), "op://Vault/Item/missing") {
+		t.Errorf("Expected warning naming the missing reference, got %q", stderr.String())
+	}
+}
+
+func TestInjectJSONReferences(t *testing.T) {
+	resolver := &fakeResolver{secrets: map[string]string{
+		"op://Vault/Database/password": "p@ss\"word<&>\n",
+		"op://Vault/Item/token":        "token-123",
+	}}
+
+	input := `{"db": {"password": "op://Vault/Database/password", "port": 5432, "ratio": 1.50, "tls": true, "ca": null},
+		"tokens": ["op://Vault/Item/token", "Bearer op://Vault/Item/token"],
+		"op://Vault/Item/token": "key names are not resolved"}`
+	output, err := injectJSONReferences(input, resolver, func(reference string, err error) error { return err })
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := `{
+  "db": {
+    "password": "p@ss\"word<&>\n",
+    "port": 5432,
+    "ratio": 1.50,
+    "tls": true,
+    "ca": null
+  },
+  "tokens": [
+    "token-123",
+    "Bearer op://Vault/Item/token"
+  ],
+  "op://Vault/Item/token": "key names are not resolved"
+}
+`
+	if output != expected {
+		t.Errorf("Expected %s, got %s", expected, output)
+	}
+
+	if _, err := injectJSONReferences(`{"a": `, resolver, nil); err == nil || !strings.Contains(err.Error(), "not valid JSON") {
+		t.Errorf("Expected an invalid JSON error, got %v", err)
+	}
+}
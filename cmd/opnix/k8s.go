@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/brizzbuzz/opnix/internal/errors"
+)
+
+// k8sSecretFormat renders a Kubernetes v1 Secret manifest. It is selected by
+// "opnix env k8s-secret" rather than -format, because it needs a name.
+const k8sSecretFormat = "k8s-secret"
+
+var (
+	// k8sNamePattern matches a DNS subdomain, which Secret names must be
+	k8sNamePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+	// k8sNamespacePattern matches a DNS label, which namespaces must be
+	k8sNamespacePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+	// k8sKeyPattern matches the keys allowed in a Secret's data map
+	k8sKeyPattern = regexp.MustCompile(`^[-._a-zA-Z0-9]+$`)
+)
+
+// k8sSecretOptions holds the manifest metadata for "opnix env k8s-secret"
+type k8sSecretOptions struct {
+	name      string
+	namespace string
+}
+
+// initK8sSecret registers the manifest flags alongside the env flags, so
+// every env option also applies to the generated Secret
+func (e *envCommand) initK8sSecret(args []string) error {
+	e.registerK8sSecretFlags()
+	e.fs.SetOutput(e.stderr)
+	return e.fs.Parse(args)
+}
+
+// registerK8sSecretFlags adds the manifest flags to the env flag set
+func (e *envCommand) registerK8sSecretFlags() {
+	e.k8s = &k8sSecretOptions{}
+	e.fs.StringVar(&e.k8s.name, "name", "", "Name of the generated Secret (required)")
+	e.fs.StringVar(&e.k8s.namespace, "namespace", "", "Namespace of the generated Secret (omitted when empty)")
+}
+
+// checkK8sSecret validates the manifest metadata and rejects flags that pick
+// a different kind of output
+func (e *envCommand) checkK8sSecret() error {
+	if e.k8s.name == "" {
+		return errors.ConfigValidationError(
+			"env.k8s-secret.name",
+			"<empty>",
+			"A Secret name is required",
+			[]string{"Example: opnix env k8s-secret -name app-secrets -namespace production"},
+		)
+	}
+	if len(e.k8s.name) > 253 || !k8sNamePattern.MatchString(e.k8s.name) {
+		return errors.ConfigValidationError(
+			"env.k8s-secret.name",
+			e.k8s.name,
+			"Secret names must be lowercase DNS subdomains of at most 253 characters",
+			[]string{"Use lowercase letters, digits, '-', and '.', starting and ending with a letter or digit"},
+		)
+	}
+	if e.k8s.namespace != "" && (len(e.k8s.namespace) > 63 || !k8sNamespacePattern.MatchString(e.k8s.namespace)) {
+		return errors.ConfigValidationError(
+			"env.k8s-secret.namespace",
+			e.k8s.namespace,
+			"Namespaces must be lowercase DNS labels of at most 63 characters",
+			[]string{"Use lowercase letters, digits, and '-', starting and ending with a letter or digit"},
+		)
+	}
+	return e.checkConflicts(
+		"env.k8s-secret",
+		e.k8s.name,
+		"k8s-secret always writes a Secret manifest",
+		[]string{"-format", "-raw", "-update"},
+		"Use -output to write the manifest to a file",
+	)
+}
+
+// renderK8sSecret writes a v1 Secret with every value base64-encoded under
+// data, so multi-line and binary values survive unchanged
+func renderK8sSecret(values map[string]string, keys []string, opts renderOptions) (string, error) {
+	var b strings.Builder
+	b.WriteString("apiVersion: v1\n")
+	b.WriteString("kind: Secret\n")
+	b.WriteString("metadata:\n")
+	fmt.Fprintf(&b, "  name: %s\n", opts.k8sName)
+	if opts.k8sNamespace != "" {
+		fmt.Fprintf(&b, "  namespace: %s\n", opts.k8sNamespace)
+	}
+	b.WriteString("type: Opaque\n")
+	if len(keys) == 0 {
+		b.WriteString("data: {}\n")
+		return b.String(), nil
+	}
+
+	b.WriteString("data:\n")
+	for _, key := range keys {
+		if !k8sKeyPattern.MatchString(key) {
+			return "", errors.ConfigValidationError(
+				"env.vars",
+				key,
+				fmt.Sprintf("Variable %s is not a valid Secret data key", key),
+				[]string{"Secret keys may contain only letters, digits, '-', '_', and '.'"},
+			)
+		}
+		encoded := base64.StdEncoding.EncodeToString([]byte(values[key]))
+		if encoded == "" {
+			encoded = `""`
+		}
+		fmt.Fprintf(&b, "  %s: %s\n", key, encoded)
+	}
+	return b.String(), nil
+}
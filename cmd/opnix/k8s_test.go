@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestEnvCommand_K8sSecret(t *testing.T) {
+	resolver := &fakeResolver{secrets: map[string]string{
+		"op://Example/Service/password": "test-password",
+		"op://Example/Service/tls-key":  "-----BEGIN KEY-----\nabc\n-----END KEY-----",
+	}}
+
+	cmd, stdout, _ := newTestEnvCommand(resolver)
+	err := cmd.Init([]string{
+		"k8s-secret",
+		"-name", "app-secrets",
+		"-namespace", "production",
+		"-config-json", `{"vars":[{"name":"DB_PASSWORD","reference":"op://Example/Service/password"},{"name":"TLS_KEY","reference":"op://Example/Service/tls-key","preserveWhitespace":true},{"name":"BINARY","value":"\u0000ÿ"}]}`,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Unexpected run error: %v", err)
+	}
+
+	var manifest struct {
+		APIVersion string `yaml:"apiVersion"`
+		Kind       string `yaml:"kind"`
+		Metadata   struct {
+			Name      string `yaml:"name"`
+			Namespace string `yaml:"namespace"`
+		} `yaml:"metadata"`
+		Type string            `yaml:"type"`
+		Data map[string]string `yaml:"data"`
+	}
+	if err := yaml.Unmarshal(stdout.Bytes(), &manifest); err != nil {
+		t.Fatalf("Failed to parse manifest: %v\n%s", err, stdout.String())
+	}
+
+	if manifest.APIVersion != "v1" || manifest.Kind != "Secret" || manifest.Type != "Opaque" {
+		t.Errorf("Expected a v1 Opaque Secret, got %s %s %s", manifest.APIVersion, manifest.Kind, manifest.Type)
+	}
+	if manifest.Metadata.Name != "app-secrets" || manifest.Metadata.Namespace != "production" {
+		t.Errorf("Expected app-secrets in production, got %s in %s", manifest.Metadata.Name, manifest.Metadata.Namespace)
+	}
+
+	expected := map[string]string{
+		"DB_PASSWORD": "test-password",
+		"TLS_KEY":     "-----BEGIN KEY-----\nabc\n-----END KEY-----",
+		"BINARY":      "\u0000ÿ",
+	}
+	for key, want := range expected {
+		decoded, err := base64.StdEncoding.DecodeString(manifest.Data[key])
+		if err != nil {
+			t.Fatalf("Failed to decode %s: %v", key, err)
+		}
+		if string(decoded) != want {
+			t.Errorf("Expected %s=%q, got %q", key, want, string(decoded))
+		}
+	}
+}
+
+func TestEnvCommand_K8sSecretValidation(t *testing.T) {
+	config := `{"vars":[{"name":"DB_PASSWORD","reference":"op://Example/Service/password"}]}`
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{"missing name", []string{}, "Secret name is required"},
+		{"invalid name", []string{"-name", "App_Secrets"}, "lowercase DNS subdomains"},
+		{"invalid namespace", []string{"-name", "app", "-namespace", "prod.eu"}, "lowercase DNS labels"},
+		{"format flag", []string{"-name", "app", "-format", "json"}, "cannot be combined with -format"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver := &fakeResolver{secrets: map[string]string{"op://Example/Service/password": "test-password"}}
+			cmd, _, _ := newTestEnvCommand(resolver)
+			args := append([]string{"k8s-secret", "-config-json", config}, tt.args...)
+			if err := cmd.Init(args); err != nil {
+				t.Fatalf("Unexpected init error: %v", err)
+			}
+
+			if err := cmd.Run(); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestRenderK8sSecret_KeyValidation(t *testing.T) {
+	opts := renderOptions{k8sName: "app"}
+	if _, err := renderK8sSecret(map[string]string{"BAD KEY": "x"}, []string{"BAD KEY"}, opts); err == nil {
+		t.Error("Expected invalid data key to be rejected")
+	}
+
+	got, err := renderK8sSecret(map[string]string{"EMPTY": ""}, []string{"EMPTY"}, opts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(got, `  EMPTY: ""`) {
+		t.Errorf("Expected empty value to render as an empty string, got %q", got)
+	}
+}
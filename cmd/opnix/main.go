@@ -1,30 +1,55 @@
 package main
 
 import (
-	"encoding/json"
+	stderrors "errors"
 	"flag"
 	"fmt"
 	"os"
-	"regexp"
-	"sort"
 	"strings"
 
 	"github.com/brizzbuzz/opnix/internal/errors"
-	"github.com/brizzbuzz/opnix/internal/onepass"
+)
+
+// Process exit codes. Exit code 2 is reserved for flag parsing errors.
+const (
+	exitCodeFailure     = 1
+	exitCodeAuthFailure = 3
+	exitCodeSDKFailure  = 4
 )
 
 type command interface {
 	Name() string
+	Flags() *flag.FlagSet
 	Init([]string) error
 	Run() error
 }
 
+// commandSummaries describes each command in the usage text and in shell
+// completions
+var commandSummaries = map[string]string{
+	"secret":     "Manage and retrieve secrets from 1Password",
+	"token":      "Manage the 1Password service account token",
+	"env":        "Resolve environment variables for development shells",
+	"inject":     "Resolve op:// references embedded in a file",
+	"vaults":     "List vaults the token can access",
+	"items":      "List items in a vault",
+	"completion": "Print a shell completion script",
+	"version":    "Print build information",
+}
+
 func main() {
+	completion := newCompletionCommand()
 	cmds := []command{
 		newSecretCommand(),
 		newTokenCommand(),
 		newEnvCommand(),
+		newInjectCommand(),
+		newVaultsCommand(),
+		newItemsCommand(),
+		completion,
+		newVersionCommand(),
 	}
+	completion.commands = cmds
 
 	os.Exit(run(os.Args, cmds))
 }
@@ -32,10 +57,10 @@ func main() {
 func printUsage(cmds []command) {
 	fmt.Fprintf(os.Stderr, "Usage: opnix <command> [options]\n\n")
 	fmt.Fprintf(os.Stderr, "Available commands:\n")
-	fmt.Fprintf(os.Stderr, "  secret    Manage and retrieve secrets from 1Password\n")
-	fmt.Fprintf(os.Stderr, "  token     Manage the 1Password service account token\n")
-	fmt.Fprintf(os.Stderr, "  env       Resolve environment variables for development shells\n\n")
-	fmt.Fprintf(os.Stderr, "Use 'opnix <command> -h' for command-specific help\n")
+	for _, cmd := range cmds {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.Name(), commandSummaries[cmd.Name()])
+	}
+	fmt.Fprintf(os.Stderr, "\nUse 'opnix <command> -h' for command-specific help\n")
 }
 
 func run(args []string, cmds []command) int {
@@ -45,6 +70,9 @@ func run(args []string, cmds []command) int {
 	}
 
 	subcommand := args[1]
+	if subcommand == "-version" || subcommand == "--version" {
+		subcommand = "version"
+	}
 
 	for _, cmd := range cmds {
 		if cmd.Name() == subcommand {
@@ -53,8 +81,11 @@ func run(args []string, cmds []command) int {
 				return 1
 			}
 			if err := cmd.Run(); err != nil {
-				handleError(err)
-				return 1
+				var childErr *childExitError
+				if !stderrors.As(err, &childErr) {
+					handleError(err)
+				}
+				return exitCodeFor(err)
 			}
 			return 0
 		}
@@ -65,6 +96,25 @@ func run(args []string, cmds []command) int {
 	return 1
 }
 
+// exitCodeFor maps an error to the process exit code reported to callers
+func exitCodeFor(err error) int {
+	var sigErr *signalError
+	if stderrors.As(err, &sigErr) {
+		return sigErr.exitCode()
+	}
+	var childErr *childExitError
+	if stderrors.As(err, &childErr) {
+		return childErr.exitCode()
+	}
+	if errors.IsAuthError(err) {
+		return exitCodeAuthFailure
+	}
+	if errors.IsSDKError(err) {
+		return exitCodeSDKFailure
+	}
+	return exitCodeFailure
+}
+
 // handleError provides user-friendly error output
 func handleError(err error) {
 	if err == nil {
@@ -97,456 +147,3 @@ func handleError(err error) {
 		}
 	}
 }
-
-type envCommand struct {
-	fs *flag.FlagSet
-
-	configPath string
-	tokenFile  string
-	format     string
-
-	configJSON string
-
-	loadConfig  func(string) (*envConfig, error)
-	parseConfig func(string) (*envConfig, error)
-	newClient   func(string) (secretResolver, error)
-}
-
-type secretResolver interface {
-	ResolveSecret(string) (string, error)
-}
-
-type envConfig struct {
-	Vars   []envVariable `json:"vars"`
-	Format string        `json:"format,omitempty"`
-}
-
-type envVariable struct {
-	Name               string `json:"name"`
-	Reference          string `json:"reference,omitempty"`
-	Value              string `json:"value,omitempty"`
-	Optional           bool   `json:"optional,omitempty"`
-	PreserveWhitespace bool   `json:"preserveWhitespace,omitempty"`
-	Description        string `json:"description,omitempty"`
-}
-
-func (v envVariable) shouldTrim() bool {
-	return !v.PreserveWhitespace
-}
-
-type envProcessor struct {
-	resolver secretResolver
-}
-
-type envSkippedVariable struct {
-	Name string
-	Err  error
-}
-
-type envResult struct {
-	Values  map[string]string
-	Skipped []envSkippedVariable
-}
-
-func newEnvCommand() *envCommand {
-	cmd := &envCommand{
-		fs: flag.NewFlagSet("env", flag.ExitOnError),
-	}
-
-	cmd.fs.StringVar(&cmd.configPath, "config", "", "Path to environment configuration file")
-	cmd.fs.StringVar(&cmd.configJSON, "config-json", "", "Inline environment configuration as JSON")
-	cmd.fs.StringVar(&cmd.tokenFile, "token-file", defaultTokenPath, "Path to file containing 1Password service account token")
-	cmd.fs.StringVar(&cmd.format, "format", "", "Output format: shell (default), dotenv, json")
-
-	cmd.fs.Usage = func() {
-		fmt.Fprintf(cmd.fs.Output(), "Usage: opnix env [options]\n\n")
-		fmt.Fprintf(cmd.fs.Output(), "Resolve environment variables from 1Password references\n\n")
-		fmt.Fprintf(cmd.fs.Output(), "Options:\n")
-		cmd.fs.PrintDefaults()
-	}
-
-	cmd.loadConfig = loadEnvConfig
-	cmd.parseConfig = parseEnvConfigString
-	cmd.newClient = func(path string) (secretResolver, error) {
-		return onepass.NewClient(path)
-	}
-
-	return cmd
-}
-
-func (e *envCommand) Name() string { return e.fs.Name() }
-
-func (e *envCommand) Init(args []string) error {
-	return e.fs.Parse(args)
-}
-
-func (e *envCommand) Run() error {
-	cfg, err := e.resolveConfig()
-	if err != nil {
-		return err
-	}
-
-	format := e.format
-	if format == "" {
-		if cfg.Format != "" {
-			format = cfg.Format
-		} else {
-			format = "shell"
-		}
-	}
-
-	format = strings.ToLower(format)
-	if !isSupportedFormat(format) {
-		return errors.ConfigValidationError(
-			"env.format",
-			format,
-			"Unsupported format specified",
-			[]string{
-				"Use one of: shell, dotenv, json",
-				"Example: opnix env -format shell",
-			},
-		)
-	}
-
-	resolver, err := e.buildResolver(cfg)
-	if err != nil {
-		return err
-	}
-
-	result, err := newEnvProcessor(resolver).Process(cfg)
-	if err != nil {
-		return err
-	}
-
-	for _, skipped := range result.Skipped {
-		fmt.Fprintf(os.Stderr, "WARNING: Skipped optional env var %s: %v\n", skipped.Name, skipped.Err)
-	}
-
-	output, err := renderOutput(result.Values, format)
-	if err != nil {
-		return err
-	}
-
-	fmt.Print(output)
-	return nil
-}
-
-func (e *envCommand) resolveConfig() (*envConfig, error) {
-	if strings.TrimSpace(e.configJSON) == "" {
-		if envJSON := os.Getenv("OPNIX_ENV_CONFIG_JSON"); strings.TrimSpace(envJSON) != "" {
-			e.configJSON = envJSON
-		}
-	}
-
-	if strings.TrimSpace(e.configPath) == "" {
-		if envPath := os.Getenv("OPNIX_ENV_CONFIG"); strings.TrimSpace(envPath) != "" {
-			e.configPath = envPath
-		}
-	}
-
-	if strings.TrimSpace(e.configJSON) != "" {
-		return e.parseConfig(e.configJSON)
-	}
-
-	if strings.TrimSpace(e.configPath) != "" {
-		return e.loadConfig(e.configPath)
-	}
-
-	return nil, errors.ConfigError(
-		"Loading environment configuration",
-		"No environment configuration provided. Use -config, -config-json, OPNIX_ENV_CONFIG, or OPNIX_ENV_CONFIG_JSON.",
-		nil,
-	)
-}
-
-func (e *envCommand) buildResolver(cfg *envConfig) (secretResolver, error) {
-	for _, variable := range cfg.Vars {
-		if variable.Reference != "" {
-			return e.newClient(e.tokenFile)
-		}
-	}
-	return staticResolver{}, nil
-}
-
-func newEnvProcessor(resolver secretResolver) *envProcessor {
-	return &envProcessor{resolver: resolver}
-}
-
-func (p *envProcessor) Process(cfg *envConfig) (*envResult, error) {
-	if cfg == nil {
-		return nil, errors.ConfigError(
-			"Processing environment configuration",
-			"Environment configuration cannot be nil",
-			nil,
-		)
-	}
-
-	result := &envResult{
-		Values:  make(map[string]string),
-		Skipped: []envSkippedVariable{},
-	}
-
-	for i, variable := range cfg.Vars {
-		value, err := p.resolveVariable(variable, i)
-		if err != nil {
-			if variable.Optional {
-				result.Skipped = append(result.Skipped, envSkippedVariable{
-					Name: variable.Name,
-					Err:  err,
-				})
-				continue
-			}
-			return nil, err
-		}
-		result.Values[variable.Name] = value
-	}
-
-	return result, nil
-}
-
-func (p *envProcessor) resolveVariable(variable envVariable, index int) (string, error) {
-	if variable.Reference != "" {
-		value, err := p.resolver.ResolveSecret(variable.Reference)
-		if err != nil {
-			return "", errors.WrapWithSuggestions(
-				err,
-				fmt.Sprintf("Resolving secret for env var %s", variable.Name),
-				"environment variable resolution",
-				[]string{
-					fmt.Sprintf("Check that the 1Password reference '%s' exists", variable.Reference),
-					"Ensure the service account has access to the vault and item",
-				},
-			)
-		}
-
-		if variable.shouldTrim() {
-			return strings.TrimSpace(value), nil
-		}
-		return value, nil
-	}
-
-	if variable.Value != "" {
-		if variable.shouldTrim() {
-			return strings.TrimSpace(variable.Value), nil
-		}
-		return variable.Value, nil
-	}
-
-	return "", errors.ConfigError(
-		fmt.Sprintf("Processing env variable at index %d", index),
-		"Variable must define either 'reference' or 'value'",
-		nil,
-	)
-}
-
-var envNamePattern = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
-
-func loadEnvConfig(path string) (*envConfig, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, errors.FileOperationError(
-			"Loading environment configuration",
-			path,
-			"Failed to read environment config file",
-			err,
-		)
-	}
-
-	return parseEnvConfig(data)
-}
-
-func parseEnvConfigString(raw string) (*envConfig, error) {
-	raw = strings.TrimSpace(raw)
-	if raw == "" {
-		return nil, errors.ConfigValidationError(
-			"env configuration",
-			"<empty>",
-			"Environment configuration JSON cannot be empty",
-			[]string{
-				"Provide configuration via -config-json",
-				"Set OPNIX_ENV_CONFIG_JSON",
-				"Or specify a configuration file path",
-			},
-		)
-	}
-
-	return parseEnvConfig([]byte(raw))
-}
-
-func parseEnvConfig(data []byte) (*envConfig, error) {
-	var cfg envConfig
-	if err := json.Unmarshal(data, &cfg); err != nil {
-		return nil, errors.ConfigError(
-			"Parsing environment configuration",
-			"Invalid JSON format in environment configuration",
-			err,
-		)
-	}
-
-	if err := validateEnvConfig(&cfg); err != nil {
-		return nil, err
-	}
-
-	return &cfg, nil
-}
-
-func validateEnvConfig(cfg *envConfig) error {
-	if len(cfg.Vars) == 0 {
-		return errors.ConfigValidationError(
-			"env.vars",
-			"<empty>",
-			"Environment configuration must define at least one variable",
-			[]string{
-				"Add variables under the 'vars' array",
-				"Example: {\"vars\": [{\"name\": \"API_TOKEN\", \"reference\": \"op://Vault/Item/token\"}]}",
-			},
-		)
-	}
-
-	for i, variable := range cfg.Vars {
-		fieldPrefix := fmt.Sprintf("env.vars[%d]", i)
-
-		if variable.Name == "" {
-			return errors.ConfigValidationError(
-				fieldPrefix+".name",
-				"<empty>",
-				"Environment variable name cannot be empty",
-				[]string{
-					"Provide a unique uppercase variable name",
-					"Example: API_TOKEN",
-				},
-			)
-		}
-
-		if !envNamePattern.MatchString(variable.Name) {
-			return errors.ConfigValidationError(
-				fieldPrefix+".name",
-				variable.Name,
-				"Environment variable names must use uppercase letters, numbers, and underscores",
-				[]string{
-					"Start with an uppercase letter",
-					"Use uppercase letters, digits, and underscores only",
-					"Example: DATABASE_PASSWORD",
-				},
-			)
-		}
-
-		hasReference := variable.Reference != ""
-		hasValue := variable.Value != ""
-
-		if hasReference && hasValue {
-			return errors.ConfigValidationError(
-				fieldPrefix,
-				variable.Name,
-				"Specify either 'reference' or 'value', not both",
-				[]string{
-					"Remove the 'value' field to use a 1Password reference",
-					"Or remove the 'reference' field to use a static value",
-				},
-			)
-		}
-
-		if !hasReference && !hasValue {
-			return errors.ConfigValidationError(
-				fieldPrefix,
-				variable.Name,
-				"Environment variable must define a 1Password reference or static value",
-				[]string{
-					"Add a 'reference': \"op://Vault/Item/field\"",
-					"Or add a 'value' for static configuration",
-				},
-			)
-		}
-	}
-
-	return nil
-}
-
-func isSupportedFormat(format string) bool {
-	switch format {
-	case "shell", "dotenv", "json":
-		return true
-	default:
-		return false
-	}
-}
-
-type staticResolver struct{}
-
-func (staticResolver) ResolveSecret(string) (string, error) {
-	return "", fmt.Errorf("no 1Password client configured")
-}
-
-func renderOutput(values map[string]string, format string) (string, error) {
-	switch format {
-	case "shell":
-		return renderShell(values), nil
-	case "dotenv":
-		return renderDotenv(values), nil
-	case "json":
-		data, err := json.MarshalIndent(values, "", "  ")
-		if err != nil {
-			return "", errors.ConfigError(
-				"Rendering environment variables",
-				"Failed to marshal JSON output",
-				err,
-			)
-		}
-		return string(data) + "\n", nil
-	default:
-		return "", fmt.Errorf("unknown format: %s", format)
-	}
-}
-
-func renderShell(values map[string]string) string {
-	var keys []string
-	for k := range values {
-		keys = append(keys, k)
-	}
-	sort.Strings(keys)
-
-	var b strings.Builder
-	for _, key := range keys {
-		fmt.Fprintf(&b, "export %s=%s\n", key, shellQuote(values[key]))
-	}
-	return b.String()
-}
-
-func renderDotenv(values map[string]string) string {
-	var keys []string
-	for k := range values {
-		keys = append(keys, k)
-	}
-	sort.Strings(keys)
-
-	var b strings.Builder
-	for _, key := range keys {
-		fmt.Fprintf(&b, "%s=%s\n", key, dotenvValue(values[key]))
-	}
-
-	return b.String()
-}
-
-func shellQuote(value string) string {
-	if value == "" {
-		return "''"
-	}
-	return "'" + strings.ReplaceAll(value, "'", `'"'"'`) + "'"
-}
-
-func dotenvValue(value string) string {
-	if value == "" {
-		return ""
-	}
-
-	if strings.ContainsAny(value, " #\"'\n\r\t") {
-		escaped := strings.ReplaceAll(value, `\`, `\\`)
-		escaped = strings.ReplaceAll(escaped, `"`, `\"`)
-		escaped = strings.ReplaceAll(escaped, "\n", `\n`)
-		escaped = strings.ReplaceAll(escaped, "\r", `\r`)
-		escaped = strings.ReplaceAll(escaped, "\t", `\t`)
-		return `"` + escaped + `"`
-	}
-
-	return value
-}
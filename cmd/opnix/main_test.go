@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/brizzbuzz/opnix/internal/errors"
+)
+
+func TestExitCodeFor(t *testing.T) {
+	authErr := errors.AuthError("Resolving 1Password secret", "Token rejected", nil)
+
+	tests := []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{"generic error", fmt.Errorf("boom"), exitCodeFailure},
+		{"not found error", errors.OnePasswordError("Resolving", "reference not found", nil), exitCodeFailure},
+		{"auth error", authErr, exitCodeAuthFailure},
+		{"wrapped auth error", errors.WrapWithSuggestions(authErr, "Resolving secret for env var API_TOKEN", "environment variable resolution", nil), exitCodeAuthFailure},
+		{"token file error", errors.TokenError("Failed to read token file: permission denied", "/etc/opnix-token", nil), exitCodeFailure},
+		{"sdk error", errors.SDKError("Initializing 1Password client", "The 1Password SDK core could not be loaded", nil), exitCodeSDKFailure},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exitCodeFor(tt.err); got != tt.expected {
+				t.Errorf("Expected exit code %d, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestVersionInfo(t *testing.T) {
+	info := versionInfo()
+
+	for _, want := range []string{"opnix " + version, "commit:", "built:", runtime.Version(), runtime.GOOS + "/" + runtime.GOARCH} {
+		if !strings.Contains(info, want) {
+			t.Errorf("Expected version info to contain %q, got:\n%s", want, info)
+		}
+	}
+}
+
+func TestRun_VersionFlag(t *testing.T) {
+	var stdout bytes.Buffer
+	vc := newVersionCommand()
+	vc.stdout = &stdout
+
+	if code := run([]string{"opnix", "-version"}, []command{vc}); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+	if !strings.HasPrefix(stdout.String(), "opnix ") {
+		t.Errorf("Expected version output, got %q", stdout.String())
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	stderrors "errors"
+	"strings"
+
+	"github.com/brizzbuzz/opnix/internal/errors"
+)
+
+// redactedItem replaces the item segment of references in diagnostics
+const redactedItem = "***"
+
+// redactReferences masks the item segment of every op:// reference in text,
+// keeping the vault and field visible. An item segment runs to the next
+// slash, so item names containing spaces are masked in full; a whole-item
+// reference without a following slash ends at whitespace or punctuation.
+func redactReferences(text string) string {
+	var b strings.Builder
+	for {
+		idx := strings.Index(text, referencePrefix)
+		if idx < 0 {
+			b.WriteString(text)
+			return b.String()
+		}
+		b.WriteString(text[:idx+len(referencePrefix)])
+		text = text[idx+len(referencePrefix):]
+
+		line := text
+		if end := strings.IndexAny(line, "\r\n"); end >= 0 {
+			line = line[:end]
+		}
+		vaultEnd := strings.IndexByte(line, '/')
+		if vaultEnd < 0 || strings.ContainsAny(line[:vaultEnd], "\"'`,;()[]{}<>") {
+			continue
+		}
+		b.WriteString(line[:vaultEnd+1])
+		item := line[vaultEnd+1:]
+
+		end := len(item)
+		hard := strings.IndexAny(item, "\"'`,;)]}>?")
+		if slash := strings.IndexByte(item, '/'); slash >= 0 && (hard < 0 || slash < hard) {
+			end = slash
+		} else if soft := strings.IndexAny(item, " \t:\"'`,;)]}>?"); soft >= 0 {
+			end = soft
+		}
+		if end > 0 {
+			b.WriteString(redactedItem)
+		}
+		text = text[vaultEnd+1+end:]
+	}
+}
+
+// redactedError reports err with references redacted while keeping the
+// original error reachable for errors.As and exit code selection
+type redactedError struct {
+	err error
+}
+
+func (e *redactedError) Error() string { return redactReferences(e.err.Error()) }
+
+func (e *redactedError) Unwrap() error { return e.err }
+
+// redactError masks references in err. Structured errors keep their shape
+// so they are still printed with their issue, context, and suggestions.
+func redactError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var sigErr *signalError
+	if stderrors.As(err, &sigErr) {
+		return err
+	}
+	var childErr *childExitError
+	if stderrors.As(err, &childErr) {
+		return err
+	}
+
+	opnixErr, ok := err.(*errors.OpnixError)
+	if !ok {
+		return &redactedError{err: err}
+	}
+
+	redacted := *opnixErr
+	redacted.Operation = redactReferences(opnixErr.Operation)
+	redacted.Issue = redactReferences(opnixErr.Issue)
+	redacted.Context = redactReferences(opnixErr.Context)
+	redacted.Suggestions = make([]string, len(opnixErr.Suggestions))
+	for i, suggestion := range opnixErr.Suggestions {
+		redacted.Suggestions[i] = redactReferences(suggestion)
+	}
+	if opnixErr.Cause != nil {
+		redacted.Cause = &redactedError{err: opnixErr.Cause}
+	}
+	return &redacted
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	stderrors "errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/brizzbuzz/opnix/internal/errors"
+)
+
+func TestRedactReferences(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"field reference", "secret not found: op://Example/Service/password", "secret not found: op://Example/***/password"},
+		{"item with spaces", "op://Example/Payroll Service/password", "op://Example/***/password"},
+		{"whole item", "op://Example/Service failed", "op://Example/*** failed"},
+		{"quoted", "reference 'op://Example/Service' exists", "reference 'op://Example/***' exists"},
+		{"query kept", "op://Example/Service?attribute=totp", "op://Example/***?attribute=totp"},
+		{"several", "op://A/One/x and op://B/Two/y", "op://A/***/x and op://B/***/y"},
+		{"vault only", "op://Example", "op://Example"},
+		{"no references", "nothing to see", "nothing to see"},
+		{"stops at line end", "op://Example/Service\nnext line/here", "op://Example/***\nnext line/here"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redactReferences(tt.text); got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRedactError(t *testing.T) {
+	cause := errors.AuthError("Resolving op://Example/Service/token", "Access denied", fmt.Errorf("denied for op://Example/Service/token"))
+	err := redactError(&errors.OpnixError{
+		Operation:   "Resolving op://Example/Service/password",
+		Issue:       "Failed to resolve op://Example/Service/password",
+		Context:     "Reference: op://Example/Service/password",
+		Suggestions: []string{"Check that 'op://Example/Service/password' exists"},
+		Cause:       cause,
+	})
+
+	if strings.Contains(err.Error(), "Service") {
+		t.Errorf("Expected item names to be redacted, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "op://Example/***/password") {
+		t.Errorf("Expected vault and field to stay visible, got %v", err)
+	}
+	if _, ok := err.(*errors.OpnixError); !ok {
+		t.Errorf("Expected structured error to keep its type, got %T", err)
+	}
+	if !errors.IsAuthError(err) {
+		t.Error("Expected redacted error to still be recognised as an auth error")
+	}
+
+	plain := redactError(fmt.Errorf("secret not found: op://Example/Service/password"))
+	if plain.Error() != "secret not found: op://Example/***/password" {
+		t.Errorf("Expected redacted plain error, got %q", plain.Error())
+	}
+
+	sigErr := &signalError{}
+	if got := redactError(sigErr); !stderrors.Is(got, sigErr) {
+		t.Errorf("Expected signal error to pass through, got %v", got)
+	}
+}
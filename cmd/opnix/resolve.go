@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/brizzbuzz/opnix/internal/errors"
+	"github.com/brizzbuzz/opnix/internal/onepass"
+	"github.com/brizzbuzz/opnix/pkg/env"
+)
+
+// resolveStdinCommand implements "opnix secret resolve-stdin", resolving a
+// list of references read from stdin without a configuration file
+type resolveStdinCommand struct {
+	fs        *flag.FlagSet
+	tokenFile string
+	json      bool
+
+	stdin  io.Reader
+	stdout io.Writer
+
+	newClient func(string) (env.Resolver, error)
+}
+
+// resolvedReference is one line of resolve-stdin JSON output
+type resolvedReference struct {
+	Reference string `json:"reference"`
+	Value     string `json:"value"`
+}
+
+func newResolveStdinCommand() *resolveStdinCommand {
+	rc := &resolveStdinCommand{
+		fs:     flag.NewFlagSet("secret resolve-stdin", flag.ExitOnError),
+		stdin:  os.Stdin,
+		stdout: os.Stdout,
+	}
+
+	rc.fs.StringVar(&rc.tokenFile, "token-file", defaultTokenPath, "Path to file containing 1Password service account token")
+	rc.fs.BoolVar(&rc.json, "json", false, "Print one JSON object per reference instead of tab-separated lines")
+
+	rc.fs.Usage = func() {
+		fmt.Fprintf(rc.fs.Output(), "Usage: opnix secret resolve-stdin [options]\n\n")
+		fmt.Fprintf(rc.fs.Output(), "Resolve op:// references read from stdin, one per line\n\n")
+		fmt.Fprintf(rc.fs.Output(), "Options:\n")
+		rc.fs.PrintDefaults()
+	}
+
+	rc.newClient = func(path string) (env.Resolver, error) {
+		return onepass.NewClient(path)
+	}
+
+	return rc
+}
+
+func (r *resolveStdinCommand) Init(args []string) error {
+	return r.fs.Parse(args)
+}
+
+func (r *resolveStdinCommand) Run() error {
+	references, err := readReferenceList(r.stdin)
+	if err != nil {
+		return err
+	}
+	if len(references) == 0 {
+		return nil
+	}
+
+	client, err := r.newClient(r.tokenFile)
+	if err != nil {
+		return err
+	}
+	resolver := env.NewCachingResolver(client)
+
+	// Resolve everything before printing so a failure never leaves partial output
+	results := make([]resolvedReference, 0, len(references))
+	for _, reference := range references {
+		value, err := resolver.ResolveSecret(reference)
+		if err != nil {
+			return errors.WrapWithSuggestions(
+				err,
+				fmt.Sprintf("Resolving reference %s", reference),
+				"stdin resolution",
+				[]string{"Verify the reference exists in 1Password"},
+			)
+		}
+		results = append(results, resolvedReference{Reference: reference, Value: strings.TrimSpace(value)})
+	}
+
+	encoder := json.NewEncoder(r.stdout)
+	for _, result := range results {
+		if r.json {
+			if err := encoder.Encode(result); err != nil {
+				return errors.ConfigError("Rendering JSON output", "Failed to encode resolved reference", err)
+			}
+			continue
+		}
+		fmt.Fprintf(r.stdout, "%s\t%s\n", result.Reference, result.Value)
+	}
+	return nil
+}
+
+// readReferenceList reads one reference per line, skipping blank lines and
+// # comments
+func readReferenceList(input io.Reader) ([]string, error) {
+	var references []string
+	scanner := bufio.NewScanner(input)
+	for line := 1; scanner.Scan(); line++ {
+		reference := strings.TrimSpace(scanner.Text())
+		if reference == "" || strings.HasPrefix(reference, "#") {
+			continue
+		}
+		if !strings.HasPrefix(reference, referencePrefix) {
+			return nil, errors.ConfigValidationError(
+				fmt.Sprintf("stdin line %d", line),
+				reference,
+				"Reference must start with 'op://'",
+				[]string{"Use format: op://Vault/Item/field"},
+			)
+		}
+		references = append(references, reference)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.FileOperationError("Reading references", "stdin", "Failed to read reference list", err)
+	}
+	return references, nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/brizzbuzz/opnix/pkg/env"
+)
+
+func TestResolveStdinCommand(t *testing.T) {
+	resolver := &fakeResolver{
+		secrets: map[string]string{
+			"op://Example/Service/password": "hunter2\n",
+			"op://Example/Service/username": "admin",
+		},
+	}
+	input := "# service credentials\nop://Example/Service/password\n\n  op://Example/Service/username  \n"
+
+	tests := []struct {
+		name    string
+		args    []string
+		input   string
+		want    string
+		wantErr string
+	}{
+		{
+			name:  "tab separated",
+			input: input,
+			want:  "op://Example/Service/password\thunter2\nop://Example/Service/username\tadmin\n",
+		},
+		{
+			name:  "json lines",
+			args:  []string{"-json"},
+			input: input,
+			want:  `{"reference":"op://Example/Service/password","value":"hunter2"}` + "\n" + `{"reference":"op://Example/Service/username","value":"admin"}` + "\n",
+		},
+		{
+			name:    "missing reference",
+			input:   "op://Example/Service/password\nop://Example/Service/missing\n",
+			wantErr: "op://Example/Service/missing",
+		},
+		{
+			name:    "not a reference",
+			input:   "Example/Service/password\n",
+			wantErr: "stdin line 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			cmd := newSecretCommand()
+			if err := cmd.Init(append([]string{"resolve-stdin"}, tt.args...)); err != nil {
+				t.Fatalf("Unexpected init error: %v", err)
+			}
+			cmd.resolveStdin.stdin = strings.NewReader(tt.input)
+			cmd.resolveStdin.stdout = &stdout
+			cmd.resolveStdin.newClient = func(string) (env.Resolver, error) { return resolver, nil }
+
+			err := cmd.Run()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				if stdout.Len() != 0 {
+					t.Errorf("Expected no partial output on failure, got %q", stdout.String())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected run error: %v", err)
+			}
+			if stdout.String() != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, stdout.String())
+			}
+		})
+	}
+}
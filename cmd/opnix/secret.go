@@ -3,19 +3,28 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 
 	"github.com/brizzbuzz/opnix/internal/config"
 	"github.com/brizzbuzz/opnix/internal/errors"
+	"github.com/brizzbuzz/opnix/internal/keychain"
 	"github.com/brizzbuzz/opnix/internal/onepass"
 	"github.com/brizzbuzz/opnix/internal/secrets"
 	"github.com/brizzbuzz/opnix/internal/systemd"
 	"github.com/brizzbuzz/opnix/internal/validation"
+	"github.com/brizzbuzz/opnix/pkg/env"
 )
 
 const defaultTokenPath = "/etc/opnix-token"
 
+// Storage backends for resolved secrets
+const (
+	backendFiles    = "files"
+	backendKeychain = "keychain"
+)
+
 type secretProcessor interface {
 	Process(*config.Config) (*secrets.ProcessResult, error)
 }
@@ -24,55 +33,184 @@ type systemdManager interface {
 	ProcessSecretChanges([]config.Secret, map[string]string) error
 }
 
+// secretWriteOptions controls how resolved values are adjusted before writing
+type secretWriteOptions struct {
+	noNewline          bool
+	trimNewline        bool
+	normalizeNewlines  bool
+	allowPathCollision bool
+
+	// keychain, when set, replaces file output with keychain entries
+	keychain        keychain.Store
+	keychainService string
+}
+
 type secretCommand struct {
-	fs         *flag.FlagSet
-	configFile string
-	outputDir  string
-	tokenFile  string
+	fs          *flag.FlagSet
+	configFile  string
+	outputDir   string
+	tokenFile   string
+	precheck    bool
+	noNewline   bool
+	trimNewline bool
+	normalize   bool
+	summary     bool
+
+	allowPathCollision bool
+	expandEnv          bool
+	strictEnv          bool
+
+	backend         string
+	keychainService string
+	referenceScheme string
+	// schemes holds the parsed -reference-scheme list, nil for the default
+	schemes []string
+
+	allowVaults stringSliceFlag
+	allowlist   string
+
+	resolveStdin *resolveStdinCommand
+
+	stdout io.Writer
 
 	loadConfig       func(string) (*config.Config, error)
 	newClient        func(string) (secrets.SecretClient, error)
-	processorFactory func(secrets.SecretClient, string) secretProcessor
+	processorFactory func(secrets.SecretClient, string, secretWriteOptions) secretProcessor
 	systemdFactory   func(config.SystemdIntegration) (systemdManager, error)
+	newKeychain      func() (keychain.Store, error)
 }
 
 func newSecretCommand() *secretCommand {
 	sc := &secretCommand{
-		fs: flag.NewFlagSet("secret", flag.ExitOnError),
+		fs:     flag.NewFlagSet("secret", flag.ExitOnError),
+		stdout: os.Stdout,
 	}
 
 	sc.fs.StringVar(&sc.configFile, "config", "secrets.json", "Path to secrets configuration file")
 	sc.fs.StringVar(&sc.outputDir, "output", "secrets", "Directory to store retrieved secrets")
 	sc.fs.StringVar(&sc.tokenFile, "token-file", defaultTokenPath, "Path to file containing 1Password service account token")
+	sc.fs.BoolVar(&sc.precheck, "precheck", false, "Verify all references exist before writing any secrets")
+	sc.fs.Var(&sc.allowVaults, "allow-vault", "Only allow references to the named vault (repeatable)")
+	sc.fs.StringVar(&sc.allowlist, "allowlist", "", "File listing the references or glob patterns the configuration may use; anything else fails before resolving")
+	sc.fs.BoolVar(&sc.noNewline, "no-newline", false, "Write secret values byte-for-byte as stored, with no newline added or removed")
+	sc.fs.BoolVar(&sc.trimNewline, "trim-trailing-newline", false, "Strip trailing newlines from secret values before writing files")
+	sc.fs.BoolVar(&sc.normalize, "normalize-newlines", false, "Convert CRLF and CR line endings in secret values to LF before writing files")
+	sc.fs.BoolVar(&sc.summary, "summary", false, "Print whether each secret file was created, changed, or left unchanged")
+	sc.fs.BoolVar(&sc.allowPathCollision, "allow-path-collision", false, "Let secrets that resolve to the same file overwrite each other instead of failing when their values differ")
+	sc.fs.BoolVar(&sc.expandEnv, "expand-env", false, "Expand $VAR and ${VAR} in secret paths, references and pathTemplate")
+	sc.fs.BoolVar(&sc.strictEnv, "strict-env", false, "Like -expand-env, but fail when a variable is not set")
+	sc.fs.StringVar(&sc.backend, "backend", backendFiles, "Where to store resolved secrets: files or keychain")
+	sc.fs.StringVar(&sc.keychainService, "keychain-service", "opnix", "Keychain service name for secrets without keychainService")
+	sc.fs.StringVar(&sc.referenceScheme, "reference-scheme", "", "Comma-separated reference schemes to accept; only op is resolved (default op, or $OPNIX_REFERENCE_SCHEME)")
 
 	sc.fs.Usage = func() {
-		fmt.Fprintf(sc.fs.Output(), "Usage: opnix secret [options]\n\n")
+		fmt.Fprintf(sc.fs.Output(), "Usage: opnix secret [options]\n")
+		fmt.Fprintf(sc.fs.Output(), "       opnix secret resolve-stdin [options]\n\n")
 		fmt.Fprintf(sc.fs.Output(), "Retrieve and manage secrets from 1Password\n\n")
 		fmt.Fprintf(sc.fs.Output(), "Options:\n")
 		sc.fs.PrintDefaults()
 	}
 
-	sc.loadConfig = config.Load
+	sc.loadConfig = func(path string) (*config.Config, error) {
+		return config.LoadWithOptions(path, config.LoadOptions{Schemes: sc.schemes, ExpandEnv: sc.expandEnv, StrictEnv: sc.strictEnv})
+	}
 	sc.newClient = func(path string) (secrets.SecretClient, error) {
 		return onepass.NewClient(path)
 	}
-	sc.processorFactory = func(client secrets.SecretClient, outputDir string) secretProcessor {
-		return secrets.NewProcessor(client, outputDir)
+	sc.processorFactory = func(client secrets.SecretClient, outputDir string, opts secretWriteOptions) secretProcessor {
+		processor := secrets.NewProcessor(client, outputDir)
+		processor.SetNoNewline(opts.noNewline)
+		processor.SetTrimTrailingNewline(opts.trimNewline)
+		processor.SetNormalizeNewlines(opts.normalizeNewlines)
+		processor.SetAllowPathCollision(opts.allowPathCollision)
+		if opts.keychain != nil {
+			processor.SetKeychain(opts.keychain, opts.keychainService)
+		}
+		return processor
 	}
 	sc.systemdFactory = func(cfg config.SystemdIntegration) (systemdManager, error) {
 		return systemd.NewManager(cfg)
 	}
+	sc.newKeychain = keychain.New
 
 	return sc
 }
 
 func (s *secretCommand) Name() string { return s.fs.Name() }
 
+func (s *secretCommand) Flags() *flag.FlagSet { return s.fs }
+
+// subcommandFlags returns the resolve-stdin flag set for completions
+func (s *secretCommand) subcommandFlags() map[string]*flag.FlagSet {
+	return map[string]*flag.FlagSet{"resolve-stdin": newResolveStdinCommand().fs}
+}
+
 func (s *secretCommand) Init(args []string) error {
+	if len(args) > 0 && args[0] == "resolve-stdin" {
+		s.resolveStdin = newResolveStdinCommand()
+		return s.resolveStdin.Init(args[1:])
+	}
 	return s.fs.Parse(args)
 }
 
+// referenceSchemes returns the schemes named by -reference-scheme or
+// OPNIX_REFERENCE_SCHEME, or nil for the default. Invalid values are errors,
+// as are schemes other than op://, which opnix secret has no resolver for.
+func (s *secretCommand) referenceSchemes() ([]string, error) {
+	source := "-reference-scheme"
+	schemes, err := validation.ParseReferenceSchemes(s.referenceScheme)
+	if s.referenceScheme == "" {
+		source = validation.ReferenceSchemeEnvVar
+		schemes, err = validation.ReferenceSchemesFromEnv()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, scheme := range schemes {
+		if scheme != validation.DefaultReferenceScheme {
+			return nil, errors.ConfigValidationError(
+				source,
+				scheme,
+				fmt.Sprintf("opnix secret has no resolver for the '%s://' scheme and only resolves %s:// references", scheme, validation.DefaultReferenceScheme),
+				[]string{
+					fmt.Sprintf("Remove '%s' from %s", scheme, source),
+					fmt.Sprintf("Use %s:// references", validation.DefaultReferenceScheme),
+				},
+			)
+		}
+	}
+	return schemes, nil
+}
+
 func (s *secretCommand) Run() error {
+	if s.resolveStdin != nil {
+		return s.resolveStdin.Run()
+	}
+
+	if s.backend != backendFiles && s.backend != backendKeychain {
+		return errors.ConfigValidationError(
+			"secret.backend",
+			s.backend,
+			"Unknown secret storage backend",
+			[]string{"Use -backend files or -backend keychain"},
+		)
+	}
+	schemes, err := s.referenceSchemes()
+	if err != nil {
+		return err
+	}
+	s.schemes = schemes
+
+	if s.noNewline && (s.trimNewline || s.normalize) {
+		return errors.ConfigValidationError(
+			"secret.no-newline",
+			"true",
+			"-no-newline writes values exactly as stored, so it cannot be combined with -trim-trailing-newline or -normalize-newlines",
+			[]string{"Drop -no-newline to strip or convert line endings before writing"},
+		)
+	}
+
 	// Pre-flight checks
 	if err := s.validatePrerequisites(); err != nil {
 		return err
@@ -87,6 +225,47 @@ func (s *secretCommand) Run() error {
 
 	log.Printf("Loaded configuration with %d secrets", len(cfg.Secrets))
 
+	opts := secretWriteOptions{
+		noNewline:          s.noNewline,
+		trimNewline:        s.trimNewline,
+		normalizeNewlines:  s.normalize,
+		allowPathCollision: s.allowPathCollision,
+	}
+	if s.backend == backendKeychain {
+		if cfg.SystemdIntegration.Enable {
+			return errors.ConfigValidationError(
+				"secret.backend",
+				s.backend,
+				"Systemd integration watches secret files and cannot be used with the keychain backend",
+				[]string{"Disable systemdIntegration or use -backend files"},
+			)
+		}
+		store, err := s.newKeychain()
+		if err != nil {
+			return err
+		}
+		opts.keychain = store
+		opts.keychainService = s.keychainService
+	}
+
+	var allowlist *validation.ReferenceAllowlist
+	if s.allowlist != "" {
+		if allowlist, err = validation.LoadReferenceAllowlist(s.allowlist); err != nil {
+			return err
+		}
+	}
+	for i, secret := range cfg.Secrets {
+		field := fmt.Sprintf("secret[%d].reference", i)
+		if err := validation.ValidateAllowedVault(secret.Reference, field, s.allowVaults); err != nil {
+			return err
+		}
+		if allowlist != nil {
+			if err := allowlist.Validate(secret.Reference, field); err != nil {
+				return err
+			}
+		}
+	}
+
 	// Initialize 1Password client with validation
 	client, err := s.newClient(s.tokenFile)
 	if err != nil {
@@ -96,15 +275,48 @@ func (s *secretCommand) Run() error {
 
 	log.Printf("Initialized 1Password client successfully")
 
+	if s.precheck {
+		references := make([]string, 0, len(cfg.Secrets))
+		for _, secret := range cfg.Secrets {
+			references = append(references, validation.StripSelector(secret.Reference))
+		}
+		prechecker, ok := client.(env.Prechecker)
+		if !ok {
+			return errors.ConfigError(
+				"Prechecking 1Password references",
+				"The configured client does not support reference prechecks",
+				nil,
+			)
+		}
+		if err := env.PrecheckReferences(prechecker, references); err != nil {
+			return err
+		}
+		log.Printf("Precheck passed for %d references", len(references))
+	}
+
 	// Process secrets with detailed progress
-	processor := s.processorFactory(client, s.outputDir)
+	processor := s.processorFactory(client, s.outputDir, opts)
 	result, err := processor.Process(cfg)
 	if err != nil {
 		// Error already has context from processor.Process
 		return err
 	}
 
-	log.Printf("Successfully processed %d secrets to %s", result.ProcessedCount, s.outputDir)
+	if s.backend == backendKeychain {
+		log.Printf("Successfully stored %d secrets in the keychain", result.ProcessedCount)
+		if s.summary {
+			writeSecretSummary(s.stdout, result)
+		}
+		return nil
+	}
+
+	log.Printf("Successfully processed %d secrets to %s (%d created, %d changed, %d unchanged)",
+		result.ProcessedCount, s.outputDir,
+		result.Count(secrets.FileCreated), result.Count(secrets.FileChanged), result.Count(secrets.FileUnchanged))
+
+	if s.summary {
+		writeSecretSummary(s.stdout, result)
+	}
 
 	// Process systemd integration if enabled
 	if cfg.SystemdIntegration.Enable {
@@ -144,6 +356,19 @@ func (s *secretCommand) Run() error {
 	return nil
 }
 
+// writeSecretSummary prints one line per secret file followed by totals
+func writeSecretSummary(w io.Writer, result *secrets.ProcessResult) {
+	for _, file := range result.Files {
+		fmt.Fprintf(w, "%-10s %s\n", file.Status, file.Path)
+	}
+	if stored := result.Count(secrets.FileStored); stored > 0 {
+		fmt.Fprintf(w, "%d stored\n", stored)
+		return
+	}
+	fmt.Fprintf(w, "%d created, %d changed, %d unchanged\n",
+		result.Count(secrets.FileCreated), result.Count(secrets.FileChanged), result.Count(secrets.FileUnchanged))
+}
+
 // validatePrerequisites performs pre-flight checks before processing
 func (s *secretCommand) validatePrerequisites() error {
 	// Check if config file exists
@@ -157,8 +382,10 @@ func (s *secretCommand) validatePrerequisites() error {
 	}
 
 	// Check if output directory is writable
-	if err := s.checkOutputDirectory(); err != nil {
-		return err
+	if s.backend == backendFiles {
+		if err := s.checkOutputDirectory(); err != nil {
+			return err
+		}
 	}
 
 	// Validate token file (but don't fail if missing - let graceful handling work)
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSecretCommand_ReferenceSchemes(t *testing.T) {
+	tests := []struct {
+		name    string
+		flag    string
+		env     string
+		want    string
+		wantErr string
+	}{
+		{name: "default", want: ""},
+		{name: "flag", flag: "op://", want: "op"},
+		{name: "environment", env: "op", want: "op"},
+		{name: "flag wins over environment", flag: "op", env: "Bad Scheme", want: "op"},
+		{name: "invalid environment value", env: "op,Bad Scheme", wantErr: "OPNIX_REFERENCE_SCHEME"},
+		{name: "scheme without a resolver", flag: "op,vault", wantErr: "no resolver for the 'vault://' scheme"},
+		{name: "environment scheme without a resolver", env: "mock", wantErr: "no resolver for the 'mock://' scheme"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OPNIX_REFERENCE_SCHEME", tt.env)
+			cmd := newSecretCommand()
+			cmd.referenceScheme = tt.flag
+
+			schemes, err := cmd.referenceSchemes()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got := strings.Join(schemes, ","); got != tt.want {
+				t.Errorf("Expected schemes %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSecretCommand_NoNewlineRejectsRewrites(t *testing.T) {
+	for _, flag := range []string{"-trim-trailing-newline", "-normalize-newlines"} {
+		t.Run(flag, func(t *testing.T) {
+			cmd := newSecretCommand()
+			if err := cmd.Init([]string{"-no-newline", flag}); err != nil {
+				t.Fatalf("Unexpected init error: %v", err)
+			}
+			err := cmd.Run()
+			if err == nil || !strings.Contains(err.Error(), "-no-newline writes values exactly as stored") {
+				t.Fatalf("Expected -no-newline to reject %s, got %v", flag, err)
+			}
+		})
+	}
+}
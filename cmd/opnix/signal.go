@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// signalError reports that a command stopped because it received a signal
+type signalError struct {
+	signal os.Signal
+}
+
+func (e *signalError) Error() string {
+	return fmt.Sprintf("interrupted by %s", e.signal)
+}
+
+// exitCode follows the shell convention of 128 plus the signal number
+func (e *signalError) exitCode() int {
+	if sig, ok := e.signal.(syscall.Signal); ok {
+		return 128 + int(sig)
+	}
+	return exitCodeFailure
+}
+
+// interruptWatcher cancels a context when SIGINT or SIGTERM arrives and
+// remembers which signal caused the cancellation
+type interruptWatcher struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	ch     chan os.Signal
+
+	mu       sync.Mutex
+	received os.Signal
+}
+
+// watchInterrupts starts listening for SIGINT and SIGTERM. Call stop once
+// the command finishes to restore default signal handling.
+func watchInterrupts(parent context.Context) *interruptWatcher {
+	ctx, cancel := context.WithCancel(parent)
+	w := &interruptWatcher{
+		ctx:    ctx,
+		cancel: cancel,
+		ch:     make(chan os.Signal, 1),
+	}
+
+	signal.Notify(w.ch, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-w.ch:
+			// A second signal falls back to the default behaviour and
+			// terminates immediately if teardown is stuck
+			signal.Stop(w.ch)
+			w.mu.Lock()
+			w.received = sig
+			w.mu.Unlock()
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return w
+}
+
+func (w *interruptWatcher) stop() {
+	signal.Stop(w.ch)
+	w.cancel()
+}
+
+// err converts err into a signalError when a signal interrupted the command
+func (w *interruptWatcher) err(err error) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err != nil && w.received != nil {
+		return &signalError{signal: w.received}
+	}
+	return err
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestWatchInterrupts(t *testing.T) {
+	interrupts := watchInterrupts(context.Background())
+	defer interrupts.stop()
+
+	if err := interrupts.err(fmt.Errorf("boom")); err.Error() != "boom" {
+		t.Errorf("Expected original error before any signal, got %v", err)
+	}
+
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGINT); err != nil {
+		t.Fatalf("Failed to send SIGINT: %v", err)
+	}
+
+	select {
+	case <-interrupts.ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected context to be cancelled after SIGINT")
+	}
+
+	err := interrupts.err(interrupts.ctx.Err())
+	if code := exitCodeFor(err); code != 130 {
+		t.Errorf("Expected exit code 130, got %d (%v)", code, err)
+	}
+	if interrupts.err(nil) != nil {
+		t.Error("Expected nil error to stay nil after a signal")
+	}
+}
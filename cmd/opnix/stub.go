@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"strings"
+
+	"github.com/brizzbuzz/opnix/internal/errors"
+	"github.com/brizzbuzz/opnix/internal/validation"
+	"github.com/brizzbuzz/opnix/pkg/env"
+)
+
+// writeCreateStubs prints, for every variable whose reference was not found,
+// the op command that would make it resolvable. Nothing is ever created; the
+// commands are only printed for the developer to review and run.
+func (e *envCommand) writeCreateStubs(cfg *env.Config, result *env.Result) {
+	variables := make(map[string]env.Variable, len(cfg.Vars))
+	for _, variable := range cfg.Vars {
+		variables[variable.Name] = variable
+	}
+
+	var missing []env.Skipped
+	missing = append(missing, result.Failed...)
+	missing = append(missing, result.Skipped...)
+	missing = append(missing, result.Placeholders...)
+	for _, entry := range missing {
+		variable, ok := variables[entry.Name]
+		if !ok || variable.Reference == "" || !isMissingReference(entry.Err) {
+			continue
+		}
+		command, itemExists, ok := createStubCommand(variable, errors.IsFieldNotFound(entry.Err))
+		if !ok {
+			continue
+		}
+		target := "a missing item"
+		if itemExists {
+			target = "a missing field"
+		}
+		e.noticef("INFO: %s references %s; to create it, review and run:\n  %s\n", entry.Name, target, command)
+	}
+}
+
+// isMissingReference reports whether err means the reference does not exist,
+// as opposed to the token being rejected or the run being cancelled
+func isMissingReference(err error) bool {
+	if errors.IsAuthError(err) || errors.IsSDKError(err) {
+		return false
+	}
+	if stderrors.Is(err, context.Canceled) || stderrors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	return errors.IsNotFound(err)
+}
+
+// createStubCommand returns an op item create command for the variable's
+// item, or an op item edit command adding the field when the item exists.
+// The field is created as an empty concealed field, with a section prefix
+// for op://Vault/Item/section/field references.
+func createStubCommand(variable env.Variable, itemExists bool) (string, bool, bool) {
+	parts, err := validation.ReferenceSegments(variable.Reference)
+	if err != nil || len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return "", false, false
+	}
+	vault, item := parts[0], parts[1]
+
+	var assignment string
+	if len(parts) > 2 {
+		assignment = shellQuote(strings.Join(parts[2:], ".") + "[password]=")
+	}
+
+	if itemExists && assignment != "" {
+		return fmt.Sprintf("op item edit %s --vault %s %s", shellQuote(item), shellQuote(vault), assignment), true, true
+	}
+
+	command := fmt.Sprintf("op item create --category 'Secure Note' --vault %s --title %s", shellQuote(vault), shellQuote(item))
+	if assignment != "" {
+		command += " " + assignment
+	}
+	return command, false, true
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/brizzbuzz/opnix/internal/errors"
+	"github.com/brizzbuzz/opnix/pkg/env"
+)
+
+// fieldMissingResolver reports every reference under item as a missing
+// field, and other unknown references as missing items
+type fieldMissingResolver struct {
+	fakeResolver
+	item string
+}
+
+func (f *fieldMissingResolver) ResolveSecret(reference string) (string, error) {
+	if strings.HasPrefix(reference, f.item+"/") {
+		if _, ok := f.secrets[reference]; !ok {
+			return "", errors.FieldNotFoundError("Resolving 1Password secret", "Database", "password", []string{"username"}, nil)
+		}
+	}
+	if _, ok := f.secrets[reference]; !ok {
+		return "", errors.OnePasswordError("Resolving 1Password secret", fmt.Sprintf("Reference not found: %s", reference), nil).WithKind(errors.KindNotFound)
+	}
+	return f.fakeResolver.ResolveSecret(reference)
+}
+
+func TestEnvCommand_CreateStub(t *testing.T) {
+	resolver := &fieldMissingResolver{
+		fakeResolver: fakeResolver{secrets: map[string]string{"op://Dev/Database/username": "app"}},
+		item:         "op://Dev/Database",
+	}
+
+	cmd, stdout, stderr := newTestEnvCommand(resolver)
+	err := cmd.Init([]string{
+		"-config-json", `{"vars":[
+			{"name":"DB_USER","reference":"op://Dev/Database/username"},
+			{"name":"DB_PASSWORD","reference":"op://Dev/Database/password"},
+			{"name":"STRIPE_KEY","reference":"op://Dev/Stripe Test/api/secret key"},
+			{"name":"SENTRY_DSN","reference":"op://Dev/Sentry/dsn","optional":true}
+		]}`,
+		"-create-stub",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+	err = cmd.Run()
+	if err == nil || !strings.Contains(err.Error(), "DB_PASSWORD, STRIPE_KEY") {
+		t.Fatalf("Expected both required failures to be reported, got %v", err)
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("Expected no output when required variables failed, got %q", stdout.String())
+	}
+
+	for _, expected := range []string{
+		"op item edit 'Database' --vault 'Dev' 'password[password]='",
+		"op item create --category 'Secure Note' --vault 'Dev' --title 'Stripe Test' 'api.secret key[password]='",
+		"op item create --category 'Secure Note' --vault 'Dev' --title 'Sentry' 'dsn[password]='",
+	} {
+		if !strings.Contains(stderr.String(), expected) {
+			t.Errorf("Expected stub command %q, got %q", expected, stderr.String())
+		}
+	}
+}
+
+func TestCreateStubCommand_WholeItem(t *testing.T) {
+	cmd, itemExists, ok := createStubCommand(env.Variable{Name: "CONFIG", Reference: "op://Dev/App%2FConfig"}, true)
+	if !ok || itemExists {
+		t.Fatalf("Expected a create command for a whole-item reference, got %q (exists=%v, ok=%v)", cmd, itemExists, ok)
+	}
+	if cmd != "op item create --category 'Secure Note' --vault 'Dev' --title 'App/Config'" {
+		t.Errorf("Unexpected command %q", cmd)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brizzbuzz/opnix/pkg/env"
+)
+
+// timingBuckets are the upper bounds of the -timing histogram rows
+var timingBuckets = []time.Duration{
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+}
+
+// timingBarWidth is the length of a histogram bar holding every call
+const timingBarWidth = 40
+
+// timingStats collects resolver latencies for the -timing summary. It only
+// holds durations and counts, never references or values.
+type timingStats struct {
+	mu     sync.Mutex
+	calls  []time.Duration
+	failed int
+	caches []*env.CachingResolver
+}
+
+// record adds one underlying resolver call
+func (s *timingStats) record(timing env.LookupTiming) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, timing.Duration)
+	if !timing.Success {
+		s.failed++
+	}
+}
+
+// track counts cache hits from cache in the summary
+func (s *timingStats) track(cache *env.CachingResolver) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.caches = append(s.caches, cache)
+}
+
+// write prints the latency summary and histogram to w
+func (s *timingStats) write(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hits := 0
+	for _, cache := range s.caches {
+		hits += cache.Hits()
+	}
+
+	calls := append([]time.Duration(nil), s.calls...)
+	sort.Slice(calls, func(i, j int) bool { return calls[i] < calls[j] })
+
+	fmt.Fprintf(w, "Resolution timing: %d API calls", len(calls))
+	if s.failed > 0 {
+		fmt.Fprintf(w, " (%d failed)", s.failed)
+	}
+	fmt.Fprintf(w, ", %d cache hits\n", hits)
+	if len(calls) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "  min %s  median %s  p95 %s  max %s\n",
+		formatLatency(calls[0]),
+		formatLatency(percentile(calls, 0.5)),
+		formatLatency(percentile(calls, 0.95)),
+		formatLatency(calls[len(calls)-1]),
+	)
+
+	counts := make([]int, len(timingBuckets)+1)
+	for _, call := range calls {
+		counts[sort.Search(len(timingBuckets), func(i int) bool { return call < timingBuckets[i] })]++
+	}
+	for i, count := range counts {
+		if count == 0 {
+			continue
+		}
+		label := ">=" + timingBuckets[len(timingBuckets)-1].String()
+		if i < len(timingBuckets) {
+			label = "<" + timingBuckets[i].String()
+		}
+		fmt.Fprintf(w, "  %-8s %s %d\n", label, strings.Repeat("#", max(1, count*timingBarWidth/len(calls))), count)
+	}
+}
+
+// percentile returns the nearest-rank percentile of sorted durations
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(float64(len(sorted))*p)) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+// formatLatency rounds d for display, keeping sub-millisecond lookups readable
+func formatLatency(d time.Duration) time.Duration {
+	if d < time.Millisecond {
+		return d.Round(time.Microsecond)
+	}
+	return d.Round(time.Millisecond)
+}
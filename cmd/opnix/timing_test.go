@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brizzbuzz/opnix/pkg/env"
+)
+
+func TestTimingStats_Write(t *testing.T) {
+	stats := &timingStats{}
+	for i := 1; i <= 20; i++ {
+		stats.record(env.LookupTiming{Duration: time.Duration(i) * 100 * time.Millisecond, References: 1, Success: true})
+	}
+
+	var b strings.Builder
+	stats.write(&b)
+	output := b.String()
+
+	for _, want := range []string{
+		"Resolution timing: 20 API calls, 0 cache hits\n",
+		"  min 100ms  median 1s  p95 1.9s  max 2s\n",
+		"  <250ms   #### 2\n",
+		"  <1s      ########## 5\n",
+		"  <2.5s    ###################### 11\n",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected summary to contain %q, got:\n%s", want, output)
+		}
+	}
+}
+
+func TestTimingStats_NoCalls(t *testing.T) {
+	var b strings.Builder
+	(&timingStats{}).write(&b)
+
+	if got := b.String(); got != "Resolution timing: 0 API calls, 0 cache hits\n" {
+		t.Errorf("Expected a single summary line, got %q", got)
+	}
+}
@@ -5,9 +5,17 @@ import (
 	"bufio"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"os/user"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
+
+	"github.com/brizzbuzz/opnix/internal/errors"
+	"github.com/brizzbuzz/opnix/internal/onepass"
 )
 
 const tokenFileMode = 0600
@@ -16,20 +24,24 @@ type tokenCommand struct {
 	fs     *flag.FlagSet
 	path   string
 	action string
+
+	stdout io.Writer
 }
 
 func newTokenCommand() *tokenCommand {
 	tc := &tokenCommand{
-		fs: flag.NewFlagSet("token", flag.ExitOnError),
+		fs:     flag.NewFlagSet("token", flag.ExitOnError),
+		stdout: os.Stdout,
 	}
 
-	tc.fs.StringVar(&tc.path, "path", defaultTokenPath, "Path to store the token file")
+	tc.fs.StringVar(&tc.path, "path", defaultTokenPath, "Path to the token file")
 
 	tc.fs.Usage = func() {
 		fmt.Fprintf(tc.fs.Output(), "Usage: opnix token <command> [options]\n\n")
 		fmt.Fprintf(tc.fs.Output(), "Manage 1Password service account token\n\n")
 		fmt.Fprintf(tc.fs.Output(), "Commands:\n")
-		fmt.Fprintf(tc.fs.Output(), "  set     Set the service account token\n\n")
+		fmt.Fprintf(tc.fs.Output(), "  set          Set the service account token\n")
+		fmt.Fprintf(tc.fs.Output(), "  show-source  Show which token source is used, without printing the token\n\n")
 		fmt.Fprintf(tc.fs.Output(), "Options:\n")
 		tc.fs.PrintDefaults()
 	}
@@ -39,6 +51,8 @@ func newTokenCommand() *tokenCommand {
 
 func (t *tokenCommand) Name() string { return t.fs.Name() }
 
+func (t *tokenCommand) Flags() *flag.FlagSet { return t.fs }
+
 func (t *tokenCommand) Init(args []string) error {
 	if err := t.fs.Parse(args); err != nil {
 		return err
@@ -57,6 +71,8 @@ func (t *tokenCommand) Run() error {
 	switch t.action {
 	case "set":
 		return t.setToken()
+	case "show-source":
+		return t.showSource()
 	default:
 		return fmt.Errorf("unknown token action: %s", t.action)
 	}
@@ -117,3 +133,60 @@ func (t *tokenCommand) setToken() error {
 	fmt.Fprintf(os.Stderr, "Token successfully stored at %s\n", t.path)
 	return nil
 }
+
+// showSource reports where the token would be read from, following the same
+// precedence as the other commands, and describes the token file
+func (t *tokenCommand) showSource() error {
+	source := onepass.ActiveTokenSource(t.path)
+	if source.EnvVar != "" {
+		fmt.Fprintf(t.stdout, "Source:    environment variable %s\n", source.EnvVar)
+		fmt.Fprintf(t.stdout, "Ignored:   %s\n", t.path)
+		return nil
+	}
+
+	info, err := os.Stat(source.Path)
+	if err != nil {
+		return errors.TokenError(
+			fmt.Sprintf("Token file is not readable and %s is not set: %s", onepass.TokenEnvVar, err.Error()),
+			source.Path,
+			err,
+		)
+	}
+
+	fmt.Fprintf(t.stdout, "Source:    file %s\n", source.Path)
+	if target, err := os.Readlink(source.Path); err == nil {
+		fmt.Fprintf(t.stdout, "Symlink:   %s\n", target)
+	}
+
+	mode := fmt.Sprintf("%04o", info.Mode().Perm())
+	if info.Mode().Perm()&0007 != 0 {
+		mode += " (accessible to all users)"
+	}
+	fmt.Fprintf(t.stdout, "Mode:      %s\n", mode)
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		fmt.Fprintf(t.stdout, "Owner:     %s:%s\n", ownerName(stat.Uid), groupName(stat.Gid))
+	}
+	fmt.Fprintf(t.stdout, "Modified:  %s\n", info.ModTime().Format(time.RFC3339))
+	if info.Size() == 0 {
+		fmt.Fprintf(t.stdout, "Warning:   token file is empty\n")
+	}
+	return nil
+}
+
+// ownerName returns the user name for uid, or the numeric ID when unknown
+func ownerName(uid uint32) string {
+	id := strconv.FormatUint(uint64(uid), 10)
+	if u, err := user.LookupId(id); err == nil {
+		return u.Username
+	}
+	return id
+}
+
+// groupName returns the group name for gid, or the numeric ID when unknown
+func groupName(gid uint32) string {
+	id := strconv.FormatUint(uint64(gid), 10)
+	if g, err := user.LookupGroupId(id); err == nil {
+		return g.Name
+	}
+	return id
+}
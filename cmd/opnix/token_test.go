@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTokenCommand_ShowSource(t *testing.T) {
+	dir := t.TempDir()
+	tokenPath := filepath.Join(dir, "token")
+	if err := os.WriteFile(tokenPath, []byte("test-token-value"), 0644); err != nil {
+		t.Fatalf("Failed to write token file: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		envToken string
+		expected []string
+		wantErr  string
+	}{
+		{
+			name:     "token file",
+			path:     tokenPath,
+			expected: []string{"Source:    file " + tokenPath, "Mode:      0644 (accessible to all users)", "Modified:"},
+		},
+		{
+			name:     "environment variable wins",
+			path:     tokenPath,
+			envToken: "test-env-token",
+			expected: []string{"Source:    environment variable OP_SERVICE_ACCOUNT_TOKEN", "Ignored:   " + tokenPath},
+		},
+		{
+			name:    "missing token file",
+			path:    filepath.Join(dir, "missing"),
+			wantErr: "Token file is not readable",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OP_SERVICE_ACCOUNT_TOKEN", tt.envToken)
+
+			var stdout bytes.Buffer
+			cmd := newTokenCommand()
+			cmd.stdout = &stdout
+			if err := cmd.Init([]string{"-path", tt.path, "show-source"}); err != nil {
+				t.Fatalf("Unexpected init error: %v", err)
+			}
+
+			err := cmd.Run()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				if code := exitCodeFor(err); code != exitCodeFailure {
+					t.Errorf("Expected a missing token file to exit %d, got %d", exitCodeFailure, code)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected run error: %v", err)
+			}
+
+			output := stdout.String()
+			for _, want := range tt.expected {
+				if !strings.Contains(output, want) {
+					t.Errorf("Expected output to contain %q, got %q", want, output)
+				}
+			}
+			if strings.Contains(output, "test-token-value") || strings.Contains(output, "test-env-token") {
+				t.Errorf("Token leaked into output: %q", output)
+			}
+		})
+	}
+}
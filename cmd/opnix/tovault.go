@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/brizzbuzz/opnix/internal/errors"
+	"github.com/brizzbuzz/opnix/pkg/env"
+)
+
+// vaultRequestTimeout bounds the write to HashiCorp Vault
+const vaultRequestTimeout = 30 * time.Second
+
+// toVaultOptions holds the destination for "opnix env to-vault"
+type toVaultOptions struct {
+	path string
+}
+
+// initToVault registers the to-vault flags alongside the env flags. Here
+// -dry-run resolves the values and lists the fields that would be written,
+// with secret values masked, without contacting Vault.
+func (e *envCommand) initToVault(args []string) error {
+	e.registerToVaultFlags()
+	e.fs.SetOutput(e.stderr)
+	return e.fs.Parse(args)
+}
+
+// registerToVaultFlags adds the to-vault flags to the env flag set
+func (e *envCommand) registerToVaultFlags() {
+	e.toVault = &toVaultOptions{}
+	e.fs.StringVar(&e.toVault.path, "path", "", "KV v2 secret to write, as mount/path, e.g. secret/app (required)")
+}
+
+// checkToVault requires a destination and rejects flags that pick a kind of
+// output, since to-vault writes values to Vault instead of printing them
+func (e *envCommand) checkToVault() error {
+	if _, _, err := splitVaultPath(e.toVault.path); err != nil {
+		return err
+	}
+	return e.checkConflicts(
+		"env.to-vault",
+		e.toVault.path,
+		"to-vault writes values to HashiCorp Vault instead of writing output",
+		outputFlags,
+		"Use -dry-run to preview the fields with secret values masked",
+	)
+}
+
+// splitVaultPath separates the secrets engine mount from the secret path.
+// As with "vault kv put", the path leaves out the API's data/ segment.
+func splitVaultPath(path string) (string, string, error) {
+	mount, secret, _ := strings.Cut(strings.Trim(path, "/"), "/")
+	if mount == "" || strings.Trim(secret, "/") == "" {
+		return "", "", errors.ConfigValidationError(
+			"env.to-vault.path",
+			path,
+			"A KV v2 path of the form mount/path is required",
+			[]string{"Example: opnix env to-vault -config opnix-env.json -path secret/app"},
+		)
+	}
+	return mount, strings.Trim(secret, "/"), nil
+}
+
+// runToVault writes every value as a field of the KV v2 secret, or lists
+// the fields with -dry-run
+func (e *envCommand) runToVault(values map[string]string, vars []env.Variable) error {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	if e.dryRun {
+		masked := maskSecretValues(values, vars)
+		fmt.Fprintf(e.stdout, "Would write %d fields to %s:\n", len(keys), e.toVault.path)
+		for _, key := range keys {
+			fmt.Fprintf(e.stdout, "  %s=%s\n", key, masked[key])
+		}
+		return nil
+	}
+
+	mount, secret, err := splitVaultPath(e.toVault.path)
+	if err != nil {
+		return err
+	}
+	version, err := putVaultKV(mount, secret, values)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stderr, "Wrote %d fields to %s (version %d)\n", len(keys), e.toVault.path, version)
+	return nil
+}
+
+// putVaultKV writes data to a KV v2 secret using VAULT_ADDR, VAULT_TOKEN,
+// and the optional VAULT_NAMESPACE, returning the new secret version. The
+// write replaces every field of the secret, as "vault kv put" does.
+func putVaultKV(mount, secret string, data map[string]string) (int, error) {
+	addr := strings.TrimRight(strings.TrimSpace(os.Getenv("VAULT_ADDR")), "/")
+	token := strings.TrimSpace(os.Getenv("VAULT_TOKEN"))
+	if addr == "" || token == "" {
+		return 0, errors.ConfigValidationError(
+			"env.to-vault",
+			mount+"/"+secret,
+			"VAULT_ADDR and VAULT_TOKEN must be set to write to HashiCorp Vault",
+			[]string{
+				"Export VAULT_ADDR, e.g. https://vault.example.com:8200",
+				"Export VAULT_TOKEN with a token that may write the path, e.g. from vault login",
+			},
+		)
+	}
+
+	body, err := json.Marshal(map[string]interface{}{"data": data})
+	if err != nil {
+		return 0, errors.ConfigError("Encoding Vault request", "Failed to encode the secret fields", err)
+	}
+	url := fmt.Sprintf("%s/v1/%s/data/%s", addr, mount, secret)
+	request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, vaultWriteError(url, "Invalid VAULT_ADDR", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Vault-Token", token)
+	if namespace := os.Getenv("VAULT_NAMESPACE"); namespace != "" {
+		request.Header.Set("X-Vault-Namespace", namespace)
+	}
+
+	client := &http.Client{Timeout: vaultRequestTimeout}
+	response, err := client.Do(request)
+	if err != nil {
+		return 0, vaultWriteError(url, "Failed to reach Vault", err)
+	}
+	defer response.Body.Close()
+
+	var reply struct {
+		Data struct {
+			Version int `json:"version"`
+		} `json:"data"`
+		Errors []string `json:"errors"`
+	}
+	payload, _ := io.ReadAll(io.LimitReader(response.Body, 1<<20))
+	_ = json.Unmarshal(payload, &reply)
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		issue := fmt.Sprintf("Vault returned %s", response.Status)
+		if len(reply.Errors) > 0 {
+			issue += ": " + strings.Join(reply.Errors, "; ")
+		}
+		return 0, vaultWriteError(url, issue, nil)
+	}
+	return reply.Data.Version, nil
+}
+
+// vaultWriteError describes a failed write to HashiCorp Vault
+func vaultWriteError(url, issue string, cause error) error {
+	return &errors.OpnixError{
+		Operation: "Writing secrets to HashiCorp Vault",
+		Component: "Vault KV",
+		Issue:     issue,
+		Context:   fmt.Sprintf("Request: POST %s", url),
+		Cause:     cause,
+		Suggestions: []string{
+			"Check that VAULT_ADDR points at the Vault server",
+			"Check that the mount is a KV version 2 secrets engine",
+			"Check that VAULT_TOKEN has create and update capabilities on the path",
+		},
+	}
+}
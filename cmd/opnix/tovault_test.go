@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestEnvCommand_ToVault(t *testing.T) {
+	config := `{"vars":[
+		{"name":"DB_PASSWORD","reference":"op://Example/Service/password"},
+		{"name":"LOG_LEVEL","value":"info"}
+	]}`
+	resolver := &fakeResolver{secrets: map[string]string{"op://Example/Service/password": "test-password"}}
+
+	var gotPath, gotToken, gotNamespace string
+	var gotBody struct {
+		Data map[string]string `json:"data"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotToken, gotNamespace = r.URL.Path, r.Header.Get("X-Vault-Token"), r.Header.Get("X-Vault-Namespace")
+		if err := json.NewDecoder(r.Body).Decode(&gotBody); err != nil {
+			t.Errorf("Failed to decode request body: %v", err)
+		}
+		if gotToken != "test-vault-token" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		w.Write([]byte(`{"data":{"version":3}}`))
+	}))
+	defer server.Close()
+	t.Setenv("VAULT_ADDR", server.URL+"/")
+	t.Setenv("VAULT_TOKEN", "test-vault-token")
+	t.Setenv("VAULT_NAMESPACE", "team")
+
+	cmd, stdout, stderr := newTestEnvCommand(resolver)
+	if err := cmd.Init([]string{"to-vault", "-config-json", config, "-path", "secret/apps/api"}); err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Unexpected run error: %v", err)
+	}
+	if gotPath != "/v1/secret/data/apps/api" {
+		t.Errorf("Expected KV v2 data path, got %q", gotPath)
+	}
+	if gotNamespace != "team" {
+		t.Errorf("Expected VAULT_NAMESPACE header, got %q", gotNamespace)
+	}
+	if gotBody.Data["DB_PASSWORD"] != "test-password" || gotBody.Data["LOG_LEVEL"] != "info" {
+		t.Errorf("Expected every variable as a field, got %v", gotBody.Data)
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("Expected nothing on stdout, got %q", stdout.String())
+	}
+	if !strings.Contains(stderr.String(), "Wrote 2 fields to secret/apps/api (version 3)") {
+		t.Errorf("Expected write summary, got %q", stderr.String())
+	}
+
+	t.Setenv("VAULT_TOKEN", "stale-token")
+	cmd, _, _ = newTestEnvCommand(resolver)
+	if err := cmd.Init([]string{"to-vault", "-config-json", config, "-path", "secret/app"}); err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+	if err := cmd.Run(); err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Errorf("Expected Vault's error to be reported, got %v", err)
+	}
+}
+
+func TestEnvCommand_ToVaultDryRun(t *testing.T) {
+	t.Setenv("VAULT_ADDR", "")
+	t.Setenv("VAULT_TOKEN", "")
+	config := `{"vars":[
+		{"name":"DB_PASSWORD","reference":"op://Example/Service/password"},
+		{"name":"LOG_LEVEL","value":"info"}
+	]}`
+	resolver := &fakeResolver{secrets: map[string]string{"op://Example/Service/password": "test-password"}}
+
+	cmd, stdout, _ := newTestEnvCommand(resolver)
+	if err := cmd.Init([]string{"to-vault", "-config-json", config, "-path", "secret/app", "-dry-run"}); err != nil {
+		t.Fatalf("Unexpected init error: %v", err)
+	}
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Unexpected run error: %v", err)
+	}
+	expected := "Would write 2 fields to secret/app:\n  DB_PASSWORD=" + maskedValue + "\n  LOG_LEVEL=info\n"
+	if stdout.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, stdout.String())
+	}
+}
+
+func TestEnvCommand_ToVaultValidation(t *testing.T) {
+	config := `{"vars":[{"name":"LOG_LEVEL","value":"info"}]}`
+	tests := []struct {
+		name      string
+		args      []string
+		wantError string
+	}{
+		{"path required", []string{"to-vault", "-config-json", config}, "mount/path is required"},
+		{"mount only", []string{"to-vault", "-config-json", config, "-path", "secret/"}, "mount/path is required"},
+		{"output flags rejected", []string{"to-vault", "-config-json", config, "-path", "secret/app", "-format", "json"}, "cannot be combined with -format"},
+		{"vault settings required", []string{"to-vault", "-config-json", config, "-path", "secret/app"}, "VAULT_ADDR and VAULT_TOKEN must be set"},
+	}
+
+	t.Setenv("VAULT_ADDR", "")
+	t.Setenv("VAULT_TOKEN", "")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, _, _ := newTestEnvCommand(&fakeResolver{})
+			if err := cmd.Init(tt.args); err != nil {
+				t.Fatalf("Unexpected init error: %v", err)
+			}
+			if err := cmd.Run(); err == nil || !strings.Contains(err.Error(), tt.wantError) {
+				t.Fatalf("Expected error containing %q, got %v", tt.wantError, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"io"
+	"os"
+
+	"github.com/brizzbuzz/opnix/internal/errors"
+	"github.com/brizzbuzz/opnix/pkg/env"
+)
+
+// checkTerminalOutput refuses to print secret values to an interactive
+// terminal unless -allow-tty is set. Piped and redirected stdout, masked or
+// encrypted output, and runs that write files are not affected.
+func (e *envCommand) checkTerminalOutput(cfg *env.Config, format string) error {
+	if e.allowTTY || e.mask || len(e.encryptTo) > 0 || e.exec != nil || e.toVault != nil || e.explain != "" || e.check {
+		return nil
+	}
+	if format == "none" || format == statusJSONFormat || e.updatePath != "" || e.outputPath != "" || e.outputs != "" {
+		return nil
+	}
+
+	secret := false
+	for _, variable := range cfg.Vars {
+		if variable.IsSecret() {
+			secret = true
+			break
+		}
+	}
+	if !secret || !e.isTerminal(e.stdout) {
+		return nil
+	}
+
+	return errors.ConfigValidationError(
+		"env.allow-tty",
+		"false",
+		"Refusing to print secret values to an interactive terminal",
+		[]string{
+			"Redirect the output to a file or pipe it: opnix env ... > app.env",
+			"Use -output FILE to write the values to a file",
+			"Use -mask to print the output with secret values masked",
+			"Pass -allow-tty to print the values anyway",
+		},
+	)
+}
+
+// isTerminalWriter reports whether w is a character device other than the
+// null device, i.e. an interactive terminal
+func isTerminalWriter(w io.Writer) bool {
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	if null, err := os.Stat(os.DevNull); err == nil && os.SameFile(info, null) {
+		return false
+	}
+	return true
+}
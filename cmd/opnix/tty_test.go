@@ -0,0 +1,72 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEnvCommand_RefusesTerminalOutput(t *testing.T) {
+	resolver := &fakeResolver{secrets: map[string]string{"op://Example/Service/password": "test-password"}}
+	secretConfig := `{"vars":[{"name":"DB_PASSWORD","reference":"op://Example/Service/password"},{"name":"LOG_LEVEL","value":"info"}]}`
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr bool
+	}{
+		{name: "secret values", args: []string{"-config-json", secretConfig}, wantErr: true},
+		{name: "raw value", args: []string{"-config-json", secretConfig, "-raw", "DB_PASSWORD"}, wantErr: true},
+		{name: "allowed", args: []string{"-config-json", secretConfig, "-allow-tty"}},
+		{name: "masked", args: []string{"-config-json", secretConfig, "-mask"}},
+		{name: "written to a file", args: []string{"-config-json", secretConfig, "-output", filepath.Join(t.TempDir(), "app.env")}},
+		{name: "format none", args: []string{"-config-json", secretConfig, "-format", "none"}},
+		{name: "static values only", args: []string{"-config-json", `{"vars":[{"name":"LOG_LEVEL","value":"info"}]}`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, stdout, _ := newTestEnvCommand(resolver)
+			cmd.isTerminal = func(io.Writer) bool { return true }
+			if err := cmd.Init(tt.args); err != nil {
+				t.Fatalf("Unexpected init error: %v", err)
+			}
+
+			err := cmd.Run()
+			if !tt.wantErr {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), "Refusing to print secret values to an interactive terminal") {
+				t.Fatalf("Expected terminal output to be refused, got %v", err)
+			}
+			if stdout.Len() != 0 {
+				t.Errorf("Expected nothing printed, got %q", stdout.String())
+			}
+		})
+	}
+}
+
+func TestIsTerminalWriter(t *testing.T) {
+	null, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", os.DevNull, err)
+	}
+	defer null.Close()
+
+	file, err := os.Create(filepath.Join(t.TempDir(), "out"))
+	if err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	defer file.Close()
+
+	for name, w := range map[string]io.Writer{"null device": null, "regular file": file, "buffer": &strings.Builder{}} {
+		if isTerminalWriter(w) {
+			t.Errorf("Expected %s not to be a terminal", name)
+		}
+	}
+}
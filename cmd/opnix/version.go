@@ -0,0 +1,76 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"runtime/debug"
+)
+
+// Build metadata, set at build time with:
+//
+//	go build -ldflags "-X main.version=1.2.3 -X main.commit=abc123 -X main.date=2024-01-01T00:00:00Z"
+var (
+	version = "dev"
+	commit  = "unknown"
+	date    = "unknown"
+)
+
+type versionCommand struct {
+	fs     *flag.FlagSet
+	stdout io.Writer
+}
+
+func newVersionCommand() *versionCommand {
+	vc := &versionCommand{
+		fs:     flag.NewFlagSet("version", flag.ExitOnError),
+		stdout: os.Stdout,
+	}
+
+	vc.fs.Usage = func() {
+		fmt.Fprintf(vc.fs.Output(), "Usage: opnix version\n\n")
+		fmt.Fprintf(vc.fs.Output(), "Print build information for this opnix binary\n")
+	}
+
+	return vc
+}
+
+func (v *versionCommand) Name() string { return v.fs.Name() }
+
+func (v *versionCommand) Flags() *flag.FlagSet { return v.fs }
+
+func (v *versionCommand) Init(args []string) error {
+	return v.fs.Parse(args)
+}
+
+func (v *versionCommand) Run() error {
+	fmt.Fprint(v.stdout, versionInfo())
+	return nil
+}
+
+// versionInfo formats the build metadata, falling back to the VCS details
+// recorded by the Go toolchain when no commit was injected via -ldflags
+func versionInfo() string {
+	revision, buildDate := commit, date
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if revision == "unknown" {
+					revision = setting.Value
+				}
+			case "vcs.time":
+				if buildDate == "unknown" {
+					buildDate = setting.Value
+				}
+			}
+		}
+	}
+
+	return fmt.Sprintf(
+		"opnix %s\n  commit:     %s\n  built:      %s\n  go version: %s\n  platform:   %s/%s\n",
+		version, revision, buildDate, runtime.Version(), runtime.GOOS, runtime.GOARCH,
+	)
+}
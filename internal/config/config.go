@@ -17,6 +17,12 @@ type Secret struct {
 	Symlinks  []string          `json:"symlinks,omitempty"`
 	Variables map[string]string `json:"variables,omitempty"`
 	Services  interface{}       `json:"services,omitempty"`
+
+	// KeychainService and KeychainAccount name the keychain entry when
+	// secrets are stored with the keychain backend. The service defaults to
+	// the -keychain-service flag and the account to the secret's path.
+	KeychainService string `json:"keychainService,omitempty"`
+	KeychainAccount string `json:"keychainAccount,omitempty"`
 }
 
 type ChangeDetection struct {
@@ -65,8 +71,33 @@ func (c *Config) convertToValidationSecrets() []validation.SecretData {
 	return secrets
 }
 
+// LoadOptions controls how a config file is loaded
+type LoadOptions struct {
+	// Schemes lists the accepted reference schemes; nil keeps the
+	// validator's default schemes
+	Schemes []string
+	// ExpandEnv expands environment variables in each secret's path and
+	// reference and in pathTemplate
+	ExpandEnv bool
+	// StrictEnv implies ExpandEnv and fails loading when a variable is not
+	// set, instead of expanding it to ""
+	StrictEnv bool
+}
+
 // Load loads a single config file
 func Load(path string) (*Config, error) {
+	return LoadWithOptions(path, LoadOptions{})
+}
+
+// LoadWithSchemes loads a single config file, accepting references that use
+// any of schemes. A nil list keeps the validator's default schemes.
+func LoadWithSchemes(path string, schemes []string) (*Config, error) {
+	return LoadWithOptions(path, LoadOptions{Schemes: schemes})
+}
+
+// LoadWithOptions loads a single config file, expanding environment
+// variables before validating it when opts asks for it
+func LoadWithOptions(path string, opts LoadOptions) (*Config, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, errors.FileOperationError(
@@ -86,8 +117,19 @@ func Load(path string) (*Config, error) {
 		)
 	}
 
+	if opts.ExpandEnv || opts.StrictEnv {
+		if err := config.expandEnv(path, opts.StrictEnv); err != nil {
+			return nil, err
+		}
+	}
+
 	// Validate the loaded configuration
 	validator := validation.NewValidator()
+	if opts.Schemes != nil {
+		if err := validator.SetReferenceSchemes(opts.Schemes); err != nil {
+			return nil, err
+		}
+	}
 	if err := validator.ValidateConfigStruct(config.convertToValidationSecrets()); err != nil {
 		return nil, err
 	}
@@ -95,6 +137,23 @@ func Load(path string) (*Config, error) {
 	return &config, nil
 }
 
+// expandEnv expands environment variables in pathTemplate and in every
+// secret's path and reference. Unset variables expand to "" unless strict is
+// set.
+func (c *Config) expandEnv(path string, strict bool) error {
+	var expander EnvExpander
+	c.PathTemplate = expander.Expand(c.PathTemplate)
+	for i := range c.Secrets {
+		c.Secrets[i].Path = expander.Expand(c.Secrets[i].Path)
+		c.Secrets[i].Reference = expander.Expand(c.Secrets[i].Reference)
+	}
+
+	if strict {
+		return expander.Err("Loading configuration file", "secret paths or references", path)
+	}
+	return nil
+}
+
 // LoadMultiple loads and merges multiple config files (GitHub #3)
 func LoadMultiple(paths []string) (*Config, error) {
 	if len(paths) == 0 {
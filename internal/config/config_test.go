@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -42,6 +43,72 @@ func TestLoad(t *testing.T) {
 	}
 }
 
+func TestLoadWithSchemes(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	configData := `{"secrets": [{"path": "test/secret", "reference": "mock://Example/Service/password"}]}`
+	if err := os.WriteFile(configPath, []byte(configData), 0600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	if _, err := Load(configPath); err == nil {
+		t.Error("Expected the default scheme to reject mock:// references")
+	}
+
+	cfg, err := LoadWithSchemes(configPath, []string{"op", "mock"})
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.Secrets[0].Reference != "mock://Example/Service/password" {
+		t.Errorf("Expected mock reference, got %q", cfg.Secrets[0].Reference)
+	}
+}
+
+func TestLoadWithOptions_ExpandEnv(t *testing.T) {
+	t.Setenv("OPNIX_TEST_ENVIRONMENT", "staging")
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	configData := `{"secrets": [{"path": "${OPNIX_TEST_ENVIRONMENT}/db-$$password", "reference": "op://App-$OPNIX_TEST_ENVIRONMENT/Database/password"}]}`
+	if err := os.WriteFile(configPath, []byte(configData), 0600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	cfg, err := LoadWithOptions(configPath, LoadOptions{StrictEnv: true})
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.Secrets[0].Path != "staging/db-$password" {
+		t.Errorf("Expected expanded path with a literal $, got %q", cfg.Secrets[0].Path)
+	}
+	if cfg.Secrets[0].Reference != "op://App-staging/Database/password" {
+		t.Errorf("Expected expanded reference, got %q", cfg.Secrets[0].Reference)
+	}
+
+	configData = `{"pathTemplate": "/run/$OPNIX_TEST_ENVIRONMENT/{name}", "secrets": [{"path": "db/$OPNIX_TEST_UNSET_DIR-password", "reference": "op://App-${OPNIX_TEST_UNSET_VAULT}x/Database/pass$1word"}]}`
+	if err := os.WriteFile(configPath, []byte(configData), 0600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	if cfg, err = Load(configPath); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.Secrets[0].Reference != "op://App-${OPNIX_TEST_UNSET_VAULT}x/Database/pass$1word" || cfg.PathTemplate != "/run/$OPNIX_TEST_ENVIRONMENT/{name}" {
+		t.Errorf("Expected no expansion without ExpandEnv, got %q and %q", cfg.Secrets[0].Reference, cfg.PathTemplate)
+	}
+
+	if cfg, err = LoadWithOptions(configPath, LoadOptions{ExpandEnv: true}); err != nil {
+		t.Fatalf("Expected unset variables to expand to empty without strict mode, got %v", err)
+	}
+	if cfg.Secrets[0].Reference != "op://App-x/Database/password" {
+		t.Errorf("Expected unset variables to expand to empty, got %q", cfg.Secrets[0].Reference)
+	}
+	if cfg.PathTemplate != "/run/staging/{name}" {
+		t.Errorf("Expected expanded path template, got %q", cfg.PathTemplate)
+	}
+
+	_, err = LoadWithOptions(configPath, LoadOptions{StrictEnv: true})
+	if err == nil || !strings.Contains(err.Error(), "1, OPNIX_TEST_UNSET_DIR, OPNIX_TEST_UNSET_VAULT") {
+		t.Errorf("Expected strict mode to list undefined variables, got %v", err)
+	}
+}
+
 func TestLoadMultiple(t *testing.T) {
 	// Create temp config files
 	tmpDir, err := os.MkdirTemp("", "opnix-tests-*")
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/brizzbuzz/opnix/internal/errors"
+)
+
+// EnvExpander replaces $VAR and ${VAR} with values from the environment and
+// $$ with a literal $, remembering the variables that were not set
+type EnvExpander struct {
+	undefined map[string]bool
+}
+
+// Expand returns value with environment variables substituted. Unset
+// variables expand to "".
+func (x *EnvExpander) Expand(value string) string {
+	return os.Expand(value, func(name string) string {
+		if name == "$" {
+			return "$"
+		}
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			if x.undefined == nil {
+				x.undefined = make(map[string]bool)
+			}
+			x.undefined[name] = true
+		}
+		return value
+	})
+}
+
+// Undefined returns the unset variables seen so far, sorted
+func (x *EnvExpander) Undefined() []string {
+	names := make([]string, 0, len(x.undefined))
+	for name := range x.undefined {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Err reports the unset variables seen so far in fields of the config at
+// source, or returns nil when every variable was set
+func (x *EnvExpander) Err(operation, fields, source string) error {
+	if len(x.undefined) == 0 {
+		return nil
+	}
+	return &errors.OpnixError{
+		Operation: operation,
+		Component: "configuration",
+		Issue:     fmt.Sprintf("Undefined environment variables in %s: %s", fields, strings.Join(x.Undefined(), ", ")),
+		Context:   fmt.Sprintf("Config: %s", source),
+		Suggestions: []string{
+			"Export the variables before running opnix",
+			"Write $$ for a literal $",
+		},
+	}
+}
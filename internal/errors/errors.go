@@ -1,6 +1,7 @@
 package errors
 
 import (
+	stderrors "errors"
 	"fmt"
 	"strings"
 )
@@ -13,8 +14,24 @@ type OpnixError struct {
 	Context     string   // Additional context about the failure
 	Suggestions []string // List of actionable suggestions to fix the issue
 	Cause       error    // Underlying error that caused this
+	Kind        Kind     // Classification for callers that act on the error
 }
 
+// Kind classifies an error for callers that decide what to do next, such as
+// whether to retry. Issue is written for people and is never matched.
+type Kind int
+
+const (
+	// KindUnclassified is the Kind of errors nothing acts on
+	KindUnclassified Kind = iota
+	// KindNotFound means a reference names a vault, item, or variable that does not exist
+	KindNotFound
+	// KindFieldNotFound means a reference names an existing item but a field it lacks
+	KindFieldNotFound
+	// KindInvalidReference means a reference is malformed
+	KindInvalidReference
+)
+
 func (e *OpnixError) Error() string {
 	var parts []string
 
@@ -58,6 +75,27 @@ func (e *OpnixError) Unwrap() error {
 	return e.Cause
 }
 
+// WithKind sets the error's Kind and returns the error
+func (e *OpnixError) WithKind(kind Kind) *OpnixError {
+	e.Kind = kind
+	return e
+}
+
+// hasKind reports whether any error in the chain has one of kinds
+func hasKind(err error, kinds ...Kind) bool {
+	for err != nil {
+		if opnixErr, ok := err.(*OpnixError); ok {
+			for _, kind := range kinds {
+				if opnixErr.Kind == kind {
+					return true
+				}
+			}
+		}
+		err = stderrors.Unwrap(err)
+	}
+	return false
+}
+
 // Error constructors for common scenarios
 
 // ConfigError creates errors related to configuration parsing and validation
@@ -190,6 +228,50 @@ func UserGroupError(operation, userOrGroup, entityType string, availableEntities
 	}
 }
 
+// FieldNotFoundError creates errors for references to a field an existing
+// item does not have, listing the fields the item does have
+func FieldNotFoundError(operation, item, field string, availableFields []string, cause error) *OpnixError {
+	issue := fmt.Sprintf("Field '%s' not found on item '%s'", field, item)
+	var suggestions []string
+	if len(availableFields) > 0 {
+		issue = fmt.Sprintf("%s; available fields: %s", issue, strings.Join(availableFields, ", "))
+		suggestions = append(suggestions, "Update the reference to use one of the item's fields:")
+		for _, available := range availableFields {
+			suggestions = append(suggestions, fmt.Sprintf("  - %s", available))
+		}
+	} else {
+		suggestions = append(suggestions, fmt.Sprintf("Add a '%s' field to the item in 1Password", field))
+	}
+	suggestions = append(suggestions, "Fields inside a section are referenced as op://Vault/Item/section/field")
+
+	return &OpnixError{
+		Operation:   operation,
+		Component:   "1Password integration",
+		Issue:       issue,
+		Suggestions: suggestions,
+		Cause:       cause,
+		Kind:        KindFieldNotFound,
+	}
+}
+
+// IsFieldNotFound reports whether any error in the chain is KindFieldNotFound,
+// meaning the item exists but lacks the field
+func IsFieldNotFound(err error) bool {
+	return hasKind(err, KindFieldNotFound)
+}
+
+// IsNotFound reports whether any error in the chain means a reference names
+// a vault, item, field, or variable that does not exist
+func IsNotFound(err error) bool {
+	return hasKind(err, KindNotFound, KindFieldNotFound)
+}
+
+// IsInvalidReference reports whether any error in the chain is
+// KindInvalidReference, rejecting a reference as malformed
+func IsInvalidReference(err error) bool {
+	return hasKind(err, KindInvalidReference)
+}
+
 // ValidationError creates general validation errors
 func ValidationError(operation, field, value, expectedFormat string) *OpnixError {
 	return &OpnixError{
@@ -204,6 +286,10 @@ func ValidationError(operation, field, value, expectedFormat string) *OpnixError
 	}
 }
 
+// tokenAccessOperation is the operation of every TokenError, which reports a
+// token that could not be loaded locally rather than one 1Password rejected
+const tokenAccessOperation = "Token access"
+
 // TokenError creates token-related errors with setup instructions
 func TokenError(issue, tokenPath string, cause error) *OpnixError {
 	suggestions := []string{
@@ -216,7 +302,7 @@ func TokenError(issue, tokenPath string, cause error) *OpnixError {
 	}
 
 	return &OpnixError{
-		Operation:   "Token access",
+		Operation:   tokenAccessOperation,
 		Component:   "authentication",
 		Issue:       issue,
 		Context:     fmt.Sprintf("Token file: %s", tokenPath),
@@ -225,6 +311,61 @@ func TokenError(issue, tokenPath string, cause error) *OpnixError {
 	}
 }
 
+// AuthError creates errors for rejected, expired, or revoked service account tokens
+func AuthError(operation, issue string, cause error) *OpnixError {
+	return &OpnixError{
+		Operation: operation,
+		Component: "authentication",
+		Issue:     issue,
+		Suggestions: []string{
+			"Check whether the service account token has expired or been revoked in the 1Password admin console",
+			"Store a fresh token using: opnix token set",
+			"Ensure OP_SERVICE_ACCOUNT_TOKEN is not overriding the token file with a stale value",
+		},
+		Cause: cause,
+	}
+}
+
+// IsAuthError reports whether any error in the chain means 1Password rejected
+// the token. A missing, unreadable, or malformed local token file is not one.
+func IsAuthError(err error) bool {
+	for err != nil {
+		if opnixErr, ok := err.(*OpnixError); ok && opnixErr.Component == "authentication" && opnixErr.Operation != tokenAccessOperation {
+			return true
+		}
+		err = stderrors.Unwrap(err)
+	}
+	return false
+}
+
+// SDKError creates errors for a 1Password SDK that could not be loaded,
+// which no token or reference change will fix
+func SDKError(operation, issue string, cause error) *OpnixError {
+	return &OpnixError{
+		Operation: operation,
+		Component: "1Password SDK",
+		Issue:     issue,
+		Suggestions: []string{
+			"Check that this platform is supported by the 1Password SDK (Linux or macOS on amd64 or arm64)",
+			"Ensure the process may allocate executable memory: systemd units with MemoryDenyWriteExecute=true block the SDK core",
+			"Make sure enough memory is available; hardened limits such as ulimit -v can prevent the SDK core from loading",
+			"Reinstall or rebuild opnix to restore the bundled SDK core",
+		},
+		Cause: cause,
+	}
+}
+
+// IsSDKError reports whether any error in the chain is a failure to load the 1Password SDK
+func IsSDKError(err error) bool {
+	for err != nil {
+		if opnixErr, ok := err.(*OpnixError); ok && opnixErr.Component == "1Password SDK" {
+			return true
+		}
+		err = stderrors.Unwrap(err)
+	}
+	return false
+}
+
 // Helper functions
 
 func getDirPath(filePath string) string {
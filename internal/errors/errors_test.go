@@ -275,6 +275,64 @@ func TestUserGroupError(t *testing.T) {
 	}
 }
 
+func TestFieldNotFoundError(t *testing.T) {
+	err := FieldNotFoundError("Resolving 1Password secret", "Database", "passwrd", []string{"username", "password"}, nil)
+
+	if err.Component != "1Password integration" {
+		t.Errorf("Expected component '1Password integration', got %q", err.Component)
+	}
+	expected := "Field 'passwrd' not found on item 'Database'; available fields: username, password"
+	if err.Issue != expected {
+		t.Errorf("Expected issue %q, got %q", expected, err.Issue)
+	}
+	if len(err.Suggestions) < 3 || err.Suggestions[1] != "  - username" || err.Suggestions[2] != "  - password" {
+		t.Errorf("Expected available fields in suggestions, got %v", err.Suggestions)
+	}
+
+	empty := FieldNotFoundError("Resolving 1Password secret", "Database", "password", nil, nil)
+	if strings.Contains(empty.Issue, "available fields") {
+		t.Errorf("Expected no field list for an item without fields, got %q", empty.Issue)
+	}
+}
+
+func TestIsFieldNotFound(t *testing.T) {
+	fieldErr := FieldNotFoundError("Resolving 1Password secret", "Database", "password", nil, nil)
+	if !IsFieldNotFound(Wrap(fieldErr, "Resolving secret for env var DB", "environment variable resolution")) {
+		t.Error("Expected wrapped FieldNotFoundError to be detected")
+	}
+	if IsFieldNotFound(OnePasswordError("Resolving 1Password item", "Item 'Database' not found in vault 'Dev'", nil).WithKind(KindNotFound)) {
+		t.Error("Expected a missing item not to be reported as a missing field")
+	}
+}
+
+func TestIsNotFound(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		notFound bool
+		invalid  bool
+	}{
+		{"nil error", nil, false, false},
+		{"missing item", OnePasswordError("Resolving 1Password item", "Item 'Database' not found in vault 'Dev'", nil).WithKind(KindNotFound), true, false},
+		{"missing field", Wrap(FieldNotFoundError("Resolving 1Password secret", "Database", "password", nil, nil), "Resolving secret for env var DB", "environment variable resolution"), true, false},
+		{"malformed reference", OnePasswordError("Resolving 1Password secret", "Invalid reference: op://Dev (parsing)", nil).WithKind(KindInvalidReference), false, true},
+		{"transient failure", OnePasswordError("Resolving 1Password secret", "Failed to resolve reference: op://Dev/Database/password", nil), false, false},
+		{"wrapped error mentioning not found", Wrap(fmt.Errorf("upstream proxy: 404 page not found"), "Resolving 1Password secret", "1Password integration"), false, false},
+		{"unclassified invalid text", OnePasswordError("Resolving 1Password secret", "Invalid reference: op://Dev (parsing)", nil), false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsNotFound(tt.err); got != tt.notFound {
+				t.Errorf("Expected IsNotFound=%v, got %v", tt.notFound, got)
+			}
+			if got := IsInvalidReference(tt.err); got != tt.invalid {
+				t.Errorf("Expected IsInvalidReference=%v, got %v", tt.invalid, got)
+			}
+		})
+	}
+}
+
 func TestValidationError(t *testing.T) {
 	err := ValidationError("Field validation", "mode", "777", "3-4 digit octal")
 
@@ -321,6 +379,84 @@ func TestTokenError(t *testing.T) {
 	}
 }
 
+func TestAuthError(t *testing.T) {
+	cause := fmt.Errorf("invalid service account token")
+	err := AuthError("Initializing 1Password client", "Service account token was rejected", cause)
+
+	if err.Component != "authentication" {
+		t.Errorf("Expected component 'authentication', got %q", err.Component)
+	}
+	if err.Cause != cause {
+		t.Errorf("Expected cause to be preserved, got %v", err.Cause)
+	}
+
+	fullError := err.Error()
+	for _, expected := range []string{"expired", "opnix token set"} {
+		if !strings.Contains(fullError, expected) {
+			t.Errorf("Expected auth error to mention %q, got:\n%s", expected, fullError)
+		}
+	}
+}
+
+func TestIsAuthError(t *testing.T) {
+	authErr := AuthError("Resolving 1Password secret", "Token rejected", nil)
+
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"nil error", nil, false},
+		{"plain error", fmt.Errorf("boom"), false},
+		{"auth error", authErr, true},
+		{"token file error", TokenError("Token file is empty", "/etc/opnix-token", nil), false},
+		{"wrapped auth error", WrapWithSuggestions(authErr, "Resolving env var", "environment variable resolution", nil), true},
+		{"fmt wrapped auth error", fmt.Errorf("context: %w", authErr), true},
+		{"not found error", OnePasswordError("Resolving", "reference not found", nil), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsAuthError(tt.err); got != tt.expected {
+				t.Errorf("Expected IsAuthError=%v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestSDKError(t *testing.T) {
+	cause := fmt.Errorf("Failed to initialize plugin: out of memory")
+	err := SDKError("Initializing 1Password client", "The 1Password SDK core could not be loaded", cause)
+
+	if err.Cause != cause {
+		t.Errorf("Expected cause to be preserved, got %v", err.Cause)
+	}
+	if !strings.Contains(err.Error(), "MemoryDenyWriteExecute") {
+		t.Errorf("Expected SDK error to suggest checking executable memory, got:\n%s", err.Error())
+	}
+
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"nil error", nil, false},
+		{"sdk error", err, true},
+		{"wrapped sdk error", fmt.Errorf("context: %w", err), true},
+		{"auth error", AuthError("Initializing 1Password client", "Token rejected", nil), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsSDKError(tt.err); got != tt.expected {
+				t.Errorf("Expected IsSDKError=%v, got %v", tt.expected, got)
+			}
+		})
+	}
+	if IsAuthError(err) {
+		t.Error("Expected SDK error not to be treated as an authentication failure")
+	}
+}
+
 func TestWrap(t *testing.T) {
 	originalErr := fmt.Errorf("original error")
 	wrappedErr := Wrap(originalErr, "Test operation", "test component")
@@ -0,0 +1,156 @@
+// Package keychain stores secret values in the platform secret store: the
+// login keychain on macOS and the Secret Service (GNOME Keyring, KWallet) on
+// Linux. Values are passed to the platform tools on stdin, never as
+// command-line arguments, so they do not appear in the process table.
+package keychain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/brizzbuzz/opnix/internal/errors"
+)
+
+// Store saves secret values under a service and account name
+type Store interface {
+	Set(service, account, value string) error
+}
+
+// commandRunner runs name with args, feeding stdin, and returns its combined output
+type commandRunner func(name string, args []string, stdin string) ([]byte, error)
+
+// New returns the secret store for the current platform
+func New() (Store, error) {
+	return newForPlatform(runtime.GOOS, exec.LookPath, runCommand)
+}
+
+func newForPlatform(goos string, lookPath func(string) (string, error), run commandRunner) (Store, error) {
+	switch goos {
+	case "darwin":
+		path, err := lookPath("security")
+		if err != nil {
+			return nil, &errors.OpnixError{
+				Operation:   "Finding the macOS keychain tool",
+				Component:   "keychain",
+				Issue:       "security not found in PATH - the keychain backend on macOS requires /usr/bin/security",
+				Cause:       err,
+				Suggestions: []string{"Add /usr/bin to PATH"},
+			}
+		}
+		return &macOSStore{security: path, run: run}, nil
+	case "linux":
+		path, err := lookPath("secret-tool")
+		if err != nil {
+			return nil, &errors.OpnixError{
+				Operation: "Finding the Secret Service tool",
+				Component: "keychain",
+				Issue:     "secret-tool not found in PATH - the keychain backend on Linux requires libsecret",
+				Cause:     err,
+				Suggestions: []string{
+					"Install secret-tool (libsecret-tools on Debian/Ubuntu, libsecret on Fedora/Arch, pkgs.libsecret on NixOS)",
+					"Ensure a Secret Service provider such as GNOME Keyring or KWallet is running",
+				},
+			}
+		}
+		return &secretServiceStore{secretTool: path, run: run}, nil
+	default:
+		return nil, &errors.OpnixError{
+			Operation: "Selecting a keychain backend",
+			Component: "keychain",
+			Issue:     fmt.Sprintf("No supported keychain backend on %s", goos),
+			Suggestions: []string{
+				"Use the keychain backend on macOS or Linux",
+				"Or write secrets to files with the default -backend files",
+			},
+		}
+	}
+}
+
+func runCommand(name string, args []string, stdin string) ([]byte, error) {
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	err := cmd.Run()
+	return output.Bytes(), err
+}
+
+// macOSStore writes generic passwords to the default keychain. Commands are
+// sent to an interactive security session on stdin, with the value
+// hex-encoded so it needs no quoting.
+type macOSStore struct {
+	security string
+	run      commandRunner
+}
+
+func (s *macOSStore) Set(service, account, value string) error {
+	for _, name := range []string{service, account} {
+		if strings.ContainsAny(name, "\"\\\r\n") {
+			return invalidNameError(service, account, "quotes, backslashes, or newlines")
+		}
+	}
+
+	command := fmt.Sprintf("add-generic-password -U -s \"%s\" -a \"%s\" -X %s\n", service, account, hex.EncodeToString([]byte(value)))
+	output, err := s.run(s.security, []string{"-i"}, command)
+	// security -i reports failed commands on its output without a non-zero exit
+	if err == nil && strings.Contains(string(output), "security: ") {
+		err = fmt.Errorf("%s", strings.TrimSpace(string(output)))
+	}
+	if err != nil {
+		return storeError(service, account, output, err)
+	}
+	return nil
+}
+
+// secretServiceStore writes items through secret-tool, which reads the value
+// from stdin
+type secretServiceStore struct {
+	secretTool string
+	run        commandRunner
+}
+
+func (s *secretServiceStore) Set(service, account, value string) error {
+	args := []string{
+		"store",
+		"--label", fmt.Sprintf("opnix: %s/%s", service, account),
+		"service", service,
+		"account", account,
+	}
+	output, err := s.run(s.secretTool, args, value)
+	if err != nil {
+		return storeError(service, account, output, err)
+	}
+	return nil
+}
+
+func invalidNameError(service, account, issue string) error {
+	return &errors.OpnixError{
+		Operation: "Storing secret in keychain",
+		Component: "keychain",
+		Issue:     fmt.Sprintf("Keychain service and account names cannot contain %s", issue),
+		Context:   fmt.Sprintf("Service: %s, account: %s", service, account),
+	}
+}
+
+func storeError(service, account string, output []byte, err error) error {
+	issue := "Failed to store secret in the platform keychain"
+	if detail := strings.TrimSpace(string(output)); detail != "" {
+		issue = fmt.Sprintf("%s: %s", issue, detail)
+	}
+	return &errors.OpnixError{
+		Operation: "Storing secret in keychain",
+		Component: "keychain",
+		Issue:     issue,
+		Context:   fmt.Sprintf("Service: %s, account: %s", service, account),
+		Cause:     err,
+		Suggestions: []string{
+			"Ensure the keychain is unlocked for the current user",
+			"Run opnix in the user's login session so the secret store is reachable",
+		},
+	}
+}
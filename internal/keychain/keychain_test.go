@@ -0,0 +1,125 @@
+package keychain
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// recordingRunner captures the last command instead of running it
+type recordingRunner struct {
+	name   string
+	args   []string
+	stdin  string
+	output string
+	err    error
+}
+
+func (r *recordingRunner) run(name string, args []string, stdin string) ([]byte, error) {
+	r.name, r.args, r.stdin = name, args, stdin
+	return []byte(r.output), r.err
+}
+
+func foundTool(name string) (string, error) {
+	return "/usr/bin/" + name, nil
+}
+
+func missingTool(name string) (string, error) {
+	return "", fmt.Errorf("executable file not found in $PATH")
+}
+
+func TestSecretServiceStore(t *testing.T) {
+	runner := &recordingRunner{}
+	store, err := newForPlatform("linux", foundTool, runner.run)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := store.Set("opnix", "database/password", "test-password"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if runner.name != "/usr/bin/secret-tool" {
+		t.Errorf("Expected secret-tool, got %q", runner.name)
+	}
+	expected := "store --label opnix: opnix/database/password service opnix account database/password"
+	if got := strings.Join(runner.args, " "); got != expected {
+		t.Errorf("Expected args %q, got %q", expected, got)
+	}
+	if runner.stdin != "test-password" {
+		t.Errorf("Expected value on stdin, got %q", runner.stdin)
+	}
+	for _, arg := range runner.args {
+		if strings.Contains(arg, "test-password") {
+			t.Errorf("Value leaked into command-line argument %q", arg)
+		}
+	}
+}
+
+func TestMacOSStore(t *testing.T) {
+	tests := []struct {
+		name    string
+		account string
+		output  string
+		wantErr bool
+	}{
+		{"stores value", "database/password", "", false},
+		{"reports command failure", "database/password", "security: SecKeychainItemCreateFromContent: User interaction is not allowed.", true},
+		{"rejects quoted names", `database"password`, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := &recordingRunner{output: tt.output}
+			store, err := newForPlatform("darwin", foundTool, runner.run)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			err = store.Set("opnix", tt.account, "test-password")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error: %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if strings.Join(runner.args, " ") != "-i" {
+				t.Errorf("Expected interactive session, got %v", runner.args)
+			}
+			expected := `add-generic-password -U -s "opnix" -a "database/password" -X 746573742d70617373776f7264` + "\n"
+			if runner.stdin != expected {
+				t.Errorf("Expected command %q, got %q", expected, runner.stdin)
+			}
+			if strings.Contains(runner.stdin, "test-password") {
+				t.Error("Expected value to be hex-encoded")
+			}
+		})
+	}
+}
+
+func TestNewForPlatformErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		goos     string
+		lookPath func(string) (string, error)
+		expected string
+	}{
+		{"unsupported platform", "windows", foundTool, "No supported keychain backend on windows"},
+		{"missing secret-tool", "linux", missingTool, "secret-tool not found"},
+		{"missing security", "darwin", missingTool, "security not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := &recordingRunner{}
+			_, err := newForPlatform(tt.goos, tt.lookPath, runner.run)
+			if err == nil {
+				t.Fatal("Expected error")
+			}
+			if !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("Expected error containing %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
@@ -2,44 +2,53 @@ package onepass
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"os"
 	"strings"
 
 	"github.com/1password/onepassword-sdk-go"
 	"github.com/brizzbuzz/opnix/internal/errors"
+	"github.com/brizzbuzz/opnix/internal/validation"
 )
 
 type Client struct {
-	client *onepassword.Client
+	client   *onepassword.Client
+	identity string
+}
+
+// TokenEnvVar is the environment variable that takes precedence over the token file
+const TokenEnvVar = "OP_SERVICE_ACCOUNT_TOKEN"
+
+// TokenSource describes where GetToken reads the token from. EnvVar is set
+// when the environment supplies the token; otherwise Path names the token file.
+type TokenSource struct {
+	EnvVar string
+	Path   string
+}
+
+// ActiveTokenSource reports which source GetToken would use for tokenFile
+// without reading the token
+func ActiveTokenSource(tokenFile string) TokenSource {
+	if os.Getenv(TokenEnvVar) != "" {
+		return TokenSource{EnvVar: TokenEnvVar}
+	}
+	return TokenSource{Path: tokenFile}
 }
 
 // GetToken retrieves token from environment or file
 func GetToken(tokenFile string) (string, error) {
+	source := ActiveTokenSource(tokenFile)
+
 	// First try environment variable
-	if token := os.Getenv("OP_SERVICE_ACCOUNT_TOKEN"); token != "" {
-		return token, nil
+	if source.EnvVar != "" {
+		return os.Getenv(source.EnvVar), nil
 	}
 
 	// Then try token file
-	if tokenFile != "" {
-		data, err := os.ReadFile(tokenFile)
-		if err != nil {
-			return "", errors.TokenError(
-				fmt.Sprintf("Failed to read token file: %s", err.Error()),
-				tokenFile,
-				err,
-			)
-		}
-		token := strings.TrimSpace(string(data))
-		if len(token) == 0 {
-			return "", errors.TokenError(
-				"Token file is empty",
-				tokenFile,
-				nil,
-			)
-		}
-		return token, nil
+	if source.Path != "" {
+		return ReadTokenFile(source.Path)
 	}
 
 	return "", errors.TokenError(
@@ -49,18 +58,66 @@ func GetToken(tokenFile string) (string, error) {
 	)
 }
 
+// ReadTokenFile reads a token from a file without consulting OP_SERVICE_ACCOUNT_TOKEN
+func ReadTokenFile(tokenFile string) (string, error) {
+	if tokenFile == "" {
+		return "", errors.TokenError(
+			"No token file specified",
+			tokenFile,
+			nil,
+		)
+	}
+
+	data, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return "", errors.TokenError(
+			fmt.Sprintf("Failed to read token file: %s", err.Error()),
+			tokenFile,
+			err,
+		)
+	}
+	token := strings.TrimSpace(string(data))
+	if len(token) == 0 {
+		return "", errors.TokenError(
+			"Token file is empty",
+			tokenFile,
+			nil,
+		)
+	}
+	return token, nil
+}
+
 func NewClient(tokenFile string) (*Client, error) {
 	token, err := GetToken(tokenFile)
 	if err != nil {
 		return nil, err
 	}
 
+	return NewClientWithToken(token)
+}
+
+// NewClientWithToken creates a client for an already loaded service account token
+func NewClientWithToken(token string) (*Client, error) {
 	client, err := onepassword.NewClient(
 		context.Background(),
 		onepassword.WithServiceAccountToken(token),
 		onepassword.WithIntegrationInfo("NixOS Secrets Integration", "v1.0.0"),
 	)
 	if err != nil {
+		if isSDKLoadFailure(err) {
+			return nil, errors.SDKError(
+				"Initializing 1Password client",
+				"The 1Password SDK core could not be loaded, so opnix cannot talk to 1Password",
+				err,
+			)
+		}
+		if isAuthFailure(err) {
+			return nil, errors.AuthError(
+				"Initializing 1Password client",
+				"1Password rejected the service account token - it may be expired, revoked, or malformed",
+				err,
+			)
+		}
 		return nil, errors.OnePasswordError(
 			"Initializing 1Password client",
 			"Failed to create 1Password SDK client - check token validity",
@@ -68,17 +125,606 @@ func NewClient(tokenFile string) (*Client, error) {
 		)
 	}
 
-	return &Client{client: client}, nil
+	return &Client{client: client, identity: tokenIdentity(token)}, nil
+}
+
+// Identity names the service account the client authenticates as, when it
+// can be read from the token
+func (c *Client) Identity() string {
+	return c.identity
+}
+
+// tokenIdentity reads the service account email and sign-in address from a
+// service account token, whose payload is base64-encoded JSON. Only those
+// two fields are decoded; an unrecognised token yields an empty identity.
+func tokenIdentity(token string) string {
+	payload := strings.TrimPrefix(token, "ops_")
+	var data []byte
+	var err error
+	for _, encoding := range []*base64.Encoding{base64.RawURLEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.StdEncoding} {
+		if data, err = encoding.DecodeString(payload); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return ""
+	}
+
+	var claims struct {
+		Email         string `json:"email"`
+		SignInAddress string `json:"signInAddress"`
+	}
+	if err := json.Unmarshal(data, &claims); err != nil || claims.Email == "" {
+		return ""
+	}
+	if claims.SignInAddress == "" {
+		return claims.Email
+	}
+	return fmt.Sprintf("%s (%s)", claims.Email, claims.SignInAddress)
 }
 
 func (c *Client) ResolveSecret(reference string) (string, error) {
-	secret, err := c.client.Secrets().Resolve(context.Background(), reference)
+	return c.ResolveSecretContext(context.Background(), reference)
+}
+
+// ResolveSecretContext resolves a single reference, giving up once ctx is
+// cancelled
+func (c *Client) ResolveSecretContext(ctx context.Context, reference string) (string, error) {
+	decoded, err := validation.DecodeReference(reference)
 	if err != nil {
 		return "", errors.OnePasswordError(
 			"Resolving 1Password secret",
+			fmt.Sprintf("Invalid percent-encoding in reference: %s", reference),
+			err,
+		).WithKind(errors.KindInvalidReference)
+	}
+
+	if validation.IsItemReference(reference) {
+		return c.resolveItem(ctx, reference)
+	}
+
+	secret, err := c.client.Secrets().Resolve(ctx, decoded)
+	if err != nil {
+		if isAuthFailure(err) {
+			return "", errors.AuthError(
+				"Resolving 1Password secret",
+				"1Password rejected the service account token - it may be expired or revoked",
+				err,
+			)
+		}
+		if isFieldNotFound(err) {
+			if fieldErr := c.fieldNotFoundError(ctx, reference, err); fieldErr != nil {
+				return "", fieldErr
+			}
+		}
+		issue, kind := fmt.Sprintf("Failed to resolve reference: %s", reference), errors.KindUnclassified
+		switch {
+		case isNotFound(err):
+			issue, kind = fmt.Sprintf("Reference not found: %s", reference), errors.KindNotFound
+		case isInvalidReference(err):
+			issue, kind = fmt.Sprintf("Invalid reference: %s", reference), errors.KindInvalidReference
+		}
+		return "", errors.OnePasswordError("Resolving 1Password secret", issue, err).WithKind(kind)
+	}
+	return secret, nil
+}
+
+// ResolveAll resolves references with a single batched lookup. Whole-item
+// references are not supported by the batch API and are resolved one at a
+// time. Per-reference failures are returned keyed by reference.
+func (c *Client) ResolveAll(ctx context.Context, references []string) (map[string]string, map[string]error, error) {
+	values := make(map[string]string, len(references))
+	errs := make(map[string]error)
+
+	decoded := make(map[string]string, len(references))
+	var batch []string
+	for _, reference := range references {
+		if _, seen := decoded[reference]; seen {
+			continue
+		}
+		if validation.IsItemReference(reference) {
+			decoded[reference] = reference
+			value, err := c.resolveItem(ctx, reference)
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, nil, ctxErr
+			}
+			if err != nil {
+				errs[reference] = err
+			} else {
+				values[reference] = value
+			}
+			continue
+		}
+
+		value, err := validation.DecodeReference(reference)
+		if err != nil {
+			decoded[reference] = reference
+			errs[reference] = errors.OnePasswordError(
+				"Resolving 1Password secret",
+				fmt.Sprintf("Invalid percent-encoding in reference: %s", reference),
+				err,
+			).WithKind(errors.KindInvalidReference)
+			continue
+		}
+		decoded[reference] = value
+		batch = append(batch, value)
+	}
+	if len(batch) == 0 {
+		return values, errs, nil
+	}
+
+	response, err := c.client.Secrets().ResolveAll(ctx, batch)
+	if err != nil {
+		if isAuthFailure(err) {
+			return nil, nil, errors.AuthError(
+				"Resolving 1Password secrets",
+				"1Password rejected the service account token - it may be expired or revoked",
+				err,
+			)
+		}
+		return nil, nil, errors.OnePasswordError(
+			"Resolving 1Password secrets",
+			"Failed to resolve references in a batch request",
+			err,
+		)
+	}
+
+	for reference, lookup := range decoded {
+		if _, done := values[reference]; done {
+			continue
+		}
+		if _, done := errs[reference]; done {
+			continue
+		}
+
+		individual, ok := response.IndividualResponses[lookup]
+		switch {
+		case ok && individual.Error == nil && individual.Content != nil:
+			values[reference] = individual.Content.Secret
+		case ok && individual.Error != nil && individual.Error.Type == onepassword.ResolveReferenceErrorTypeVariantFieldNotFound:
+			if fieldErr := c.fieldNotFoundError(ctx, reference, nil); fieldErr != nil {
+				errs[reference] = fieldErr
+				continue
+			}
+			errs[reference] = resolveFailureError(reference, individual.Error.Type)
+		case ok && individual.Error != nil:
+			errs[reference] = resolveFailureError(reference, individual.Error.Type)
+		default:
+			errs[reference] = errors.OnePasswordError(
+				"Resolving 1Password secret",
+				fmt.Sprintf("Failed to resolve reference: %s", reference),
+				nil,
+			)
+		}
+	}
+	return values, errs, nil
+}
+
+// Precheck reports which of the given references name a vault or item that
+// does not exist. It only lists vault and item overviews, which carry no field
+// values, so no secret is fetched; a missing field is reported when the
+// reference is resolved.
+func (c *Client) Precheck(references []string) ([]string, error) {
+	if len(references) == 0 {
+		return nil, nil
+	}
+
+	ctx := context.Background()
+	vaults, err := c.listVaults(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Item IDs and titles, listed once per vault
+	items := make(map[string]map[string]bool)
+	var missing []string
+	for _, reference := range references {
+		parts, err := validation.ReferenceSegments(reference)
+		if err != nil {
+			return nil, errors.OnePasswordError(
+				"Prechecking 1Password references",
+				fmt.Sprintf("Invalid percent-encoding in reference: %s", reference),
+				err,
+			).WithKind(errors.KindInvalidReference)
+		}
+
+		vaultID := matchVault(vaults, parts[0])
+		if vaultID == "" || len(parts) < 2 {
+			missing = append(missing, reference)
+			continue
+		}
+
+		names, listed := items[vaultID]
+		if !listed {
+			overviews, err := c.client.Items().List(ctx, vaultID)
+			if err != nil {
+				if isAuthFailure(err) {
+					return nil, errors.AuthError(
+						"Prechecking 1Password references",
+						"1Password rejected the service account token - it may be expired or revoked",
+						err,
+					)
+				}
+				return nil, errors.OnePasswordError(
+					"Prechecking 1Password references",
+					fmt.Sprintf("Failed to list items in vault '%s'", parts[0]),
+					err,
+				)
+			}
+			names = make(map[string]bool, len(overviews)*2)
+			for _, overview := range overviews {
+				names[overview.ID] = true
+				names[overview.Title] = true
+			}
+			items[vaultID] = names
+		}
+		if !names[parts[1]] {
+			missing = append(missing, reference)
+		}
+	}
+
+	return missing, nil
+}
+
+// VaultSummary describes a vault without any of its contents
+type VaultSummary struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+}
+
+// ItemSummary describes an item without any of its field values
+type ItemSummary struct {
+	ID       string `json:"id"`
+	Title    string `json:"title"`
+	Category string `json:"category"`
+}
+
+// ListVaults returns the vaults the service account token can read
+func (c *Client) ListVaults() ([]VaultSummary, error) {
+	return c.listVaults(context.Background())
+}
+
+func (c *Client) listVaults(ctx context.Context) ([]VaultSummary, error) {
+	vaults, err := c.client.Vaults().List(ctx)
+	if err != nil {
+		if isAuthFailure(err) {
+			return nil, errors.AuthError(
+				"Listing 1Password vaults",
+				"1Password rejected the service account token - it may be expired or revoked",
+				err,
+			)
+		}
+		return nil, errors.OnePasswordError(
+			"Listing 1Password vaults",
+			"Failed to list vaults accessible to the service account",
+			err,
+		)
+	}
+
+	summaries := make([]VaultSummary, 0, len(vaults))
+	for _, vault := range vaults {
+		summaries = append(summaries, VaultSummary{ID: vault.ID, Title: vault.Title})
+	}
+	return summaries, nil
+}
+
+// ListItems returns the items in a vault identified by title or ID
+func (c *Client) ListItems(vault string) ([]ItemSummary, error) {
+	vaultID, err := c.findVault(context.Background(), vault)
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := c.client.Items().List(context.Background(), vaultID)
+	if err != nil {
+		return nil, errors.OnePasswordError(
+			"Listing 1Password items",
+			fmt.Sprintf("Failed to list items in vault '%s'", vault),
+			err,
+		)
+	}
+
+	summaries := make([]ItemSummary, 0, len(items))
+	for _, item := range items {
+		summaries = append(summaries, ItemSummary{ID: item.ID, Title: item.Title, Category: string(item.Category)})
+	}
+	return summaries, nil
+}
+
+// findVault returns the ID of the vault identified by title or ID
+func (c *Client) findVault(ctx context.Context, vault string) (string, error) {
+	vaults, err := c.listVaults(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	vaultID := matchVault(vaults, vault)
+	if vaultID == "" {
+		available := make([]string, 0, len(vaults))
+		for _, candidate := range vaults {
+			available = append(available, candidate.Title)
+		}
+		return "", &errors.OpnixError{
+			Operation: "Listing 1Password items",
+			Component: "1Password integration",
+			Issue:     fmt.Sprintf("Vault '%s' is not accessible to the service account", vault),
+			Context:   fmt.Sprintf("Accessible vaults: %s", strings.Join(available, ", ")),
+			Suggestions: []string{
+				"List accessible vaults: opnix vaults",
+				"Grant the service account access to the vault in 1Password",
+			},
+		}
+	}
+	return vaultID, nil
+}
+
+// matchVault returns the ID of the vault identified by ID or, ignoring case,
+// by title, or "" when none matches
+func matchVault(vaults []VaultSummary, vault string) string {
+	vaultID := ""
+	for _, candidate := range vaults {
+		if candidate.ID == vault || strings.EqualFold(candidate.Title, vault) {
+			vaultID = candidate.ID
+		}
+	}
+	return vaultID
+}
+
+// findItem returns the vault and item IDs of an item identified by title
+// or ID within a vault identified by title or ID
+func (c *Client) findItem(ctx context.Context, vault, item string) (string, string, error) {
+	vaultID, err := c.findVault(ctx, vault)
+	if err != nil {
+		return "", "", err
+	}
+
+	items, err := c.client.Items().List(ctx, vaultID)
+	if err != nil {
+		return "", "", errors.OnePasswordError(
+			"Resolving 1Password item",
+			fmt.Sprintf("Failed to list items in vault '%s'", vault),
+			err,
+		)
+	}
+	for _, candidate := range items {
+		if candidate.ID == item || candidate.Title == item {
+			return vaultID, candidate.ID, nil
+		}
+	}
+	return "", "", errors.OnePasswordError(
+		"Resolving 1Password item",
+		fmt.Sprintf("Item '%s' not found in vault '%s'", item, vault),
+		nil,
+	).WithKind(errors.KindNotFound)
+}
+
+// resolveItem fetches every field of an op://Vault/Item reference and
+// returns them as a JSON object keyed by field label
+func (c *Client) resolveItem(ctx context.Context, reference string) (string, error) {
+	parts, err := validation.ReferenceSegments(reference)
+	if err != nil {
+		return "", errors.OnePasswordError(
+			"Resolving 1Password item",
+			fmt.Sprintf("Invalid percent-encoding in reference: %s", reference),
+			err,
+		).WithKind(errors.KindInvalidReference)
+	}
+
+	vaultID, itemID, err := c.findItem(ctx, parts[0], parts[1])
+	if err != nil {
+		return "", err
+	}
+
+	item, err := c.client.Items().Get(ctx, vaultID, itemID)
+	if err != nil {
+		if isAuthFailure(err) {
+			return "", errors.AuthError(
+				"Resolving 1Password item",
+				"1Password rejected the service account token - it may be expired or revoked",
+				err,
+			)
+		}
+		return "", errors.OnePasswordError(
+			"Resolving 1Password item",
 			fmt.Sprintf("Failed to resolve reference: %s", reference),
 			err,
 		)
 	}
-	return secret, nil
+
+	return itemFieldsJSON(item.Fields)
+}
+
+// fieldNotFoundError looks up the item a field reference points at and
+// returns an error listing its field labels. It returns nil when the item
+// cannot be read, so the caller can report the original failure instead.
+func (c *Client) fieldNotFoundError(ctx context.Context, reference string, cause error) error {
+	parts, err := validation.ReferenceSegments(reference)
+	if err != nil || len(parts) < 3 {
+		return nil
+	}
+
+	vaultID, itemID, err := c.findItem(ctx, parts[0], parts[1])
+	if err != nil {
+		return nil
+	}
+	item, err := c.client.Items().Get(ctx, vaultID, itemID)
+	if err != nil {
+		return nil
+	}
+
+	return errors.FieldNotFoundError(
+		"Resolving 1Password secret",
+		parts[1],
+		strings.Join(parts[2:], "/"),
+		fieldLabels(item.Fields),
+		cause,
+	)
+}
+
+// fieldLabels returns the distinct field labels in item order, falling back
+// to the field ID for unlabelled fields
+func fieldLabels(fields []onepassword.ItemField) []string {
+	seen := make(map[string]bool, len(fields))
+	var labels []string
+	for _, field := range fields {
+		label := field.Title
+		if label == "" {
+			label = field.ID
+		}
+		if label == "" || seen[label] {
+			continue
+		}
+		seen[label] = true
+		labels = append(labels, label)
+	}
+	return labels
+}
+
+// itemFieldsJSON encodes fields as a JSON object keyed by field label. A
+// field without a label, or whose label repeats an earlier field's, is keyed
+// by its field ID instead so no value is dropped.
+func itemFieldsJSON(fields []onepassword.ItemField) (string, error) {
+	values := make(map[string]string, len(fields))
+	for _, field := range fields {
+		key := field.Title
+		if _, taken := values[key]; key == "" || taken {
+			key = field.ID
+		}
+		values[key] = field.Value
+	}
+
+	data, err := json.Marshal(values)
+	if err != nil {
+		return "", errors.OnePasswordError(
+			"Resolving 1Password item",
+			"Failed to encode item fields as JSON",
+			err,
+		)
+	}
+	return string(data), nil
+}
+
+// AccessibleVaults returns the titles and IDs of every vault the service
+// account token can read
+func (c *Client) AccessibleVaults() ([]string, error) {
+	vaults, err := c.ListVaults()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(vaults)*2)
+	for _, vault := range vaults {
+		names = append(names, vault.Title, vault.ID)
+	}
+	return names, nil
+}
+
+// authFailureMarkers are fragments of SDK error messages that indicate the
+// service account token itself was rejected
+var authFailureMarkers = []string{
+	"unauthorized",
+	"unauthenticated",
+	"invalid service account token",
+	"invalid token",
+	"token expired",
+	"token has expired",
+	"token was revoked",
+	"status code 401",
+}
+
+// sdkLoadFailureMarkers are fragments of SDK error messages that indicate the
+// embedded WebAssembly core failed to load, before any token was checked
+var sdkLoadFailureMarkers = []string{
+	"failed to initialize plugin",
+	"extism",
+	"wasm",
+	"wazero",
+}
+
+// fieldNotFoundMarkers are fragments of SDK error messages that indicate the
+// item exists but has no field matching the reference
+var fieldNotFoundMarkers = []string{
+	"fieldnotfound",
+	"field not found",
+	"field cannot be found",
+	"no field matched",
+	"no matching field",
+}
+
+// resolveFailureError describes a failed lookup in a batch response, marking
+// missing and malformed references so they are not retried
+func resolveFailureError(reference string, errorType onepassword.ResolveReferenceErrorTypes) *errors.OpnixError {
+	issue, kind := fmt.Sprintf("Failed to resolve reference: %s (%s)", reference, errorType), errors.KindUnclassified
+	switch errorType {
+	case onepassword.ResolveReferenceErrorTypeVariantVaultNotFound,
+		onepassword.ResolveReferenceErrorTypeVariantItemNotFound,
+		onepassword.ResolveReferenceErrorTypeVariantFieldNotFound,
+		onepassword.ResolveReferenceErrorTypeVariantNoMatchingSections:
+		issue, kind = fmt.Sprintf("Reference not found: %s (%s)", reference, errorType), errors.KindNotFound
+	case onepassword.ResolveReferenceErrorTypeVariantParsing:
+		issue, kind = fmt.Sprintf("Invalid reference: %s (%s)", reference, errorType), errors.KindInvalidReference
+	}
+	return errors.OnePasswordError("Resolving 1Password secret", issue, nil).WithKind(kind)
+}
+
+// notFoundMarkers are fragments of SDK error messages that indicate the
+// vault, item, or section a reference names does not exist
+var notFoundMarkers = []string{
+	"vaultnotfound",
+	"itemnotfound",
+	"no vault matched",
+	"no item matched",
+	"no section found",
+	"nomatchingsections",
+}
+
+// invalidReferenceMarkers are fragments of SDK error messages that indicate
+// a reference could not be parsed
+var invalidReferenceMarkers = []string{
+	"error parsing secret reference",
+	"invalid secret reference",
+	"secret reference is not prefixed",
+}
+
+// isNotFound reports whether an SDK error was caused by a missing vault,
+// item, section, or field
+func isNotFound(err error) bool {
+	return isFieldNotFound(err) || containsMarker(err, notFoundMarkers)
+}
+
+// isInvalidReference reports whether an SDK error was caused by a malformed
+// reference
+func isInvalidReference(err error) bool {
+	return containsMarker(err, invalidReferenceMarkers)
+}
+
+// containsMarker reports whether err's message contains any of markers,
+// ignoring case
+func containsMarker(err error, markers []string) bool {
+	if err == nil {
+		return false
+	}
+
+	message := strings.ToLower(err.Error())
+	for _, marker := range markers {
+		if strings.Contains(message, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// isFieldNotFound reports whether an SDK error was caused by a missing field
+func isFieldNotFound(err error) bool {
+	return containsMarker(err, fieldNotFoundMarkers)
+}
+
+// isSDKLoadFailure reports whether err means the SDK itself is unusable
+func isSDKLoadFailure(err error) bool {
+	return containsMarker(err, sdkLoadFailureMarkers)
+}
+
+// isAuthFailure reports whether an SDK error was caused by a rejected token
+func isAuthFailure(err error) bool {
+	return containsMarker(err, authFailureMarkers)
 }
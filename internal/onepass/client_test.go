@@ -1,9 +1,16 @@
 package onepass
 
 import (
+    "encoding/base64"
+    "fmt"
     "os"
     "path/filepath"
+    "strings"
     "testing"
+
+    "github.com/1password/onepassword-sdk-go"
+
+    "github.com/brizzbuzz/opnix/internal/errors"
 )
 
 func TestGetToken(t *testing.T) {
@@ -65,4 +72,224 @@ func TestGetToken(t *testing.T) {
     })
 }
 
+func TestReadTokenFile(t *testing.T) {
+    tmpDir := t.TempDir()
+
+    tokenFile := filepath.Join(tmpDir, "token")
+    if err := os.WriteFile(tokenFile, []byte("ops_file_token\n"), 0600); err != nil {
+        t.Fatalf("Failed to write token file: %v", err)
+    }
+
+    // The environment token must not override an explicit token file
+    os.Setenv("OP_SERVICE_ACCOUNT_TOKEN", "ops_env_token")
+    defer os.Unsetenv("OP_SERVICE_ACCOUNT_TOKEN")
+
+    got, err := ReadTokenFile(tokenFile)
+    if err != nil {
+        t.Fatalf("Unexpected error: %v", err)
+    }
+    if got != "ops_file_token" {
+        t.Errorf("Expected token %q, got %q", "ops_file_token", got)
+    }
+
+    if _, err := ReadTokenFile(""); err == nil {
+        t.Error("Expected error when no token file specified")
+    }
+
+    emptyFile := filepath.Join(tmpDir, "empty")
+    if err := os.WriteFile(emptyFile, []byte("  \n"), 0600); err != nil {
+        t.Fatalf("Failed to write token file: %v", err)
+    }
+    if _, err := ReadTokenFile(emptyFile); err == nil {
+        t.Error("Expected error for empty token file")
+    }
+}
+
+func TestIsAuthFailure(t *testing.T) {
+    tests := []struct {
+        name     string
+        err      error
+        expected bool
+    }{
+        {"nil error", nil, false},
+        {"invalid token", fmt.Errorf("invalid service account token, please make sure you provide a valid service account token as parameter"), true},
+        {"unauthorized", fmt.Errorf("request failed: Unauthorized"), true},
+        {"expired", fmt.Errorf("token has expired"), true},
+        {"not found", fmt.Errorf("error resolving secret reference: no item matched the secret reference query"), false},
+        {"network", fmt.Errorf("dial tcp: connection refused"), false},
+        {"unrelated authentication mention", fmt.Errorf("item 'Authentication Keys' has no field 'password'"), false},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := isAuthFailure(tt.err); got != tt.expected {
+                t.Errorf("Expected isAuthFailure=%v, got %v", tt.expected, got)
+            }
+        })
+    }
+}
+
+func TestIsSDKLoadFailure(t *testing.T) {
+    tests := []struct {
+        name     string
+        err      error
+        expected bool
+    }{
+        {"nil error", nil, false},
+        {"plugin init", fmt.Errorf("Failed to initialize plugin: failed to compile module\n"), true},
+        {"wasm runtime", fmt.Errorf("wasm error: out of bounds memory access"), true},
+        {"invalid token", fmt.Errorf("error initializing client: invalid service account token"), false},
+        {"network", fmt.Errorf("dial tcp: connection refused"), false},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := isSDKLoadFailure(tt.err); got != tt.expected {
+                t.Errorf("Expected isSDKLoadFailure=%v, got %v", tt.expected, got)
+            }
+        })
+    }
+}
+
+func TestIsFieldNotFound(t *testing.T) {
+    tests := []struct {
+        name     string
+        err      error
+        expected bool
+    }{
+        {"nil error", nil, false},
+        {"field not found", fmt.Errorf("error resolving secret reference: the specified field cannot be found within the item"), true},
+        {"error type", fmt.Errorf("resolve failed: fieldNotFound"), true},
+        {"item not found", fmt.Errorf("error resolving secret reference: no item matched the secret reference query"), false},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := isFieldNotFound(tt.err); got != tt.expected {
+                t.Errorf("Expected isFieldNotFound=%v, got %v", tt.expected, got)
+            }
+        })
+    }
+}
+
+func TestIsNotFound(t *testing.T) {
+    tests := []struct {
+        name     string
+        err      error
+        notFound bool
+        invalid  bool
+    }{
+        {"nil error", nil, false, false},
+        {"item not found", fmt.Errorf("error resolving secret reference: no item matched the secret reference query"), true, false},
+        {"vault not found", fmt.Errorf("resolve failed: vaultNotFound"), true, false},
+        {"field not found", fmt.Errorf("error resolving secret reference: the specified field cannot be found within the item"), true, false},
+        {"parse failure", fmt.Errorf("error parsing secret reference: missing item segment"), false, true},
+        {"network failure", fmt.Errorf("connection reset by peer"), false, false},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := isNotFound(tt.err); got != tt.notFound {
+                t.Errorf("Expected isNotFound=%v, got %v", tt.notFound, got)
+            }
+            if got := isInvalidReference(tt.err); got != tt.invalid {
+                t.Errorf("Expected isInvalidReference=%v, got %v", tt.invalid, got)
+            }
+        })
+    }
+}
+
+func TestResolveFailureError(t *testing.T) {
+    reference := "op://Example/Service/password"
+    tests := []struct {
+        errorType onepassword.ResolveReferenceErrorTypes
+        expected  string
+        kind      errors.Kind
+    }{
+        {onepassword.ResolveReferenceErrorTypeVariantItemNotFound, "Reference not found: op://Example/Service/password (itemNotFound)", errors.KindNotFound},
+        {onepassword.ResolveReferenceErrorTypeVariantParsing, "Invalid reference: op://Example/Service/password (parsing)", errors.KindInvalidReference},
+        {onepassword.ResolveReferenceErrorTypeVariantTooManyItems, "Failed to resolve reference: op://Example/Service/password (tooManyItems)", errors.KindUnclassified},
+    }
+
+    for _, tt := range tests {
+        got := resolveFailureError(reference, tt.errorType)
+        if got.Issue != tt.expected {
+            t.Errorf("Expected %q, got %q", tt.expected, got.Issue)
+        }
+        if got.Kind != tt.kind {
+            t.Errorf("Expected kind %v for %s, got %v", tt.kind, tt.errorType, got.Kind)
+        }
+    }
+}
+
+func TestMatchVault(t *testing.T) {
+    vaults := []VaultSummary{{ID: "abc123", Title: "Development"}, {ID: "def456", Title: "Production"}}
+
+    for vault, expected := range map[string]string{
+        "Development": "abc123",
+        "production":  "def456",
+        "def456":      "def456",
+        "Billing":     "",
+    } {
+        if got := matchVault(vaults, vault); got != expected {
+            t.Errorf("Expected matchVault(%q)=%q, got %q", vault, expected, got)
+        }
+    }
+}
+
+func TestFieldLabels(t *testing.T) {
+    fields := []onepassword.ItemField{
+        {ID: "username", Title: "username"},
+        {ID: "password", Title: "password"},
+        {ID: "abc123", Title: ""},
+        {ID: "def456", Title: "username"},
+    }
+
+    got := strings.Join(fieldLabels(fields), ",")
+    if got != "username,password,abc123" {
+        t.Errorf("Expected username,password,abc123, got %s", got)
+    }
+}
+
 // Note: We'll skip actual client initialization tests since they require valid tokens
+
+func TestItemFieldsJSON(t *testing.T) {
+    fields := []onepassword.ItemField{
+        {ID: "username", Title: "username", Value: "api-user"},
+        {ID: "credential", Title: "credential", Value: "api-secret"},
+        {ID: "abc123", Title: "", Value: "unlabelled"},
+        {ID: "def456", Title: "username", Value: "duplicate"},
+    }
+
+    got, err := itemFieldsJSON(fields)
+    if err != nil {
+        t.Fatalf("Unexpected error: %v", err)
+    }
+
+    expected := `{"abc123":"unlabelled","credential":"api-secret","def456":"duplicate","username":"api-user"}`
+    if got != expected {
+        t.Errorf("Expected %s, got %s", expected, got)
+    }
+}
+
+func TestTokenIdentity(t *testing.T) {
+    payload := base64.RawURLEncoding.EncodeToString([]byte(`{"signInAddress":"example.1password.com","email":"service@example.com","secretKey":"redacted"}`))
+
+    tests := []struct {
+        name     string
+        token    string
+        expected string
+    }{
+        {"service account token", "ops_" + payload, "service@example.com (example.1password.com)"},
+        {"undecodable token", "ops_not base64!", ""},
+        {"not json", "ops_" + base64.RawURLEncoding.EncodeToString([]byte("plain")), ""},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := tokenIdentity(tt.token); got != tt.expected {
+                t.Errorf("Expected identity %q, got %q", tt.expected, got)
+            }
+        })
+    }
+}
@@ -1,6 +1,8 @@
 package secrets
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"fmt"
 	"os"
 	"os/user"
@@ -11,6 +13,9 @@ import (
 
 	"github.com/brizzbuzz/opnix/internal/config"
 	"github.com/brizzbuzz/opnix/internal/errors"
+	"github.com/brizzbuzz/opnix/internal/keychain"
+	"github.com/brizzbuzz/opnix/internal/validation"
+	"github.com/brizzbuzz/opnix/pkg/env"
 )
 
 type SecretClient interface {
@@ -20,6 +25,39 @@ type SecretClient interface {
 type ProcessResult struct {
 	SecretPaths    map[string]string // Maps secret names to their file paths
 	ProcessedCount int
+	Files          []FileResult // Per-file outcome in configuration order
+}
+
+// FileStatus describes what a run did to a secret file
+type FileStatus string
+
+const (
+	// FileCreated marks a secret file that did not exist before
+	FileCreated FileStatus = "created"
+	// FileChanged marks an existing file rewritten with a new value or mode
+	FileChanged FileStatus = "changed"
+	// FileUnchanged marks a file left untouched because it already matched
+	FileUnchanged FileStatus = "unchanged"
+	// FileStored marks a secret written to the keychain instead of a file
+	FileStored FileStatus = "stored"
+)
+
+// FileResult records the outcome for a single secret file
+type FileResult struct {
+	Name   string
+	Path   string
+	Status FileStatus
+}
+
+// Count returns how many files ended with status
+func (r *ProcessResult) Count(status FileStatus) int {
+	count := 0
+	for _, file := range r.Files {
+		if file.Status == status {
+			count++
+		}
+	}
+	return count
 }
 
 type Processor struct {
@@ -27,6 +65,18 @@ type Processor struct {
 	outputDir    string
 	pathTemplate string
 	defaults     map[string]string
+	noNewline    bool
+	trimNewline  bool
+	normalize    bool
+	// allowCollisions lets secrets that resolve to the same file overwrite
+	// each other, last one winning
+	allowCollisions bool
+
+	keychain        keychain.Store
+	keychainService string
+
+	// schemeClients resolve references whose scheme is not op://
+	schemeClients map[string]SecretClient
 }
 
 func NewProcessor(client SecretClient, outputDir string) *Processor {
@@ -45,6 +95,66 @@ func NewProcessorWithConfig(client SecretClient, outputDir, pathTemplate string,
 	}
 }
 
+// SetNoNewline guarantees values are written byte-for-byte as resolved:
+// nothing is appended, and trimming and newline normalization are skipped
+func (p *Processor) SetNoNewline(noNewline bool) {
+	p.noNewline = noNewline
+}
+
+// SetTrimTrailingNewline controls whether trailing line terminators in
+// resolved values are stripped before writing. Other whitespace is preserved
+// so values remain byte-for-byte what was stored in 1Password apart from the
+// final newline.
+func (p *Processor) SetTrimTrailingNewline(trimNewline bool) {
+	p.trimNewline = trimNewline
+}
+
+// SetNormalizeNewlines controls whether CRLF and lone CR line endings in
+// resolved values are converted to LF, after any trailing newline is stripped
+func (p *Processor) SetNormalizeNewlines(normalize bool) {
+	p.normalize = normalize
+}
+
+// SetAllowPathCollision controls whether two secrets may write different
+// values to the same file. By default that is an error; identical values are
+// always allowed and written once.
+func (p *Processor) SetAllowPathCollision(allow bool) {
+	p.allowCollisions = allow
+}
+
+// SetKeychain stores secrets in store instead of writing files. Entries use
+// service unless a secret sets its own keychainService.
+func (p *Processor) SetKeychain(store keychain.Store, service string) {
+	p.keychain = store
+	p.keychainService = service
+}
+
+// SetSchemeClient routes references using scheme (e.g. vault for
+// vault://...) to client instead of the 1Password client
+func (p *Processor) SetSchemeClient(scheme string, client SecretClient) {
+	if p.schemeClients == nil {
+		p.schemeClients = make(map[string]SecretClient)
+	}
+	p.schemeClients[scheme] = client
+}
+
+// clientFor returns the client that resolves reference based on its scheme
+func (p *Processor) clientFor(reference, secretName string) (SecretClient, error) {
+	scheme := validation.ReferenceScheme(reference)
+	if scheme == "" || scheme == validation.DefaultReferenceScheme {
+		return p.client, nil
+	}
+	if client, ok := p.schemeClients[scheme]; ok {
+		return client, nil
+	}
+	return nil, errors.ConfigValidationError(
+		fmt.Sprintf("%s.reference", secretName),
+		reference,
+		fmt.Sprintf("No resolver is available for the '%s://' scheme", scheme),
+		[]string{fmt.Sprintf("Use an %s:// reference", validation.DefaultReferenceScheme)},
+	)
+}
+
 func (p *Processor) Process(cfg *config.Config) (*ProcessResult, error) {
 	// Update processor with config-level settings
 	if cfg.PathTemplate != "" {
@@ -54,6 +164,10 @@ func (p *Processor) Process(cfg *config.Config) (*ProcessResult, error) {
 		p.defaults = cfg.Defaults
 	}
 
+	if p.keychain != nil {
+		return p.processKeychain(cfg)
+	}
+
 	if err := os.MkdirAll(p.outputDir, 0755); err != nil {
 		return nil, errors.FileOperationError(
 			"Creating output directory",
@@ -68,10 +182,15 @@ func (p *Processor) Process(cfg *config.Config) (*ProcessResult, error) {
 		ProcessedCount: 0,
 	}
 
+	// Every secret is written to a temporary file first, so a failure midway
+	// never leaves a service with a half-updated set of secrets
+	var staged []stagedSecret
+	written := make(map[string]int)
 	for i, secret := range cfg.Secrets {
 		secretName := fmt.Sprintf("secret[%d]:%s", i, secret.Path)
-		outputPath, err := p.processSecret(secret, secretName)
+		file, err := p.stageSecret(secret, secretName)
 		if err != nil {
+			removeStaged(staged)
 			return nil, errors.WrapWithSuggestions(
 				err,
 				fmt.Sprintf("Processing %s", secretName),
@@ -84,16 +203,238 @@ func (p *Processor) Process(cfg *config.Config) (*ProcessResult, error) {
 			)
 		}
 
-		result.SecretPaths[secretName] = outputPath
+		// Secrets from merged configs can land on the same file; only
+		// identical values may share it, so the outcome never depends on order
+		target := filepath.Clean(file.outputPath)
+		if prev, ok := written[target]; ok && !p.allowCollisions {
+			if staged[prev].digest != file.digest {
+				removeStaged(append(staged, file))
+				return nil, errors.ConfigValidationError(
+					fmt.Sprintf("secret[%d].path", i),
+					file.outputPath,
+					fmt.Sprintf("Writes a different value to the same file as %s", staged[prev].name),
+					[]string{
+						"Give each secret a unique path",
+						"Or pass -allow-path-collision to let the last secret win",
+					},
+				)
+			}
+			removeStaged([]stagedSecret{file})
+			file.tempPath = ""
+			file.status = staged[prev].status
+		}
+		written[target] = len(staged)
+		staged = append(staged, file)
+	}
+
+	installed, err := installStaged(staged)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range staged {
+		// Create symlinks if specified
+		if err := p.createSymlinks(file.outputPath, file.symlinks, file.name); err != nil {
+			rollbackInstalled(installed)
+			return nil, err
+		}
+	}
+	discardBackups(installed)
+
+	for _, file := range staged {
+		result.SecretPaths[file.name] = file.outputPath
 		result.ProcessedCount++
+		result.Files = append(result.Files, FileResult{Name: file.name, Path: file.outputPath, Status: file.status})
 	}
 
 	return result, nil
 }
 
-func (p *Processor) processSecret(secret config.Secret, secretName string) (string, error) {
+// stagedSecret is a resolved secret written next to its destination and
+// waiting to be renamed into place. Unchanged secrets have no temporary file.
+type stagedSecret struct {
+	name       string
+	tempPath   string
+	outputPath string
+	symlinks   []string
+	status     FileStatus
+	digest     [sha256.Size]byte
+}
+
+// installedSecret is a staged file renamed into place. backup holds the file
+// it replaced, or is empty when the destination did not exist.
+type installedSecret struct {
+	path   string
+	backup string
+}
+
+// installStaged renames every staged file into place. Each file it replaces
+// is hard linked to a backup first, so a failure partway through puts back
+// the files already installed.
+func installStaged(staged []stagedSecret) ([]installedSecret, error) {
+	var installed []installedSecret
+	for i, file := range staged {
+		if file.tempPath == "" {
+			continue
+		}
+		backup, err := backupExisting(file)
+		if err == nil {
+			if err = os.Rename(file.tempPath, file.outputPath); err != nil && backup != "" {
+				_ = os.Remove(backup) // The destination was not replaced
+			}
+		}
+		if err != nil {
+			removeStaged(staged[i:])
+			rollbackInstalled(installed)
+			return nil, errors.FileOperationError(
+				fmt.Sprintf("Installing secret file for %s", file.name),
+				file.outputPath,
+				"Failed to move secret file into place",
+				err,
+			)
+		}
+		installed = append(installed, installedSecret{path: file.outputPath, backup: backup})
+	}
+	return installed, nil
+}
+
+// backupExisting hard links the file at the secret's destination next to its
+// temporary file and returns the link, or "" when there is nothing to keep.
+// Directories are not backed up; renaming over them fails anyway.
+func backupExisting(file stagedSecret) (string, error) {
+	info, err := os.Lstat(file.outputPath)
+	if err != nil || info.IsDir() {
+		return "", nil
+	}
+	backup := file.tempPath + ".backup"
+	if err := os.Link(file.outputPath, backup); err != nil {
+		return "", err
+	}
+	return backup, nil
+}
+
+// rollbackInstalled restores the files replaced by installStaged, newest
+// first so secrets sharing a path end up with the original file
+func rollbackInstalled(installed []installedSecret) {
+	for i := len(installed) - 1; i >= 0; i-- {
+		file := installed[i]
+		if file.backup == "" {
+			_ = os.Remove(file.path) // Ignore error - rollback is best effort
+		} else {
+			_ = os.Rename(file.backup, file.path)
+		}
+	}
+}
+
+// discardBackups deletes the backups once every secret is in place
+func discardBackups(installed []installedSecret) {
+	for _, file := range installed {
+		if file.backup != "" {
+			_ = os.Remove(file.backup) // Ignore error - cleanup is best effort
+		}
+	}
+}
+
+// removeStaged deletes temporary files that will not be installed
+func removeStaged(staged []stagedSecret) {
+	for _, file := range staged {
+		if file.tempPath != "" {
+			_ = os.Remove(file.tempPath) // Ignore error - cleanup is best effort
+		}
+	}
+}
+
+// compareExisting reports whether path must be created, rewritten, or can be
+// left alone because it already holds data with the expected mode and
+// ownership. A uid or gid of -1 is not compared.
+func compareExisting(path string, data []byte, mode os.FileMode, uid, gid int) FileStatus {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return FileCreated
+	}
+	if !info.Mode().IsRegular() || info.Mode().Perm() != mode.Perm() || info.Size() != int64(len(data)) {
+		return FileChanged
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		if (uid != -1 && int(stat.Uid) != uid) || (gid != -1 && int(stat.Gid) != gid) {
+			return FileChanged
+		}
+	}
+
+	existing, err := os.ReadFile(path)
+	if err != nil {
+		return FileChanged
+	}
+	existingHash := sha256.Sum256(existing)
+	newHash := sha256.Sum256(data)
+	if !bytes.Equal(existingHash[:], newHash[:]) {
+		return FileChanged
+	}
+	return FileUnchanged
+}
+
+// processKeychain resolves every secret before storing any of them, so a
+// failed lookup leaves the keychain as it was
+func (p *Processor) processKeychain(cfg *config.Config) (*ProcessResult, error) {
+	values := make([]string, len(cfg.Secrets))
+	for i, secret := range cfg.Secrets {
+		secretName := fmt.Sprintf("secret[%d]:%s", i, secret.Path)
+		value, err := p.resolveValue(secret, secretName)
+		if err != nil {
+			return nil, errors.WrapWithSuggestions(
+				err,
+				fmt.Sprintf("Processing %s", secretName),
+				"secret processing",
+				[]string{"Verify 1Password reference is correct"},
+			)
+		}
+		values[i] = value
+	}
+
+	result := &ProcessResult{SecretPaths: make(map[string]string)}
+	for i, secret := range cfg.Secrets {
+		secretName := fmt.Sprintf("secret[%d]:%s", i, secret.Path)
+		service := secret.KeychainService
+		if service == "" {
+			service = p.keychainService
+		}
+		account := secret.KeychainAccount
+		if account == "" {
+			account = secret.Path
+		}
+
+		if err := p.keychain.Set(service, account, values[i]); err != nil {
+			return nil, err
+		}
+
+		location := fmt.Sprintf("keychain:%s/%s", service, account)
+		result.SecretPaths[secretName] = location
+		result.ProcessedCount++
+		result.Files = append(result.Files, FileResult{Name: secretName, Path: location, Status: FileStored})
+	}
+	return result, nil
+}
+
+// resolveValue looks up a secret and applies its selector and the
+// processor's newline handling
+func (p *Processor) resolveValue(secret config.Secret, secretName string) (string, error) {
+	// Split off any line or JSON selector, which 1Password does not understand
+	lookup, selector, err := validation.ParseSelector(secret.Reference)
+	if err != nil {
+		return "", errors.ConfigError(
+			fmt.Sprintf("Resolving secret %s", secretName),
+			fmt.Sprintf("Invalid reference selector: %v", err),
+			nil,
+		).WithKind(errors.KindInvalidReference)
+	}
+
+	client, err := p.clientFor(lookup, secretName)
+	if err != nil {
+		return "", err
+	}
+
 	// Resolve the secret value from 1Password
-	value, err := p.client.ResolveSecret(secret.Reference)
+	value, err := client.ResolveSecret(lookup)
 	if err != nil {
 		return "", errors.OnePasswordError(
 			fmt.Sprintf("Resolving secret %s", secretName),
@@ -102,21 +443,47 @@ func (p *Processor) processSecret(secret config.Secret, secretName string) (stri
 		)
 	}
 
+	if selector != nil {
+		if value, err = selector.Apply(value); err != nil {
+			return "", errors.Wrap(err, fmt.Sprintf("Resolving secret %s", secretName), "secret processing")
+		}
+	}
+
+	// The processor never appends a newline. Values are written as stored
+	// unless trimming or normalizing was requested.
+	if p.noNewline {
+		return value, nil
+	}
+	if p.trimNewline {
+		value = strings.TrimRight(value, "\r\n")
+	}
+	if p.normalize {
+		value = env.NormalizeNewlines(value)
+	}
+	return value, nil
+}
+
+func (p *Processor) stageSecret(secret config.Secret, secretName string) (stagedSecret, error) {
+	value, err := p.resolveValue(secret, secretName)
+	if err != nil {
+		return stagedSecret{}, err
+	}
+
 	// Determine output path with enhanced path management
 	outputPath, err := p.resolveSecretPathWithTemplate(secret, secretName)
 	if err != nil {
-		return "", err
+		return stagedSecret{}, err
 	}
 
 	// Validate the resolved path for security
 	if err := p.validateSecretPath(outputPath, secretName); err != nil {
-		return "", err
+		return stagedSecret{}, err
 	}
 
 	// Create parent directory if needed (validation already ensured it's writable)
 	parentDir := filepath.Dir(outputPath)
 	if err := os.MkdirAll(parentDir, 0755); err != nil {
-		return "", errors.FileOperationError(
+		return stagedSecret{}, errors.FileOperationError(
 			fmt.Sprintf("Creating parent directory for %s", secretName),
 			parentDir,
 			"Failed to create parent directory",
@@ -131,7 +498,7 @@ func (p *Processor) processSecret(secret config.Secret, secretName string) (stri
 	}
 	fileMode, err := strconv.ParseUint(mode, 8, 32)
 	if err != nil {
-		return "", errors.ValidationError(
+		return stagedSecret{}, errors.ValidationError(
 			fmt.Sprintf("Parsing file mode for %s", secretName),
 			"mode",
 			mode,
@@ -139,9 +506,29 @@ func (p *Processor) processSecret(secret config.Secret, secretName string) (stri
 		)
 	}
 
-	// Write file with specified permissions
-	if err := os.WriteFile(outputPath, []byte(value), os.FileMode(fileMode)); err != nil {
-		return "", errors.FileOperationError(
+	// Files that already hold the value are not rewritten, so services
+	// watching them see no change
+	uid, gid, err := p.lookupOwnership(secret.Owner, secret.Group, secretName)
+	if err != nil {
+		return stagedSecret{}, err
+	}
+	digest := sha256.Sum256([]byte(value))
+	status := compareExisting(outputPath, []byte(value), os.FileMode(fileMode), uid, gid)
+	if status == FileUnchanged {
+		return stagedSecret{
+			name:       secretName,
+			outputPath: outputPath,
+			symlinks:   secret.Symlinks,
+			status:     status,
+			digest:     digest,
+		}, nil
+	}
+
+	// Write to a temporary file in the destination directory so the final
+	// rename stays on one filesystem and is atomic
+	tempPath, err := writeTempFile(parentDir, filepath.Base(outputPath), []byte(value), os.FileMode(fileMode))
+	if err != nil {
+		return stagedSecret{}, errors.FileOperationError(
 			fmt.Sprintf("Writing secret file for %s", secretName),
 			outputPath,
 			"Failed to write secret to file",
@@ -149,23 +536,75 @@ func (p *Processor) processSecret(secret config.Secret, secretName string) (stri
 		)
 	}
 
-	// Set ownership if specified
+	// Set ownership if specified, before the file becomes visible
 	if secret.Owner != "" || secret.Group != "" {
-		if err := p.setOwnership(outputPath, secret.Owner, secret.Group, secretName); err != nil {
-			return "", err
+		if err := p.setOwnership(tempPath, secret.Owner, secret.Group, secretName); err != nil {
+			_ = os.Remove(tempPath)
+			return stagedSecret{}, err
 		}
 	}
 
-	// Create symlinks if specified
-	if err := p.createSymlinks(outputPath, secret.Symlinks, secretName); err != nil {
+	return stagedSecret{
+		name:       secretName,
+		tempPath:   tempPath,
+		outputPath: outputPath,
+		symlinks:   secret.Symlinks,
+		status:     status,
+		digest:     digest,
+	}, nil
+}
+
+// writeTempFile writes data to a new hidden file in dir with the given mode
+// and returns its path
+func writeTempFile(dir, base string, data []byte, mode os.FileMode) (string, error) {
+	f, err := os.CreateTemp(dir, "."+base+".opnix-*")
+	if err != nil {
 		return "", err
 	}
+	tempPath := f.Name()
 
-	return outputPath, nil
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tempPath)
+		return "", err
+	}
+	if err := f.Chmod(mode); err != nil {
+		f.Close()
+		os.Remove(tempPath)
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tempPath)
+		return "", err
+	}
+	return tempPath, nil
 }
 
 // setOwnership sets the file ownership based on owner and group names
 func (p *Processor) setOwnership(path, owner, group, secretName string) error {
+	uid, gid, err := p.lookupOwnership(owner, group, secretName)
+	if err != nil {
+		return err
+	}
+
+	// Set ownership
+	if uid != -1 || gid != -1 {
+		if err := syscall.Chown(path, uid, gid); err != nil {
+			return errors.FileOperationError(
+				fmt.Sprintf("Setting ownership for %s", secretName),
+				path,
+				fmt.Sprintf("Failed to change ownership to %s:%s", owner, group),
+				err,
+			)
+		}
+	}
+
+	return nil
+}
+
+// lookupOwnership resolves owner and group names to IDs. Unset names are
+// returned as -1, which leaves that part of the ownership unchanged.
+func (p *Processor) lookupOwnership(owner, group, secretName string) (int, int, error) {
 	var uid, gid = -1, -1
 
 	// Resolve owner to UID
@@ -177,7 +616,7 @@ func (p *Processor) setOwnership(path, owner, group, secretName string) error {
 			if err != nil {
 				// Get available users for suggestions
 				availableUsers := p.getAvailableUsers()
-				return errors.UserGroupError(
+				return -1, -1, errors.UserGroupError(
 					fmt.Sprintf("Setting ownership for %s", secretName),
 					owner,
 					"user",
@@ -186,7 +625,7 @@ func (p *Processor) setOwnership(path, owner, group, secretName string) error {
 			}
 			parsedUID, err := strconv.Atoi(u.Uid)
 			if err != nil {
-				return errors.ConfigError(
+				return -1, -1, errors.ConfigError(
 					fmt.Sprintf("Parsing UID for user %s", owner),
 					fmt.Sprintf("Invalid UID format: %s", u.Uid),
 					err,
@@ -205,7 +644,7 @@ func (p *Processor) setOwnership(path, owner, group, secretName string) error {
 			if err != nil {
 				// Get available groups for suggestions
 				availableGroups := p.getAvailableGroups()
-				return errors.UserGroupError(
+				return -1, -1, errors.UserGroupError(
 					fmt.Sprintf("Setting ownership for %s", secretName),
 					group,
 					"group",
@@ -214,7 +653,7 @@ func (p *Processor) setOwnership(path, owner, group, secretName string) error {
 			}
 			parsedGID, err := strconv.Atoi(g.Gid)
 			if err != nil {
-				return errors.ConfigError(
+				return -1, -1, errors.ConfigError(
 					fmt.Sprintf("Parsing GID for group %s", group),
 					fmt.Sprintf("Invalid GID format: %s", g.Gid),
 					err,
@@ -224,19 +663,7 @@ func (p *Processor) setOwnership(path, owner, group, secretName string) error {
 		}
 	}
 
-	// Set ownership
-	if uid != -1 || gid != -1 {
-		if err := syscall.Chown(path, uid, gid); err != nil {
-			return errors.FileOperationError(
-				fmt.Sprintf("Setting ownership for %s", secretName),
-				path,
-				fmt.Sprintf("Failed to change ownership to %s:%s", owner, group),
-				err,
-			)
-		}
-	}
-
-	return nil
+	return uid, gid, nil
 }
 
 // getAvailableUsers returns a list of common system users for error suggestions
@@ -394,6 +821,11 @@ func (p *Processor) createSymlinks(targetPath string, symlinks []string, secretN
 			)
 		}
 
+		// A symlink that already points at the secret is left in place
+		if existing, err := os.Readlink(symlinkPath); err == nil && existing == targetPath {
+			continue
+		}
+
 		// Remove existing symlink or file if it exists
 		if err := os.Remove(symlinkPath); err != nil && !os.IsNotExist(err) {
 			return errors.FileOperationError(
@@ -5,6 +5,8 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
+	"strings"
 	"testing"
 
 	"github.com/brizzbuzz/opnix/internal/config"
@@ -337,3 +339,602 @@ func containsAtIndex(s, substr string) bool {
 	}
 	return false
 }
+
+func TestProcessorNoNewline(t *testing.T) {
+	mock := &mockClient{
+		secrets: map[string]string{
+			"op://vault/item/password": "hunter2",
+			"op://vault/item/padded":   " hunter2\r\n\n",
+		},
+	}
+
+	tests := []struct {
+		name      string
+		reference string
+		trim      bool
+		expected  string
+	}{
+		{"value without a newline is written as stored", "op://vault/item/password", false, "hunter2"},
+		{"trailing line endings are kept", "op://vault/item/padded", false, " hunter2\r\n\n"},
+		{"trimming is skipped", "op://vault/item/padded", true, " hunter2\r\n\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+
+			processor := NewProcessor(mock, tmpDir)
+			processor.SetNoNewline(true)
+			processor.SetTrimTrailingNewline(tt.trim)
+			processor.SetNormalizeNewlines(tt.trim)
+
+			cfg := &config.Config{
+				Secrets: []config.Secret{
+					{Path: "secret", Reference: tt.reference},
+				},
+			}
+			if _, err := processor.Process(cfg); err != nil {
+				t.Fatalf("Failed to process secrets: %v", err)
+			}
+
+			content, err := os.ReadFile(filepath.Join(tmpDir, "secret"))
+			if err != nil {
+				t.Fatalf("Failed to read output file: %v", err)
+			}
+			if string(content) != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, string(content))
+			}
+		})
+	}
+}
+
+func TestProcessorTrimTrailingNewline(t *testing.T) {
+	mock := &mockClient{
+		secrets: map[string]string{
+			"op://vault/item/password": "  hunter2\n",
+			"op://vault/item/crlf":     "value\r\n",
+			"op://vault/item/blank":    "value\n\n",
+		},
+	}
+
+	tests := []struct {
+		name        string
+		reference   string
+		trimNewline bool
+		expected    string
+	}{
+		{"default preserves value", "op://vault/item/password", false, "  hunter2\n"},
+		{"strips trailing newline", "op://vault/item/password", true, "  hunter2"},
+		{"strips trailing CRLF", "op://vault/item/crlf", true, "value"},
+		{"default keeps every trailing newline", "op://vault/item/blank", false, "value\n\n"},
+		{"strips every trailing newline", "op://vault/item/blank", true, "value"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+
+			processor := NewProcessor(mock, tmpDir)
+			processor.SetTrimTrailingNewline(tt.trimNewline)
+
+			cfg := &config.Config{
+				Secrets: []config.Secret{
+					{Path: "secret", Reference: tt.reference},
+				},
+			}
+
+			if _, err := processor.Process(cfg); err != nil {
+				t.Fatalf("Failed to process secrets: %v", err)
+			}
+
+			content, err := os.ReadFile(filepath.Join(tmpDir, "secret"))
+			if err != nil {
+				t.Fatalf("Failed to read output file: %v", err)
+			}
+
+			if string(content) != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, string(content))
+			}
+		})
+	}
+}
+
+func TestProcessorReferenceSelector(t *testing.T) {
+	mock := &mockClient{
+		secrets: map[string]string{
+			"op://vault/item/config": `{"tls": {"cert": "-----BEGIN CERTIFICATE-----"}}`,
+		},
+	}
+
+	tmpDir := t.TempDir()
+	processor := NewProcessor(mock, tmpDir)
+
+	cfg := &config.Config{
+		Secrets: []config.Secret{
+			{Path: "cert", Reference: "op://vault/item/config?json=.tls.cert"},
+		},
+	}
+
+	if _, err := processor.Process(cfg); err != nil {
+		t.Fatalf("Failed to process secrets: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(tmpDir, "cert"))
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+
+	if string(content) != "-----BEGIN CERTIFICATE-----" {
+		t.Errorf("Expected selected JSON value, got %q", string(content))
+	}
+}
+
+func TestProcessorAtomicWrites(t *testing.T) {
+	mock := &mockClient{
+		secrets: map[string]string{
+			"op://vault/item/first": "new-first",
+		},
+	}
+
+	tmpDir := t.TempDir()
+	existing := filepath.Join(tmpDir, "first")
+	if err := os.WriteFile(existing, []byte("old-first"), 0600); err != nil {
+		t.Fatalf("Failed to write existing secret: %v", err)
+	}
+
+	processor := NewProcessor(mock, tmpDir)
+	cfg := &config.Config{
+		Secrets: []config.Secret{
+			{Path: "first", Reference: "op://vault/item/first"},
+			{Path: "second", Reference: "op://vault/item/missing"},
+		},
+	}
+
+	if _, err := processor.Process(cfg); err == nil {
+		t.Fatal("Expected error for missing secret")
+	}
+
+	content, err := os.ReadFile(existing)
+	if err != nil {
+		t.Fatalf("Failed to read existing secret: %v", err)
+	}
+	if string(content) != "old-first" {
+		t.Errorf("Expected existing secret to be untouched, got %q", string(content))
+	}
+
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to read output directory: %v", err)
+	}
+	if len(entries) != 1 {
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		t.Errorf("Expected only the existing secret to remain, got %v", names)
+	}
+
+	// Once every secret resolves, all files are replaced together
+	mock.secrets["op://vault/item/missing"] = "new-second"
+	if _, err := processor.Process(cfg); err != nil {
+		t.Fatalf("Failed to process secrets: %v", err)
+	}
+	for name, expected := range map[string]string{"first": "new-first", "second": "new-second"} {
+		content, err := os.ReadFile(filepath.Join(tmpDir, name))
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", name, err)
+		}
+		if string(content) != expected {
+			t.Errorf("Expected %s to contain %q, got %q", name, expected, string(content))
+		}
+	}
+}
+
+func TestProcessorInstallRollback(t *testing.T) {
+	mock := &mockClient{
+		secrets: map[string]string{
+			"op://vault/item/first":  "new-first",
+			"op://vault/item/second": "new-second",
+			"op://vault/item/third":  "new-third",
+		},
+	}
+
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "first"), []byte("old-first"), 0600); err != nil {
+		t.Fatalf("Failed to write existing secret: %v", err)
+	}
+	// Renaming a file over a non-empty directory fails after the first
+	// secret has already been installed
+	if err := os.MkdirAll(filepath.Join(tmpDir, "second", "child"), 0755); err != nil {
+		t.Fatalf("Failed to create blocking directory: %v", err)
+	}
+
+	processor := NewProcessor(mock, tmpDir)
+	cfg := &config.Config{
+		Secrets: []config.Secret{
+			{Path: "first", Reference: "op://vault/item/first"},
+			{Path: "second", Reference: "op://vault/item/second"},
+			{Path: "third", Reference: "op://vault/item/third"},
+		},
+	}
+
+	assertRolledBack := func(t *testing.T, extra ...string) {
+		t.Helper()
+		content, err := os.ReadFile(filepath.Join(tmpDir, "first"))
+		if err != nil {
+			t.Fatalf("Failed to read existing secret: %v", err)
+		}
+		if string(content) != "old-first" {
+			t.Errorf("Expected first secret to be restored, got %q", string(content))
+		}
+
+		entries, err := os.ReadDir(tmpDir)
+		if err != nil {
+			t.Fatalf("Failed to read output directory: %v", err)
+		}
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		want := append([]string{"first", "second"}, extra...)
+		sort.Strings(want)
+		if strings.Join(names, ",") != strings.Join(want, ",") {
+			t.Errorf("Expected only %v to remain, got %v", want, names)
+		}
+	}
+
+	if _, err := processor.Process(cfg); err == nil {
+		t.Fatal("Expected error when a secret cannot be moved into place")
+	}
+	assertRolledBack(t)
+
+	// A failing symlink also restores every installed file
+	if err := os.RemoveAll(filepath.Join(tmpDir, "second")); err != nil {
+		t.Fatalf("Failed to remove blocking directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "second"), []byte("old-second"), 0600); err != nil {
+		t.Fatalf("Failed to write existing secret: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(tmpDir, "link", "child"), 0755); err != nil {
+		t.Fatalf("Failed to create blocking directory: %v", err)
+	}
+	cfg.Secrets[2].Symlinks = []string{filepath.Join(tmpDir, "link")}
+	if _, err := processor.Process(cfg); err == nil {
+		t.Fatal("Expected error when a symlink cannot be created")
+	}
+	assertRolledBack(t, "link")
+	content, err := os.ReadFile(filepath.Join(tmpDir, "second"))
+	if err != nil {
+		t.Fatalf("Failed to read existing secret: %v", err)
+	}
+	if string(content) != "old-second" {
+		t.Errorf("Expected second secret to be restored, got %q", string(content))
+	}
+}
+
+func TestProcessorChangeDetection(t *testing.T) {
+	mock := &mockClient{
+		secrets: map[string]string{
+			"op://vault/item/first":  "first-value",
+			"op://vault/item/second": "second-value",
+		},
+	}
+
+	tmpDir := t.TempDir()
+	processor := NewProcessor(mock, tmpDir)
+	cfg := &config.Config{
+		Secrets: []config.Secret{
+			{Path: "first", Reference: "op://vault/item/first"},
+			{Path: "second", Reference: "op://vault/item/second", Symlinks: []string{filepath.Join(tmpDir, "links/second")}},
+		},
+	}
+
+	statuses := func(result *ProcessResult) []FileStatus {
+		var got []FileStatus
+		for _, file := range result.Files {
+			got = append(got, file.Status)
+		}
+		return got
+	}
+	expectStatuses := func(result *ProcessResult, want ...FileStatus) {
+		t.Helper()
+		got := statuses(result)
+		if len(got) != len(want) {
+			t.Fatalf("Expected statuses %v, got %v", want, got)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("Expected statuses %v, got %v", want, got)
+				return
+			}
+		}
+	}
+
+	result, err := processor.Process(cfg)
+	if err != nil {
+		t.Fatalf("Failed to process secrets: %v", err)
+	}
+	expectStatuses(result, FileCreated, FileCreated)
+
+	before, err := os.Stat(filepath.Join(tmpDir, "first"))
+	if err != nil {
+		t.Fatalf("Failed to stat secret: %v", err)
+	}
+
+	// A second run with the same values rewrites nothing
+	result, err = processor.Process(cfg)
+	if err != nil {
+		t.Fatalf("Failed to process secrets: %v", err)
+	}
+	expectStatuses(result, FileUnchanged, FileUnchanged)
+	after, err := os.Stat(filepath.Join(tmpDir, "first"))
+	if err != nil {
+		t.Fatalf("Failed to stat secret: %v", err)
+	}
+	if !os.SameFile(before, after) {
+		t.Error("Expected unchanged secret file to be left in place")
+	}
+	if result.ProcessedCount != 2 {
+		t.Errorf("Expected unchanged files to count as processed, got %d", result.ProcessedCount)
+	}
+
+	// A new value or a different mode rewrites the file
+	mock.secrets["op://vault/item/first"] = "rotated-value"
+	cfg.Secrets[1].Mode = "0640"
+	result, err = processor.Process(cfg)
+	if err != nil {
+		t.Fatalf("Failed to process secrets: %v", err)
+	}
+	expectStatuses(result, FileChanged, FileChanged)
+	if result.Count(FileChanged) != 2 || result.Count(FileUnchanged) != 0 {
+		t.Errorf("Expected counts of 2 changed and 0 unchanged, got %d and %d", result.Count(FileChanged), result.Count(FileUnchanged))
+	}
+
+	content, err := os.ReadFile(filepath.Join(tmpDir, "links/second"))
+	if err != nil {
+		t.Fatalf("Failed to read through symlink: %v", err)
+	}
+	if string(content) != "second-value" {
+		t.Errorf("Expected symlink to reach the secret, got %q", string(content))
+	}
+}
+
+func TestProcessorNormalizeNewlines(t *testing.T) {
+	mock := &mockClient{
+		secrets: map[string]string{
+			"op://vault/item/key": "-----BEGIN KEY-----\r\nabc\rdef\r\n-----END KEY-----\r\n",
+		},
+	}
+
+	tests := []struct {
+		name        string
+		normalize   bool
+		trimNewline bool
+		expected    string
+	}{
+		{"default preserves CRLF", false, false, "-----BEGIN KEY-----\r\nabc\rdef\r\n-----END KEY-----\r\n"},
+		{"converts CRLF and CR", true, false, "-----BEGIN KEY-----\nabc\ndef\n-----END KEY-----\n"},
+		{"combines with trim-trailing-newline", true, true, "-----BEGIN KEY-----\nabc\ndef\n-----END KEY-----"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+
+			processor := NewProcessor(mock, tmpDir)
+			processor.SetNormalizeNewlines(tt.normalize)
+			processor.SetTrimTrailingNewline(tt.trimNewline)
+
+			cfg := &config.Config{
+				Secrets: []config.Secret{
+					{Path: "key", Reference: "op://vault/item/key"},
+				},
+			}
+
+			if _, err := processor.Process(cfg); err != nil {
+				t.Fatalf("Failed to process secrets: %v", err)
+			}
+
+			content, err := os.ReadFile(filepath.Join(tmpDir, "key"))
+			if err != nil {
+				t.Fatalf("Failed to read output file: %v", err)
+			}
+			if string(content) != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, string(content))
+			}
+		})
+	}
+}
+
+// fakeKeychain records stored values by service and account
+type fakeKeychain struct {
+	values map[string]string
+}
+
+func (f *fakeKeychain) Set(service, account, value string) error {
+	f.values[service+"/"+account] = value
+	return nil
+}
+
+func TestProcessorKeychain(t *testing.T) {
+	mock := &mockClient{
+		secrets: map[string]string{
+			"op://Example/Service/password": "test-password\n",
+			"op://Example/Service/token":    "test-token",
+		},
+	}
+
+	t.Run("stores values instead of writing files", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		store := &fakeKeychain{values: make(map[string]string)}
+
+		processor := NewProcessor(mock, tmpDir)
+		processor.SetTrimTrailingNewline(true)
+		processor.SetKeychain(store, "opnix")
+
+		cfg := &config.Config{
+			Secrets: []config.Secret{
+				{Path: "service/password", Reference: "op://Example/Service/password"},
+				{Path: "token", Reference: "op://Example/Service/token", KeychainService: "api", KeychainAccount: "deploy"},
+			},
+		}
+
+		result, err := processor.Process(cfg)
+		if err != nil {
+			t.Fatalf("Failed to process secrets: %v", err)
+		}
+
+		if store.values["opnix/service/password"] != "test-password" {
+			t.Errorf("Expected default service and path account, got %v", store.values)
+		}
+		if store.values["api/deploy"] != "test-token" {
+			t.Errorf("Expected per-secret service and account, got %v", store.values)
+		}
+		if result.Count(FileStored) != 2 {
+			t.Errorf("Expected 2 stored secrets, got %d", result.Count(FileStored))
+		}
+		if path := result.SecretPaths["secret[1]:token"]; path != "keychain:api/deploy" {
+			t.Errorf("Expected keychain location, got %q", path)
+		}
+
+		entries, err := os.ReadDir(tmpDir)
+		if err != nil {
+			t.Fatalf("Failed to read output directory: %v", err)
+		}
+		if len(entries) != 0 {
+			t.Errorf("Expected no files in keychain mode, got %d", len(entries))
+		}
+	})
+
+	t.Run("stores nothing when a reference fails", func(t *testing.T) {
+		store := &fakeKeychain{values: make(map[string]string)}
+
+		processor := NewProcessor(mock, t.TempDir())
+		processor.SetKeychain(store, "opnix")
+
+		cfg := &config.Config{
+			Secrets: []config.Secret{
+				{Path: "token", Reference: "op://Example/Service/token"},
+				{Path: "missing", Reference: "op://Example/Service/missing"},
+			},
+		}
+
+		if _, err := processor.Process(cfg); err == nil {
+			t.Fatal("Expected error for missing reference")
+		}
+		if len(store.values) != 0 {
+			t.Errorf("Expected no stored values, got %v", store.values)
+		}
+	})
+}
+
+func TestProcessorPathCollision(t *testing.T) {
+	mock := &mockClient{
+		secrets: map[string]string{
+			"op://Example/Service/token":     "test-token",
+			"op://Example/Service/token-any": "test-token",
+			"op://Example/Service/other":     "other-token",
+		},
+	}
+
+	tests := []struct {
+		name      string
+		second    string
+		allow     bool
+		wantErr   bool
+		wantValue string
+	}{
+		{"identical values are written once", "op://Example/Service/token-any", false, false, "test-token"},
+		{"different values fail", "op://Example/Service/other", false, true, ""},
+		{"allowed collision lets the last secret win", "op://Example/Service/other", true, false, "other-token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+
+			processor := NewProcessor(mock, tmpDir)
+			processor.SetAllowPathCollision(tt.allow)
+
+			cfg := &config.Config{
+				Secrets: []config.Secret{
+					{Path: "app/token", Reference: "op://Example/Service/token"},
+					{Path: filepath.Join(tmpDir, "app", ".", "token"), Reference: tt.second},
+				},
+			}
+
+			_, err := processor.Process(cfg)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "same file as secret[0]:app/token") {
+					t.Fatalf("Expected collision error, got %v", err)
+				}
+				entries, _ := os.ReadDir(filepath.Join(tmpDir, "app"))
+				if len(entries) != 0 {
+					t.Errorf("Expected no files after a collision, got %d", len(entries))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to process secrets: %v", err)
+			}
+
+			content, err := os.ReadFile(filepath.Join(tmpDir, "app", "token"))
+			if err != nil {
+				t.Fatalf("Failed to read output file: %v", err)
+			}
+			if string(content) != tt.wantValue {
+				t.Errorf("Expected %q, got %q", tt.wantValue, string(content))
+			}
+			entries, _ := os.ReadDir(filepath.Join(tmpDir, "app"))
+			if len(entries) != 1 {
+				t.Errorf("Expected only the secret file, got %d entries", len(entries))
+			}
+		})
+	}
+}
+
+func TestProcessorSchemeClients(t *testing.T) {
+	onePassword := &mockClient{secrets: map[string]string{"op://Example/Service/password": "test-password"}}
+	mockScheme := &mockClient{secrets: map[string]string{"mock://Example/Service/token": "test-token"}}
+
+	t.Run("routes references by scheme", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		processor := NewProcessor(onePassword, tmpDir)
+		processor.SetSchemeClient("mock", mockScheme)
+
+		cfg := &config.Config{
+			Secrets: []config.Secret{
+				{Path: "password", Reference: "op://Example/Service/password"},
+				{Path: "token", Reference: "mock://Example/Service/token"},
+			},
+		}
+		if _, err := processor.Process(cfg); err != nil {
+			t.Fatalf("Failed to process secrets: %v", err)
+		}
+
+		for name, want := range map[string]string{"password": "test-password", "token": "test-token"} {
+			data, err := os.ReadFile(filepath.Join(tmpDir, name))
+			if err != nil {
+				t.Fatalf("Failed to read %s: %v", name, err)
+			}
+			if string(data) != want {
+				t.Errorf("Expected %s to contain %q, got %q", name, want, data)
+			}
+		}
+	})
+
+	t.Run("rejects schemes without a client", func(t *testing.T) {
+		processor := NewProcessor(onePassword, t.TempDir())
+
+		cfg := &config.Config{
+			Secrets: []config.Secret{{Path: "token", Reference: "vault://Example/Service/token"}},
+		}
+		_, err := processor.Process(cfg)
+		if err == nil {
+			t.Fatal("Expected error for unrouted scheme")
+		}
+		if !strings.Contains(err.Error(), "No resolver is available for the 'vault://' scheme") {
+			t.Errorf("Expected unknown scheme error, got: %v", err)
+		}
+	})
+}
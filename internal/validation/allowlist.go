@@ -0,0 +1,94 @@
+package validation
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/brizzbuzz/opnix/internal/errors"
+)
+
+// ReferenceAllowlist holds the references a configuration may use, loaded
+// from a manifest with one reference or glob pattern per line
+type ReferenceAllowlist struct {
+	path     string
+	patterns []string
+}
+
+// LoadReferenceAllowlist reads an allowlist manifest. Blank lines and lines
+// starting with '#' are ignored. Patterns use path.Match syntax, so '*'
+// matches within a single segment: op://Example/*/password allows the
+// password field of every item in the Example vault.
+func LoadReferenceAllowlist(file string) (*ReferenceAllowlist, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, errors.FileOperationError(
+			"Loading reference allowlist",
+			file,
+			"Failed to read allowlist file",
+			err,
+		)
+	}
+	defer f.Close()
+
+	allowlist := &ReferenceAllowlist{path: file}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		pattern := strings.TrimSpace(scanner.Text())
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, errors.ConfigValidationError(
+				fmt.Sprintf("allowlist line %d", line),
+				pattern,
+				"Invalid allowlist pattern",
+				[]string{
+					"Use '*' to match within one segment and '?' for a single character",
+					"Close every '[' character class, or escape a literal '[' as '\\['",
+				},
+			)
+		}
+		allowlist.patterns = append(allowlist.patterns, pattern)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.FileOperationError(
+			"Loading reference allowlist",
+			file,
+			"Failed to read allowlist file",
+			err,
+		)
+	}
+	return allowlist, nil
+}
+
+// Allows reports whether reference matches an allowlist entry. The query,
+// such as a selector or ?attribute=totp, is ignored because it only changes
+// how an allowed field is read.
+func (a *ReferenceAllowlist) Allows(reference string) bool {
+	lookup, _, _ := strings.Cut(reference, "?")
+	for _, pattern := range a.patterns {
+		if matched, _ := path.Match(pattern, lookup); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate returns an error for field when reference is not on the allowlist
+func (a *ReferenceAllowlist) Validate(reference, field string) error {
+	if a.Allows(reference) {
+		return nil
+	}
+	return errors.ConfigValidationError(
+		field,
+		reference,
+		fmt.Sprintf("Reference is not on the allowlist in %s", a.path),
+		[]string{
+			"Point the configuration at an allowed reference",
+			fmt.Sprintf("Or add the reference to %s through your change-control process", a.path),
+		},
+	)
+}
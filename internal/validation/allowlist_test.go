@@ -0,0 +1,65 @@
+package validation
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeAllowlist(t *testing.T, content string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "allowlist.txt")
+	if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write allowlist: %v", err)
+	}
+	return file
+}
+
+func TestReferenceAllowlist_Allows(t *testing.T) {
+	file := writeAllowlist(t, `# Service references approved for production
+op://Example/Service/password
+
+op://Example/*/token
+`)
+	allowlist, err := LoadReferenceAllowlist(file)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		reference string
+		expected  bool
+	}{
+		{"op://Example/Service/password", true},
+		{"op://Example/Service/password?json=.key", true},
+		{"op://Example/Other/token", true},
+		{"op://Example/Other/token?attribute=totp", true},
+		{"op://Example/Service/username", false},
+		{"op://Example/Nested/Section/token", false},
+		{"op://Other/Service/password", false},
+	}
+
+	for _, tt := range tests {
+		if got := allowlist.Allows(tt.reference); got != tt.expected {
+			t.Errorf("Allows(%q): expected %v, got %v", tt.reference, tt.expected, got)
+		}
+	}
+
+	err = allowlist.Validate("op://Other/Service/password", "env.vars[0].reference")
+	if err == nil || !strings.Contains(err.Error(), "not on the allowlist") {
+		t.Errorf("Expected allowlist error, got %v", err)
+	}
+}
+
+func TestLoadReferenceAllowlist_Errors(t *testing.T) {
+	if _, err := LoadReferenceAllowlist(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("Expected error for missing allowlist file")
+	}
+
+	file := writeAllowlist(t, "op://Example/Service/password\nop://Example/[Service/token\n")
+	_, err := LoadReferenceAllowlist(file)
+	if err == nil || !strings.Contains(err.Error(), "allowlist line 2") {
+		t.Errorf("Expected invalid pattern error on line 2, got %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+package validation
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/brizzbuzz/opnix/internal/errors"
+)
+
+// sdkQueryParameters are reference query parameters understood by 1Password
+// itself; they are passed through to the SDK untouched
+var sdkQueryParameters = map[string]bool{
+	"attribute":  true,
+	"ssh-format": true,
+}
+
+// Selector extracts part of a resolved value. It is requested with a
+// ?line=N or ?json=.path query on a reference and applied by OpNix after
+// resolution, since 1Password does not understand these parameters.
+type Selector struct {
+	Line     int
+	JSONPath string
+}
+
+// ParseSelector splits the OpNix selector out of reference. It returns the
+// reference to hand to 1Password, with any SDK query parameters kept, and a
+// nil selector when none is requested. Unknown query parameters are errors.
+func ParseSelector(reference string) (string, *Selector, error) {
+	base, query, ok := strings.Cut(reference, "?")
+	if !ok {
+		return reference, nil, nil
+	}
+
+	var selector *Selector
+	var kept []string
+	for _, param := range strings.Split(query, "&") {
+		key, value, _ := strings.Cut(param, "=")
+		switch {
+		case sdkQueryParameters[strings.ToLower(key)]:
+			kept = append(kept, param)
+		case key == "line" || key == "json":
+			if selector != nil {
+				return "", nil, fmt.Errorf("only one of the line and json selectors may be used")
+			}
+			selector = &Selector{}
+			if key == "line" {
+				line, err := strconv.Atoi(value)
+				if err != nil || line < 1 {
+					return "", nil, fmt.Errorf("line selector must be a positive line number, got %q", value)
+				}
+				selector.Line = line
+			} else {
+				if !strings.HasPrefix(value, ".") {
+					return "", nil, fmt.Errorf("json selector must be a path starting with '.', got %q", value)
+				}
+				selector.JSONPath = value
+			}
+		default:
+			return "", nil, fmt.Errorf("unsupported reference selector %q", key)
+		}
+	}
+
+	if len(kept) > 0 {
+		base += "?" + strings.Join(kept, "&")
+	}
+	return base, selector, nil
+}
+
+// StripSelector returns reference without an OpNix selector. References
+// with an invalid selector are returned unchanged.
+func StripSelector(reference string) string {
+	if lookup, _, err := ParseSelector(reference); err == nil {
+		return lookup
+	}
+	return reference
+}
+
+// Apply extracts the selected part of value. Lines are numbered from 1. JSON
+// paths are dot-separated object keys or array indexes (.servers.0.host);
+// string results are returned as-is and other results as compact JSON.
+func (s *Selector) Apply(value string) (string, error) {
+	if s.Line > 0 {
+		lines := strings.Split(strings.TrimRight(value, "\r\n"), "\n")
+		if s.Line > len(lines) {
+			return "", errors.ConfigError(
+				"Applying reference selector",
+				fmt.Sprintf("Line %d requested but the value has %d lines", s.Line, len(lines)),
+				nil,
+			)
+		}
+		return strings.TrimSuffix(lines[s.Line-1], "\r"), nil
+	}
+
+	var current interface{}
+	if err := json.Unmarshal([]byte(value), &current); err != nil {
+		return "", errors.ConfigError("Applying reference selector", "Value is not valid JSON", err)
+	}
+
+	for _, key := range strings.Split(strings.TrimPrefix(s.JSONPath, "."), ".") {
+		if key == "" {
+			continue
+		}
+		switch node := current.(type) {
+		case map[string]interface{}:
+			next, ok := node[key]
+			if !ok {
+				return "", errors.ConfigError(
+					"Applying reference selector",
+					fmt.Sprintf("Key '%s' not found for json path %s", key, s.JSONPath),
+					nil,
+				)
+			}
+			current = next
+		case []interface{}:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(node) {
+				return "", errors.ConfigError(
+					"Applying reference selector",
+					fmt.Sprintf("Index '%s' out of range for json path %s", key, s.JSONPath),
+					nil,
+				)
+			}
+			current = node[index]
+		default:
+			return "", errors.ConfigError(
+				"Applying reference selector",
+				fmt.Sprintf("Cannot select '%s' from a scalar value for json path %s", key, s.JSONPath),
+				nil,
+			)
+		}
+	}
+
+	if text, ok := current.(string); ok {
+		return text, nil
+	}
+	encoded, err := json.Marshal(current)
+	if err != nil {
+		return "", errors.ConfigError("Applying reference selector", "Failed to encode selected value", err)
+	}
+	return string(encoded), nil
+}
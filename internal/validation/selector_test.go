@@ -0,0 +1,83 @@
+package validation
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSelector(t *testing.T) {
+	tests := []struct {
+		name       string
+		reference  string
+		wantLookup string
+		want       *Selector
+		wantErr    bool
+	}{
+		{"no query", "op://Vault/Item/field", "op://Vault/Item/field", nil, false},
+		{"sdk attribute only", "op://Vault/Item/otp?attribute=totp", "op://Vault/Item/otp?attribute=totp", nil, false},
+		{"line", "op://Vault/Item/notesPlain?line=2", "op://Vault/Item/notesPlain", &Selector{Line: 2}, false},
+		{"json keeps attribute", "op://Vault/Item/config?json=.db.host&attribute=value", "op://Vault/Item/config?attribute=value", &Selector{JSONPath: ".db.host"}, false},
+		{"zero line", "op://Vault/Item/notesPlain?line=0", "", nil, true},
+		{"json without dot", "op://Vault/Item/config?json=db", "", nil, true},
+		{"both selectors", "op://Vault/Item/config?line=1&json=.db", "", nil, true},
+		{"unknown parameter", "op://Vault/Item/config?xpath=/db", "", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lookup, selector, err := ParseSelector(tt.reference)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr {
+				return
+			}
+			if lookup != tt.wantLookup {
+				t.Errorf("Expected lookup %q, got %q", tt.wantLookup, lookup)
+			}
+			if (selector == nil) != (tt.want == nil) || (selector != nil && *selector != *tt.want) {
+				t.Errorf("Expected selector %+v, got %+v", tt.want, selector)
+			}
+		})
+	}
+}
+
+func TestSelector_Apply(t *testing.T) {
+	document := `{"db": {"host": "db.example.com", "port": 5432}, "servers": [{"name": "a"}, {"name": "b"}]}`
+
+	tests := []struct {
+		name     string
+		selector Selector
+		value    string
+		want     string
+		wantErr  string
+	}{
+		{"line", Selector{Line: 2}, "first\r\nsecond\r\nthird\n", "second", ""},
+		{"line out of range", Selector{Line: 4}, "first\nsecond\nthird\n", "", "has 3 lines"},
+		{"json string", Selector{JSONPath: ".db.host"}, document, "db.example.com", ""},
+		{"json number", Selector{JSONPath: ".db.port"}, document, "5432", ""},
+		{"json array index", Selector{JSONPath: ".servers.1.name"}, document, "b", ""},
+		{"json object", Selector{JSONPath: ".servers.0"}, document, `{"name":"a"}`, ""},
+		{"json missing key", Selector{JSONPath: ".db.user"}, document, "", "Key 'user' not found"},
+		{"json index out of range", Selector{JSONPath: ".servers.2"}, document, "", "out of range"},
+		{"not json", Selector{JSONPath: ".db"}, "plain text", "", "not valid JSON"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.selector.Apply(tt.value)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package validation
 
 import (
 	"fmt"
+	"net/url"
 	"os"
 	"os/user"
 	"regexp"
@@ -11,12 +12,107 @@ import (
 	"github.com/brizzbuzz/opnix/internal/errors"
 )
 
+const (
+	// DefaultReferenceScheme is the scheme of 1Password references (op://)
+	DefaultReferenceScheme = "op"
+	// ReferenceSchemeEnvVar overrides the accepted reference schemes with a
+	// comma-separated list
+	ReferenceSchemeEnvVar = "OPNIX_REFERENCE_SCHEME"
+)
+
+var schemePattern = regexp.MustCompile(`^[a-z][a-z0-9+.-]*$`)
+
 // Validator provides comprehensive validation with helpful error messages
-type Validator struct{}
+type Validator struct {
+	// schemes lists the reference schemes validateReference accepts
+	schemes []string
+}
 
-// NewValidator creates a new validator instance
+// NewValidator creates a new validator instance. It accepts the schemes named
+// by OPNIX_REFERENCE_SCHEME, or op:// when the variable is unset. An invalid
+// value also falls back to op://, so commands check it at startup with
+// ReferenceSchemesFromEnv to report it instead.
 func NewValidator() *Validator {
-	return &Validator{}
+	schemes, err := ReferenceSchemesFromEnv()
+	if err != nil || len(schemes) == 0 {
+		schemes = []string{DefaultReferenceScheme}
+	}
+	return &Validator{schemes: schemes}
+}
+
+// ReferenceSchemesFromEnv parses OPNIX_REFERENCE_SCHEME. An unset variable
+// returns nil.
+func ReferenceSchemesFromEnv() ([]string, error) {
+	value := os.Getenv(ReferenceSchemeEnvVar)
+	schemes, err := ParseReferenceSchemes(value)
+	if err != nil {
+		return nil, errors.ConfigValidationError(
+			ReferenceSchemeEnvVar,
+			value,
+			"Environment variable does not list valid reference schemes",
+			[]string{
+				"Set it to a comma-separated list of schemes without '://', e.g. op",
+				fmt.Sprintf("Or unset %s to accept only %s:// references", ReferenceSchemeEnvVar, DefaultReferenceScheme),
+			},
+		)
+	}
+	return schemes, nil
+}
+
+// SetReferenceSchemes replaces the reference schemes the validator accepts
+func (v *Validator) SetReferenceSchemes(schemes []string) error {
+	if len(schemes) == 0 {
+		return errors.ConfigValidationError(
+			"reference scheme",
+			"<empty>",
+			"At least one reference scheme is required",
+			[]string{fmt.Sprintf("Use the default scheme: %s", DefaultReferenceScheme)},
+		)
+	}
+	for _, scheme := range schemes {
+		if !schemePattern.MatchString(scheme) {
+			return errors.ConfigValidationError(
+				"reference scheme",
+				scheme,
+				"Reference schemes must start with a lowercase letter and contain only lowercase letters, digits, '+', '-', or '.'",
+				[]string{
+					"Pass the scheme without '://', e.g. op or vault",
+				},
+			)
+		}
+	}
+	v.schemes = append([]string(nil), schemes...)
+	return nil
+}
+
+// ParseReferenceSchemes splits a comma-separated list of reference schemes,
+// such as the value of OPNIX_REFERENCE_SCHEME. An empty value returns nil.
+func ParseReferenceSchemes(value string) ([]string, error) {
+	var schemes []string
+	for _, scheme := range strings.Split(value, ",") {
+		scheme = strings.TrimSuffix(strings.TrimSpace(scheme), "://")
+		if scheme == "" {
+			continue
+		}
+		schemes = append(schemes, scheme)
+	}
+	if len(schemes) == 0 {
+		return nil, nil
+	}
+	if err := (&Validator{}).SetReferenceSchemes(schemes); err != nil {
+		return nil, err
+	}
+	return schemes, nil
+}
+
+// ReferenceScheme returns the scheme of reference (op for op://Vault/Item/field),
+// or an empty string when it has none
+func ReferenceScheme(reference string) string {
+	idx := strings.Index(reference, "://")
+	if idx <= 0 || !schemePattern.MatchString(reference[:idx]) {
+		return ""
+	}
+	return reference[:idx]
 }
 
 // Secret represents a secret for validation
@@ -268,11 +364,12 @@ func (v *Validator) validateReference(reference, secretName string) error {
 				"Example: op://Homelab/Database/password",
 				"Check 1Password documentation for reference format",
 			},
-		)
+		).WithKind(errors.KindInvalidReference)
 	}
 
 	// Extract and validate components first
-	if !strings.HasPrefix(reference, "op://") {
+	scheme := ReferenceScheme(reference)
+	if scheme == "" {
 		return errors.ConfigValidationError(
 			fmt.Sprintf("%s.reference", secretName),
 			reference,
@@ -284,10 +381,47 @@ func (v *Validator) validateReference(reference, secretName string) error {
 				"Ensure vault, item, and field names don't contain forward slashes",
 				"Check the reference in 1Password web interface",
 			},
-		)
+		).WithKind(errors.KindInvalidReference)
+	}
+	if !v.acceptsScheme(scheme) {
+		return errors.ConfigValidationError(
+			fmt.Sprintf("%s.reference", secretName),
+			reference,
+			fmt.Sprintf("Unknown reference scheme '%s://'", scheme),
+			[]string{
+				fmt.Sprintf("Supported schemes: %s", strings.Join(v.schemeList(), ", ")),
+				fmt.Sprintf("Set %s to a comma-separated list to accept other schemes", ReferenceSchemeEnvVar),
+			},
+		).WithKind(errors.KindInvalidReference)
 	}
 
-	parts := strings.Split(strings.TrimPrefix(reference, "op://"), "/")
+	parts, err := ReferenceSegments(reference)
+	if err != nil {
+		return errors.ConfigValidationError(
+			fmt.Sprintf("%s.reference", secretName),
+			reference,
+			"Reference contains an invalid percent-encoded sequence",
+			[]string{
+				"Encode '/' in names as %2F and '%' as %25",
+				"Example: op://Vault/Item/my%2Ffield",
+			},
+		).WithKind(errors.KindInvalidReference)
+	}
+	if _, _, err := ParseSelector(reference); err != nil {
+		return errors.ConfigValidationError(
+			fmt.Sprintf("%s.reference", secretName),
+			reference,
+			fmt.Sprintf("Invalid reference selector: %v", err),
+			[]string{
+				"Use ?line=N to select a line or ?json=.key to select a JSON value",
+				"Example: op://Homelab/Config/notesPlain?json=.database.password",
+			},
+		).WithKind(errors.KindInvalidReference)
+	}
+	if len(parts) == 2 && parts[0] != "" && parts[1] != "" {
+		// op://Vault/Item resolves the whole item as a JSON object
+		return nil
+	}
 	if len(parts) < 3 {
 		return errors.ConfigValidationError(
 			fmt.Sprintf("%s.reference", secretName),
@@ -295,10 +429,11 @@ func (v *Validator) validateReference(reference, secretName string) error {
 			"Reference must have at least 3 parts: vault/item/field",
 			[]string{
 				"Verify the reference format: op://Vault/Item/field",
+				"Use op://Vault/Item to resolve every field of an item as JSON",
 				"Or with sections: op://Vault/Item/Section/field",
 				"Check for missing forward slashes",
 			},
-		)
+		).WithKind(errors.KindInvalidReference)
 	}
 
 	vault, item := parts[0], parts[1]
@@ -313,7 +448,7 @@ func (v *Validator) validateReference(reference, secretName string) error {
 				"Specify a valid vault name in the reference",
 				"List available vaults: op vault list",
 			},
-		)
+		).WithKind(errors.KindInvalidReference)
 	}
 
 	if item == "" {
@@ -325,7 +460,7 @@ func (v *Validator) validateReference(reference, secretName string) error {
 				"Specify a valid item name in the reference",
 				fmt.Sprintf("List items in vault: op item list --vault '%s'", vault),
 			},
-		)
+		).WithKind(errors.KindInvalidReference)
 	}
 
 	if field == "" {
@@ -338,12 +473,125 @@ func (v *Validator) validateReference(reference, secretName string) error {
 				fmt.Sprintf("View item details: op item get '%s' --vault '%s'", item, vault),
 				"Common field names: password, credential, token, key",
 			},
-		)
+		).WithKind(errors.KindInvalidReference)
 	}
 
 	return nil
 }
 
+// acceptsScheme reports whether scheme is one the validator accepts
+func (v *Validator) acceptsScheme(scheme string) bool {
+	for _, accepted := range v.schemeList() {
+		if scheme == accepted {
+			return true
+		}
+	}
+	return false
+}
+
+// schemeList returns the accepted schemes, defaulting to op for a zero Validator
+func (v *Validator) schemeList() []string {
+	if len(v.schemes) == 0 {
+		return []string{DefaultReferenceScheme}
+	}
+	return v.schemes
+}
+
+// ReferenceSegments splits an op:// reference into its decoded path segments.
+// Segments are split on literal '/' before percent-decoding, so names that
+// contain a slash can be written as %2F (op://Vault/Item/my%2Ffield). A
+// trailing ?query is not part of any segment. References using another
+// scheme are split the same way.
+func ReferenceSegments(reference string) ([]string, error) {
+	path := reference
+	if scheme := ReferenceScheme(reference); scheme != "" {
+		path = strings.TrimPrefix(reference, scheme+"://")
+	}
+	if idx := strings.Index(path, "?"); idx >= 0 {
+		path = path[:idx]
+	}
+
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		decoded, err := url.PathUnescape(part)
+		if err != nil {
+			return nil, err
+		}
+		parts[i] = decoded
+	}
+	return parts, nil
+}
+
+// IsItemReference reports whether reference names a whole item
+// (op://Vault/Item) rather than a single field
+func IsItemReference(reference string) bool {
+	if !strings.HasPrefix(reference, "op://") {
+		return false
+	}
+	parts, err := ReferenceSegments(reference)
+	return err == nil && len(parts) == 2 && parts[0] != "" && parts[1] != ""
+}
+
+// DecodeReference percent-decodes each segment of an op:// reference so it
+// can be handed to the 1Password SDK. References without escapes are
+// returned unchanged.
+func DecodeReference(reference string) (string, error) {
+	if !strings.HasPrefix(reference, "op://") || !strings.Contains(reference, "%") {
+		return reference, nil
+	}
+
+	query := ""
+	if idx := strings.Index(reference, "?"); idx >= 0 {
+		reference, query = reference[:idx], reference[idx:]
+	}
+
+	parts, err := ReferenceSegments(reference)
+	if err != nil {
+		return "", err
+	}
+	return "op://" + strings.Join(parts, "/") + query, nil
+}
+
+// ReferenceVault returns the decoded vault segment of a 1Password reference,
+// or an empty string when the reference is not in op:// form
+func ReferenceVault(reference string) string {
+	if !strings.HasPrefix(reference, "op://") {
+		return ""
+	}
+	parts, err := ReferenceSegments(reference)
+	if err != nil {
+		return strings.SplitN(strings.TrimPrefix(reference, "op://"), "/", 2)[0]
+	}
+	return parts[0]
+}
+
+// ValidateAllowedVault ensures a reference targets one of the allowed vaults.
+// Vault names are compared case-insensitively; an empty allow-list permits
+// every vault.
+func ValidateAllowedVault(reference, field string, allowed []string) error {
+	if len(allowed) == 0 {
+		return nil
+	}
+
+	vault := ReferenceVault(reference)
+	for _, candidate := range allowed {
+		if vault != "" && strings.EqualFold(vault, candidate) {
+			return nil
+		}
+	}
+
+	return errors.ConfigValidationError(
+		field,
+		reference,
+		fmt.Sprintf("Vault '%s' is not in the allowed vault list", vault),
+		[]string{
+			fmt.Sprintf("Allowed vaults: %s", strings.Join(allowed, ", ")),
+			"Point the reference at an allowed vault",
+			"Or add the vault with another -allow-vault flag if it is intended",
+		},
+	)
+}
+
 // validatePath validates secret path and checks for duplicates
 func (v *Validator) validatePath(path, secretName string, seenPaths map[string]string) error {
 	if path == "" {
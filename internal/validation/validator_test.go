@@ -3,6 +3,7 @@ package validation
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/brizzbuzz/opnix/internal/errors"
@@ -102,10 +103,15 @@ func TestValidator_ValidateReference(t *testing.T) {
 		},
 		{
 			name:      "invalid format - too few parts",
-			reference: "op://Vault/Item",
+			reference: "op://Vault",
 			wantError: true,
 			errorType: "at least 3 parts",
 		},
+		{
+			name:      "valid format - whole item",
+			reference: "op://Vault/Item",
+			wantError: false,
+		},
 		{
 			name:      "valid format - with section",
 			reference: "op://Vault/Item/Section/field",
@@ -155,6 +161,38 @@ func TestValidator_ValidateReference(t *testing.T) {
 			reference: "op://My-Vault/Complex_Item-Name/custom.field",
 			wantError: false,
 		},
+		{
+			name:      "valid format - percent-encoded slash in field",
+			reference: "op://Vault/Item/my%2Ffield",
+			wantError: false,
+		},
+		{
+			name:      "valid format - unicode names",
+			reference: "op://Coffre/Clé API/mot de passe",
+			wantError: false,
+		},
+		{
+			name:      "invalid percent-encoding",
+			reference: "op://Vault/Item/100%",
+			wantError: true,
+			errorType: "invalid percent-encoded sequence",
+		},
+		{
+			name:      "valid format - line selector",
+			reference: "op://Vault/Item/notesPlain?line=3",
+			wantError: false,
+		},
+		{
+			name:      "valid format - json selector with attribute",
+			reference: "op://Vault/Item/config?attribute=value&json=.database.host",
+			wantError: false,
+		},
+		{
+			name:      "unsupported selector",
+			reference: "op://Vault/Item/notesPlain?yaml=.key",
+			wantError: true,
+			errorType: "Invalid reference selector",
+		},
 	}
 
 	for _, tt := range tests {
@@ -169,6 +207,9 @@ func TestValidator_ValidateReference(t *testing.T) {
 				if tt.errorType != "" && !containsString(err.Error(), tt.errorType) {
 					t.Errorf("Expected error to contain %q, got: %v", tt.errorType, err)
 				}
+				if !errors.IsInvalidReference(err) {
+					t.Errorf("Expected an invalid reference error, got: %v", err)
+				}
 			} else {
 				if err != nil {
 					t.Errorf("Expected no error but got: %v", err)
@@ -659,3 +700,223 @@ func containsStringSlice(slice []string, item string) bool {
 	}
 	return false
 }
+
+func TestValidateAllowedVault(t *testing.T) {
+	tests := []struct {
+		name      string
+		reference string
+		allowed   []string
+		wantError bool
+	}{
+		{"no allow-list", "op://Production/Item/field", nil, false},
+		{"allowed vault", "op://Development/Item/field", []string{"Development"}, false},
+		{"case insensitive", "op://development/Item/field", []string{"Development"}, false},
+		{"disallowed vault", "op://Production/Item/field", []string{"Development", "Staging"}, true},
+		{"non op reference", "vault/item/field", []string{"vault"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateAllowedVault(tt.reference, "secret[0].reference", tt.allowed)
+			if tt.wantError && err == nil {
+				t.Error("Expected error but got none")
+			}
+			if !tt.wantError && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestIsItemReference(t *testing.T) {
+	tests := []struct {
+		reference string
+		expected  bool
+	}{
+		{"op://Vault/Item", true},
+		{"op://Vault/API%2FKeys", true},
+		{"op://Vault/Item/field", false},
+		{"op://Vault/", false},
+		{"op://Vault", false},
+		{"Vault/Item", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsItemReference(tt.reference); got != tt.expected {
+			t.Errorf("IsItemReference(%q): expected %v, got %v", tt.reference, tt.expected, got)
+		}
+	}
+}
+
+func TestDecodeReference(t *testing.T) {
+	tests := []struct {
+		name      string
+		reference string
+		expected  string
+		segments  []string
+		wantError bool
+	}{
+		{"no escapes", "op://Vault/Item/field", "op://Vault/Item/field", []string{"Vault", "Item", "field"}, false},
+		{"encoded slash", "op://Vault/Item/my%2Ffield", "op://Vault/Item/my/field", []string{"Vault", "Item", "my/field"}, false},
+		{"encoded spaces", "op://My%20Vault/Item/api%20key", "op://My Vault/Item/api key", []string{"My Vault", "Item", "api key"}, false},
+		{"literal spaces and unicode", "op://Vault/Clé API/日本語", "op://Vault/Clé API/日本語", []string{"Vault", "Clé API", "日本語"}, false},
+		{"encoded unicode", "op://Vault/Cl%C3%A9/field", "op://Vault/Clé/field", []string{"Vault", "Clé", "field"}, false},
+		{"query preserved", "op://Vault/Item/one%2Ftime?attribute=totp", "op://Vault/Item/one/time?attribute=totp", []string{"Vault", "Item", "one/time"}, false},
+		{"invalid escape", "op://Vault/Item/50%zz", "", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoded, err := DecodeReference(tt.reference)
+			if tt.wantError {
+				if err == nil {
+					t.Error("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if decoded != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, decoded)
+			}
+
+			segments, err := ReferenceSegments(tt.reference)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(segments) != len(tt.segments) {
+				t.Fatalf("Expected segments %q, got %q", tt.segments, segments)
+			}
+			for i := range segments {
+				if segments[i] != tt.segments[i] {
+					t.Errorf("Expected segments %q, got %q", tt.segments, segments)
+				}
+			}
+		})
+	}
+
+	if vault := ReferenceVault("op://My%20Vault/Item/field"); vault != "My Vault" {
+		t.Errorf("Expected decoded vault name, got %q", vault)
+	}
+}
+
+func TestValidator_ReferenceSchemes(t *testing.T) {
+	tests := []struct {
+		name      string
+		schemes   []string
+		reference string
+		wantError bool
+		errorType string
+	}{
+		{
+			name:      "default accepts op",
+			reference: "op://Example/Service/password",
+		},
+		{
+			name:      "default rejects other schemes",
+			reference: "vault://Example/Service/password",
+			wantError: true,
+			errorType: "Unknown reference scheme 'vault://'",
+		},
+		{
+			name:      "configured scheme is accepted",
+			schemes:   []string{"op", "vault"},
+			reference: "vault://Example/Service/password",
+		},
+		{
+			name:      "configured scheme still validates segments",
+			schemes:   []string{"mock"},
+			reference: "mock://Example//password",
+			wantError: true,
+			errorType: "Item name cannot be empty",
+		},
+		{
+			name:      "op is rejected when not configured",
+			schemes:   []string{"mock"},
+			reference: "op://Example/Service/password",
+			wantError: true,
+			errorType: "Supported schemes: mock",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			validator := NewValidator()
+			if tt.schemes != nil {
+				if err := validator.SetReferenceSchemes(tt.schemes); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			}
+
+			err := validator.validateReference(tt.reference, "test-secret")
+			if tt.wantError {
+				if err == nil {
+					t.Fatal("Expected error but got none")
+				}
+				if !containsString(err.Error(), tt.errorType) {
+					t.Errorf("Expected error to contain %q, got: %v", tt.errorType, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Expected no error but got: %v", err)
+			}
+		})
+	}
+}
+
+func TestParseReferenceSchemes(t *testing.T) {
+	tests := []struct {
+		value     string
+		expected  []string
+		wantError bool
+	}{
+		{"", nil, false},
+		{"op", []string{"op"}, false},
+		{" op , vault:// ", []string{"op", "vault"}, false},
+		{"Vault", nil, true},
+		{"my_scheme", nil, true},
+	}
+
+	for _, tt := range tests {
+		schemes, err := ParseReferenceSchemes(tt.value)
+		if tt.wantError {
+			if err == nil {
+				t.Errorf("ParseReferenceSchemes(%q): expected error, got %v", tt.value, schemes)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseReferenceSchemes(%q): unexpected error: %v", tt.value, err)
+			continue
+		}
+		if strings.Join(schemes, ",") != strings.Join(tt.expected, ",") {
+			t.Errorf("ParseReferenceSchemes(%q): expected %v, got %v", tt.value, tt.expected, schemes)
+		}
+	}
+}
+
+func TestNewValidator_SchemeFromEnv(t *testing.T) {
+	t.Setenv(ReferenceSchemeEnvVar, "op,mock")
+
+	validator := NewValidator()
+	if err := validator.validateReference("mock://Example/Service/password", "test-secret"); err != nil {
+		t.Errorf("Expected scheme from %s to be accepted, got: %v", ReferenceSchemeEnvVar, err)
+	}
+}
+
+func TestReferenceSchemesFromEnv(t *testing.T) {
+	t.Setenv(ReferenceSchemeEnvVar, "")
+	if schemes, err := ReferenceSchemesFromEnv(); err != nil || schemes != nil {
+		t.Errorf("Expected no schemes when %s is unset, got %v, %v", ReferenceSchemeEnvVar, schemes, err)
+	}
+
+	t.Setenv(ReferenceSchemeEnvVar, "op,Not A Scheme")
+	if _, err := ReferenceSchemesFromEnv(); err == nil || !strings.Contains(err.Error(), ReferenceSchemeEnvVar) {
+		t.Errorf("Expected an error naming %s, got %v", ReferenceSchemeEnvVar, err)
+	}
+	if err := NewValidator().validateReference("op://Example/Service/password", "test-secret"); err != nil {
+		t.Errorf("Expected NewValidator to fall back to op://, got: %v", err)
+	}
+}
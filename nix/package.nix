@@ -1,8 +1,9 @@
 {pkgs}:
-pkgs.buildGoModule {
+pkgs.buildGoModule rec {
   pname = "opnix";
   version = "0.9.0";
   src = ../.;
-  vendorHash = "sha256-rmwZue0X6o0q29ZVe9bWHBOxHVx/yiMJXHc4urooaHo=";
+  vendorHash = "sha256-B3/Ka/kw4xK7h5DoiZXrlnaiaC8fRuYFwfxUQppm2kM=";
   subPackages = ["cmd/opnix"];
+  ldflags = ["-X main.version=${version}"];
 }
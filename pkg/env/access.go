@@ -0,0 +1,75 @@
+package env
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/brizzbuzz/opnix/internal/errors"
+	"github.com/brizzbuzz/opnix/internal/validation"
+)
+
+// VaultLister is implemented by resolvers that can list the vaults their
+// credentials are allowed to read
+type VaultLister interface {
+	AccessibleVaults() ([]string, error)
+}
+
+// CheckVaultAccess verifies that every vault referenced by references is
+// visible to the resolver's credentials, so permission problems are reported
+// as such instead of as individual missing items
+func CheckVaultAccess(lister VaultLister, references []string) error {
+	var vaults []string
+	for _, reference := range references {
+		vaults = append(vaults, validation.ReferenceVault(reference))
+	}
+	vaults = uniqueSortedStrings(vaults)
+	if len(vaults) == 0 {
+		return nil
+	}
+
+	accessible, err := lister.AccessibleVaults()
+	if err != nil {
+		return err
+	}
+
+	visible := make(map[string]bool, len(accessible))
+	for _, name := range accessible {
+		visible[strings.ToLower(name)] = true
+	}
+
+	var denied []string
+	for _, vault := range vaults {
+		if !visible[strings.ToLower(vault)] {
+			denied = append(denied, vault)
+		}
+	}
+	if len(denied) == 0 {
+		return nil
+	}
+
+	return &errors.OpnixError{
+		Operation: "Checking 1Password vault access",
+		Component: "1Password integration",
+		Issue:     fmt.Sprintf("Token lacks access to vault %s", strings.Join(denied, ", ")),
+		Context:   fmt.Sprintf("%d of %d referenced vaults are not visible to the service account", len(denied), len(vaults)),
+		Suggestions: []string{
+			"Grant the service account access to the listed vaults in 1Password",
+			"Check the vault names in your references for typos",
+			"Verify you are using the intended service account token",
+		},
+	}
+}
+
+// asVaultLister returns resolver as a VaultLister, or an error when listing
+// vaults is unsupported
+func asVaultLister(resolver interface{}) (VaultLister, error) {
+	lister, ok := resolver.(VaultLister)
+	if !ok {
+		return nil, errors.ConfigError(
+			"Checking 1Password vault access",
+			"The configured resolver does not support listing vaults",
+			nil,
+		)
+	}
+	return lister, nil
+}
@@ -0,0 +1,54 @@
+package env
+
+import (
+	"strings"
+	"testing"
+)
+
+// vaultListingResolver reports a fixed set of accessible vaults
+type vaultListingResolver struct {
+	fakeResolver
+	vaults []string
+}
+
+func (v *vaultListingResolver) AccessibleVaults() ([]string, error) {
+	return v.vaults, nil
+}
+
+func TestCheckVaultAccess(t *testing.T) {
+	resolver := &vaultListingResolver{vaults: []string{"Development", "abc123"}}
+
+	tests := []struct {
+		name       string
+		references []string
+		wantError  string
+	}{
+		{"all vaults visible", []string{"op://Development/Item/token", "op://development/Other/key"}, ""},
+		{"vault referenced by ID", []string{"op://abc123/Item/token"}, ""},
+		{"no references", nil, ""},
+		{"inaccessible vaults", []string{"op://Development/Item/token", "op://Production/DB/password", "op://Billing/Card/number"}, "Token lacks access to vault Billing, Production"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckVaultAccess(resolver, tt.references)
+			if tt.wantError == "" {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("Expected error but got none")
+			}
+			if !strings.Contains(err.Error(), tt.wantError) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantError, err)
+			}
+		})
+	}
+
+	cached := NewCachingResolver(resolver)
+	if err := CheckVaultAccess(cached, []string{"op://Production/DB/password"}); err == nil {
+		t.Error("Expected caching resolver to delegate vault listing")
+	}
+}
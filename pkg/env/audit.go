@@ -0,0 +1,112 @@
+package env
+
+import (
+	"context"
+	"time"
+
+	"github.com/brizzbuzz/opnix/internal/validation"
+)
+
+// IdentityReporter is implemented by resolvers that know which 1Password
+// account their credentials belong to
+type IdentityReporter interface {
+	Identity() string
+}
+
+// AuditEntry records a single reference lookup. It never holds the value.
+type AuditEntry struct {
+	Time      time.Time `json:"time"`
+	Reference string    `json:"reference"`
+	Vault     string    `json:"vault"`
+	Item      string    `json:"item"`
+	Account   string    `json:"account,omitempty"`
+	Identity  string    `json:"identity,omitempty"`
+	Success   bool      `json:"success"`
+}
+
+// AuditResolver reports every lookup made through an underlying resolver.
+// Place it beneath a CachingResolver to record each fetch once.
+type AuditResolver struct {
+	resolver Resolver
+	account  string
+	identity string
+	record   func(AuditEntry)
+	now      func() time.Time
+}
+
+// NewAuditResolver wraps resolver so each lookup is passed to record. The
+// account names the configured account the resolver belongs to, if any.
+func NewAuditResolver(resolver Resolver, account string, record func(AuditEntry)) *AuditResolver {
+	identity := ""
+	if reporter, ok := resolver.(IdentityReporter); ok {
+		identity = reporter.Identity()
+	}
+	return &AuditResolver{
+		resolver: resolver,
+		account:  account,
+		identity: identity,
+		record:   record,
+		now:      time.Now,
+	}
+}
+
+// ResolveSecret resolves reference and records the outcome
+func (a *AuditResolver) ResolveSecret(reference string) (string, error) {
+	return a.ResolveSecretContext(context.Background(), reference)
+}
+
+// ResolveSecretContext resolves reference and records the outcome
+func (a *AuditResolver) ResolveSecretContext(ctx context.Context, reference string) (string, error) {
+	value, err := WithContext(a.resolver).ResolveSecretContext(ctx, reference)
+	a.audit(reference, err == nil)
+	return value, err
+}
+
+// ResolveAll resolves references and records the outcome of each
+func (a *AuditResolver) ResolveAll(ctx context.Context, references []string) (map[string]string, map[string]error, error) {
+	values, errs, err := WithContext(a.resolver).ResolveAll(ctx, references)
+	if err != nil {
+		for _, reference := range uniqueSortedStrings(references) {
+			a.audit(reference, false)
+		}
+		return nil, nil, err
+	}
+
+	for _, reference := range uniqueSortedStrings(references) {
+		_, ok := values[reference]
+		a.audit(reference, ok)
+	}
+	return values, errs, nil
+}
+
+// Precheck delegates to the underlying resolver when it supports prechecks
+func (a *AuditResolver) Precheck(references []string) ([]string, error) {
+	prechecker, err := asPrechecker(a.resolver)
+	if err != nil {
+		return nil, err
+	}
+	return prechecker.Precheck(references)
+}
+
+// AccessibleVaults delegates to the underlying resolver when it can list vaults
+func (a *AuditResolver) AccessibleVaults() ([]string, error) {
+	lister, err := asVaultLister(a.resolver)
+	if err != nil {
+		return nil, err
+	}
+	return lister.AccessibleVaults()
+}
+
+func (a *AuditResolver) audit(reference string, success bool) {
+	entry := AuditEntry{
+		Time:      a.now().UTC(),
+		Reference: reference,
+		Account:   a.account,
+		Identity:  a.identity,
+		Success:   success,
+	}
+	if parts, err := validation.ReferenceSegments(reference); err == nil && len(parts) >= 2 {
+		entry.Vault, entry.Item = parts[0], parts[1]
+	}
+	a.record(entry)
+}
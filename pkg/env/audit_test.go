@@ -0,0 +1,50 @@
+package env
+
+import (
+	"testing"
+)
+
+// identityResolver reports a fixed account identity
+type identityResolver struct {
+	fakeResolver
+}
+
+func (identityResolver) Identity() string { return "service@example.com" }
+
+func TestAuditResolver_RecordsFetches(t *testing.T) {
+	var entries []AuditEntry
+	resolver := &identityResolver{fakeResolver{secrets: map[string]string{
+		"op://Example/Service/password": "test-password",
+	}}}
+	cache := NewCachingResolver(NewAuditResolver(resolver, "work", func(entry AuditEntry) {
+		entries = append(entries, entry)
+	}))
+
+	for i := 0; i < 2; i++ {
+		if _, err := cache.ResolveSecret("op://Example/Service/password"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if _, err := cache.ResolveSecret("op://Example/Missing/password"); err == nil {
+		t.Fatal("Expected error for missing reference")
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("Expected one entry per fetch, got %d: %+v", len(entries), entries)
+	}
+
+	expected := []AuditEntry{
+		{Reference: "op://Example/Service/password", Vault: "Example", Item: "Service", Account: "work", Identity: "service@example.com", Success: true},
+		{Reference: "op://Example/Missing/password", Vault: "Example", Item: "Missing", Account: "work", Identity: "service@example.com", Success: false},
+	}
+	for i, want := range expected {
+		got := entries[i]
+		if got.Time.IsZero() {
+			t.Errorf("Entry %d: expected a timestamp", i)
+		}
+		got.Time = want.Time
+		if got != want {
+			t.Errorf("Entry %d: expected %+v, got %+v", i, want, got)
+		}
+	}
+}
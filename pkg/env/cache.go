@@ -0,0 +1,223 @@
+package env
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// CachingResolver memoizes successful lookups from an underlying resolver.
+// Concurrent requests for the same reference share a single in-flight call,
+// so parallel workers never issue duplicate API requests. One-time password
+// references, and lookups made with a WithoutCache context, are always resolved
+// fresh because their value changes over time.
+type CachingResolver struct {
+	resolver Resolver
+
+	mu       sync.Mutex
+	values   map[string]string
+	inflight map[string]*resolveCall
+	hits     int
+}
+
+// resolveCall tracks a lookup that callers for the same reference wait on
+type resolveCall struct {
+	done  chan struct{}
+	value string
+	err   error
+}
+
+// noCacheKey marks a context whose lookups must bypass caching resolvers
+type noCacheKey struct{}
+
+// WithoutCache returns a context that makes CachingResolver resolve every
+// reference fresh, without reusing or storing cached values or joining
+// lookups already in flight
+func WithoutCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCacheKey{}, true)
+}
+
+// cacheBypassed reports whether ctx was marked with WithoutCache
+func cacheBypassed(ctx context.Context) bool {
+	bypass, _ := ctx.Value(noCacheKey{}).(bool)
+	return bypass
+}
+
+// NewCachingResolver wraps resolver with a concurrency-safe cache
+func NewCachingResolver(resolver Resolver) *CachingResolver {
+	return &CachingResolver{
+		resolver: resolver,
+		values:   make(map[string]string),
+		inflight: make(map[string]*resolveCall),
+	}
+}
+
+// ResolveSecret returns the cached value for reference, resolving it at most
+// once across concurrent callers. Failed lookups are not cached.
+func (c *CachingResolver) ResolveSecret(reference string) (string, error) {
+	return c.ResolveSecretContext(context.Background(), reference)
+}
+
+// ResolveSecretContext is like ResolveSecret but stops waiting once ctx is
+// cancelled
+func (c *CachingResolver) ResolveSecretContext(ctx context.Context, reference string) (string, error) {
+	if isOTPReference(reference) || cacheBypassed(ctx) {
+		return WithContext(c.resolver).ResolveSecretContext(ctx, reference)
+	}
+
+	c.mu.Lock()
+	if value, ok := c.values[reference]; ok {
+		c.hits++
+		c.mu.Unlock()
+		return value, nil
+	}
+	if call, ok := c.inflight[reference]; ok {
+		c.hits++
+		c.mu.Unlock()
+		return call.wait(ctx)
+	}
+
+	call := &resolveCall{done: make(chan struct{})}
+	c.inflight[reference] = call
+	c.mu.Unlock()
+
+	call.value, call.err = WithContext(c.resolver).ResolveSecretContext(ctx, reference)
+	c.finish(reference, call)
+
+	return call.value, call.err
+}
+
+// ResolveAll serves cached references directly, waits on lookups already in
+// flight, and sends the remaining references to the underlying resolver in
+// one batch
+func (c *CachingResolver) ResolveAll(ctx context.Context, references []string) (map[string]string, map[string]error, error) {
+	values := make(map[string]string, len(references))
+	errs := make(map[string]error)
+	owned := make(map[string]*resolveCall)
+	waiting := make(map[string]*resolveCall)
+	seen := make(map[string]bool, len(references))
+	var batch []string
+	bypass := cacheBypassed(ctx)
+
+	c.mu.Lock()
+	for _, reference := range references {
+		if seen[reference] {
+			continue
+		}
+		seen[reference] = true
+
+		if isOTPReference(reference) || bypass {
+			batch = append(batch, reference)
+			continue
+		}
+		if value, ok := c.values[reference]; ok {
+			values[reference] = value
+			c.hits++
+			continue
+		}
+		if call, ok := c.inflight[reference]; ok {
+			waiting[reference] = call
+			c.hits++
+			continue
+		}
+
+		call := &resolveCall{done: make(chan struct{})}
+		c.inflight[reference] = call
+		owned[reference] = call
+		batch = append(batch, reference)
+	}
+	c.mu.Unlock()
+
+	if len(batch) > 0 {
+		resolved, failed, err := WithContext(c.resolver).ResolveAll(ctx, batch)
+		for reference, call := range owned {
+			switch {
+			case err != nil:
+				call.err = err
+			case failed[reference] != nil:
+				call.err = failed[reference]
+			default:
+				call.value = resolved[reference]
+			}
+			c.finish(reference, call)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for reference, value := range resolved {
+			values[reference] = value
+		}
+		for reference, err := range failed {
+			errs[reference] = err
+		}
+	}
+
+	for reference, call := range waiting {
+		value, err := call.wait(ctx)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, nil, ctxErr
+		}
+		if err != nil {
+			errs[reference] = err
+			continue
+		}
+		values[reference] = value
+	}
+
+	return values, errs, nil
+}
+
+// Hits reports how many lookups were served from the cache or shared a
+// lookup already in flight instead of reaching the underlying resolver
+func (c *CachingResolver) Hits() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits
+}
+
+// finish records the outcome of a lookup this caller owned and releases
+// everyone waiting on it
+func (c *CachingResolver) finish(reference string, call *resolveCall) {
+	c.mu.Lock()
+	if call.err == nil {
+		c.values[reference] = call.value
+	}
+	delete(c.inflight, reference)
+	c.mu.Unlock()
+	close(call.done)
+}
+
+// wait blocks until the lookup completes or ctx is cancelled
+func (r *resolveCall) wait(ctx context.Context) (string, error) {
+	select {
+	case <-r.done:
+		return r.value, r.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// Precheck delegates to the underlying resolver when it supports prechecks
+func (c *CachingResolver) Precheck(references []string) ([]string, error) {
+	prechecker, err := asPrechecker(c.resolver)
+	if err != nil {
+		return nil, err
+	}
+	return prechecker.Precheck(references)
+}
+
+// AccessibleVaults delegates to the underlying resolver when it can list vaults
+func (c *CachingResolver) AccessibleVaults() ([]string, error) {
+	lister, err := asVaultLister(c.resolver)
+	if err != nil {
+		return nil, err
+	}
+	return lister.AccessibleVaults()
+}
+
+// isOTPReference reports whether reference requests a one-time password code
+func isOTPReference(reference string) bool {
+	lower := strings.ToLower(reference)
+	return strings.Contains(lower, "attribute=totp") || strings.Contains(lower, "attribute=otp")
+}
@@ -0,0 +1,184 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingResolver counts calls and holds every lookup until released
+type blockingResolver struct {
+	calls   atomic.Int32
+	started chan struct{}
+	release chan struct{}
+	fail    bool
+}
+
+func (b *blockingResolver) ResolveSecret(reference string) (string, error) {
+	b.calls.Add(1)
+	b.started <- struct{}{}
+	<-b.release
+	if b.fail {
+		return "", fmt.Errorf("lookup failed for %s", reference)
+	}
+	return "value-for-" + reference, nil
+}
+
+func TestCachingResolver_SingleFlight(t *testing.T) {
+	const workers = 8
+	resolver := &blockingResolver{
+		started: make(chan struct{}, workers),
+		release: make(chan struct{}),
+	}
+	cache := NewCachingResolver(resolver)
+
+	var wg, entered sync.WaitGroup
+	results := make([]string, workers)
+	errs := make([]error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		entered.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			entered.Done()
+			results[i], errs[i] = cache.ResolveSecret("op://Vault/Item/token")
+		}(i)
+	}
+
+	// Hold the first lookup open until every worker has issued its request
+	<-resolver.started
+	entered.Wait()
+	time.Sleep(10 * time.Millisecond)
+	close(resolver.release)
+	wg.Wait()
+
+	if calls := resolver.calls.Load(); calls != 1 {
+		t.Errorf("Expected 1 underlying call, got %d", calls)
+	}
+	for i := 0; i < workers; i++ {
+		if errs[i] != nil {
+			t.Errorf("Worker %d: unexpected error: %v", i, errs[i])
+		}
+		if results[i] != "value-for-op://Vault/Item/token" {
+			t.Errorf("Worker %d: expected shared value, got %q", i, results[i])
+		}
+	}
+
+	// Subsequent lookups are served from the cache
+	if _, err := cache.ResolveSecret("op://Vault/Item/token"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if calls := resolver.calls.Load(); calls != 1 {
+		t.Errorf("Expected cached lookup, got %d underlying calls", calls)
+	}
+}
+
+func TestCachingResolver_DoesNotCacheFailures(t *testing.T) {
+	resolver := &blockingResolver{
+		started: make(chan struct{}, 2),
+		release: make(chan struct{}),
+		fail:    true,
+	}
+	close(resolver.release)
+	cache := NewCachingResolver(resolver)
+
+	for i := 0; i < 2; i++ {
+		if _, err := cache.ResolveSecret("op://Vault/Item/missing"); err == nil {
+			t.Fatal("Expected error from failing resolver")
+		}
+	}
+	if calls := resolver.calls.Load(); calls != 2 {
+		t.Errorf("Expected failed lookups to be retried, got %d calls", calls)
+	}
+}
+
+func TestCachingResolver_BypassesOTP(t *testing.T) {
+	resolver := &blockingResolver{
+		started: make(chan struct{}, 2),
+		release: make(chan struct{}),
+	}
+	close(resolver.release)
+	cache := NewCachingResolver(resolver)
+
+	for i := 0; i < 2; i++ {
+		if _, err := cache.ResolveSecret("op://Vault/Item/one-time password?attribute=totp"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if calls := resolver.calls.Load(); calls != 2 {
+		t.Errorf("Expected OTP lookups to bypass the cache, got %d calls", calls)
+	}
+}
+
+func TestCachingResolver_ResolveAllBatchesMisses(t *testing.T) {
+	resolver := &batchResolver{fakeResolver: fakeResolver{secrets: map[string]string{
+		"op://Example/Service/password": "test-password",
+		"op://Example/Service/token":    "test-token",
+	}}}
+	cache := NewCachingResolver(resolver)
+
+	if _, err := cache.ResolveSecret("op://Example/Service/password"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	values, errs, err := cache.ResolveAll(context.Background(), []string{
+		"op://Example/Service/password",
+		"op://Example/Service/token",
+		"op://Example/Service/missing",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if values["op://Example/Service/password"] != "test-password" || values["op://Example/Service/token"] != "test-token" {
+		t.Errorf("Expected both values, got %v", values)
+	}
+	if errs["op://Example/Service/missing"] == nil {
+		t.Errorf("Expected error for missing reference, got %v", errs)
+	}
+
+	if len(resolver.batches) != 1 || len(resolver.batches[0]) != 2 {
+		t.Fatalf("Expected a single batch of the two uncached references, got %v", resolver.batches)
+	}
+
+	// Successful batch results are cached for later lookups
+	if _, _, err := cache.ResolveAll(context.Background(), []string{"op://Example/Service/token"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(resolver.batches) != 1 {
+		t.Errorf("Expected cached reference to skip the resolver, got %d batches", len(resolver.batches))
+	}
+}
+
+func TestCachingResolver_WithoutCache(t *testing.T) {
+	resolver := &blockingResolver{
+		started: make(chan struct{}, 4),
+		release: make(chan struct{}),
+	}
+	close(resolver.release)
+	cache := NewCachingResolver(resolver)
+	bypass := WithoutCache(context.Background())
+
+	if _, err := cache.ResolveSecret("op://Example/Service/token"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := cache.ResolveSecretContext(bypass, "op://Example/Service/token"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, _, err := cache.ResolveAll(bypass, []string{"op://Example/Service/token"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if calls := resolver.calls.Load(); calls != 3 {
+		t.Errorf("Expected bypassed lookups to skip the cache, got %d calls", calls)
+	}
+
+	// Bypassed lookups do not replace the cached value for everyone else
+	if _, err := cache.ResolveSecret("op://Example/Service/token"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if calls := resolver.calls.Load(); calls != 3 {
+		t.Errorf("Expected regular lookup to stay cached, got %d calls", calls)
+	}
+}
@@ -0,0 +1,995 @@
+package env
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brizzbuzz/opnix/internal/config"
+	"github.com/brizzbuzz/opnix/internal/errors"
+	"github.com/brizzbuzz/opnix/internal/validation"
+	"gopkg.in/yaml.v3"
+)
+
+// SchemaVersion is the newest configuration version this build understands.
+// Configurations may declare it with the top-level "version" field so older
+// binaries refuse them instead of silently ignoring newer fields.
+const SchemaVersion = 1
+
+// Config describes the environment variables to resolve
+type Config struct {
+	// Version is the schema version the configuration was written for; 0
+	// means undeclared
+	Version         int                    `json:"version,omitempty" yaml:"version,omitempty"`
+	Vars            []Variable             `json:"vars" yaml:"vars"`
+	Format          string                 `json:"format,omitempty" yaml:"format,omitempty"`
+	Accounts        map[string]Account     `json:"accounts,omitempty" yaml:"accounts,omitempty"`
+	Environments    map[string]Environment `json:"environments,omitempty" yaml:"environments,omitempty"`
+	DefaultVault    string                 `json:"defaultVault,omitempty" yaml:"defaultVault,omitempty"`
+	DefaultOptional bool                   `json:"defaultOptional,omitempty" yaml:"defaultOptional,omitempty"`
+	// Files sets the ownership and permissions of output files, keyed by path
+	Files map[string]FileOptions `json:"files,omitempty" yaml:"files,omitempty"`
+}
+
+// FileOptions sets the owner, group, and mode of an output file. Unset
+// owner and group leave the file owned by the writing process; an unset
+// mode writes 0600.
+type FileOptions struct {
+	Owner string `json:"owner,omitempty" yaml:"owner,omitempty"`
+	Group string `json:"group,omitempty" yaml:"group,omitempty"`
+	Mode  string `json:"mode,omitempty" yaml:"mode,omitempty"`
+}
+
+// defaultFileMode is the mode output files are written with unless configured
+const defaultFileMode = 0600
+
+// FileMode returns the configured mode, or 0600 when none is set
+func (o FileOptions) FileMode() os.FileMode {
+	mode, err := strconv.ParseUint(o.Mode, 8, 32)
+	if o.Mode == "" || err != nil {
+		return defaultFileMode
+	}
+	return os.FileMode(mode)
+}
+
+// FileOptionsFor returns the options configured for path, comparing cleaned paths
+func (cfg *Config) FileOptionsFor(path string) FileOptions {
+	if options, ok := cfg.Files[path]; ok {
+		return options
+	}
+	cleaned := filepath.Clean(path)
+	for configured, options := range cfg.Files {
+		if filepath.Clean(configured) == cleaned {
+			return options
+		}
+	}
+	return FileOptions{}
+}
+
+// Environment is a named block of variables layered over the shared vars
+type Environment struct {
+	Vars   []Variable `json:"vars" yaml:"vars"`
+	Format string     `json:"format,omitempty" yaml:"format,omitempty"`
+}
+
+// Account describes an additional 1Password account with its own service account token
+type Account struct {
+	TokenFile string `json:"tokenFile,omitempty" yaml:"tokenFile,omitempty"`
+	TokenEnv  string `json:"tokenEnv,omitempty" yaml:"tokenEnv,omitempty"`
+}
+
+// Variable describes a single environment variable sourced from a reference or static value
+type Variable struct {
+	Name               string   `json:"name" yaml:"name"`
+	Reference          string   `json:"reference,omitempty" yaml:"reference,omitempty"`
+	Value              string   `json:"value,omitempty" yaml:"value,omitempty"`
+	Optional           bool     `json:"optional,omitempty" yaml:"optional,omitempty"`
+	Required           bool     `json:"required,omitempty" yaml:"required,omitempty"`
+	PreserveWhitespace bool     `json:"preserveWhitespace,omitempty" yaml:"preserveWhitespace,omitempty"`
+	Description        string   `json:"description,omitempty" yaml:"description,omitempty"`
+	Secret             bool     `json:"secret,omitempty" yaml:"secret,omitempty"`
+	OTP                bool     `json:"otp,omitempty" yaml:"otp,omitempty"`
+	NoCache            bool     `json:"noCache,omitempty" yaml:"noCache,omitempty"`
+	Account            string   `json:"account,omitempty" yaml:"account,omitempty"`
+	ExpectedSHA256     string   `json:"expectedSha256,omitempty" yaml:"expectedSha256,omitempty"`
+	Type               string   `json:"type,omitempty" yaml:"type,omitempty"`
+	Delimiter          string   `json:"delimiter,omitempty" yaml:"delimiter,omitempty"`
+	FieldFallbacks     []string `json:"fieldFallbacks,omitempty" yaml:"fieldFallbacks,omitempty"`
+	MinLength          int      `json:"minLength,omitempty" yaml:"minLength,omitempty"`
+	MaxLength          int      `json:"maxLength,omitempty" yaml:"maxLength,omitempty"`
+	RequiredIf         string   `json:"requiredIf,omitempty" yaml:"requiredIf,omitempty"`
+	// Timeout bounds this variable's resolution, including retries and
+	// fallbacks, as a Go duration such as "30s"
+	Timeout string `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+}
+
+// IsOptional reports whether variable may be skipped when it fails to
+// resolve. An explicit required or optional wins over defaultOptional.
+func (cfg *Config) IsOptional(variable Variable) bool {
+	if variable.Required {
+		return false
+	}
+	return variable.Optional || cfg.DefaultOptional
+}
+
+// TrimMode selects how surrounding whitespace is removed from values
+type TrimMode string
+
+const (
+	// TrimFull removes all leading and trailing whitespace
+	TrimFull TrimMode = "full"
+	// TrimTrailingNewline removes only trailing line terminators
+	TrimTrailingNewline TrimMode = "trailing-newline"
+	// TrimNone keeps values exactly as stored
+	TrimNone TrimMode = "none"
+)
+
+// TrimModes lists the accepted trim mode names
+var TrimModes = []string{string(TrimFull), string(TrimTrailingNewline), string(TrimNone)}
+
+// ParseTrimMode validates a trim mode name. An empty name selects TrimFull.
+func ParseTrimMode(name string) (TrimMode, error) {
+	if name == "" {
+		return TrimFull, nil
+	}
+	for _, mode := range TrimModes {
+		if name == mode {
+			return TrimMode(name), nil
+		}
+	}
+	return "", errors.ConfigValidationError(
+		"env.trimMode",
+		name,
+		"Unsupported trim mode",
+		[]string{"Use one of: " + strings.Join(TrimModes, ", ")},
+	)
+}
+
+// newlineNormalizer rewrites CRLF before lone CR so each line ending becomes
+// exactly one LF
+var newlineNormalizer = strings.NewReplacer("\r\n", "\n", "\r", "\n")
+
+// NormalizeNewlines converts CRLF and lone CR line endings in value to LF
+func NormalizeNewlines(value string) string {
+	return newlineNormalizer.Replace(value)
+}
+
+// TypeArray marks a variable whose value is a delimited list of elements
+const TypeArray = "array"
+
+// defaultArrayDelimiter separates array elements when no delimiter is set
+const defaultArrayDelimiter = ","
+
+// otpAttributeQuery asks 1Password for the current TOTP code instead of the otpauth:// URI
+const otpAttributeQuery = "attribute=totp"
+
+// trim removes whitespace from a resolved value according to mode unless
+// the variable preserves whitespace
+func (v Variable) trim(value string, mode TrimMode) string {
+	// OTP codes are fixed-format, so whitespace is never meaningful
+	if v.IsOTP() {
+		return strings.TrimSpace(value)
+	}
+	if v.PreserveWhitespace {
+		return value
+	}
+
+	switch mode {
+	case TrimNone:
+		return value
+	case TrimTrailingNewline:
+		return strings.TrimRight(value, "\r\n")
+	default:
+		return strings.TrimSpace(value)
+	}
+}
+
+// IsArray reports whether the variable holds a list of elements
+func (v Variable) IsArray() bool {
+	return v.Type == TypeArray
+}
+
+// Elements splits a resolved value into its array elements using the
+// variable's delimiter (default ","). Elements are trimmed and empty
+// elements are dropped.
+func (v Variable) Elements(value string) []string {
+	delimiter := v.Delimiter
+	if delimiter == "" {
+		delimiter = defaultArrayDelimiter
+	}
+
+	var elements []string
+	for _, element := range strings.Split(value, delimiter) {
+		if element = strings.TrimSpace(element); element != "" {
+			elements = append(elements, element)
+		}
+	}
+	return elements
+}
+
+// IsOTP reports whether the variable resolves a time-based one-time password.
+// OTP values change every period and must never be cached.
+func (v Variable) IsOTP() bool {
+	if v.OTP {
+		return true
+	}
+	if v.Reference == "" {
+		return false
+	}
+
+	base, query, _ := strings.Cut(strings.ToLower(v.Reference), "?")
+	if strings.Contains(query, "attribute=totp") || strings.Contains(query, "attribute=otp") {
+		return true
+	}
+
+	field := base[strings.LastIndex(base, "/")+1:]
+	return field == "one-time password" || field == "one-time-password"
+}
+
+// Field returns the decoded field segment of the variable's reference
+func (v Variable) Field() string {
+	base, _, _ := strings.Cut(v.Reference, "?")
+	field := base[strings.LastIndex(base, "/")+1:]
+	if decoded, err := url.PathUnescape(field); err == nil {
+		return decoded
+	}
+	return field
+}
+
+// FallbackReferences returns the lookup references for each fallback field,
+// pointing at the same item and keeping any query attributes
+func (v Variable) FallbackReferences() []string {
+	base, query, hasQuery := strings.Cut(v.Reference, "?")
+	item := base[:strings.LastIndex(base, "/")+1]
+
+	references := make([]string, 0, len(v.FieldFallbacks))
+	for _, field := range v.FieldFallbacks {
+		fallback := v
+		fallback.Reference = item + referenceSegmentEscaper.Replace(field)
+		if hasQuery {
+			fallback.Reference += "?" + query
+		}
+		references = append(references, fallback.LookupReference())
+	}
+	return references
+}
+
+// referenceSegmentEscaper percent-encodes the characters that cannot appear
+// literally in a reference segment
+var referenceSegmentEscaper = strings.NewReplacer("%", "%25", "/", "%2F")
+
+// LookupReference returns the reference passed to the resolver, requesting
+// the current TOTP code for OTP fields unless an attribute is already set
+func (v Variable) LookupReference() string {
+	if !v.IsOTP() || strings.Contains(strings.ToLower(v.Reference), "attribute=") {
+		return v.Reference
+	}
+
+	separator := "?"
+	if strings.Contains(v.Reference, "?") {
+		separator = "&"
+	}
+	return v.Reference + separator + otpAttributeQuery
+}
+
+// ResolveTimeout returns the variable's timeout, or 0 when none is set
+func (v Variable) ResolveTimeout() time.Duration {
+	timeout, err := time.ParseDuration(v.Timeout)
+	if err != nil {
+		return 0
+	}
+	return timeout
+}
+
+// IsSecret reports whether the value must be masked in diagnostic output.
+// Reference-sourced values are always secret; static values opt in.
+func (v Variable) IsSecret() bool {
+	return v.Reference != "" || v.Secret
+}
+
+var envNamePattern = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+
+var sha256Pattern = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+// Load reads and validates an environment configuration file. Files ending
+// in .yaml or .yml are parsed as YAML; everything else is parsed as JSON.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.FileOperationError(
+			"Loading environment configuration",
+			path,
+			"Failed to read environment config file",
+			err,
+		)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return ParseYAML(data)
+	default:
+		return Parse(data)
+	}
+}
+
+// ParseYAML parses and validates YAML environment configuration data
+func ParseYAML(data []byte) (*Config, error) {
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, errors.ConfigError(
+			"Parsing environment configuration",
+			"Invalid YAML format in environment configuration",
+			err,
+		)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+// ParseString parses and validates an inline JSON environment configuration
+func ParseString(raw string) (*Config, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, errors.ConfigValidationError(
+			"env configuration",
+			"<empty>",
+			"Environment configuration JSON cannot be empty",
+			[]string{
+				"Provide configuration via -config-json",
+				"Set OPNIX_ENV_CONFIG_JSON",
+				"Or specify a configuration file path",
+			},
+		)
+	}
+
+	return Parse([]byte(raw))
+}
+
+// Parse parses and validates JSON (or JSONC) environment configuration data
+func Parse(data []byte) (*Config, error) {
+	data = stripJSONComments(data)
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		issue := "Invalid JSON format in environment configuration"
+
+		var syntaxErr *json.SyntaxError
+		if stderrors.As(err, &syntaxErr) && syntaxErr.Offset > 0 {
+			line, column := jsonErrorPosition(data, syntaxErr.Offset-1)
+			issue = fmt.Sprintf("%s at line %d, column %d", issue, line, column)
+		}
+
+		return nil, errors.ConfigError(
+			"Parsing environment configuration",
+			issue,
+			err,
+		)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+// Validate checks the configuration for structural errors before any resolution
+func (cfg *Config) Validate() error {
+	if err := cfg.validateVersion(); err != nil {
+		return err
+	}
+
+	if len(cfg.Vars) == 0 && len(cfg.Environments) == 0 {
+		return errors.ConfigValidationError(
+			"env.vars",
+			"<empty>",
+			"Environment configuration must define at least one variable",
+			[]string{
+				"Add variables under the 'vars' array",
+				"Or define named blocks under 'environments'",
+				"Example: {\"vars\": [{\"name\": \"API_TOKEN\", \"reference\": \"op://Vault/Item/token\"}]}",
+			},
+		)
+	}
+
+	for name, account := range cfg.Accounts {
+		if account.TokenFile == "" && account.TokenEnv == "" {
+			return errors.ConfigValidationError(
+				fmt.Sprintf("env.accounts.%s", name),
+				"<empty>",
+				"Account must define a 'tokenFile' or 'tokenEnv'",
+				[]string{
+					"Point 'tokenFile' at the account's service account token",
+					"Or set 'tokenEnv' to the environment variable holding the token",
+				},
+			)
+		}
+	}
+
+	for path, options := range cfg.Files {
+		if err := validateFileOptions(path, options); err != nil {
+			return err
+		}
+	}
+
+	for i, variable := range cfg.Vars {
+		if err := cfg.validateVariable(variable, fmt.Sprintf("env.vars[%d]", i)); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range cfg.EnvironmentNames() {
+		for i, variable := range cfg.Environments[name].Vars {
+			if err := cfg.validateVariable(variable, fmt.Sprintf("env.environments.%s.vars[%d]", name, i)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateVersion rejects configurations written for a newer schema than
+// this build supports. Unknown fields are still tolerated for the current
+// and older versions.
+func (cfg *Config) validateVersion() error {
+	if cfg.Version < 0 {
+		return errors.ConfigValidationError(
+			"env.version",
+			strconv.Itoa(cfg.Version),
+			"Configuration version cannot be negative",
+			[]string{fmt.Sprintf("Set \"version\": %d or remove the field", SchemaVersion)},
+		)
+	}
+	if cfg.Version > SchemaVersion {
+		return errors.ConfigValidationError(
+			"env.version",
+			strconv.Itoa(cfg.Version),
+			fmt.Sprintf("Configuration requires schema version %d, but this opnix only supports up to version %d", cfg.Version, SchemaVersion),
+			[]string{
+				"Upgrade opnix to a release that supports this configuration version",
+				"Check the installed release with: opnix version",
+			},
+		)
+	}
+	return nil
+}
+
+// validateEnvReference checks an env://NAME reference names a variable and
+// does not also select a 1Password account
+func validateEnvReference(variable Variable, fieldPrefix string) error {
+	name, _, _ := strings.Cut(strings.TrimPrefix(variable.Reference, EnvScheme), "?")
+	if !envReferenceNamePattern.MatchString(name) {
+		return errors.ConfigValidationError(
+			fieldPrefix+".reference",
+			variable.Reference,
+			"env:// references must name an environment variable",
+			[]string{"Example: env://DATABASE_URL"},
+		)
+	}
+	if variable.Account != "" {
+		return errors.ConfigValidationError(
+			fieldPrefix+".account",
+			variable.Account,
+			"env:// references are read locally and cannot select a 1Password account",
+			[]string{"Remove the 'account' field or use an op:// reference"},
+		)
+	}
+	return nil
+}
+
+var envReferenceNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+var fileModePattern = regexp.MustCompile(`^[0-7]{3,4}$`)
+
+// validateFileOptions checks the mode of a files entry, rejecting modes that
+// let other users modify the file
+func validateFileOptions(path string, options FileOptions) error {
+	field := fmt.Sprintf("env.files.%s.mode", path)
+	if options.Mode == "" {
+		return nil
+	}
+	if !fileModePattern.MatchString(options.Mode) {
+		return errors.ConfigValidationError(
+			field,
+			options.Mode,
+			"File mode must be a 3-4 digit octal number",
+			[]string{"Example: \"mode\": \"0640\""},
+		)
+	}
+	if options.FileMode()&0002 != 0 {
+		return errors.ConfigValidationError(
+			field,
+			options.Mode,
+			"Mode allows world write access (others can modify the secret)",
+			[]string{"Use modes like 0600 or 0640 instead"},
+		)
+	}
+	return nil
+}
+
+// validateVariable checks a single variable definition
+func (cfg *Config) validateVariable(variable Variable, fieldPrefix string) error {
+	if variable.Name == "" {
+		return errors.ConfigValidationError(
+			fieldPrefix+".name",
+			"<empty>",
+			"Environment variable name cannot be empty",
+			[]string{
+				"Provide a unique uppercase variable name",
+				"Example: API_TOKEN",
+			},
+		)
+	}
+
+	if !envNamePattern.MatchString(variable.Name) {
+		return errors.ConfigValidationError(
+			fieldPrefix+".name",
+			variable.Name,
+			"Environment variable names must use uppercase letters, numbers, and underscores",
+			[]string{
+				"Start with an uppercase letter",
+				"Use uppercase letters, digits, and underscores only",
+				"Example: DATABASE_PASSWORD",
+			},
+		)
+	}
+
+	hasReference := variable.Reference != ""
+	hasValue := variable.Value != ""
+
+	if hasReference && hasValue {
+		return errors.ConfigValidationError(
+			fieldPrefix,
+			variable.Name,
+			"Specify either 'reference' or 'value', not both",
+			[]string{
+				"Remove the 'value' field to use a 1Password reference",
+				"Or remove the 'reference' field to use a static value",
+			},
+		)
+	}
+
+	if hasReference {
+		if _, _, err := validation.ParseSelector(variable.Reference); err != nil {
+			return errors.ConfigValidationError(
+				fieldPrefix+".reference",
+				variable.Reference,
+				fmt.Sprintf("Invalid reference selector: %v", err),
+				[]string{
+					"Use ?line=N to select a line or ?json=.key to select a JSON value",
+					"Example: op://Example/Service/notesPlain?json=.database.password",
+				},
+			)
+		}
+		if IsEnvReference(variable.Reference) {
+			if err := validateEnvReference(variable, fieldPrefix); err != nil {
+				return err
+			}
+		}
+	}
+
+	if variable.Account != "" {
+		if !hasReference {
+			return errors.ConfigValidationError(
+				fieldPrefix+".account",
+				variable.Account,
+				"Only variables with a 1Password reference can select an account",
+				[]string{
+					"Remove the 'account' field from static values",
+				},
+			)
+		}
+		if _, ok := cfg.Accounts[variable.Account]; !ok {
+			return errors.ConfigValidationError(
+				fieldPrefix+".account",
+				variable.Account,
+				"Variable refers to an account that is not defined",
+				[]string{
+					"Define the account under the top-level 'accounts' object",
+					"Example: {\"accounts\": {\"work\": {\"tokenFile\": \"/run/secrets/work-token\"}}}",
+				},
+			)
+		}
+	}
+
+	if variable.ExpectedSHA256 != "" && !sha256Pattern.MatchString(variable.ExpectedSHA256) {
+		return errors.ConfigValidationError(
+			fieldPrefix+".expectedSha256",
+			variable.ExpectedSHA256,
+			"Expected hash must be a 64 character hex-encoded SHA-256 digest",
+			[]string{
+				"Compute the digest with: printf '%s' \"$VALUE\" | sha256sum",
+			},
+		)
+	}
+
+	if variable.OTP && !hasReference {
+		return errors.ConfigValidationError(
+			fieldPrefix+".otp",
+			variable.Name,
+			"OTP variables must use a 1Password reference",
+			[]string{
+				"Point 'reference' at the item's one-time password field",
+				"Example: op://Vault/Item/one-time password",
+			},
+		)
+	}
+
+	if variable.NoCache && !hasReference {
+		return errors.ConfigValidationError(
+			fieldPrefix+".noCache",
+			variable.Name,
+			"noCache only applies to variables with a 1Password reference",
+			[]string{"Remove noCache from static values"},
+		)
+	}
+
+	switch variable.Type {
+	case "", "string", TypeArray:
+	default:
+		return errors.ConfigValidationError(
+			fieldPrefix+".type",
+			variable.Type,
+			"Unsupported variable type",
+			[]string{
+				"Use \"string\" (the default) or \"array\"",
+			},
+		)
+	}
+
+	if len(variable.FieldFallbacks) > 0 && !hasReference {
+		return errors.ConfigValidationError(
+			fieldPrefix+".fieldFallbacks",
+			variable.Name,
+			"Field fallbacks require a 1Password reference",
+			[]string{
+				"Add a 'reference' whose field is tried first",
+				"Or remove the 'fieldFallbacks' list",
+			},
+		)
+	}
+	for i, field := range variable.FieldFallbacks {
+		if strings.TrimSpace(field) == "" {
+			return errors.ConfigValidationError(
+				fmt.Sprintf("%s.fieldFallbacks[%d]", fieldPrefix, i),
+				"<empty>",
+				"Fallback field names cannot be empty",
+				[]string{
+					"Remove the empty entry",
+					"Example: \"fieldFallbacks\": [\"credential\"]",
+				},
+			)
+		}
+	}
+
+	if variable.MinLength < 0 || variable.MaxLength < 0 {
+		return errors.ConfigValidationError(
+			fieldPrefix+".minLength",
+			fmt.Sprintf("%d/%d", variable.MinLength, variable.MaxLength),
+			"Length bounds cannot be negative",
+			[]string{"Use a positive length, or omit the bound"},
+		)
+	}
+	if variable.MaxLength > 0 && variable.MinLength > variable.MaxLength {
+		return errors.ConfigValidationError(
+			fieldPrefix+".maxLength",
+			fmt.Sprintf("%d", variable.MaxLength),
+			fmt.Sprintf("maxLength must be at least minLength (%d)", variable.MinLength),
+			[]string{"Swap the bounds or raise maxLength"},
+		)
+	}
+
+	if variable.Timeout != "" {
+		if !hasReference {
+			return errors.ConfigValidationError(
+				fieldPrefix+".timeout",
+				variable.Timeout,
+				"timeout only applies to variables with a reference",
+				[]string{"Remove timeout from static values"},
+			)
+		}
+		if timeout, err := time.ParseDuration(variable.Timeout); err != nil || timeout <= 0 {
+			return errors.ConfigValidationError(
+				fieldPrefix+".timeout",
+				variable.Timeout,
+				"timeout must be a positive duration",
+				[]string{"Example: \"timeout\": \"30s\""},
+			)
+		}
+	}
+
+	if variable.Optional && variable.Required {
+		return errors.ConfigValidationError(
+			fieldPrefix+".required",
+			variable.Name,
+			"A variable cannot be both optional and required",
+			[]string{
+				"Remove 'optional' to require the variable",
+				"Or remove 'required' to let it be skipped",
+			},
+		)
+	}
+
+	if variable.RequiredIf == variable.Name {
+		return errors.ConfigValidationError(
+			fieldPrefix+".requiredIf",
+			variable.RequiredIf,
+			"A variable cannot be conditionally required by itself",
+			[]string{"Name the variable whose presence makes this one required"},
+		)
+	}
+
+	if variable.Delimiter != "" && !variable.IsArray() {
+		return errors.ConfigValidationError(
+			fieldPrefix+".delimiter",
+			variable.Delimiter,
+			"Only array variables can set a delimiter",
+			[]string{
+				"Add \"type\": \"array\" to the variable",
+				"Or remove the 'delimiter' field",
+			},
+		)
+	}
+
+	if !hasReference && !hasValue {
+		return errors.ConfigValidationError(
+			fieldPrefix,
+			variable.Name,
+			"Environment variable must define a 1Password reference or static value",
+			[]string{
+				"Add a 'reference': \"op://Vault/Item/field\"",
+				"Or add a 'value' for static configuration",
+			},
+		)
+	}
+
+	return nil
+}
+
+// EnvironmentNames returns the names of the configured environments in sorted order
+func (cfg *Config) EnvironmentNames() []string {
+	names := make([]string, 0, len(cfg.Environments))
+	for name := range cfg.Environments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Select returns the configuration for the named environment: the shared vars
+// with the environment's vars layered on top, replacing shared variables of
+// the same name. An empty name selects the shared vars alone.
+func (cfg *Config) Select(name string) (*Config, error) {
+	if name == "" {
+		if len(cfg.Vars) == 0 {
+			return nil, errors.ConfigValidationError(
+				"env.environment",
+				"<empty>",
+				"Configuration only defines named environments; one must be selected",
+				environmentSuggestions(cfg),
+			)
+		}
+		return cfg, nil
+	}
+
+	environment, ok := cfg.Environments[name]
+	if !ok {
+		return nil, errors.ConfigValidationError(
+			"env.environment",
+			name,
+			"Environment is not defined in the configuration",
+			environmentSuggestions(cfg),
+		)
+	}
+
+	vars := append([]Variable{}, cfg.Vars...)
+	index := make(map[string]int, len(vars))
+	for i, variable := range vars {
+		index[variable.Name] = i
+	}
+	for _, variable := range environment.Vars {
+		if i, exists := index[variable.Name]; exists {
+			vars[i] = variable
+			continue
+		}
+		index[variable.Name] = len(vars)
+		vars = append(vars, variable)
+	}
+
+	selected := &Config{
+		Version:         cfg.Version,
+		Vars:            vars,
+		Format:          cfg.Format,
+		Accounts:        cfg.Accounts,
+		DefaultVault:    cfg.DefaultVault,
+		DefaultOptional: cfg.DefaultOptional,
+		Files:           cfg.Files,
+	}
+	if environment.Format != "" {
+		selected.Format = environment.Format
+	}
+
+	if len(selected.Vars) == 0 {
+		return nil, errors.ConfigValidationError(
+			fmt.Sprintf("env.environments.%s.vars", name),
+			"<empty>",
+			"Selected environment does not define any variables",
+			[]string{"Add variables to the environment or to the shared 'vars' array"},
+		)
+	}
+
+	return selected, nil
+}
+
+// ExpandEnv expands $VAR and ${VAR} in every variable's reference, including
+// those in environment blocks, and validates the result. Unset variables
+// expand to "" unless strict is set, in which case they are reported as an
+// error naming source.
+func (cfg *Config) ExpandEnv(source string, strict bool) error {
+	var expander config.EnvExpander
+	expandAll := func(vars []Variable) {
+		for i := range vars {
+			vars[i].Reference = expander.Expand(vars[i].Reference)
+		}
+	}
+	expandAll(cfg.Vars)
+	for _, environment := range cfg.Environments {
+		expandAll(environment.Vars)
+	}
+
+	if strict {
+		if err := expander.Err("Loading environment configuration", "variable references", source); err != nil {
+			return err
+		}
+	}
+	return cfg.Validate()
+}
+
+// QualifyReferences expands short references written as "Item/field" into
+// full op:// references in the default vault. vault overrides the config's
+// defaultVault when set. References that already start with op:// or env://
+// are left untouched, so anything else is always treated as short.
+func (cfg *Config) QualifyReferences(vault string) error {
+	if vault == "" {
+		vault = cfg.DefaultVault
+	}
+
+	for i, variable := range cfg.Vars {
+		if variable.Reference == "" || strings.HasPrefix(variable.Reference, "op://") || IsEnvReference(variable.Reference) {
+			continue
+		}
+
+		field := fmt.Sprintf("env.vars[%d].reference", i)
+		if vault == "" {
+			return errors.ConfigValidationError(
+				field,
+				variable.Reference,
+				"Short references require a default vault",
+				[]string{
+					"Set 'defaultVault' in the configuration or pass -vault <name>",
+					"Or write the full reference: op://Vault/Item/field",
+				},
+			)
+		}
+
+		parts := strings.Split(variable.Reference, "/")
+		if len(parts) < 2 || parts[0] == "" || parts[len(parts)-1] == "" {
+			return errors.ConfigValidationError(
+				field,
+				variable.Reference,
+				"Short references must have at least 2 parts: item/field",
+				[]string{
+					"Use format: Item/field or Item/Section/field",
+					"Or write the full reference: op://Vault/Item/field",
+				},
+			)
+		}
+
+		cfg.Vars[i].Reference = "op://" + vault + "/" + variable.Reference
+	}
+
+	return nil
+}
+
+func environmentSuggestions(cfg *Config) []string {
+	names := cfg.EnvironmentNames()
+	if len(names) == 0 {
+		return []string{"Remove the environment selection; this configuration defines no environments"}
+	}
+	return []string{
+		fmt.Sprintf("Available environments: %s", strings.Join(names, ", ")),
+		"Select one with -environment <name>",
+	}
+}
+
+// WithPrefix returns a copy of cfg with prefix prepended to every variable
+// name and requiredIf condition. Names that would become invalid or collide
+// once prefixed are rejected.
+func (cfg *Config) WithPrefix(prefix string) (*Config, error) {
+	if prefix == "" {
+		return cfg, nil
+	}
+
+	prefixed := *cfg
+	prefixed.Vars = make([]Variable, len(cfg.Vars))
+	seen := make(map[string]int, len(cfg.Vars))
+	for i, variable := range cfg.Vars {
+		variable.Name = prefix + variable.Name
+		if variable.RequiredIf != "" {
+			variable.RequiredIf = prefix + variable.RequiredIf
+		}
+
+		field := fmt.Sprintf("env.vars[%d].name", i)
+		if !envNamePattern.MatchString(variable.Name) {
+			return nil, errors.ConfigValidationError(
+				field,
+				variable.Name,
+				fmt.Sprintf("Prefix %q produces an invalid environment variable name", prefix),
+				[]string{"Use a prefix that starts with an uppercase letter and contains only uppercase letters, digits, and underscores"},
+			)
+		}
+		if previous, exists := seen[variable.Name]; exists {
+			return nil, errors.ConfigValidationError(
+				field,
+				variable.Name,
+				fmt.Sprintf("Prefixed name collides with env.vars[%d]", previous),
+				[]string{"Rename one of the variables so each prefixed name is unique"},
+			)
+		}
+		seen[variable.Name] = i
+		prefixed.Vars[i] = variable
+	}
+
+	return &prefixed, nil
+}
+
+// PrefixFromPath derives a variable name prefix from a file's basename:
+// the extension is dropped, the rest is uppercased with every other
+// character replaced by an underscore, and a trailing underscore is added.
+// service-a.json becomes SERVICE_A_.
+func PrefixFromPath(path string) string {
+	base := filepath.Base(path)
+	base = strings.TrimSuffix(base, filepath.Ext(base))
+
+	var b strings.Builder
+	for _, r := range strings.ToUpper(base) {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	b.WriteByte('_')
+	return b.String()
+}
+
+// CheckAllowlist verifies that every reference cfg may resolve, including
+// fallback fields, is on allowlist
+func (cfg *Config) CheckAllowlist(allowlist *validation.ReferenceAllowlist) error {
+	for i, variable := range cfg.Vars {
+		if variable.Reference == "" {
+			continue
+		}
+		field := fmt.Sprintf("env.vars[%d].reference", i)
+		references := append([]string{variable.LookupReference()}, variable.FallbackReferences()...)
+		for _, reference := range references {
+			if err := allowlist.Validate(reference, field); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,490 @@
+package env
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVariable_LookupReference(t *testing.T) {
+	tests := []struct {
+		name     string
+		variable Variable
+		wantOTP  bool
+		expected string
+	}{
+		{
+			name:     "regular field",
+			variable: Variable{Reference: "op://Vault/Item/password"},
+			expected: "op://Vault/Item/password",
+		},
+		{
+			name:     "one-time password field",
+			variable: Variable{Reference: "op://Vault/Item/one-time password"},
+			wantOTP:  true,
+			expected: "op://Vault/Item/one-time password?attribute=totp",
+		},
+		{
+			name:     "explicit otp flag",
+			variable: Variable{Reference: "op://Vault/Item/mfa", OTP: true},
+			wantOTP:  true,
+			expected: "op://Vault/Item/mfa?attribute=totp",
+		},
+		{
+			name:     "attribute already present",
+			variable: Variable{Reference: "op://Vault/Item/mfa?attribute=totp"},
+			wantOTP:  true,
+			expected: "op://Vault/Item/mfa?attribute=totp",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.variable.IsOTP(); got != tt.wantOTP {
+				t.Errorf("Expected isOTP=%v, got %v", tt.wantOTP, got)
+			}
+			if got := tt.variable.LookupReference(); got != tt.expected {
+				t.Errorf("Expected reference %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestValidate_Accounts(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{
+			name:    "undefined account",
+			config:  `{"vars":[{"name":"KEY","reference":"op://V/I/f","account":"missing"}]}`,
+			wantErr: "account that is not defined",
+		},
+		{
+			name:    "account without token source",
+			config:  `{"accounts":{"work":{}},"vars":[{"name":"KEY","reference":"op://V/I/f","account":"work"}]}`,
+			wantErr: "must define a 'tokenFile' or 'tokenEnv'",
+		},
+		{
+			name:    "account on static value",
+			config:  `{"accounts":{"work":{"tokenFile":"/t"}},"vars":[{"name":"KEY","value":"x","account":"work"}]}`,
+			wantErr: "Only variables with a 1Password reference",
+		},
+		{
+			name:   "valid account",
+			config: `{"accounts":{"work":{"tokenEnv":"WORK_TOKEN"}},"vars":[{"name":"KEY","reference":"op://V/I/f","account":"work"}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.config))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestConfig_SelectEnvironment(t *testing.T) {
+	cfg, err := ParseString(`{
+		"format": "shell",
+		"vars": [
+			{"name": "REGION", "value": "us-east-1"},
+			{"name": "API_TOKEN", "reference": "op://Shared/API/token"}
+		],
+		"environments": {
+			"prod": {
+				"format": "dotenv",
+				"vars": [
+					{"name": "API_TOKEN", "reference": "op://Prod/API/token"},
+					{"name": "DB_PASSWORD", "reference": "op://Prod/DB/password"}
+				]
+			},
+			"staging": {"vars": [{"name": "REGION", "value": "eu-west-1"}]}
+		}
+	}`)
+	if err != nil {
+		t.Fatalf("Unexpected parse error: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		environment string
+		format      string
+		vars        []string
+		wantError   string
+	}{
+		{"shared only", "", "shell", []string{"REGION=us-east-1", "API_TOKEN=op://Shared/API/token"}, ""},
+		{"override and append", "prod", "dotenv", []string{"REGION=us-east-1", "API_TOKEN=op://Prod/API/token", "DB_PASSWORD=op://Prod/DB/password"}, ""},
+		{"override static value", "staging", "shell", []string{"REGION=eu-west-1", "API_TOKEN=op://Shared/API/token"}, ""},
+		{"undefined environment", "dev", "", nil, "Available environments: prod, staging"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selected, err := cfg.Select(tt.environment)
+			if tt.wantError != "" {
+				if err == nil {
+					t.Fatal("Expected error but got none")
+				}
+				if !strings.Contains(err.Error(), tt.wantError) {
+					t.Errorf("Expected error containing %q, got %v", tt.wantError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if selected.Format != tt.format {
+				t.Errorf("Expected format %q, got %q", tt.format, selected.Format)
+			}
+
+			var got []string
+			for _, variable := range selected.Vars {
+				source := variable.Reference
+				if source == "" {
+					source = variable.Value
+				}
+				got = append(got, variable.Name+"="+source)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.vars, ",") {
+				t.Errorf("Expected vars %v, got %v", tt.vars, got)
+			}
+		})
+	}
+}
+
+func TestConfig_EnvironmentsOnly(t *testing.T) {
+	cfg, err := ParseString(`{"environments": {"prod": {"vars": [{"name": "API_TOKEN", "reference": "op://Prod/API/token"}]}}}`)
+	if err != nil {
+		t.Fatalf("Expected environment-only config to parse, got %v", err)
+	}
+
+	if _, err := cfg.Select(""); err == nil || !strings.Contains(err.Error(), "Available environments: prod") {
+		t.Errorf("Expected error requiring an environment selection, got %v", err)
+	}
+
+	if _, err := ParseString(`{"environments": {"prod": {"vars": [{"name": "bad-name", "value": "x"}]}}}`); err == nil || !strings.Contains(err.Error(), "env.environments.prod.vars[0].name") {
+		t.Errorf("Expected validation error naming the environment variable, got %v", err)
+	}
+}
+
+func TestConfig_QualifyReferences(t *testing.T) {
+	tests := []struct {
+		name         string
+		defaultVault string
+		vault        string
+		reference    string
+		expected     string
+		wantError    string
+	}{
+		{"config default vault", "Dev", "", "API/token", "op://Dev/API/token", ""},
+		{"flag overrides config", "Dev", "Prod", "API/token", "op://Prod/API/token", ""},
+		{"section reference", "Dev", "", "API/Keys/token", "op://Dev/API/Keys/token", ""},
+		{"qualified reference untouched", "Dev", "", "op://Other/API/token", "op://Other/API/token", ""},
+		{"no default vault", "", "", "API/token", "", "Short references require a default vault"},
+		{"missing field", "Dev", "", "API", "", "at least 2 parts"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				DefaultVault: tt.defaultVault,
+				Vars: []Variable{
+					{Name: "API_TOKEN", Reference: tt.reference},
+					{Name: "STATIC", Value: "value"},
+				},
+			}
+
+			err := cfg.QualifyReferences(tt.vault)
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Errorf("Expected error containing %q, got %v", tt.wantError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if cfg.Vars[0].Reference != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, cfg.Vars[0].Reference)
+			}
+			if cfg.Vars[1].Reference != "" {
+				t.Errorf("Expected static variable to stay static, got reference %q", cfg.Vars[1].Reference)
+			}
+		})
+	}
+}
+
+func TestVariable_Elements(t *testing.T) {
+	tests := []struct {
+		name     string
+		variable Variable
+		value    string
+		expected []string
+	}{
+		{"default delimiter", Variable{Type: TypeArray}, "a, b ,c", []string{"a", "b", "c"}},
+		{"custom delimiter", Variable{Type: TypeArray, Delimiter: "\n"}, "one\ntwo words\n\n", []string{"one", "two words"}},
+		{"empty value", Variable{Type: TypeArray}, "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.variable.Elements(tt.value)
+			if strings.Join(got, "|") != strings.Join(tt.expected, "|") || len(got) != len(tt.expected) {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+
+	invalid := []string{
+		`{"vars":[{"name":"HOSTS","value":"a","type":"list"}]}`,
+		`{"vars":[{"name":"HOSTS","value":"a","delimiter":";"}]}`,
+	}
+	for _, raw := range invalid {
+		if _, err := ParseString(raw); err == nil {
+			t.Errorf("Expected validation error for %s", raw)
+		}
+	}
+}
+
+func TestVariable_FallbackReferences(t *testing.T) {
+	variable := Variable{
+		Reference:      "op://Example/Service/password?attribute=type",
+		FieldFallbacks: []string{"credential", "api/key"},
+	}
+
+	want := []string{
+		"op://Example/Service/credential?attribute=type",
+		"op://Example/Service/api%2Fkey?attribute=type",
+	}
+	got := variable.FallbackReferences()
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	invalid := []string{
+		`{"vars":[{"name":"TOKEN","value":"a","fieldFallbacks":["credential"]}]}`,
+		`{"vars":[{"name":"TOKEN","reference":"op://Example/Service/password","fieldFallbacks":[""]}]}`,
+	}
+	for _, raw := range invalid {
+		if _, err := ParseString(raw); err == nil {
+			t.Errorf("Expected validation error for %s", raw)
+		}
+	}
+}
+
+func TestLoad_YAML(t *testing.T) {
+	dir := t.TempDir()
+	content := `# Shared settings
+format: dotenv
+vars:
+  - name: API_TOKEN
+    reference: op://Example/Service/token
+    fieldFallbacks: [credential]
+  - name: REGION
+    value: eu
+environments:
+  prod:
+    vars:
+      - name: REGION
+        value: us
+`
+
+	for _, name := range []string{"opnix-env.yaml", "opnix-env.YML"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+
+		cfg, err := Load(path)
+		if err != nil {
+			t.Fatalf("Unexpected error loading %s: %v", name, err)
+		}
+		if cfg.Format != "dotenv" || len(cfg.Vars) != 2 {
+			t.Fatalf("Expected format and two vars from %s, got %+v", name, cfg)
+		}
+		if cfg.Vars[0].Reference != "op://Example/Service/token" || cfg.Vars[0].FieldFallbacks[0] != "credential" {
+			t.Errorf("Expected reference fields to be parsed, got %+v", cfg.Vars[0])
+		}
+		if cfg.Environments["prod"].Vars[0].Value != "us" {
+			t.Errorf("Expected environment vars to be parsed, got %+v", cfg.Environments)
+		}
+	}
+
+	invalid := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"syntax", "vars: [\n", "Invalid YAML format"},
+		{"validation", "vars:\n  - name: lower\n    value: x\n", "env.vars[0]"},
+	}
+	for _, tt := range invalid {
+		path := filepath.Join(dir, tt.name+".yaml")
+		if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+		if _, err := Load(path); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Expected %s error containing %q, got %v", tt.name, tt.want, err)
+		}
+	}
+}
+
+func TestConfig_WithPrefix(t *testing.T) {
+	cfg := &Config{Vars: []Variable{
+		{Name: "DB_PASSWORD", Reference: "op://Example/Service/password"},
+		{Name: "DB_REPLICA", Reference: "op://Example/Replica/password", RequiredIf: "DB_PASSWORD"},
+	}}
+
+	prefixed, err := cfg.WithPrefix("SERVICE_A_")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if prefixed.Vars[0].Name != "SERVICE_A_DB_PASSWORD" || prefixed.Vars[1].RequiredIf != "SERVICE_A_DB_PASSWORD" {
+		t.Errorf("Expected names and requiredIf to be prefixed, got %+v", prefixed.Vars)
+	}
+	if cfg.Vars[0].Name != "DB_PASSWORD" {
+		t.Errorf("Expected original config to be unchanged, got %q", cfg.Vars[0].Name)
+	}
+
+	if _, err := cfg.WithPrefix("1_"); err == nil {
+		t.Error("Expected error for prefix producing an invalid name")
+	}
+
+	duplicate := &Config{Vars: []Variable{{Name: "TOKEN", Value: "a"}, {Name: "TOKEN", Value: "b"}}}
+	if _, err := duplicate.WithPrefix("APP_"); err == nil || !strings.Contains(err.Error(), "collides") {
+		t.Errorf("Expected collision error, got %v", err)
+	}
+}
+
+func TestPrefixFromPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"service-a.json", "SERVICE_A_"},
+		{"/etc/opnix/billing.api.yaml", "BILLING_API_"},
+		{"worker", "WORKER_"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := PrefixFromPath(tt.path); got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParse_Version(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		wantErr string
+	}{
+		{name: "undeclared", raw: `{"vars":[{"name":"A","value":"1"}]}`},
+		{name: "current with unknown fields", raw: `{"version":1,"futureField":true,"vars":[{"name":"A","value":"1","futureOption":"x"}]}`},
+		{name: "newer", raw: `{"version":2,"vars":[{"name":"A","value":"1"}]}`, wantErr: "requires schema version 2, but this opnix only supports up to version 1"},
+		{name: "newer with invalid vars", raw: `{"version":3,"vars":[]}`, wantErr: "requires schema version 3"},
+		{name: "negative", raw: `{"version":-1,"vars":[{"name":"A","value":"1"}]}`, wantErr: "cannot be negative"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseString(tt.raw)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestValidate_Files(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    string
+		wantErr string
+	}{
+		{name: "group readable", mode: "0640"},
+		{name: "default", mode: ""},
+		{name: "not octal", mode: "rw-r-----", wantErr: "3-4 digit octal"},
+		{name: "world writable", mode: "0666", wantErr: "world write"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				Vars:  []Variable{{Name: "A", Value: "1"}},
+				Files: map[string]FileOptions{"/run/app/app.env": {Group: "app", Mode: tt.mode}},
+			}
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestConfig_FileOptionsFor(t *testing.T) {
+	cfg := &Config{Files: map[string]FileOptions{"/run/app/../app/app.env": {Group: "app", Mode: "0640"}}}
+
+	options := cfg.FileOptionsFor("/run/app/app.env")
+	if options.Group != "app" || options.FileMode() != 0640 {
+		t.Errorf("Expected the options of the cleaned path, got %+v", options)
+	}
+	if mode := cfg.FileOptionsFor("/run/other.env").FileMode(); mode != 0600 {
+		t.Errorf("Expected 0600 for an unconfigured path, got %04o", mode)
+	}
+}
+
+func TestConfig_ExpandEnv(t *testing.T) {
+	t.Setenv("OPNIX_TEST_ENVIRONMENT", "Staging")
+	cfg, err := ParseString(`{"vars":[{"name":"TOKEN","reference":"op://App-${OPNIX_TEST_ENVIRONMENT}/Item/token"}],
+		"environments":{"prod":{"vars":[{"name":"PASSWORD","reference":"op://$OPNIX_TEST_ENVIRONMENT/Item/pass$$word"}]}}}`)
+	if err != nil {
+		t.Fatalf("Unexpected parse error: %v", err)
+	}
+	if err := cfg.ExpandEnv("config.json", true); err != nil {
+		t.Fatalf("Unexpected expand error: %v", err)
+	}
+	if cfg.Vars[0].Reference != "op://App-Staging/Item/token" {
+		t.Errorf("Expected expanded reference, got %q", cfg.Vars[0].Reference)
+	}
+	if got := cfg.Environments["prod"].Vars[0].Reference; got != "op://Staging/Item/pass$word" {
+		t.Errorf("Expected expanded environment reference, got %q", got)
+	}
+
+	cfg, err = ParseString(`{"vars":[{"name":"TOKEN","reference":"op://App-${OPNIX_TEST_UNSET}/Item/token"}]}`)
+	if err != nil {
+		t.Fatalf("Unexpected parse error: %v", err)
+	}
+	if err := cfg.ExpandEnv("config.json", true); err == nil || !strings.Contains(err.Error(), "OPNIX_TEST_UNSET") {
+		t.Errorf("Expected strict expansion to report the unset variable, got %v", err)
+	}
+	if err := cfg.ExpandEnv("config.json", false); err != nil {
+		t.Errorf("Unexpected error expanding without strict mode: %v", err)
+	}
+}
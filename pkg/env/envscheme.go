@@ -0,0 +1,159 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/brizzbuzz/opnix/internal/errors"
+)
+
+// EnvScheme prefixes references read from a local dotenv file or the process
+// environment instead of 1Password, as in env://DATABASE_URL
+const EnvScheme = "env://"
+
+// IsEnvReference reports whether reference uses the env:// scheme
+func IsEnvReference(reference string) bool {
+	return strings.HasPrefix(reference, EnvScheme)
+}
+
+// EnvResolver resolves env://NAME references from a dotenv file's values,
+// falling back to the process environment, for secrets that have not been
+// migrated to 1Password yet
+type EnvResolver struct {
+	values    map[string]string
+	lookupEnv func(string) (string, bool)
+}
+
+// NewEnvResolver resolves env:// references from values, then from the
+// process environment. values may be nil.
+func NewEnvResolver(values map[string]string) *EnvResolver {
+	return &EnvResolver{values: values, lookupEnv: os.LookupEnv}
+}
+
+// ResolveSecret returns the value of the variable named by reference
+func (r *EnvResolver) ResolveSecret(reference string) (string, error) {
+	name := strings.TrimPrefix(reference, EnvScheme)
+	if value, ok := r.values[name]; ok {
+		return value, nil
+	}
+	if value, ok := r.lookupEnv(name); ok {
+		return value, nil
+	}
+	return "", &errors.OpnixError{
+		Operation: "Resolving secret from the local environment",
+		Component: "environment variable resolution",
+		Issue:     fmt.Sprintf("Variable '%s' not found in the env file or the process environment", name),
+		Suggestions: []string{
+			"Add the variable to the file passed with -env-file or export it",
+			"Or move the secret to 1Password and use an op:// reference",
+		},
+		Kind: errors.KindNotFound,
+	}
+}
+
+// ResolveSecretContext is like ResolveSecret but fails once ctx is cancelled
+func (r *EnvResolver) ResolveSecretContext(ctx context.Context, reference string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return r.ResolveSecret(reference)
+}
+
+// ResolveAll looks up every reference in the local environment
+func (r *EnvResolver) ResolveAll(ctx context.Context, references []string) (map[string]string, map[string]error, error) {
+	return ResolveEach(ctx, references, r.ResolveSecretContext)
+}
+
+// SchemeResolver sends env:// references to a local resolver and every
+// other reference to the 1Password resolver, so a configuration can mix
+// both while secrets are migrated
+type SchemeResolver struct {
+	onePassword Resolver
+	local       Resolver
+}
+
+// NewSchemeResolver routes env:// references to local and the rest to onePassword
+func NewSchemeResolver(onePassword, local Resolver) *SchemeResolver {
+	return &SchemeResolver{onePassword: onePassword, local: local}
+}
+
+func (s *SchemeResolver) resolverFor(reference string) Resolver {
+	if IsEnvReference(reference) {
+		return s.local
+	}
+	return s.onePassword
+}
+
+// ResolveSecret resolves reference with the resolver for its scheme
+func (s *SchemeResolver) ResolveSecret(reference string) (string, error) {
+	return s.resolverFor(reference).ResolveSecret(reference)
+}
+
+// ResolveSecretContext resolves reference with the resolver for its scheme
+func (s *SchemeResolver) ResolveSecretContext(ctx context.Context, reference string) (string, error) {
+	return WithContext(s.resolverFor(reference)).ResolveSecretContext(ctx, reference)
+}
+
+// ResolveAll splits references by scheme and resolves each group as a batch
+func (s *SchemeResolver) ResolveAll(ctx context.Context, references []string) (map[string]string, map[string]error, error) {
+	var local, remote []string
+	for _, reference := range references {
+		if IsEnvReference(reference) {
+			local = append(local, reference)
+		} else {
+			remote = append(remote, reference)
+		}
+	}
+
+	values := make(map[string]string, len(references))
+	errs := make(map[string]error)
+	for _, group := range []struct {
+		resolver   Resolver
+		references []string
+	}{{s.local, local}, {s.onePassword, remote}} {
+		if len(group.references) == 0 {
+			continue
+		}
+		resolved, failed, err := WithContext(group.resolver).ResolveAll(ctx, group.references)
+		if err != nil {
+			return nil, nil, err
+		}
+		for reference, value := range resolved {
+			values[reference] = value
+		}
+		for reference, err := range failed {
+			errs[reference] = err
+		}
+	}
+	return values, errs, nil
+}
+
+// Precheck sends the non-env:// references to the 1Password resolver. env://
+// references are read locally and never prechecked.
+func (s *SchemeResolver) Precheck(references []string) ([]string, error) {
+	var remote []string
+	for _, reference := range references {
+		if !IsEnvReference(reference) {
+			remote = append(remote, reference)
+		}
+	}
+	if len(remote) == 0 {
+		return nil, nil
+	}
+	prechecker, err := asPrechecker(s.onePassword)
+	if err != nil {
+		return nil, err
+	}
+	return prechecker.Precheck(remote)
+}
+
+// AccessibleVaults delegates to the 1Password resolver when it can list vaults
+func (s *SchemeResolver) AccessibleVaults() ([]string, error) {
+	lister, err := asVaultLister(s.onePassword)
+	if err != nil {
+		return nil, err
+	}
+	return lister.AccessibleVaults()
+}
@@ -0,0 +1,116 @@
+package env
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestEnvResolver(t *testing.T) {
+	resolver := NewEnvResolver(map[string]string{"DATABASE_URL": "postgres://localhost/app"})
+	resolver.lookupEnv = func(name string) (string, bool) {
+		if name == "LEGACY_TOKEN" {
+			return "from-process", true
+		}
+		return "", false
+	}
+
+	if value, err := resolver.ResolveSecret("env://DATABASE_URL"); err != nil || value != "postgres://localhost/app" {
+		t.Errorf("Expected the env file value, got %q (%v)", value, err)
+	}
+	if value, err := resolver.ResolveSecret("env://LEGACY_TOKEN"); err != nil || value != "from-process" {
+		t.Errorf("Expected the process environment value, got %q (%v)", value, err)
+	}
+	if _, err := resolver.ResolveSecret("env://UNSET"); err == nil || !strings.Contains(err.Error(), "'UNSET' not found") {
+		t.Errorf("Expected a not found error, got %v", err)
+	}
+}
+
+func TestSchemeResolver(t *testing.T) {
+	onePassword := &fakeResolver{secrets: map[string]string{"op://Example/Service/password": "hunter2"}}
+	local := NewEnvResolver(map[string]string{"DATABASE_URL": "postgres://localhost/app"})
+	resolver := NewSchemeResolver(onePassword, local)
+
+	values, errs, err := resolver.ResolveAll(context.Background(), []string{
+		"op://Example/Service/password",
+		"env://DATABASE_URL",
+		"env://MISSING_FOR_TEST",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if values["op://Example/Service/password"] != "hunter2" || values["env://DATABASE_URL"] != "postgres://localhost/app" {
+		t.Errorf("Expected both schemes to resolve, got %v", values)
+	}
+	if _, ok := errs["env://MISSING_FOR_TEST"]; !ok || len(errs) != 1 {
+		t.Errorf("Expected only the missing env reference to fail, got %v", errs)
+	}
+}
+
+func TestProcessor_EnvReferences(t *testing.T) {
+	cfg, err := ParseString(`{"defaultVault":"Example","vars":[
+		{"name":"PASSWORD","reference":"Service/password"},
+		{"name":"DATABASE_URL","reference":"env://DATABASE_URL"}
+	]}`)
+	if err != nil {
+		t.Fatalf("Unexpected parse error: %v", err)
+	}
+	if err := cfg.QualifyReferences(""); err != nil {
+		t.Fatalf("Unexpected qualify error: %v", err)
+	}
+	if cfg.Vars[1].Reference != "env://DATABASE_URL" {
+		t.Errorf("Expected env:// references to stay unqualified, got %q", cfg.Vars[1].Reference)
+	}
+
+	onePassword := &fakeResolver{secrets: map[string]string{"op://Example/Service/password": "hunter2"}}
+	processor := NewProcessor(NewSchemeResolver(onePassword, NewEnvResolver(map[string]string{"DATABASE_URL": "postgres://localhost/app"})))
+	processor.AllowedVaults = []string{"Example"}
+	result, err := processor.Process(cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Values["DATABASE_URL"] != "postgres://localhost/app" || result.Values["PASSWORD"] != "hunter2" {
+		t.Errorf("Unexpected values %v", result.Values)
+	}
+
+	for _, raw := range []string{
+		`{"vars":[{"name":"TOKEN","reference":"env://"}]}`,
+		`{"vars":[{"name":"TOKEN","reference":"env://BAD-NAME"}]}`,
+		`{"accounts":{"work":{"tokenEnv":"WORK_TOKEN"}},"vars":[{"name":"TOKEN","reference":"env://TOKEN","account":"work"}]}`,
+	} {
+		if _, err := ParseString(raw); err == nil {
+			t.Errorf("Expected validation error for %s", raw)
+		}
+	}
+}
+
+func TestProcessor_EnvReferencesPrecheckAndAccess(t *testing.T) {
+	cfg, err := ParseString(`{"vars":[
+		{"name":"PASSWORD","reference":"op://Example/Service/password"},
+		{"name":"DATABASE_URL","reference":"env://DATABASE_URL"}
+	]}`)
+	if err != nil {
+		t.Fatalf("Unexpected parse error: %v", err)
+	}
+
+	onePassword := &vaultListingResolver{
+		fakeResolver: fakeResolver{secrets: map[string]string{"op://Example/Service/password": "hunter2"}},
+		vaults:       []string{"Example"},
+	}
+	processor := NewProcessor(NewSchemeResolver(onePassword, NewEnvResolver(nil)))
+	if err := processor.PrecheckConfig(cfg); err != nil {
+		t.Errorf("Unexpected precheck error: %v", err)
+	}
+	if err := processor.CheckAccess(cfg); err != nil {
+		t.Errorf("Unexpected access error: %v", err)
+	}
+
+	onePassword.secrets = nil
+	onePassword.vaults = nil
+	if err := processor.PrecheckConfig(cfg); err == nil || !strings.Contains(err.Error(), "op://Example/Service/password") {
+		t.Errorf("Expected precheck to report the missing op:// reference, got %v", err)
+	}
+	if err := processor.CheckAccess(cfg); err == nil || !strings.Contains(err.Error(), "Example") {
+		t.Errorf("Expected access check to report the Example vault, got %v", err)
+	}
+}
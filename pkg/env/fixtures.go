@@ -0,0 +1,90 @@
+package env
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/brizzbuzz/opnix/internal/errors"
+	"github.com/brizzbuzz/opnix/internal/validation"
+)
+
+// FixtureResolver resolves references from a fixed map instead of
+// 1Password, so tooling built on opnix can be tested without an account
+type FixtureResolver struct {
+	values map[string]string
+}
+
+// NewFixtureResolver resolves references from values, keyed by reference
+func NewFixtureResolver(values map[string]string) *FixtureResolver {
+	return &FixtureResolver{values: values}
+}
+
+// LoadFixtures reads a JSON (or JSONC) object mapping references to values
+func LoadFixtures(path string) (*FixtureResolver, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.FileOperationError(
+			"Loading fixtures",
+			path,
+			"Failed to read fixtures file",
+			err,
+		)
+	}
+
+	var values map[string]string
+	if err := json.Unmarshal(stripJSONComments(data), &values); err != nil {
+		return nil, errors.ConfigError(
+			"Parsing fixtures",
+			fmt.Sprintf("Fixtures file %s must be a JSON object of reference to string value", path),
+			err,
+		)
+	}
+	return NewFixtureResolver(values), nil
+}
+
+// ResolveSecret returns the fixture value for reference
+func (f *FixtureResolver) ResolveSecret(reference string) (string, error) {
+	if value, ok := f.values[reference]; ok {
+		return value, nil
+	}
+	return "", errors.OnePasswordError(
+		"Resolving secret from fixtures",
+		fmt.Sprintf("Reference '%s' not found in fixtures", reference),
+		nil,
+	).WithKind(errors.KindNotFound)
+}
+
+// ResolveSecretContext is like ResolveSecret but fails once ctx is cancelled
+func (f *FixtureResolver) ResolveSecretContext(ctx context.Context, reference string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return f.ResolveSecret(reference)
+}
+
+// ResolveAll looks up every reference in the fixtures
+func (f *FixtureResolver) ResolveAll(ctx context.Context, references []string) (map[string]string, map[string]error, error) {
+	return ResolveEach(ctx, references, f.ResolveSecretContext)
+}
+
+// Precheck reports the references missing from the fixtures
+func (f *FixtureResolver) Precheck(references []string) ([]string, error) {
+	var missing []string
+	for _, reference := range references {
+		if _, ok := f.values[reference]; !ok {
+			missing = append(missing, reference)
+		}
+	}
+	return missing, nil
+}
+
+// AccessibleVaults lists the vaults named by the fixture references
+func (f *FixtureResolver) AccessibleVaults() ([]string, error) {
+	vaults := make([]string, 0, len(f.values))
+	for reference := range f.values {
+		vaults = append(vaults, validation.ReferenceVault(reference))
+	}
+	return uniqueSortedStrings(vaults), nil
+}
@@ -0,0 +1,57 @@
+package env
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadFixtures(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fixtures.json")
+	content := `{
+  // Values used by CI instead of real secrets
+  "op://Example/Service/password": "test-password",
+  "op://Other/Service/token": "test-token",
+}`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write fixtures: %v", err)
+	}
+
+	fixtures, err := LoadFixtures(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	value, err := fixtures.ResolveSecret("op://Example/Service/password")
+	if err != nil || value != "test-password" {
+		t.Errorf("Expected fixture value, got %q (%v)", value, err)
+	}
+	if _, err := fixtures.ResolveSecret("op://Example/Service/missing"); err == nil || !strings.Contains(err.Error(), "not found in fixtures") {
+		t.Errorf("Expected not-found error, got %v", err)
+	}
+
+	missing, err := fixtures.Precheck([]string{"op://Example/Service/password", "op://Example/Service/missing"})
+	if err != nil || len(missing) != 1 || missing[0] != "op://Example/Service/missing" {
+		t.Errorf("Expected one missing reference, got %v (%v)", missing, err)
+	}
+
+	vaults, err := fixtures.AccessibleVaults()
+	if err != nil || strings.Join(vaults, ",") != "Example,Other" {
+		t.Errorf("Expected fixture vaults, got %v (%v)", vaults, err)
+	}
+}
+
+func TestLoadFixtures_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fixtures.json")
+	if err := os.WriteFile(path, []byte(`{"op://Example/Service/port": 5432}`), 0600); err != nil {
+		t.Fatalf("Failed to write fixtures: %v", err)
+	}
+
+	if _, err := LoadFixtures(path); err == nil {
+		t.Error("Expected error for non-string fixture value")
+	}
+	if _, err := LoadFixtures(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("Expected error for missing fixtures file")
+	}
+}
@@ -0,0 +1,109 @@
+package env
+
+// stripJSONComments converts JSONC input into strict JSON by blanking out
+// `//` and `/* */` comments as well as trailing commas. Removed bytes are
+// replaced with spaces (newlines are kept) so that offsets reported by
+// encoding/json still point at the original location in the file.
+func stripJSONComments(data []byte) []byte {
+	out := make([]byte, len(data))
+	copy(out, data)
+
+	inString := false
+	escaped := false
+
+	for i := 0; i < len(out); i++ {
+		c := out[i]
+
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+
+		switch {
+		case c == '"':
+			inString = true
+		case c == '/' && i+1 < len(out) && out[i+1] == '/':
+			for ; i < len(out) && out[i] != '\n'; i++ {
+				out[i] = ' '
+			}
+		case c == '/' && i+1 < len(out) && out[i+1] == '*':
+			out[i], out[i+1] = ' ', ' '
+			for i += 2; i < len(out); i++ {
+				if out[i] == '*' && i+1 < len(out) && out[i+1] == '/' {
+					out[i], out[i+1] = ' ', ' '
+					i++
+					break
+				}
+				if out[i] != '\n' {
+					out[i] = ' '
+				}
+			}
+		}
+	}
+
+	return stripTrailingCommas(out)
+}
+
+// stripTrailingCommas blanks commas that directly precede a closing bracket
+func stripTrailingCommas(data []byte) []byte {
+	inString := false
+	escaped := false
+
+	for i, c := range data {
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+
+		if c == '"' {
+			inString = true
+			continue
+		}
+
+		if c != ',' {
+			continue
+		}
+
+		j := i + 1
+		for j < len(data) && isJSONWhitespace(data[j]) {
+			j++
+		}
+		if j < len(data) && (data[j] == '}' || data[j] == ']') {
+			data[i] = ' '
+		}
+	}
+
+	return data
+}
+
+func isJSONWhitespace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// jsonErrorPosition converts a byte offset into a 1-based line and column
+func jsonErrorPosition(data []byte, offset int64) (line, column int) {
+	line, column = 1, 1
+	for i := int64(0); i < offset && i < int64(len(data)); i++ {
+		if data[i] == '\n' {
+			line++
+			column = 1
+			continue
+		}
+		column++
+	}
+	return line, column
+}
@@ -0,0 +1,81 @@
+package env
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStripJSONComments(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "line comment",
+			input:    "{\"a\": 1} // trailing\n",
+			expected: "{\"a\": 1}            \n",
+		},
+		{
+			name:     "block comment keeps newlines",
+			input:    "{/* one\ntwo */\"a\": 1}",
+			expected: "{      \n      \"a\": 1}",
+		},
+		{
+			name:     "comment markers inside strings are preserved",
+			input:    `{"url": "op://Vault/Item/field", "note": "/* keep */"}`,
+			expected: `{"url": "op://Vault/Item/field", "note": "/* keep */"}`,
+		},
+		{
+			name:     "escaped quotes inside strings",
+			input:    `{"a": "say \"//hi\""}`,
+			expected: `{"a": "say \"//hi\""}`,
+		},
+		{
+			name:     "trailing commas",
+			input:    "{\"vars\": [1, 2,\n], }",
+			expected: "{\"vars\": [1, 2 \n]  }",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := string(stripJSONComments([]byte(tt.input)))
+			if got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+			if len(got) != len(tt.input) {
+				t.Errorf("Expected length %d to be preserved, got %d", len(tt.input), len(got))
+			}
+		})
+	}
+}
+
+func TestParse_JSONC(t *testing.T) {
+	raw := `{
+  // API credentials for local development
+  "vars": [
+    {"name": "API_TOKEN", "reference": "op://Vault/API/token"}, /* primary */
+  ],
+}`
+
+	cfg, err := Parse([]byte(raw))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(cfg.Vars) != 1 || cfg.Vars[0].Name != "API_TOKEN" {
+		t.Errorf("Expected API_TOKEN variable, got %+v", cfg.Vars)
+	}
+}
+
+func TestParse_SyntaxErrorPosition(t *testing.T) {
+	raw := "{\n  // comment\n  \"vars\": [}\n}"
+
+	_, err := Parse([]byte(raw))
+	if err == nil {
+		t.Fatal("Expected error but got none")
+	}
+	if !strings.Contains(err.Error(), "line 3, column 12") {
+		t.Errorf("Expected error to report line 3, column 12, got:\n%v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package env
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/brizzbuzz/opnix/internal/errors"
+)
+
+// Prechecker is implemented by resolvers that can report missing
+// references up front without resolving each one individually
+type Prechecker interface {
+	Precheck(references []string) (missing []string, err error)
+}
+
+// PrecheckReferences verifies that every reference exists before resolution
+// begins so that all missing references can be reported in one error
+func PrecheckReferences(prechecker Prechecker, references []string) error {
+	unique := uniqueSortedStrings(references)
+	if len(unique) == 0 {
+		return nil
+	}
+
+	missing, err := prechecker.Precheck(unique)
+	if err != nil {
+		return err
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	missing = uniqueSortedStrings(missing)
+	return &errors.OpnixError{
+		Operation: "Prechecking 1Password references",
+		Component: "1Password integration",
+		Issue:     fmt.Sprintf("%d of %d references not found", len(missing), len(unique)),
+		Context:   fmt.Sprintf("Missing: %s", strings.Join(missing, ", ")),
+		Suggestions: []string{
+			"Verify the 1Password reference format: op://Vault/Item/field",
+			"Check that the vault, item, and field exist in 1Password",
+			"Ensure the service account has access to the specified vaults",
+		},
+		Kind: errors.KindNotFound,
+	}
+}
+
+// asPrechecker returns resolver as a Prechecker, or an error when prechecks
+// are unsupported
+func asPrechecker(resolver interface{}) (Prechecker, error) {
+	prechecker, ok := resolver.(Prechecker)
+	if !ok {
+		return nil, errors.ConfigError(
+			"Prechecking 1Password references",
+			"The configured resolver does not support reference prechecks",
+			nil,
+		)
+	}
+	return prechecker, nil
+}
+
+func uniqueSortedStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	var unique []string
+	for _, value := range values {
+		if value == "" || seen[value] {
+			continue
+		}
+		seen[value] = true
+		unique = append(unique, value)
+	}
+	sort.Strings(unique)
+	return unique
+}
@@ -0,0 +1,81 @@
+package env
+
+import (
+	"strings"
+	"testing"
+)
+
+// noPrecheckResolver resolves nothing and does not implement Prechecker
+type noPrecheckResolver struct{}
+
+func (noPrecheckResolver) ResolveSecret(string) (string, error) {
+	return "", nil
+}
+
+func TestPrecheckReferences(t *testing.T) {
+	resolver := &fakeResolver{
+		secrets: map[string]string{
+			"op://Vault/Item/present": "value",
+		},
+	}
+
+	tests := []struct {
+		name       string
+		resolver   Prechecker
+		references []string
+		wantErr    bool
+		contains   []string
+	}{
+		{
+			name:       "all references present",
+			resolver:   resolver,
+			references: []string{"op://Vault/Item/present", "op://Vault/Item/present"},
+		},
+		{
+			name:       "missing references reported together",
+			resolver:   resolver,
+			references: []string{"op://Vault/Item/b", "op://Vault/Item/present", "op://Vault/Item/a"},
+			wantErr:    true,
+			contains:   []string{"2 of 3 references not found", "op://Vault/Item/a, op://Vault/Item/b"},
+		},
+		{
+			name:     "no references",
+			resolver: resolver,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := PrecheckReferences(tt.resolver, tt.references)
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("Expected error but got none")
+			}
+			for _, expected := range tt.contains {
+				if !strings.Contains(err.Error(), expected) {
+					t.Errorf("Expected error to contain %q, got:\n%v", expected, err)
+				}
+			}
+		})
+	}
+}
+
+func TestProcessor_PrecheckUnsupported(t *testing.T) {
+	cfg, err := ParseString(`{"vars":[{"name":"TOKEN","reference":"op://Vault/Item/present"}]}`)
+	if err != nil {
+		t.Fatalf("Unexpected parse error: %v", err)
+	}
+
+	processor := NewProcessor(noPrecheckResolver{})
+	if err := processor.PrecheckConfig(cfg); err == nil || !strings.Contains(err.Error(), "does not support reference prechecks") {
+		t.Errorf("Expected an unsupported precheck error, got %v", err)
+	}
+	if err := processor.CheckAccess(cfg); err == nil || !strings.Contains(err.Error(), "does not support listing vaults") {
+		t.Errorf("Expected an unsupported vault listing error, got %v", err)
+	}
+}
@@ -0,0 +1,572 @@
+// Package env resolves opnix environment configurations into concrete values.
+// It powers the `opnix env` command and can be embedded by other Go programs
+// that supply their own Resolver implementation.
+package env
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/brizzbuzz/opnix/internal/errors"
+	"github.com/brizzbuzz/opnix/internal/validation"
+)
+
+// Resolver resolves a single 1Password reference to its secret value
+type Resolver interface {
+	ResolveSecret(reference string) (string, error)
+}
+
+// Processor resolves environment configurations into concrete values
+type Processor struct {
+	resolver Resolver
+
+	// Accounts holds resolvers for named accounts referenced by variables
+	Accounts map[string]Resolver
+	// ErrorOnEmpty rejects references that resolve to an empty value
+	ErrorOnEmpty bool
+	// TrimMode sets how values are trimmed when a variable does not set
+	// PreserveWhitespace; the zero value trims all surrounding whitespace
+	TrimMode TrimMode
+	// NormalizeNewlines converts CRLF and lone CR line endings to LF after
+	// trimming, for values pasted from Windows
+	NormalizeNewlines bool
+	// Required forces the named variables to resolve even when marked optional
+	Required map[string]bool
+	// AllowedVaults restricts references to the listed vaults when non-empty
+	AllowedVaults []string
+	// MissingPlaceholder, when non-empty, replaces the value of any reference
+	// that fails to resolve instead of failing or skipping the variable.
+	// Authentication failures and cancellation still fail the run.
+	MissingPlaceholder string
+	// CollectFailures records required variables that fail to resolve in
+	// Result.Failed and keeps going, so every variable gets an outcome.
+	// Cancellation still stops the run.
+	CollectFailures bool
+	// MaxValueSize, when positive, fails any reference whose resolved value
+	// is larger than this many bytes, before selectors or trimming apply
+	MaxValueSize int
+}
+
+// Skipped records an optional variable that failed to resolve
+type Skipped struct {
+	Name string
+	Err  error
+}
+
+// Result holds resolved values and the optional variables that were skipped
+type Result struct {
+	Values  map[string]string
+	Skipped []Skipped
+	// Placeholders records variables whose value is MissingPlaceholder
+	// because their reference failed to resolve
+	Placeholders []Skipped
+	// Failed records required variables that failed to resolve when
+	// CollectFailures is set
+	Failed []Skipped
+	// Sources maps each reference-backed variable to the reference that
+	// supplied its value, which is a fallback field when the primary failed
+	Sources map[string]string
+}
+
+// Resolve resolves cfg with resolver using default processing options
+func Resolve(cfg *Config, resolver Resolver) (map[string]string, []Skipped, error) {
+	result, err := NewProcessor(resolver).Process(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return result.Values, result.Skipped, nil
+}
+
+// NewProcessor creates a processor that resolves references with resolver
+func NewProcessor(resolver Resolver) *Processor {
+	return &Processor{
+		resolver: resolver,
+		Accounts: make(map[string]Resolver),
+		Required: make(map[string]bool),
+	}
+}
+
+// Process resolves every variable in cfg, skipping optional variables that fail
+func (p *Processor) Process(cfg *Config) (*Result, error) {
+	return p.ProcessContext(context.Background(), cfg)
+}
+
+// ProcessContext is like Process but stops before resolving the next variable
+// once ctx is cancelled, returning the context's error
+func (p *Processor) ProcessContext(ctx context.Context, cfg *Config) (*Result, error) {
+	if cfg == nil {
+		return nil, errors.ConfigError(
+			"Processing environment configuration",
+			"Environment configuration cannot be nil",
+			nil,
+		)
+	}
+
+	if err := p.checkRequiredDefined(cfg); err != nil {
+		return nil, err
+	}
+
+	if err := p.checkAllowedVaults(cfg); err != nil {
+		return nil, err
+	}
+
+	if err := checkRequiredIfDefined(cfg); err != nil {
+		return nil, err
+	}
+
+	result := &Result{
+		Values:  make(map[string]string),
+		Skipped: []Skipped{},
+		Sources: make(map[string]string),
+	}
+
+	for i, variable := range cfg.Vars {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		value, source, err := p.resolveVariable(ctx, variable, i)
+		var missing *missingReference
+		if stderrors.As(err, &missing) {
+			result.Values[variable.Name] = p.MissingPlaceholder
+			result.Placeholders = append(result.Placeholders, Skipped{
+				Name: variable.Name,
+				Err:  missing.err,
+			})
+			continue
+		}
+		if err != nil {
+			if p.skippable(cfg, variable) {
+				result.Skipped = append(result.Skipped, Skipped{
+					Name: variable.Name,
+					Err:  err,
+				})
+				continue
+			}
+			if p.CollectFailures && ctx.Err() == nil {
+				result.Failed = append(result.Failed, Skipped{
+					Name: variable.Name,
+					Err:  err,
+				})
+				continue
+			}
+			return nil, err
+		}
+		result.Values[variable.Name] = value
+		if source != "" {
+			result.Sources[variable.Name] = source
+		}
+	}
+
+	if failures := requiredIfFailures(cfg, result); len(failures) > 0 {
+		if !p.CollectFailures {
+			return nil, failures[0].Err
+		}
+		failed := make(map[string]bool, len(failures))
+		for _, failure := range failures {
+			failed[failure.Name] = true
+		}
+		skipped := result.Skipped[:0]
+		for _, entry := range result.Skipped {
+			if !failed[entry.Name] {
+				skipped = append(skipped, entry)
+			}
+		}
+		result.Skipped = skipped
+		result.Failed = append(result.Failed, failures...)
+	}
+
+	return result, nil
+}
+
+// skippable reports whether a failure to resolve variable may be skipped.
+// Variables with requiredIf are skippable until checkRequiredIf runs.
+func (p *Processor) skippable(cfg *Config, variable Variable) bool {
+	if variable.Required || p.Required[variable.Name] {
+		return false
+	}
+	return cfg.IsOptional(variable) || variable.RequiredIf != ""
+}
+
+// checkRequiredIfDefined ensures every requiredIf names a defined variable
+func checkRequiredIfDefined(cfg *Config) error {
+	defined := make(map[string]bool, len(cfg.Vars))
+	for _, variable := range cfg.Vars {
+		defined[variable.Name] = true
+	}
+
+	for i, variable := range cfg.Vars {
+		if variable.RequiredIf != "" && !defined[variable.RequiredIf] {
+			return errors.ConfigValidationError(
+				fmt.Sprintf("env.vars[%d].requiredIf", i),
+				variable.RequiredIf,
+				"requiredIf names a variable that is not defined in the environment configuration",
+				[]string{
+					"Check the spelling of the variable name",
+					"Add the variable to the 'vars' array",
+				},
+			)
+		}
+	}
+	return nil
+}
+
+// requiredIfFailures returns the skipped variables whose requiredIf variable
+// resolved to a non-empty value, each with the error explaining why it was
+// required
+func requiredIfFailures(cfg *Config, result *Result) []Skipped {
+	conditions := make(map[string]string, len(cfg.Vars))
+	for _, variable := range cfg.Vars {
+		if variable.RequiredIf != "" {
+			conditions[variable.Name] = variable.RequiredIf
+		}
+	}
+
+	var failures []Skipped
+	for _, skipped := range result.Skipped {
+		condition, ok := conditions[skipped.Name]
+		if !ok || result.Values[condition] == "" {
+			continue
+		}
+		failures = append(failures, Skipped{
+			Name: skipped.Name,
+			Err: &errors.OpnixError{
+				Operation: fmt.Sprintf("Resolving secret for env var %s", skipped.Name),
+				Component: "environment variable resolution",
+				Issue:     fmt.Sprintf("%s is required because %s is set, but it could not be resolved", skipped.Name, condition),
+				Cause:     skipped.Err,
+				Suggestions: []string{
+					fmt.Sprintf("Check that the 1Password reference for %s exists", skipped.Name),
+					fmt.Sprintf("Or unset %s if %s is not needed", condition, skipped.Name),
+				},
+			},
+		})
+	}
+	return failures
+}
+
+// requiredReferences lists the references of variables that must resolve,
+// grouped by account. Variables with field fallbacks are left out when
+// skipFallbacks is set, since their primary field may legitimately be missing.
+// env:// references are read locally and never checked against 1Password.
+func (p *Processor) requiredReferences(cfg *Config, skipFallbacks bool) map[string][]string {
+	references := make(map[string][]string)
+	for _, variable := range cfg.Vars {
+		if variable.Reference == "" || IsEnvReference(variable.Reference) {
+			continue
+		}
+		if skipFallbacks && len(variable.FieldFallbacks) > 0 {
+			continue
+		}
+		if p.skippable(cfg, variable) {
+			continue
+		}
+		references[variable.Account] = append(references[variable.Account], validation.StripSelector(variable.LookupReference()))
+	}
+	return references
+}
+
+// PrecheckConfig verifies required references exist, checking each account separately
+func (p *Processor) PrecheckConfig(cfg *Config) error {
+	if err := p.checkAllowedVaults(cfg); err != nil {
+		return err
+	}
+
+	return p.forEachAccount(p.requiredReferences(cfg, true), "Prechecking references", func(resolver Resolver, references []string) error {
+		prechecker, err := asPrechecker(resolver)
+		if err != nil {
+			return err
+		}
+		return PrecheckReferences(prechecker, references)
+	})
+}
+
+// CheckAccess verifies each account's token can see every vault its required
+// references point at, before any of them are resolved
+func (p *Processor) CheckAccess(cfg *Config) error {
+	return p.forEachAccount(p.requiredReferences(cfg, false), "Checking vault access", func(resolver Resolver, references []string) error {
+		lister, err := asVaultLister(resolver)
+		if err != nil {
+			return err
+		}
+		return CheckVaultAccess(lister, references)
+	})
+}
+
+// forEachAccount runs check against the references of each account in name
+// order, naming non-default accounts in returned errors
+func (p *Processor) forEachAccount(references map[string][]string, operation string, check func(Resolver, []string) error) error {
+	accounts := make([]string, 0, len(references))
+	for account := range references {
+		accounts = append(accounts, account)
+	}
+	sort.Strings(accounts)
+
+	for _, account := range accounts {
+		resolver, err := p.resolverFor(account)
+		if err != nil {
+			return err
+		}
+
+		if err := check(resolver, references[account]); err != nil {
+			if account == "" {
+				return err
+			}
+			return errors.Wrap(err, fmt.Sprintf("%s for account %s", operation, account), "1Password integration")
+		}
+	}
+	return nil
+}
+
+// resolverFor returns the resolver for a named account, or the default resolver
+func (p *Processor) resolverFor(account string) (Resolver, error) {
+	if account == "" {
+		return p.resolver, nil
+	}
+
+	resolver, ok := p.Accounts[account]
+	if !ok {
+		return nil, errors.ConfigError(
+			fmt.Sprintf("Selecting 1Password account %s", account),
+			fmt.Sprintf("No client configured for account '%s'", account),
+			nil,
+		)
+	}
+	return resolver, nil
+}
+
+// checkRequiredDefined ensures every variable forced via -require exists in the config
+func (p *Processor) checkRequiredDefined(cfg *Config) error {
+	defined := make(map[string]bool, len(cfg.Vars))
+	for _, variable := range cfg.Vars {
+		defined[variable.Name] = true
+	}
+
+	var missing []string
+	for name := range p.Required {
+		if !defined[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	sort.Strings(missing)
+	return errors.ConfigValidationError(
+		"env.require",
+		strings.Join(missing, ", "),
+		"Required variables are not defined in the environment configuration",
+		[]string{
+			"Add the variables to the 'vars' array",
+			"Or remove them from the -require flags",
+		},
+	)
+}
+
+// checkAllowedVaults rejects any reference outside AllowedVaults, including
+// optional variables, before anything is resolved
+func (p *Processor) checkAllowedVaults(cfg *Config) error {
+	for i, variable := range cfg.Vars {
+		if variable.Reference == "" || IsEnvReference(variable.Reference) {
+			continue
+		}
+		field := fmt.Sprintf("env.vars[%d].reference", i)
+		if err := validation.ValidateAllowedVault(variable.Reference, field, p.AllowedVaults); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveFallbacks tries each fallback field on the variable's item after the
+// primary field failed, reporting every field tried if none resolve
+func (p *Processor) resolveFallbacks(ctx context.Context, resolver ContextResolver, variable Variable, operation string, primaryErr error) (string, string, error) {
+	err := primaryErr
+	for _, reference := range variable.FallbackReferences() {
+		var value string
+		value, err = resolver.ResolveSecretContext(ctx, validation.StripSelector(reference))
+		if err == nil {
+			return value, reference, nil
+		}
+		if errors.IsAuthError(err) {
+			break
+		}
+	}
+
+	fields := append([]string{variable.Field()}, variable.FieldFallbacks...)
+	return "", "", &errors.OpnixError{
+		Operation: operation,
+		Component: "environment variable resolution",
+		Issue:     fmt.Sprintf("None of the fields %s could be resolved", strings.Join(fields, ", ")),
+		Context:   fmt.Sprintf("Reference: %s", variable.Reference),
+		Cause:     err,
+		Suggestions: []string{
+			"Check the field labels on the item in 1Password",
+			"Add the item's actual field label to 'fieldFallbacks'",
+		},
+	}
+}
+
+// checkLength enforces the variable's minLength and maxLength, counted in
+// characters of the final (trimmed) value
+func checkLength(variable Variable, value string) error {
+	length := utf8.RuneCountInString(value)
+
+	var issue string
+	switch {
+	case variable.MinLength > 0 && length < variable.MinLength:
+		issue = fmt.Sprintf("Resolved value is %d characters, shorter than minLength %d", length, variable.MinLength)
+	case variable.MaxLength > 0 && length > variable.MaxLength:
+		issue = fmt.Sprintf("Resolved value is %d characters, longer than maxLength %d", length, variable.MaxLength)
+	default:
+		return nil
+	}
+
+	return errors.ConfigError(
+		fmt.Sprintf("Checking length of env var %s", variable.Name),
+		issue,
+		nil,
+	)
+}
+
+// missingReference reports a failed lookup that MissingPlaceholder stands in for
+type missingReference struct {
+	err error
+}
+
+func (m *missingReference) Error() string { return m.err.Error() }
+
+func (m *missingReference) Unwrap() error { return m.err }
+
+// placeholderFor marks a lookup failure for replacement by MissingPlaceholder,
+// leaving authentication failures and cancellation to fail the run
+func (p *Processor) placeholderFor(ctx context.Context, err error) error {
+	if p.MissingPlaceholder == "" || errors.IsAuthError(err) || ctx.Err() != nil {
+		return err
+	}
+	return &missingReference{err: err}
+}
+
+// finish applies trimming and newline normalization to a resolved value
+func (p *Processor) finish(variable Variable, value string) string {
+	value = variable.trim(value, p.TrimMode)
+	if p.NormalizeNewlines {
+		value = NormalizeNewlines(value)
+	}
+	return value
+}
+
+// resolveVariable returns the variable's value and, for references, the
+// reference that supplied it
+func (p *Processor) resolveVariable(ctx context.Context, variable Variable, index int) (string, string, error) {
+	if variable.Reference != "" {
+		resolver, err := p.resolverFor(variable.Account)
+		if err != nil {
+			return "", "", err
+		}
+
+		operation := fmt.Sprintf("Resolving secret for env var %s", variable.Name)
+		if variable.Account != "" {
+			operation = fmt.Sprintf("%s from account %s", operation, variable.Account)
+		}
+
+		lookup, selector, err := validation.ParseSelector(variable.LookupReference())
+		if err != nil {
+			return "", "", errors.ConfigError(operation, fmt.Sprintf("Invalid reference selector: %v", err), nil).WithKind(errors.KindInvalidReference)
+		}
+
+		if variable.NoCache {
+			ctx = WithoutCache(ctx)
+		}
+
+		// A per-variable timeout runs under ctx, so the global -timeout
+		// still wins when less of it remains
+		resolveCtx := ctx
+		if timeout := variable.ResolveTimeout(); timeout > 0 {
+			var cancel context.CancelFunc
+			resolveCtx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		source := variable.Reference
+		contextResolver := WithContext(resolver)
+		value, err := contextResolver.ResolveSecretContext(resolveCtx, lookup)
+		if err != nil && len(variable.FieldFallbacks) > 0 && !errors.IsAuthError(err) {
+			value, source, err = p.resolveFallbacks(resolveCtx, contextResolver, variable, operation, err)
+		} else if err != nil {
+			err = errors.WrapWithSuggestions(
+				err,
+				operation,
+				"environment variable resolution",
+				[]string{
+					fmt.Sprintf("Check that the 1Password reference '%s' exists", variable.Reference),
+					"Ensure the service account has access to the vault and item",
+				},
+			)
+		}
+		if err != nil {
+			if ctx.Err() == nil && resolveCtx.Err() != nil {
+				err = &errors.OpnixError{
+					Operation: operation,
+					Component: "environment variable resolution",
+					Issue:     fmt.Sprintf("Resolution did not finish within the variable's timeout of %s", variable.Timeout),
+					Context:   fmt.Sprintf("Reference: %s", variable.Reference),
+					Suggestions: []string{
+						"Increase the variable's timeout",
+						"Check connectivity to 1Password",
+					},
+				}
+			}
+			return "", "", p.placeholderFor(ctx, err)
+		}
+
+		if p.MaxValueSize > 0 && len(value) > p.MaxValueSize {
+			return "", "", &errors.OpnixError{
+				Operation: operation,
+				Component: "environment variable resolution",
+				Issue:     fmt.Sprintf("Resolved value is %d bytes, larger than the maximum of %d bytes", len(value), p.MaxValueSize),
+				Context:   fmt.Sprintf("Reference: %s", source),
+				Suggestions: []string{
+					"Check that the reference points at a field, not a document or attachment",
+					"Raise -max-value-size if the value is expected to be this large",
+				},
+			}
+		}
+
+		if selector != nil {
+			if value, err = selector.Apply(value); err != nil {
+				return "", "", errors.Wrap(err, operation, "environment variable resolution")
+			}
+		}
+
+		value = p.finish(variable, value)
+
+		if p.ErrorOnEmpty && strings.TrimSpace(value) == "" {
+			return "", "", errors.ConfigError(
+				fmt.Sprintf("Resolving secret for env var %s", variable.Name),
+				fmt.Sprintf("Reference '%s' resolved to an empty value", variable.Reference),
+				nil,
+			)
+		}
+
+		if err := checkLength(variable, value); err != nil {
+			return "", "", err
+		}
+		return value, source, nil
+	}
+
+	if variable.Value != "" {
+		return p.finish(variable, variable.Value), "", nil
+	}
+
+	return "", "", errors.ConfigError(
+		fmt.Sprintf("Processing env variable at index %d", index),
+		"Variable must define either 'reference' or 'value'",
+		nil,
+	)
+}
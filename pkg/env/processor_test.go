@@ -0,0 +1,846 @@
+package env
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brizzbuzz/opnix/internal/errors"
+)
+
+// fakeResolver resolves references from an in-memory map
+type fakeResolver struct {
+	secrets map[string]string
+}
+
+func (f *fakeResolver) ResolveSecret(reference string) (string, error) {
+	if value, ok := f.secrets[reference]; ok {
+		return value, nil
+	}
+	return "", fmt.Errorf("secret not found: %s", reference)
+}
+
+func (f *fakeResolver) Precheck(references []string) ([]string, error) {
+	var missing []string
+	for _, reference := range references {
+		if _, ok := f.secrets[reference]; !ok {
+			missing = append(missing, reference)
+		}
+	}
+	return missing, nil
+}
+
+func TestProcessor_ErrorOnEmpty(t *testing.T) {
+	resolver := &fakeResolver{
+		secrets: map[string]string{
+			"op://Vault/Item/blank":  "   \n",
+			"op://Vault/Item/filled": "value",
+		},
+	}
+
+	tests := []struct {
+		name         string
+		variable     Variable
+		errorOnEmpty bool
+		wantErr      bool
+		wantSkipped  bool
+		wantValue    string
+	}{
+		{
+			name:      "empty value allowed by default",
+			variable:  Variable{Name: "BLANK", Reference: "op://Vault/Item/blank"},
+			wantValue: "",
+		},
+		{
+			name:         "empty value rejected",
+			variable:     Variable{Name: "BLANK", Reference: "op://Vault/Item/blank"},
+			errorOnEmpty: true,
+			wantErr:      true,
+		},
+		{
+			name:         "empty optional value skipped",
+			variable:     Variable{Name: "BLANK", Reference: "op://Vault/Item/blank", Optional: true},
+			errorOnEmpty: true,
+			wantSkipped:  true,
+		},
+		{
+			name:         "non-empty value accepted",
+			variable:     Variable{Name: "FILLED", Reference: "op://Vault/Item/filled"},
+			errorOnEmpty: true,
+			wantValue:    "value",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			processor := NewProcessor(resolver)
+			processor.ErrorOnEmpty = tt.errorOnEmpty
+
+			result, err := processor.Process(&Config{Vars: []Variable{tt.variable}})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if tt.wantSkipped {
+				if len(result.Skipped) != 1 {
+					t.Fatalf("Expected 1 skipped variable, got %d", len(result.Skipped))
+				}
+				return
+			}
+
+			if got := result.Values[tt.variable.Name]; got != tt.wantValue {
+				t.Errorf("Expected value %q, got %q", tt.wantValue, got)
+			}
+		})
+	}
+}
+
+func TestProcessor_Required(t *testing.T) {
+	resolver := &fakeResolver{
+		secrets: map[string]string{
+			"op://Vault/Item/present": "value",
+		},
+	}
+
+	cfg := &Config{
+		Vars: []Variable{
+			{Name: "PRESENT", Reference: "op://Vault/Item/present", Optional: true},
+			{Name: "ABSENT", Reference: "op://Vault/Item/absent", Optional: true},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		required    []string
+		wantErr     bool
+		wantSkipped int
+	}{
+		{name: "optional semantics without require", wantSkipped: 1},
+		{name: "require resolvable variable", required: []string{"PRESENT"}, wantSkipped: 1},
+		{name: "require unresolvable variable", required: []string{"ABSENT"}, wantErr: true},
+		{name: "require undefined variable", required: []string{"UNKNOWN"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			processor := NewProcessor(resolver)
+			for _, name := range tt.required {
+				processor.Required[name] = true
+			}
+
+			result, err := processor.Process(cfg)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(result.Skipped) != tt.wantSkipped {
+				t.Errorf("Expected %d skipped variables, got %d", tt.wantSkipped, len(result.Skipped))
+			}
+		})
+	}
+
+	if _, err := ParseString(`{"vars":[{"name":"DB_PASSWORD","value":"a","requiredIf":"DB_PASSWORD"}]}`); err == nil {
+		t.Error("Expected validation error for a self-referencing requiredIf")
+	}
+}
+
+func TestProcessor_DefaultOptional(t *testing.T) {
+	resolver := &fakeResolver{secrets: map[string]string{"op://Vault/Item/present": "value"}}
+
+	tests := []struct {
+		name        string
+		config      string
+		wantErr     string
+		wantSkipped int
+	}{
+		{
+			name:        "defaultOptional skips unmarked variables",
+			config:      `{"defaultOptional":true,"vars":[{"name":"PRESENT","reference":"op://Vault/Item/present"},{"name":"ABSENT","reference":"op://Vault/Item/absent"}]}`,
+			wantSkipped: 1,
+		},
+		{
+			name:    "required overrides defaultOptional",
+			config:  `{"defaultOptional":true,"vars":[{"name":"ABSENT","reference":"op://Vault/Item/absent","required":true}]}`,
+			wantErr: "ABSENT",
+		},
+		{
+			name:    "required is the default without defaultOptional",
+			config:  `{"vars":[{"name":"ABSENT","reference":"op://Vault/Item/absent","required":true}]}`,
+			wantErr: "ABSENT",
+		},
+		{
+			name:    "optional and required conflict",
+			config:  `{"vars":[{"name":"ABSENT","reference":"op://Vault/Item/absent","optional":true,"required":true}]}`,
+			wantErr: "cannot be both optional and required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := ParseString(tt.config)
+			if err == nil {
+				var result *Result
+				result, err = NewProcessor(resolver).Process(cfg)
+				if err == nil && len(result.Skipped) != tt.wantSkipped {
+					t.Errorf("Expected %d skipped variables, got %d", tt.wantSkipped, len(result.Skipped))
+				}
+			}
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	cfg, err := ParseString(`{"defaultOptional":true,"vars":[{"name":"ABSENT","reference":"op://Vault/Item/absent"}],"environments":{"prod":{"vars":[{"name":"EXTRA","value":"x"}]}}}`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	selected, err := cfg.Select("prod")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !selected.IsOptional(selected.Vars[0]) {
+		t.Error("Expected defaultOptional to carry over to the selected environment")
+	}
+}
+
+func TestProcessor_OTPIgnoresPreserveWhitespace(t *testing.T) {
+	resolver := &fakeResolver{
+		secrets: map[string]string{
+			"op://Vault/Item/one-time password?attribute=totp": " 123456\n",
+		},
+	}
+
+	cfg := &Config{
+		Vars: []Variable{
+			{Name: "MFA_CODE", Reference: "op://Vault/Item/one-time password", PreserveWhitespace: true},
+		},
+	}
+
+	result, err := NewProcessor(resolver).Process(cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := result.Values["MFA_CODE"]; got != "123456" {
+		t.Errorf("Expected OTP code 123456, got %q", got)
+	}
+}
+
+func TestProcessor_NoCache(t *testing.T) {
+	resolver := &blockingResolver{
+		started: make(chan struct{}, 4),
+		release: make(chan struct{}),
+	}
+	close(resolver.release)
+
+	cfg := &Config{
+		Vars: []Variable{
+			{Name: "TOKEN", Reference: "op://Example/Service/token"},
+			{Name: "TOKEN_COPY", Reference: "op://Example/Service/token"},
+			{Name: "FRESH_TOKEN", Reference: "op://Example/Service/token", NoCache: true},
+		},
+	}
+
+	if _, err := NewProcessor(NewCachingResolver(resolver)).Process(cfg); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if calls := resolver.calls.Load(); calls != 2 {
+		t.Errorf("Expected one cached and one fresh lookup, got %d calls", calls)
+	}
+}
+
+func TestProcessor_TrimMode(t *testing.T) {
+	resolver := &fakeResolver{
+		secrets: map[string]string{
+			"op://Vault/Item/token": "  secret token \n",
+		},
+	}
+
+	tests := []struct {
+		name     string
+		mode     TrimMode
+		variable Variable
+		expected string
+	}{
+		{"default trims all whitespace", "", Variable{Name: "TOKEN", Reference: "op://Vault/Item/token"}, "secret token"},
+		{"full", TrimFull, Variable{Name: "TOKEN", Reference: "op://Vault/Item/token"}, "secret token"},
+		{"trailing newline", TrimTrailingNewline, Variable{Name: "TOKEN", Reference: "op://Vault/Item/token"}, "  secret token "},
+		{"none", TrimNone, Variable{Name: "TOKEN", Reference: "op://Vault/Item/token"}, "  secret token \n"},
+		{"static value follows mode", TrimTrailingNewline, Variable{Name: "STATIC", Value: " static\n"}, " static"},
+		{"preserveWhitespace overrides mode", TrimFull, Variable{Name: "TOKEN", Reference: "op://Vault/Item/token", PreserveWhitespace: true}, "  secret token \n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			processor := NewProcessor(resolver)
+			processor.TrimMode = tt.mode
+
+			result, err := processor.Process(&Config{Vars: []Variable{tt.variable}})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got := result.Values[tt.variable.Name]; got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestProcessor_NormalizeNewlines(t *testing.T) {
+	resolver := &fakeResolver{
+		secrets: map[string]string{
+			"op://Vault/Item/cert": "line one\r\nline two\rline three\r\n",
+		},
+	}
+
+	tests := []struct {
+		name      string
+		normalize bool
+		mode      TrimMode
+		expected  string
+	}{
+		{"disabled by default", false, TrimNone, "line one\r\nline two\rline three\r\n"},
+		{"converts CRLF and CR", true, TrimNone, "line one\nline two\nline three\n"},
+		{"applies after trimming", true, TrimFull, "line one\nline two\nline three"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			processor := NewProcessor(resolver)
+			processor.TrimMode = tt.mode
+			processor.NormalizeNewlines = tt.normalize
+
+			result, err := processor.Process(&Config{Vars: []Variable{
+				{Name: "CERT", Reference: "op://Vault/Item/cert"},
+				{Name: "STATIC", Value: "a\r\nb"},
+			}})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got := result.Values["CERT"]; got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+			if tt.normalize && result.Values["STATIC"] != "a\nb" {
+				t.Errorf("Expected static value to be normalized, got %q", result.Values["STATIC"])
+			}
+		})
+	}
+}
+
+func TestParseTrimMode(t *testing.T) {
+	for _, name := range append([]string{""}, TrimModes...) {
+		if _, err := ParseTrimMode(name); err != nil {
+			t.Errorf("Unexpected error for %q: %v", name, err)
+		}
+	}
+	if _, err := ParseTrimMode("trailing"); err == nil {
+		t.Error("Expected error for unknown trim mode")
+	}
+}
+
+func TestProcessor_RequiredIf(t *testing.T) {
+	password := Variable{Name: "DB_PASSWORD", Reference: "op://Example/Database/password", RequiredIf: "DB_HOST"}
+
+	tests := []struct {
+		name        string
+		secrets     map[string]string
+		vars        []Variable
+		wantErr     string
+		wantSkipped int
+	}{
+		{
+			name:    "condition set and variable resolves",
+			secrets: map[string]string{"op://Example/Database/password": "test-password"},
+			vars:    []Variable{{Name: "DB_HOST", Value: "db.example.com"}, password},
+		},
+		{
+			name:    "condition set and variable missing",
+			vars:    []Variable{{Name: "DB_HOST", Value: "db.example.com"}, password},
+			wantErr: "DB_PASSWORD is required because DB_HOST is set",
+		},
+		{
+			name:        "condition unset allows skip",
+			vars:        []Variable{{Name: "DB_HOST", Reference: "op://Example/Database/host", Optional: true}, password},
+			wantSkipped: 2,
+		},
+		{
+			name:    "condition names unknown variable",
+			vars:    []Variable{password},
+			wantErr: "requiredIf names a variable that is not defined",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			processor := NewProcessor(&fakeResolver{secrets: tt.secrets})
+
+			result, err := processor.Process(&Config{Vars: tt.vars})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(result.Skipped) != tt.wantSkipped {
+				t.Errorf("Expected %d skipped variables, got %d", tt.wantSkipped, len(result.Skipped))
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	resolver := &fakeResolver{
+		secrets: map[string]string{
+			"op://Vault/Item/token": " secret-token \n",
+		},
+	}
+
+	cfg, err := ParseString(`{"vars":[
+		{"name":"API_TOKEN","reference":"op://Vault/Item/token"},
+		{"name":"REGION","value":"us-east-1"},
+		{"name":"OPTIONAL","reference":"op://Vault/Item/missing","optional":true}
+	]}`)
+	if err != nil {
+		t.Fatalf("Unexpected parse error: %v", err)
+	}
+
+	values, skipped, err := Resolve(cfg, resolver)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if values["API_TOKEN"] != "secret-token" {
+		t.Errorf("Expected trimmed token, got %q", values["API_TOKEN"])
+	}
+	if values["REGION"] != "us-east-1" {
+		t.Errorf("Expected static region, got %q", values["REGION"])
+	}
+	if len(skipped) != 1 || skipped[0].Name != "OPTIONAL" {
+		t.Errorf("Expected OPTIONAL to be skipped, got %+v", skipped)
+	}
+
+	if _, _, err := Resolve(nil, resolver); err == nil {
+		t.Error("Expected error for nil configuration")
+	}
+}
+
+func TestProcessor_AllowedVaults(t *testing.T) {
+	resolver := &fakeResolver{
+		secrets: map[string]string{
+			"op://Dev/Item/token":  "dev-token",
+			"op://Prod/Item/token": "prod-token",
+		},
+	}
+
+	cfg := &Config{Vars: []Variable{
+		{Name: "DEV_TOKEN", Reference: "op://Dev/Item/token"},
+		{Name: "PROD_TOKEN", Reference: "op://Prod/Item/token", Optional: true},
+	}}
+
+	processor := NewProcessor(resolver)
+	processor.AllowedVaults = []string{"Dev"}
+
+	if _, err := processor.Process(cfg); err == nil {
+		t.Fatal("Expected error for reference outside the allowed vaults")
+	} else if !strings.Contains(err.Error(), "not in the allowed vault list") {
+		t.Errorf("Expected allow-list error, got %v", err)
+	}
+
+	processor.AllowedVaults = []string{"Dev", "Prod"}
+	result, err := processor.Process(cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Values["PROD_TOKEN"] != "prod-token" {
+		t.Errorf("Expected prod token, got %q", result.Values["PROD_TOKEN"])
+	}
+}
+
+func TestProcessor_ProcessContextCancelled(t *testing.T) {
+	resolver := &fakeResolver{secrets: map[string]string{"op://Vault/Item/token": "secret-token"}}
+	cfg := &Config{Vars: []Variable{{Name: "API_TOKEN", Reference: "op://Vault/Item/token"}}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := NewProcessor(resolver).ProcessContext(ctx, cfg); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+// slowResolver blocks on references under slow until ctx is done
+type slowResolver struct {
+	fakeResolver
+	slow string
+}
+
+func (s *slowResolver) ResolveSecretContext(ctx context.Context, reference string) (string, error) {
+	if strings.HasPrefix(reference, s.slow) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+	return s.ResolveSecret(reference)
+}
+
+func (s *slowResolver) ResolveAll(ctx context.Context, references []string) (map[string]string, map[string]error, error) {
+	return ResolveEach(ctx, references, s.ResolveSecretContext)
+}
+
+func TestProcessor_VariableTimeout(t *testing.T) {
+	resolver := &slowResolver{
+		fakeResolver: fakeResolver{secrets: map[string]string{"op://Example/Service/password": "hunter2"}},
+		slow:         "op://Example/Documents/",
+	}
+
+	t.Run("fires before the global timeout", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		_, err := NewProcessor(resolver).ProcessContext(ctx, &Config{Vars: []Variable{
+			{Name: "PASSWORD", Reference: "op://Example/Service/password", Timeout: "20ms"},
+			{Name: "BUNDLE", Reference: "op://Example/Documents/bundle", Timeout: "20ms"},
+		}})
+		if err == nil || !strings.Contains(err.Error(), "BUNDLE") || !strings.Contains(err.Error(), "variable's timeout of 20ms") {
+			t.Fatalf("Expected BUNDLE's own timeout to fire, got %v", err)
+		}
+		if stderrors.Is(err, context.DeadlineExceeded) || ctx.Err() != nil {
+			t.Errorf("Expected the global deadline to be untouched, got %v", err)
+		}
+	})
+
+	t.Run("optional variable is skipped", func(t *testing.T) {
+		result, err := NewProcessor(resolver).Process(&Config{Vars: []Variable{
+			{Name: "PASSWORD", Reference: "op://Example/Service/password"},
+			{Name: "BUNDLE", Reference: "op://Example/Documents/bundle", Timeout: "20ms", Optional: true},
+		}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if result.Values["PASSWORD"] != "hunter2" || len(result.Skipped) != 1 {
+			t.Errorf("Expected PASSWORD resolved and BUNDLE skipped, got %v / %v", result.Values, result.Skipped)
+		}
+	})
+
+	t.Run("global timeout still wins", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		_, err := NewProcessor(resolver).ProcessContext(ctx, &Config{Vars: []Variable{
+			{Name: "BUNDLE", Reference: "op://Example/Documents/bundle", Timeout: "1m"},
+		}})
+		if !stderrors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected the global deadline to abort the run, got %v", err)
+		}
+	})
+
+	for _, raw := range []string{
+		`{"vars":[{"name":"TOKEN","reference":"op://Example/Service/password","timeout":"soon"}]}`,
+		`{"vars":[{"name":"TOKEN","reference":"op://Example/Service/password","timeout":"0s"}]}`,
+		`{"vars":[{"name":"TOKEN","value":"static","timeout":"5s"}]}`,
+	} {
+		if _, err := ParseString(raw); err == nil {
+			t.Errorf("Expected validation error for %s", raw)
+		}
+	}
+}
+
+func TestProcessor_MissingPlaceholder(t *testing.T) {
+	resolver := &fakeResolver{
+		secrets: map[string]string{
+			"op://Example/Service/password": "test-password",
+		},
+	}
+
+	cfg := &Config{
+		Vars: []Variable{
+			{Name: "PASSWORD", Reference: "op://Example/Service/password"},
+			{Name: "API_KEY", Reference: "op://Example/Service/api-key"},
+			{Name: "WEBHOOK", Reference: "op://Example/Service/webhook", Optional: true},
+			{Name: "SHORT", Reference: "op://Example/Service/password", MinLength: 64},
+		},
+	}
+
+	processor := NewProcessor(resolver)
+	processor.MissingPlaceholder = "__MISSING__"
+
+	_, err := processor.Process(cfg)
+	if err == nil || !strings.Contains(err.Error(), "SHORT") {
+		t.Fatalf("Expected length check to still fail, got %v", err)
+	}
+
+	cfg.Vars = cfg.Vars[:3]
+	result, err := processor.Process(cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := map[string]string{
+		"PASSWORD": "test-password",
+		"API_KEY":  "__MISSING__",
+		"WEBHOOK":  "__MISSING__",
+	}
+	for name, value := range expected {
+		if result.Values[name] != value {
+			t.Errorf("Expected %s=%q, got %q", name, value, result.Values[name])
+		}
+	}
+	if len(result.Skipped) != 0 {
+		t.Errorf("Expected no skipped variables, got %v", result.Skipped)
+	}
+	if len(result.Placeholders) != 2 || result.Placeholders[0].Name != "API_KEY" || result.Placeholders[1].Name != "WEBHOOK" {
+		t.Errorf("Expected placeholders for API_KEY and WEBHOOK, got %v", result.Placeholders)
+	}
+}
+
+func TestProcessor_MissingPlaceholderKeepsAuthErrors(t *testing.T) {
+	resolver := newFlakyResolver(map[string]int{"op://Example/Service/token": 1})
+	resolver.auth = true
+
+	processor := NewProcessor(resolver)
+	processor.MissingPlaceholder = "__MISSING__"
+
+	_, err := processor.Process(&Config{
+		Vars: []Variable{{Name: "TOKEN", Reference: "op://Example/Service/token"}},
+	})
+	if err == nil || !errors.IsAuthError(err) {
+		t.Errorf("Expected authentication error to fail the run, got %v", err)
+	}
+}
+
+func TestProcessor_FieldFallbacks(t *testing.T) {
+	resolver := &fakeResolver{
+		secrets: map[string]string{
+			"op://Example/Service/credential": "from-credential",
+			"op://Example/Other/password":     "from-password",
+		},
+	}
+
+	tests := []struct {
+		name      string
+		variable  Variable
+		want      string
+		source    string
+		wantError []string
+	}{
+		{
+			name:     "primary field found",
+			variable: Variable{Name: "TOKEN", Reference: "op://Example/Other/password", FieldFallbacks: []string{"credential"}},
+			want:     "from-password",
+			source:   "op://Example/Other/password",
+		},
+		{
+			name:     "fallback field found",
+			variable: Variable{Name: "TOKEN", Reference: "op://Example/Service/password", FieldFallbacks: []string{"token", "credential"}},
+			want:     "from-credential",
+			source:   "op://Example/Service/credential",
+		},
+		{
+			name:      "no field found",
+			variable:  Variable{Name: "TOKEN", Reference: "op://Example/Service/password", FieldFallbacks: []string{"token", "api key"}},
+			wantError: []string{"password, token, api key", "op://Example/Service/password"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := NewProcessor(resolver).Process(&Config{Vars: []Variable{tt.variable}})
+			if len(tt.wantError) > 0 {
+				if err == nil {
+					t.Fatal("Expected error when no field resolves")
+				}
+				for _, want := range tt.wantError {
+					if !strings.Contains(err.Error(), want) {
+						t.Errorf("Expected error to contain %q, got %v", want, err)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result.Values["TOKEN"] != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, result.Values["TOKEN"])
+			}
+			if result.Sources["TOKEN"] != tt.source {
+				t.Errorf("Expected source %q, got %q", tt.source, result.Sources["TOKEN"])
+			}
+		})
+	}
+
+	// Precheck cannot tell which field exists, so it leaves fallback variables to resolution
+	cfg := &Config{Vars: []Variable{tests[1].variable}}
+	if err := NewProcessor(resolver).PrecheckConfig(cfg); err != nil {
+		t.Errorf("Expected precheck to skip variables with fallbacks, got %v", err)
+	}
+}
+
+func TestProcessor_ReferenceSelectors(t *testing.T) {
+	resolver := &fakeResolver{
+		secrets: map[string]string{
+			"op://Example/Service/notesPlain": "host=db.example.com\nuser=admin\n",
+			"op://Example/Service/config":     `{"database": {"password": "hunter2"}}`,
+		},
+	}
+
+	cfg := &Config{Vars: []Variable{
+		{Name: "DB_USER_LINE", Reference: "op://Example/Service/notesPlain?line=2"},
+		{Name: "DB_PASSWORD", Reference: "op://Example/Service/config?json=.database.password"},
+	}}
+
+	result, err := NewProcessor(resolver).Process(cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Values["DB_USER_LINE"] != "user=admin" {
+		t.Errorf("Expected selected line, got %q", result.Values["DB_USER_LINE"])
+	}
+	if result.Values["DB_PASSWORD"] != "hunter2" {
+		t.Errorf("Expected selected JSON value, got %q", result.Values["DB_PASSWORD"])
+	}
+
+	if _, err := ParseString(`{"vars":[{"name":"TOKEN","reference":"op://Example/Service/config?yaml=.key"}]}`); err == nil {
+		t.Error("Expected validation error for unsupported selector")
+	}
+}
+
+func TestProcessor_LengthBounds(t *testing.T) {
+	resolver := &fakeResolver{
+		secrets: map[string]string{
+			"op://Example/Service/password": "  hunter2  ",
+			"op://Example/Service/pin":      "ü12",
+		},
+	}
+
+	tests := []struct {
+		name        string
+		variable    Variable
+		wantErr     string
+		wantSkipped bool
+	}{
+		{"within bounds after trimming", Variable{Name: "PASSWORD", Reference: "op://Example/Service/password", MinLength: 7, MaxLength: 7}, "", false},
+		{"counts characters not bytes", Variable{Name: "PIN", Reference: "op://Example/Service/pin", MaxLength: 3}, "", false},
+		{"too short", Variable{Name: "PASSWORD", Reference: "op://Example/Service/password", MinLength: 16}, "shorter than minLength 16", false},
+		{"too long", Variable{Name: "PASSWORD", Reference: "op://Example/Service/password", MaxLength: 4}, "longer than maxLength 4", false},
+		{"optional is skipped", Variable{Name: "PASSWORD", Reference: "op://Example/Service/password", MinLength: 16, Optional: true}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := NewProcessor(resolver).Process(&Config{Vars: []Variable{tt.variable}})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) || !strings.Contains(err.Error(), tt.variable.Name) {
+					t.Fatalf("Expected error naming %s and containing %q, got %v", tt.variable.Name, tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if skipped := len(result.Skipped) == 1; skipped != tt.wantSkipped {
+				t.Errorf("Expected skipped %v, got %v", tt.wantSkipped, result.Skipped)
+			}
+		})
+	}
+
+	invalid := []string{
+		`{"vars":[{"name":"TOKEN","reference":"op://Example/Service/password","minLength":-1}]}`,
+		`{"vars":[{"name":"TOKEN","reference":"op://Example/Service/password","minLength":10,"maxLength":5}]}`,
+	}
+	for _, raw := range invalid {
+		if _, err := ParseString(raw); err == nil {
+			t.Errorf("Expected validation error for %s", raw)
+		}
+	}
+}
+
+func TestProcessor_MaxValueSize(t *testing.T) {
+	resolver := &fakeResolver{
+		secrets: map[string]string{
+			"op://Example/Service/password": "hunter2",
+			"op://Example/Service/bundle":   strings.Repeat("x", 2048),
+		},
+	}
+
+	processor := NewProcessor(resolver)
+	processor.MaxValueSize = 1024
+
+	result, err := processor.Process(&Config{Vars: []Variable{
+		{Name: "PASSWORD", Reference: "op://Example/Service/password"},
+		{Name: "OPTIONAL_BUNDLE", Reference: "op://Example/Service/bundle", Optional: true},
+	}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Values["PASSWORD"] != "hunter2" || len(result.Skipped) != 1 {
+		t.Errorf("Expected PASSWORD resolved and the optional bundle skipped, got %v / %v", result.Values, result.Skipped)
+	}
+
+	_, err = processor.Process(&Config{Vars: []Variable{{Name: "BUNDLE", Reference: "op://Example/Service/bundle"}}})
+	if err == nil || !strings.Contains(err.Error(), "BUNDLE") || !strings.Contains(err.Error(), "2048 bytes") {
+		t.Errorf("Expected an error naming BUNDLE and its size, got %v", err)
+	}
+}
+
+func TestProcessor_CollectFailures(t *testing.T) {
+	resolver := &fakeResolver{
+		secrets: map[string]string{
+			"op://Example/Service/password": "test-password",
+		},
+	}
+
+	cfg := &Config{
+		Vars: []Variable{
+			{Name: "PASSWORD", Reference: "op://Example/Service/password"},
+			{Name: "API_KEY", Reference: "op://Example/Service/api-key"},
+			{Name: "WEBHOOK", Reference: "op://Example/Service/webhook", Optional: true},
+			{Name: "TOKEN", Reference: "op://Example/Service/token", RequiredIf: "PASSWORD"},
+		},
+	}
+
+	processor := NewProcessor(resolver)
+	if _, err := processor.Process(cfg); err == nil {
+		t.Fatal("Expected required failure without CollectFailures")
+	}
+
+	processor.CollectFailures = true
+	result, err := processor.Process(cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if result.Values["PASSWORD"] != "test-password" {
+		t.Errorf("Expected PASSWORD to resolve, got %v", result.Values)
+	}
+	if len(result.Skipped) != 1 || result.Skipped[0].Name != "WEBHOOK" {
+		t.Errorf("Expected only WEBHOOK to be skipped, got %v", result.Skipped)
+	}
+	if len(result.Failed) != 2 || result.Failed[0].Name != "API_KEY" || result.Failed[1].Name != "TOKEN" {
+		t.Fatalf("Expected API_KEY and TOKEN to fail, got %v", result.Failed)
+	}
+	if !strings.Contains(result.Failed[1].Err.Error(), "required because PASSWORD is set") {
+		t.Errorf("Expected requiredIf explanation, got %v", result.Failed[1].Err)
+	}
+}
@@ -0,0 +1,95 @@
+package env
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/brizzbuzz/opnix/internal/errors"
+)
+
+// LoadReferences reads a map of variable names to references from a file
+// owned separately from the main configuration. Files ending in .yaml or
+// .yml are parsed as YAML; everything else is parsed as JSON.
+func LoadReferences(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.FileOperationError(
+			"Loading reference file",
+			path,
+			"Failed to read reference file",
+			err,
+		)
+	}
+
+	var references map[string]string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &references)
+	default:
+		err = json.Unmarshal(stripJSONComments(data), &references)
+	}
+	if err != nil {
+		return nil, errors.ConfigError(
+			"Parsing reference file",
+			fmt.Sprintf("%s must map variable names to references, e.g. {\"DB_PASSWORD\": \"op://Example/Service/password\"}", path),
+			err,
+		)
+	}
+	return references, nil
+}
+
+// MergeReferences adds references to the shared vars of cfg. A name that is
+// not defined yet becomes a new variable, appended in name order. A variable
+// with the same reference is left alone, and one with a static value keeps
+// it, since the value is a deliberate override; those names are returned.
+// A variable with a different reference is a conflict, because it is unclear
+// which owner is right. source names the reference file in errors.
+func (cfg *Config) MergeReferences(references map[string]string, source string) ([]string, error) {
+	index := make(map[string]int, len(cfg.Vars))
+	for i, variable := range cfg.Vars {
+		index[variable.Name] = i
+	}
+
+	names := make([]string, 0, len(references))
+	for name := range references {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var overridden []string
+	for _, name := range names {
+		reference := references[name]
+		i, exists := index[name]
+		if !exists {
+			cfg.Vars = append(cfg.Vars, Variable{Name: name, Reference: reference})
+			continue
+		}
+
+		variable := cfg.Vars[i]
+		switch {
+		case variable.Value != "":
+			overridden = append(overridden, name)
+		case variable.Reference != reference:
+			return nil, errors.ConfigValidationError(
+				fmt.Sprintf("env.vars[%d].reference", i),
+				variable.Reference,
+				fmt.Sprintf("%s is mapped to %s in %s, which conflicts with the reference in the configuration", name, reference, source),
+				[]string{
+					fmt.Sprintf("Remove the reference for %s from one of the files", name),
+					"Or replace it with a static 'value' in the configuration to override the reference file",
+				},
+			)
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return overridden, nil
+}
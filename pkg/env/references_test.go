@@ -0,0 +1,117 @@
+package env
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadReferences(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"refs.json": `{
+  // Owned by the database team
+  "DB_PASSWORD": "op://Example/Service/password"
+}`,
+		"refs.yaml": "DB_PASSWORD: op://Example/Service/password\n",
+	}
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("Failed to write reference file: %v", err)
+		}
+		references, err := LoadReferences(path)
+		if err != nil {
+			t.Fatalf("Unexpected error loading %s: %v", name, err)
+		}
+		if references["DB_PASSWORD"] != "op://Example/Service/password" {
+			t.Errorf("Expected reference from %s, got %v", name, references)
+		}
+	}
+
+	invalid := filepath.Join(dir, "invalid.json")
+	if err := os.WriteFile(invalid, []byte(`["op://Example/Service/password"]`), 0600); err != nil {
+		t.Fatalf("Failed to write reference file: %v", err)
+	}
+	if _, err := LoadReferences(invalid); err == nil || !strings.Contains(err.Error(), "must map variable names") {
+		t.Errorf("Expected parse error, got %v", err)
+	}
+	if _, err := LoadReferences(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("Expected error for missing reference file")
+	}
+}
+
+func TestConfig_MergeReferences(t *testing.T) {
+	tests := []struct {
+		name           string
+		vars           []Variable
+		references     map[string]string
+		wantNames      []string
+		wantOverridden []string
+		wantError      string
+	}{
+		{
+			name:       "adds missing variables in name order",
+			vars:       []Variable{{Name: "LOG_LEVEL", Value: "info"}},
+			references: map[string]string{"DB_PASSWORD": "op://Example/Service/password", "API_TOKEN": "op://Example/Service/token"},
+			wantNames:  []string{"LOG_LEVEL", "API_TOKEN", "DB_PASSWORD"},
+		},
+		{
+			name:       "identical inline reference is not a conflict",
+			vars:       []Variable{{Name: "DB_PASSWORD", Reference: "op://Example/Service/password"}},
+			references: map[string]string{"DB_PASSWORD": "op://Example/Service/password"},
+			wantNames:  []string{"DB_PASSWORD"},
+		},
+		{
+			name:           "static value overrides the reference file",
+			vars:           []Variable{{Name: "DB_PASSWORD", Value: "local"}},
+			references:     map[string]string{"DB_PASSWORD": "op://Example/Service/password"},
+			wantNames:      []string{"DB_PASSWORD"},
+			wantOverridden: []string{"DB_PASSWORD"},
+		},
+		{
+			name:       "different inline reference conflicts",
+			vars:       []Variable{{Name: "DB_PASSWORD", Reference: "op://Example/Service/password"}},
+			references: map[string]string{"DB_PASSWORD": "op://Example/Other/password"},
+			wantError:  "conflicts with the reference in the configuration",
+		},
+		{
+			name:       "merged references are validated",
+			vars:       []Variable{{Name: "LOG_LEVEL", Value: "info"}},
+			references: map[string]string{"db-password": "op://Example/Service/password"},
+			wantError:  "env.vars[1]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Vars: tt.vars}
+			overridden, err := cfg.MergeReferences(tt.references, "refs.json")
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("Expected error containing %q, got %v", tt.wantError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var names []string
+			for _, variable := range cfg.Vars {
+				names = append(names, variable.Name)
+			}
+			if strings.Join(names, ",") != strings.Join(tt.wantNames, ",") {
+				t.Errorf("Expected vars %v, got %v", tt.wantNames, names)
+			}
+			if strings.Join(overridden, ",") != strings.Join(tt.wantOverridden, ",") {
+				t.Errorf("Expected overridden %v, got %v", tt.wantOverridden, overridden)
+			}
+			if cfg.Vars[0].Name == "DB_PASSWORD" && tt.wantOverridden != nil && cfg.Vars[0].Value != "local" {
+				t.Errorf("Expected static value to be kept, got %+v", cfg.Vars[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package env
+
+import (
+	"context"
+)
+
+// ContextResolver is implemented by resolvers that honour cancellation and
+// can resolve several references in one call. Resolvers that only implement
+// Resolver can be adapted with WithContext.
+type ContextResolver interface {
+	// ResolveSecretContext resolves a single reference, giving up once ctx
+	// is cancelled
+	ResolveSecretContext(ctx context.Context, reference string) (string, error)
+
+	// ResolveAll resolves every reference, returning values and errors keyed
+	// by reference. Each reference appears in exactly one of the maps. The
+	// final error is reserved for failures of the whole batch, such as a
+	// cancelled ctx, in which case neither map is meaningful.
+	ResolveAll(ctx context.Context, references []string) (map[string]string, map[string]error, error)
+}
+
+// WithContext returns resolver as a ContextResolver. Resolvers that already
+// implement ContextResolver are returned unchanged; others resolve one
+// reference at a time and check ctx before each lookup.
+func WithContext(resolver Resolver) ContextResolver {
+	if contextResolver, ok := resolver.(ContextResolver); ok {
+		return contextResolver
+	}
+	return contextAdapter{resolver: resolver}
+}
+
+// contextAdapter gives a single-method Resolver the ContextResolver methods
+type contextAdapter struct {
+	resolver Resolver
+}
+
+func (a contextAdapter) ResolveSecret(reference string) (string, error) {
+	return a.resolver.ResolveSecret(reference)
+}
+
+func (a contextAdapter) ResolveSecretContext(ctx context.Context, reference string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return a.resolver.ResolveSecret(reference)
+}
+
+func (a contextAdapter) ResolveAll(ctx context.Context, references []string) (map[string]string, map[string]error, error) {
+	return ResolveEach(ctx, references, a.ResolveSecretContext)
+}
+
+// ResolveEach implements ResolveAll for resolvers without a batch API by
+// calling resolve once per distinct reference, stopping when ctx is cancelled
+func ResolveEach(ctx context.Context, references []string, resolve func(context.Context, string) (string, error)) (map[string]string, map[string]error, error) {
+	values := make(map[string]string, len(references))
+	errs := make(map[string]error)
+	for _, reference := range references {
+		if _, done := values[reference]; done {
+			continue
+		}
+		if _, done := errs[reference]; done {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+
+		value, err := resolve(ctx, reference)
+		if err != nil {
+			errs[reference] = err
+			continue
+		}
+		values[reference] = value
+	}
+	return values, errs, nil
+}
@@ -0,0 +1,68 @@
+package env
+
+import (
+	"context"
+	"testing"
+)
+
+// batchResolver records each batch it is asked to resolve
+type batchResolver struct {
+	fakeResolver
+	batches [][]string
+}
+
+func (b *batchResolver) ResolveSecretContext(ctx context.Context, reference string) (string, error) {
+	return b.ResolveSecret(reference)
+}
+
+func (b *batchResolver) ResolveAll(ctx context.Context, references []string) (map[string]string, map[string]error, error) {
+	b.batches = append(b.batches, references)
+	return ResolveEach(ctx, references, b.ResolveSecretContext)
+}
+
+func TestWithContext_ReturnsContextResolvers(t *testing.T) {
+	resolver := &batchResolver{}
+	if got := WithContext(resolver); got != resolver {
+		t.Errorf("Expected ContextResolver to be returned unchanged, got %T", got)
+	}
+	if _, ok := WithContext(&fakeResolver{}).(contextAdapter); !ok {
+		t.Error("Expected single-method resolver to be adapted")
+	}
+}
+
+func TestWithContext_ResolveAll(t *testing.T) {
+	resolver := WithContext(&fakeResolver{
+		secrets: map[string]string{"op://Example/Service/password": "test-password"},
+	})
+
+	values, errs, err := resolver.ResolveAll(context.Background(), []string{
+		"op://Example/Service/password",
+		"op://Example/Service/missing",
+		"op://Example/Service/password",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(values) != 1 || values["op://Example/Service/password"] != "test-password" {
+		t.Errorf("Expected one resolved value, got %v", values)
+	}
+	if len(errs) != 1 || errs["op://Example/Service/missing"] == nil {
+		t.Errorf("Expected one per-reference error, got %v", errs)
+	}
+}
+
+func TestWithContext_Cancelled(t *testing.T) {
+	resolver := WithContext(&fakeResolver{
+		secrets: map[string]string{"op://Example/Service/password": "test-password"},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := resolver.ResolveSecretContext(ctx, "op://Example/Service/password"); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if _, _, err := resolver.ResolveAll(ctx, []string{"op://Example/Service/password"}); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/brizzbuzz/opnix/internal/errors"
+)
+
+// RetryingResolver retries failed lookups with exponential backoff. Retries
+// never outlast the context: before each attempt and each backoff it checks
+// the deadline and gives up with a "timeout during retry" error instead of
+// sleeping past it. Authentication failures, missing items, and malformed
+// references are never retried.
+type RetryingResolver struct {
+	resolver Resolver
+	attempts int
+	backoff  time.Duration
+}
+
+// NewRetryingResolver wraps resolver so each lookup is tried up to attempts
+// times, waiting backoff before the first retry and doubling it after that
+func NewRetryingResolver(resolver Resolver, attempts int, backoff time.Duration) *RetryingResolver {
+	if attempts < 1 {
+		attempts = 1
+	}
+	return &RetryingResolver{
+		resolver: resolver,
+		attempts: attempts,
+		backoff:  backoff,
+	}
+}
+
+// ResolveSecret resolves reference, retrying transient failures
+func (r *RetryingResolver) ResolveSecret(reference string) (string, error) {
+	return r.ResolveSecretContext(context.Background(), reference)
+}
+
+// ResolveSecretContext resolves reference, retrying transient failures
+// until the attempts are used up or ctx's deadline would be exceeded
+func (r *RetryingResolver) ResolveSecretContext(ctx context.Context, reference string) (string, error) {
+	resolver := WithContext(r.resolver)
+
+	var lastErr error
+	for attempt := 1; attempt <= r.attempts; attempt++ {
+		if err := r.wait(ctx, attempt, lastErr); err != nil {
+			return "", err
+		}
+
+		value, err := resolver.ResolveSecretContext(ctx, reference)
+		if err == nil || !retryable(ctx, err) {
+			return value, err
+		}
+		lastErr = err
+	}
+	return "", lastErr
+}
+
+// ResolveAll resolves references in batches, retrying only the references
+// whose lookup failed transiently
+func (r *RetryingResolver) ResolveAll(ctx context.Context, references []string) (map[string]string, map[string]error, error) {
+	resolver := WithContext(r.resolver)
+	values := make(map[string]string, len(references))
+	errs := make(map[string]error)
+
+	pending := references
+	var lastErr error
+	for attempt := 1; attempt <= r.attempts && len(pending) > 0; attempt++ {
+		if err := r.wait(ctx, attempt, lastErr); err != nil {
+			return nil, nil, err
+		}
+
+		resolved, failed, err := resolver.ResolveAll(ctx, pending)
+		if err != nil {
+			if !retryable(ctx, err) || attempt == r.attempts {
+				return nil, nil, err
+			}
+			lastErr = err
+			continue
+		}
+
+		for reference, value := range resolved {
+			values[reference] = value
+		}
+
+		var retry []string
+		for _, reference := range pending {
+			refErr, ok := failed[reference]
+			if !ok {
+				continue
+			}
+			if attempt < r.attempts && retryable(ctx, refErr) {
+				retry = append(retry, reference)
+				lastErr = refErr
+				continue
+			}
+			errs[reference] = refErr
+		}
+		pending = retry
+	}
+
+	return values, errs, nil
+}
+
+// wait enforces the deadline before attempt. The first attempt only checks
+// that ctx is still live; later attempts sleep for the backoff unless the
+// deadline would pass first.
+func (r *RetryingResolver) wait(ctx context.Context, attempt int, lastErr error) error {
+	if err := ctx.Err(); err != nil {
+		if attempt == 1 {
+			return err
+		}
+		return r.timeoutError(attempt, lastErr)
+	}
+	if attempt == 1 {
+		return nil
+	}
+
+	delay := r.backoff << (attempt - 2)
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+		return r.timeoutError(attempt, lastErr)
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return r.timeoutError(attempt, lastErr)
+	}
+}
+
+func (r *RetryingResolver) timeoutError(attempt int, lastErr error) error {
+	return &errors.OpnixError{
+		Operation: "Resolving secret reference",
+		Component: "1Password integration",
+		Issue:     fmt.Sprintf("timeout during retry: the deadline passed before attempt %d of %d", attempt, r.attempts),
+		Cause:     lastErr,
+		Suggestions: []string{
+			"Increase -timeout to leave room for retries",
+			"Or lower -retries or -retry-backoff to fit within the timeout",
+		},
+	}
+}
+
+// retryable reports whether err may succeed on another attempt. Rejected
+// tokens, missing items, and malformed references fail the same way every
+// time.
+func retryable(ctx context.Context, err error) bool {
+	return ctx.Err() == nil && !errors.IsAuthError(err) && !errors.IsNotFound(err) && !errors.IsInvalidReference(err)
+}
+
+// Precheck delegates to the underlying resolver when it supports prechecks
+func (r *RetryingResolver) Precheck(references []string) ([]string, error) {
+	prechecker, err := asPrechecker(r.resolver)
+	if err != nil {
+		return nil, err
+	}
+	return prechecker.Precheck(references)
+}
+
+// AccessibleVaults delegates to the underlying resolver when it can list vaults
+func (r *RetryingResolver) AccessibleVaults() ([]string, error) {
+	lister, err := asVaultLister(r.resolver)
+	if err != nil {
+		return nil, err
+	}
+	return lister.AccessibleVaults()
+}
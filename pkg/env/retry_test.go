@@ -0,0 +1,186 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/brizzbuzz/opnix/internal/errors"
+)
+
+// flakyResolver fails each reference a set number of times before succeeding
+type flakyResolver struct {
+	mu       sync.Mutex
+	failures map[string]int
+	calls    map[string]int
+	auth     bool
+	missing  bool
+}
+
+func (f *flakyResolver) ResolveSecret(reference string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls[reference]++
+	if f.calls[reference] <= f.failures[reference] {
+		if f.auth {
+			return "", errors.AuthError("Resolving secret", "Token rejected", nil)
+		}
+		if f.missing {
+			return "", errors.OnePasswordError("Resolving 1Password secret", fmt.Sprintf("Reference not found: %s", reference), nil).WithKind(errors.KindNotFound)
+		}
+		return "", fmt.Errorf("temporary failure for %s", reference)
+	}
+	return "value-for-" + reference, nil
+}
+
+func newFlakyResolver(failures map[string]int) *flakyResolver {
+	return &flakyResolver{failures: failures, calls: make(map[string]int)}
+}
+
+func TestRetryingResolver_RetriesTransientFailures(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int
+		attempts  int
+		auth      bool
+		missing   bool
+		wantErr   bool
+		wantCalls int
+	}{
+		{name: "succeeds after retries", failures: 2, attempts: 3, wantCalls: 3},
+		{name: "gives up after attempts", failures: 5, attempts: 3, wantErr: true, wantCalls: 3},
+		{name: "auth errors are not retried", failures: 5, attempts: 3, auth: true, wantErr: true, wantCalls: 1},
+		{name: "missing items are not retried", failures: 5, attempts: 3, missing: true, wantErr: true, wantCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flaky := newFlakyResolver(map[string]int{"op://Example/Service/token": tt.failures})
+			flaky.auth = tt.auth
+			flaky.missing = tt.missing
+			resolver := NewRetryingResolver(flaky, tt.attempts, time.Millisecond)
+
+			value, err := resolver.ResolveSecret("op://Example/Service/token")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Expected error but got none")
+				}
+			} else if err != nil || value != "value-for-op://Example/Service/token" {
+				t.Fatalf("Expected value after retries, got %q, %v", value, err)
+			}
+			if calls := flaky.calls["op://Example/Service/token"]; calls != tt.wantCalls {
+				t.Errorf("Expected %d calls, got %d", tt.wantCalls, calls)
+			}
+		})
+	}
+}
+
+func TestRetryingResolver_RespectsDeadline(t *testing.T) {
+	tests := []struct {
+		name      string
+		backoff   time.Duration
+		timeout   time.Duration
+		wantCalls int
+	}{
+		// The first backoff alone is longer than the whole budget
+		{name: "backoff longer than deadline", backoff: time.Second, timeout: 50 * time.Millisecond, wantCalls: 1},
+		// One retry fits, but the doubled backoff would cross the deadline
+		{name: "deadline expires mid-backoff", backoff: 40 * time.Millisecond, timeout: 100 * time.Millisecond, wantCalls: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flaky := newFlakyResolver(map[string]int{"op://Example/Service/token": 10})
+			resolver := NewRetryingResolver(flaky, 10, tt.backoff)
+
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+
+			start := time.Now()
+			_, err := resolver.ResolveSecretContext(ctx, "op://Example/Service/token")
+			elapsed := time.Since(start)
+
+			if err == nil || !strings.Contains(err.Error(), "timeout during retry") {
+				t.Fatalf("Expected timeout during retry error, got %v", err)
+			}
+			if !strings.Contains(err.Error(), "temporary failure") {
+				t.Errorf("Expected the last lookup error as the cause, got %v", err)
+			}
+			if elapsed > tt.timeout {
+				t.Errorf("Expected retries to stop within the %s deadline, took %s", tt.timeout, elapsed)
+			}
+			if calls := flaky.calls["op://Example/Service/token"]; calls != tt.wantCalls {
+				t.Errorf("Expected %d calls, got %d", tt.wantCalls, calls)
+			}
+		})
+	}
+}
+
+func TestRetryingResolver_CancelledDuringBackoff(t *testing.T) {
+	flaky := newFlakyResolver(map[string]int{"op://Example/Service/token": 10})
+	resolver := NewRetryingResolver(flaky, 3, time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := resolver.ResolveSecretContext(ctx, "op://Example/Service/token")
+	if err == nil || !strings.Contains(err.Error(), "timeout during retry") {
+		t.Fatalf("Expected timeout during retry error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected cancellation to interrupt the backoff, took %s", elapsed)
+	}
+}
+
+func TestRetryingResolver_ResolveAllRetriesFailures(t *testing.T) {
+	flaky := newFlakyResolver(map[string]int{
+		"op://Example/Service/token": 1,
+		"op://Example/Service/key":   5,
+	})
+	resolver := NewRetryingResolver(flaky, 2, time.Millisecond)
+
+	values, errs, err := resolver.ResolveAll(context.Background(), []string{
+		"op://Example/Service/password",
+		"op://Example/Service/token",
+		"op://Example/Service/key",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(values) != 2 || values["op://Example/Service/token"] == "" {
+		t.Errorf("Expected password and token to resolve, got %v", values)
+	}
+	if errs["op://Example/Service/key"] == nil || len(errs) != 1 {
+		t.Errorf("Expected only the key to fail, got %v", errs)
+	}
+	if calls := flaky.calls["op://Example/Service/password"]; calls != 1 {
+		t.Errorf("Expected resolved references not to be retried, got %d calls", calls)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"transient failure", fmt.Errorf("connection reset by peer"), true},
+		{"wrapped failure mentioning not found", errors.Wrap(fmt.Errorf("proxy returned 404 page not found"), "Resolving 1Password secret", "1Password integration"), true},
+		{"missing item", errors.OnePasswordError("Resolving 1Password secret", "Reference not found: op://Example/Service/password", nil).WithKind(errors.KindNotFound), false},
+		{"missing field", errors.FieldNotFoundError("Resolving 1Password secret", "Service", "password", nil, nil), false},
+		{"malformed reference", errors.OnePasswordError("Resolving 1Password secret", "Invalid reference: op://Example", nil).WithKind(errors.KindInvalidReference), false},
+		{"rejected token", errors.AuthError("Resolving 1Password secret", "Token rejected", nil), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryable(context.Background(), tt.err); got != tt.want {
+				t.Errorf("Expected retryable=%v, got %v", tt.want, got)
+			}
+		})
+	}
+}
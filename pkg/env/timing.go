@@ -0,0 +1,75 @@
+package env
+
+import (
+	"context"
+	"time"
+)
+
+// LookupTiming records how long a single call to the underlying resolver
+// took. It never holds the reference or the value.
+type LookupTiming struct {
+	Duration   time.Duration
+	References int
+	Success    bool
+}
+
+// TimingResolver measures every call made through an underlying resolver.
+// Place it beneath a CachingResolver so cache hits are not counted as calls.
+type TimingResolver struct {
+	resolver Resolver
+	record   func(LookupTiming)
+	now      func() time.Time
+}
+
+// NewTimingResolver wraps resolver so the duration of each call is passed
+// to record
+func NewTimingResolver(resolver Resolver, record func(LookupTiming)) *TimingResolver {
+	return &TimingResolver{
+		resolver: resolver,
+		record:   record,
+		now:      time.Now,
+	}
+}
+
+// ResolveSecret resolves reference and records how long it took
+func (t *TimingResolver) ResolveSecret(reference string) (string, error) {
+	return t.ResolveSecretContext(context.Background(), reference)
+}
+
+// ResolveSecretContext resolves reference and records how long it took
+func (t *TimingResolver) ResolveSecretContext(ctx context.Context, reference string) (string, error) {
+	start := t.now()
+	value, err := WithContext(t.resolver).ResolveSecretContext(ctx, reference)
+	t.record(LookupTiming{Duration: t.now().Sub(start), References: 1, Success: err == nil})
+	return value, err
+}
+
+// ResolveAll resolves references as one call and records how long it took
+func (t *TimingResolver) ResolveAll(ctx context.Context, references []string) (map[string]string, map[string]error, error) {
+	start := t.now()
+	values, errs, err := WithContext(t.resolver).ResolveAll(ctx, references)
+	t.record(LookupTiming{
+		Duration:   t.now().Sub(start),
+		References: len(uniqueSortedStrings(references)),
+		Success:    err == nil && len(errs) == 0,
+	})
+	return values, errs, err
+}
+
+// Precheck delegates to the underlying resolver when it supports prechecks
+func (t *TimingResolver) Precheck(references []string) ([]string, error) {
+	prechecker, err := asPrechecker(t.resolver)
+	if err != nil {
+		return nil, err
+	}
+	return prechecker.Precheck(references)
+}
+
+// AccessibleVaults delegates to the underlying resolver when it can list vaults
+func (t *TimingResolver) AccessibleVaults() ([]string, error) {
+	lister, err := asVaultLister(t.resolver)
+	if err != nil {
+		return nil, err
+	}
+	return lister.AccessibleVaults()
+}
@@ -0,0 +1,55 @@
+package env
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTimingResolver_RecordsCalls(t *testing.T) {
+	var timings []LookupTiming
+	resolver := &batchResolver{fakeResolver: fakeResolver{secrets: map[string]string{
+		"op://Example/Service/password": "test-password",
+		"op://Example/Service/token":    "test-token",
+	}}}
+	timed := NewTimingResolver(resolver, func(timing LookupTiming) {
+		timings = append(timings, timing)
+	})
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	timed.now = func() time.Time {
+		clock = clock.Add(10 * time.Millisecond)
+		return clock
+	}
+	cache := NewCachingResolver(timed)
+
+	if _, err := cache.ResolveSecret("op://Example/Service/password"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := cache.ResolveSecret("op://Example/Service/password"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, _, err := cache.ResolveAll(context.Background(), []string{
+		"op://Example/Service/password",
+		"op://Example/Service/token",
+		"op://Example/Service/missing",
+	}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []LookupTiming{
+		{Duration: 10 * time.Millisecond, References: 1, Success: true},
+		{Duration: 10 * time.Millisecond, References: 2, Success: false},
+	}
+	if len(timings) != len(expected) {
+		t.Fatalf("Expected one timing per underlying call, got %d: %+v", len(timings), timings)
+	}
+	for i, want := range expected {
+		if timings[i] != want {
+			t.Errorf("Timing %d: expected %+v, got %+v", i, want, timings[i])
+		}
+	}
+
+	if hits := cache.Hits(); hits != 2 {
+		t.Errorf("Expected 2 cache hits, got %d", hits)
+	}
+}